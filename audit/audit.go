@@ -0,0 +1,549 @@
+package audit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	stellarkp "github.com/stellar/go/keypair"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+/*
+AUDIT LOG
+
+append-only JSON lines file, one record per event
+hash of record is sha256 of record without hash and signature, and record carries hash of previous record (genesis is 64 zeros)
+hash is signed by server audit key (ed25519), so that record cannot be edited without the key
+chain tail is kept in memory, head (seq and hash of last record) is written to anchor (vault) in background after file is synced,
+so that truncated tail is detected without vault round trip on every record
+server and admin CLI append to same file, appends are serialized by flock, file is read again only if other process appended
+*/
+
+var logger = logrus.WithField("module", "Audit")
+
+// hash of previous record of first record
+var GenesisHash = strings.Repeat("0", 64)
+
+// Event types
+const (
+	EventIntroduce = "auth.introduce"
+	EventAnswer    = "auth.answer"
+	EventSignReq   = "sign.request"
+	EventSign      = "sign"
+	EventApproval  = "approval"
+	EventAdmin     = "admin"
+)
+
+type Fields map[string]interface{}
+
+// Record
+// Data is kept as written, so that hash is computed over same bytes on verification
+type Record struct {
+	Seq       uint64          `json:"seq"`
+	Time      string          `json:"time"`
+	Event     string          `json:"event"`
+	Data      json.RawMessage `json:"data"`
+	PrevHash  string          `json:"prevHash"`
+	Hash      string          `json:"hash"`
+	Signature string          `json:"signature"`
+}
+
+// body
+// part of record covered by hash
+type body struct {
+	Seq      uint64          `json:"seq"`
+	Time     string          `json:"time"`
+	Event    string          `json:"event"`
+	Data     json.RawMessage `json:"data"`
+	PrevHash string          `json:"prevHash"`
+}
+
+// ComputeHash
+// sha256 hex of record body
+func (record *Record) ComputeHash() (string, error) {
+	bBytes, e := json.Marshal(body{Seq: record.Seq, Time: record.Time, Event: record.Event, Data: record.Data, PrevHash: record.PrevHash})
+	if e != nil {
+		return "", e
+	}
+	hash := sha256.Sum256(bBytes)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// Check
+// hash and signature of record by audit public key
+func (record *Record) Check(publicKey stellarkp.KP) error {
+	hash, e := record.ComputeHash()
+	if e != nil {
+		return e
+	}
+	if hash != record.Hash {
+		return fmt.Errorf("record %d hash mismatch", record.Seq)
+	}
+
+	hBytes, _ := hex.DecodeString(hash)
+	sBytes, e := base64.StdEncoding.DecodeString(record.Signature)
+	if e != nil || publicKey.Verify(hBytes, sBytes) != nil {
+		return fmt.Errorf("record %d signature is invalid", record.Seq)
+	}
+
+	return nil
+}
+
+// Head
+// seq and hash of last record
+type Head struct {
+	Seq  uint64
+	Hash string
+}
+
+// Anchor
+// storage of head outside of log file
+type Anchor interface {
+	// head, false if not written yet
+	Head() (Head, bool, error)
+	SetHead(head Head) error
+}
+
+// head is anchored after anchorInterval at most, records after head might be lost undetected on crash or truncation within it
+var anchorInterval = time.Second
+
+// Stats
+// records appended and failed by this process, head seq of file and of anchor
+type Stats struct {
+	Records  uint64 `json:"records"`
+	Failures uint64 `json:"failures"`
+	Head     uint64 `json:"head"`
+	Anchored uint64 `json:"anchored"`
+}
+
+type Log struct {
+	path   string
+	key    *stellarkp.Full
+	anchor Anchor
+
+	mutex sync.Mutex
+	file  *os.File
+	// last record and size of file after it, file is read again only if other process (admin CLI) appended
+	tail Head
+	end  int64
+	// last head written to anchor
+	anchored Head
+
+	records  uint64
+	failures uint64
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// Open
+// open log file to append, tail of file must match head of anchor
+// head is anchored in background, and on Close
+func Open(path string, key *stellarkp.Full, anchor Anchor) (*Log, error) {
+	file, e := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0640)
+	if e != nil {
+		return nil, e
+	}
+
+	log := &Log{path: path, key: key, anchor: anchor, file: file, tail: Head{Hash: GenesisHash}}
+
+	e = log.withFileLock(func() error {
+		tail, partial, e := readTail(log.file)
+		if e != nil {
+			return e
+		}
+		if e := log.checkTail(tail); e != nil {
+			if partial > 0 {
+				return fmt.Errorf("audit log %s ends with incomplete record of %d bytes and %s, restore log from backup", log.path, partial, e.Error())
+			}
+			return e
+		}
+		if partial > 0 {
+			if e := log.dropPartial(partial); e != nil {
+				return e
+			}
+		}
+		return log.setTail(tail)
+	})
+	if e != nil {
+		_ = file.Close()
+		return nil, e
+	}
+
+	log.anchored = log.tail
+	log.stop = make(chan struct{})
+	log.stopped = make(chan struct{})
+	go log.anchorLoop(log.stop, log.stopped)
+
+	return log, nil
+}
+
+// checkTail
+// last record of file must be signed by key and not before head of anchor
+func (log *Log) checkTail(tail *Record) error {
+	head, found, e := log.anchor.Head()
+	if e != nil {
+		return e
+	}
+
+	if tail == nil {
+		if found {
+			return fmt.Errorf("audit log %s is empty but head is %d", log.path, head.Seq)
+		}
+		return nil
+	}
+
+	if e := tail.Check(log.key); e != nil {
+		return e
+	}
+
+	if !found {
+		return fmt.Errorf("audit log %s has records but head is not found", log.path)
+	}
+	if tail.Seq < head.Seq {
+		return fmt.Errorf("audit log %s is truncated : last record %d, head %d", log.path, tail.Seq, head.Seq)
+	}
+	if tail.Seq == head.Seq && tail.Hash != head.Hash {
+		return fmt.Errorf("audit log %s last record %d does not match head", log.path, tail.Seq)
+	}
+
+	// record was written but head was not (crash before anchoring), head follows file
+	if tail.Seq > head.Seq {
+		return log.anchor.SetHead(Head{Seq: tail.Seq, Hash: tail.Hash})
+	}
+
+	return nil
+}
+
+// dropPartial
+// incomplete last line is a write cut by crash, it is truncated after last complete record is checked against head
+func (log *Log) dropPartial(partial int64) error {
+	info, e := log.file.Stat()
+	if e != nil {
+		return e
+	}
+	if e := log.file.Truncate(info.Size() - partial); e != nil {
+		return e
+	}
+	if e := log.file.Sync(); e != nil {
+		return e
+	}
+
+	logger.WithField("alert", "AUDIT").Warn("incomplete record of ", partial, " bytes dropped from end of audit log ", log.path)
+	return nil
+}
+
+// setTail
+// tail of file as last record, nil is empty file
+func (log *Log) setTail(tail *Record) error {
+	info, e := log.file.Stat()
+	if e != nil {
+		return e
+	}
+
+	log.end = info.Size()
+	if tail == nil {
+		log.tail = Head{Hash: GenesisHash}
+	} else {
+		log.tail = Head{Seq: tail.Seq, Hash: tail.Hash}
+	}
+	return nil
+}
+
+// refreshTail
+// read tail of file again if other process appended after last record of this process, file lock must be held
+func (log *Log) refreshTail() error {
+	info, e := log.file.Stat()
+	if e != nil {
+		return e
+	}
+	if info.Size() == log.end {
+		return nil
+	}
+
+	tail, partial, e := readTail(log.file)
+	if e != nil {
+		return e
+	}
+	if partial > 0 {
+		return fmt.Errorf("audit log %s ends with incomplete record of %d bytes", log.path, partial)
+	}
+	if tail == nil || tail.Seq < log.tail.Seq {
+		return fmt.Errorf("audit log %s is truncated while open", log.path)
+	}
+	if e := tail.Check(log.key); e != nil {
+		return e
+	}
+
+	return log.setTail(tail)
+}
+
+// Record
+// append record of event, nil log records nothing
+// failure is logged as alert and counted, caller must not go on with signing if it fails
+func (log *Log) Record(event string, data Fields) error {
+	if log == nil {
+		return nil
+	}
+	if _, e := log.Append(event, data); e != nil {
+		atomic.AddUint64(&log.failures, 1)
+		logger.WithFields(logrus.Fields{"alert": "AUDIT", "event": event}).Error("ALERT : audit record failed : ", e)
+		return e
+	}
+	return nil
+}
+
+// Append
+// append record chained to last record of file, head is anchored in background
+func (log *Log) Append(event string, data Fields) (*Record, error) {
+	if data == nil {
+		data = Fields{}
+	}
+	dBytes, e := json.Marshal(data)
+	if e != nil {
+		return nil, e
+	}
+
+	var record *Record
+
+	e = log.withFileLock(func() error {
+		if e := log.refreshTail(); e != nil {
+			return e
+		}
+
+		record = &Record{
+			Seq:      log.tail.Seq + 1,
+			Time:     time.Now().UTC().Format(time.RFC3339Nano),
+			Event:    event,
+			Data:     dBytes,
+			PrevHash: log.tail.Hash,
+		}
+
+		hash, e := record.ComputeHash()
+		if e != nil {
+			return e
+		}
+		record.Hash = hash
+
+		hBytes, _ := hex.DecodeString(hash)
+		sBytes, e := log.key.Sign(hBytes)
+		if e != nil {
+			return e
+		}
+		record.Signature = base64.StdEncoding.EncodeToString(sBytes)
+
+		rBytes, e := json.Marshal(record)
+		if e != nil {
+			return e
+		}
+
+		n, e := log.file.Write(append(rBytes, '\n'))
+		log.end += int64(n)
+		if e != nil {
+			return e
+		}
+
+		log.tail = Head{Seq: record.Seq, Hash: record.Hash}
+		atomic.AddUint64(&log.records, 1)
+		return nil
+	})
+
+	return record, e
+}
+
+// withFileLock
+// run f while log is locked in process, and file is locked against admin CLI appending to same file
+func (log *Log) withFileLock(f func() error) error {
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+
+	if log.file == nil {
+		return errors.New("audit log is closed")
+	}
+
+	fd := int(log.file.Fd())
+	if e := syscall.Flock(fd, syscall.LOCK_EX); e != nil {
+		return e
+	}
+	defer syscall.Flock(fd, syscall.LOCK_UN)
+
+	return f()
+}
+
+// anchorLoop
+// anchor head every anchorInterval until Close
+func (log *Log) anchorLoop(stop chan struct{}, stopped chan struct{}) {
+	defer close(stopped)
+
+	ticker := time.NewTicker(anchorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if e := log.Flush(); e != nil {
+				atomic.AddUint64(&log.failures, 1)
+				logger.WithField("alert", "AUDIT").Error("ALERT : audit head anchoring failed : ", e)
+			}
+		}
+	}
+}
+
+// Flush
+// sync file and write head to anchor, head is never ahead of synced file
+// head anchored by other process (admin CLI) after this process is not moved back
+func (log *Log) Flush() error {
+	log.mutex.Lock()
+	head, file := log.tail, log.file
+	anchored := log.anchored
+	log.mutex.Unlock()
+
+	if file == nil || head == anchored {
+		return nil
+	}
+
+	if e := file.Sync(); e != nil {
+		return e
+	}
+
+	current, found, e := log.anchor.Head()
+	if e != nil {
+		return e
+	}
+	if !found || current.Seq < head.Seq {
+		if e := log.anchor.SetHead(head); e != nil {
+			return e
+		}
+	}
+
+	log.mutex.Lock()
+	log.anchored = head
+	log.mutex.Unlock()
+
+	return nil
+}
+
+// Stats
+// counters of log, zero for nil log
+func (log *Log) Stats() Stats {
+	if log == nil {
+		return Stats{}
+	}
+
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+
+	return Stats{
+		Records:  atomic.LoadUint64(&log.records),
+		Failures: atomic.LoadUint64(&log.failures),
+		Head:     log.tail.Seq,
+		Anchored: log.anchored.Seq,
+	}
+}
+
+// Close
+// anchor head and close log file
+func (log *Log) Close() {
+	if log == nil {
+		return
+	}
+
+	log.mutex.Lock()
+	stop := log.stop
+	log.stop = nil
+	log.mutex.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-log.stopped
+	}
+
+	if e := log.Flush(); e != nil {
+		logger.WithField("alert", "AUDIT").Error("ALERT : audit head anchoring failed : ", e)
+	}
+
+	log.mutex.Lock()
+	defer log.mutex.Unlock()
+
+	if log.file != nil {
+		_ = log.file.Close()
+		log.file = nil
+	}
+}
+
+// readTail
+// last complete record of file (nil if none) and size of incomplete line (no final newline) after it
+func readTail(file *os.File) (*Record, int64, error) {
+	info, e := file.Stat()
+	if e != nil {
+		return nil, 0, e
+	}
+
+	size := info.Size()
+	if size == 0 {
+		return nil, 0, nil
+	}
+
+	// read backward until start of last complete line
+	const chunk = 4096
+	var buffer []byte
+	offset := size
+
+	for {
+		readSize := int64(chunk)
+		if offset < readSize {
+			readSize = offset
+		}
+		offset -= readSize
+
+		part := make([]byte, readSize)
+		if _, e := file.ReadAt(part, offset); e != nil && e != io.EOF {
+			return nil, 0, e
+		}
+		buffer = append(part, buffer...)
+
+		end := len(buffer)
+		if buffer[end-1] != '\n' {
+			i := bytes.LastIndexByte(buffer, '\n')
+			if i < 0 && offset > 0 {
+				continue
+			}
+			end = i + 1
+		}
+		partial := int64(len(buffer) - end)
+
+		trimmed := bytes.TrimRight(buffer[:end], "\n")
+		if i := bytes.LastIndexByte(trimmed, '\n'); i >= 0 {
+			record, e := parseRecord(trimmed[i+1:])
+			return record, partial, e
+		}
+		if offset == 0 {
+			if len(trimmed) == 0 {
+				return nil, partial, nil
+			}
+			record, e := parseRecord(trimmed)
+			return record, partial, e
+		}
+	}
+}
+
+func parseRecord(line []byte) (*Record, error) {
+	record := &Record{}
+	if e := json.Unmarshal(line, record); e != nil {
+		return nil, fmt.Errorf("broken audit record : %s", e.Error())
+	}
+	return record, nil
+}
@@ -0,0 +1,295 @@
+package audit_test
+
+import (
+	"bytes"
+	"github.com/colligence-io/signServer/audit"
+	stellarkp "github.com/stellar/go/keypair"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+type memAnchor struct {
+	mutex sync.Mutex
+	head  audit.Head
+	found bool
+	sets  int
+}
+
+func (anchor *memAnchor) Head() (audit.Head, bool, error) {
+	anchor.mutex.Lock()
+	defer anchor.mutex.Unlock()
+	return anchor.head, anchor.found, nil
+}
+
+func (anchor *memAnchor) SetHead(head audit.Head) error {
+	anchor.mutex.Lock()
+	defer anchor.mutex.Unlock()
+	anchor.head = head
+	anchor.found = true
+	anchor.sets++
+	return nil
+}
+
+func newLog(t *testing.T, records int) (string, *stellarkp.Full, *memAnchor) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := stellarkp.Random()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "audit.log")
+	anchor := &memAnchor{}
+
+	log, err := audit.Open(path, key, anchor)
+	if err != nil {
+		t.Fatal("ER : Open :", err)
+	}
+	defer log.Close()
+
+	for i := 0; i < records; i++ {
+		if _, err := log.Append(audit.EventSign, audit.Fields{"app": "exchange", "n": i}); err != nil {
+			t.Fatal("ER : Append :", err)
+		}
+	}
+
+	return path, key, anchor
+}
+
+func readLines(t *testing.T, path string) [][]byte {
+	fBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.SplitAfter(bytes.TrimRight(fBytes, "\n"), []byte("\n"))
+}
+
+func writeLines(t *testing.T, path string, lines [][]byte) {
+	if err := ioutil.WriteFile(path, bytes.Join(lines, nil), 0640); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAppendAndVerify(t *testing.T) {
+	path, key, anchor := newLog(t, 3)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	if anchor.head.Seq != 3 {
+		t.Error("ER : head is not updated", anchor.head)
+	}
+
+	count, err := audit.Verify(path, key, anchor)
+	if err != nil || count != 3 {
+		t.Error("ER : Verify", count, err)
+	}
+
+	// reopened log continues chain
+	log, err := audit.Open(path, key, anchor)
+	if err != nil {
+		t.Fatal("ER : reopen :", err)
+	}
+	record, err := log.Append(audit.EventAdmin, audit.Fields{"mode": "kpgen"})
+	log.Close()
+	if err != nil || record.Seq != 4 {
+		t.Fatal("ER : Append after reopen", record, err)
+	}
+
+	if count, err := audit.Verify(path, key, anchor); err != nil || count != 4 {
+		t.Error("ER : Verify after reopen", count, err)
+	}
+
+	// other key does not verify
+	other, _ := stellarkp.Random()
+	if _, err := audit.Verify(path, other, anchor); err == nil {
+		t.Error("ER : verified by other key")
+	}
+}
+
+func TestDetectEdit(t *testing.T) {
+	path, key, anchor := newLog(t, 3)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	lines := readLines(t, path)
+	lines[1] = bytes.Replace(lines[1], []byte("exchange"), []byte("exchangf"), 1)
+	writeLines(t, path, lines)
+
+	if _, err := audit.Verify(path, key, anchor); err == nil {
+		t.Error("ER : edited record verified")
+	}
+}
+
+func TestDetectRemoval(t *testing.T) {
+	path, key, anchor := newLog(t, 3)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	lines := readLines(t, path)
+	writeLines(t, path, [][]byte{lines[0], lines[2]})
+
+	if _, err := audit.Verify(path, key, anchor); err == nil {
+		t.Error("ER : removed record verified")
+	}
+}
+
+func TestDetectTruncation(t *testing.T) {
+	path, key, anchor := newLog(t, 3)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	lines := readLines(t, path)
+	writeLines(t, path, lines[:2])
+
+	if _, err := audit.Verify(path, key, anchor); err == nil {
+		t.Error("ER : truncated log verified")
+	}
+	if _, err := audit.Open(path, key, anchor); err == nil {
+		t.Error("ER : truncated log opened")
+	}
+
+	// head is lost
+	writeLines(t, path, lines)
+	if _, err := audit.Verify(path, key, &memAnchor{}); err == nil {
+		t.Error("ER : log verified without head")
+	}
+}
+
+func TestDropPartialRecord(t *testing.T) {
+	path, key, anchor := newLog(t, 3)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	complete, _ := ioutil.ReadFile(path)
+	lines := readLines(t, path)
+
+	// record 4 cut by crash before head is written
+	torn := append(append([]byte{}, complete...), lines[2][:len(lines[2])/2]...)
+	if err := ioutil.WriteFile(path, torn, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := audit.Verify(path, key, anchor); err == nil {
+		t.Error("ER : log with incomplete record verified")
+	}
+
+	log, err := audit.Open(path, key, anchor)
+	if err != nil {
+		t.Fatal("ER : Open with incomplete record :", err)
+	}
+	record, err := log.Append(audit.EventAdmin, audit.Fields{"mode": "kplist"})
+	log.Close()
+	if err != nil || record.Seq != 4 {
+		t.Fatal("ER : Append after dropped record", record, err)
+	}
+	if count, err := audit.Verify(path, key, anchor); err != nil || count != 4 {
+		t.Error("ER : Verify after dropped record", count, err)
+	}
+
+	// last complete record does not match head, nothing is dropped
+	lines = readLines(t, path)
+	torn = append(bytes.Join(lines[:3], nil), lines[3][:10]...)
+	if err := ioutil.WriteFile(path, torn, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := audit.Open(path, key, anchor); err == nil {
+		t.Error("ER : incomplete record dropped before head mismatch")
+	}
+	if fBytes, _ := ioutil.ReadFile(path); !bytes.Equal(fBytes, torn) {
+		t.Error("ER : log changed on head mismatch")
+	}
+
+	// only record is incomplete
+	if err := ioutil.WriteFile(path, lines[0][:10], 0640); err != nil {
+		t.Fatal(err)
+	}
+	log, err = audit.Open(path, key, &memAnchor{})
+	if err != nil {
+		t.Fatal("ER : Open with incomplete first record :", err)
+	}
+	log.Close()
+	if info, _ := os.Stat(path); info.Size() != 0 {
+		t.Error("ER : incomplete first record is not dropped", info.Size())
+	}
+}
+
+func TestAnchorBatched(t *testing.T) {
+	path, key, anchor := newLog(t, 0)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	log, err := audit.Open(path, key, anchor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sets := anchor.sets
+
+	for i := 0; i < 5; i++ {
+		if err := log.Record(audit.EventSign, audit.Fields{"n": i}); err != nil {
+			t.Fatal("ER : Record", err)
+		}
+	}
+	if anchor.sets != sets {
+		t.Error("ER : head anchored on every record", anchor.sets-sets)
+	}
+
+	if err := log.Flush(); err != nil {
+		t.Fatal("ER : Flush", err)
+	}
+	if anchor.sets != sets+1 || anchor.head.Seq != 5 {
+		t.Error("ER : batched head", anchor.sets-sets, anchor.head)
+	}
+	if stats := log.Stats(); stats.Records != 5 || stats.Head != 5 || stats.Anchored != 5 || stats.Failures != 0 {
+		t.Error("ER : Stats", stats)
+	}
+
+	log.Close()
+	if err := log.Record(audit.EventSign, nil); err == nil {
+		t.Error("ER : record on closed log")
+	}
+	if stats := log.Stats(); stats.Failures != 1 {
+		t.Error("ER : failure is not counted", stats)
+	}
+}
+
+func TestAppendByOtherProcess(t *testing.T) {
+	path, key, anchor := newLog(t, 2)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	server, err := audit.Open(path, key, anchor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// admin CLI appends while server keeps tail in memory
+	for i := 0; i < 3; i++ {
+		if _, err := server.Append(audit.EventSign, nil); err != nil {
+			t.Fatal("ER : server Append", err)
+		}
+		cli, err := audit.Open(path, key, anchor)
+		if err != nil {
+			t.Fatal("ER : cli Open", err)
+		}
+		if _, err := cli.Append(audit.EventAdmin, audit.Fields{"mode": "kplist"}); err != nil {
+			t.Fatal("ER : cli Append", err)
+		}
+		cli.Close()
+	}
+
+	record, err := server.Append(audit.EventSign, nil)
+	if err != nil || record.Seq != 9 {
+		t.Fatal("ER : server Append after cli", record, err)
+	}
+
+	// head anchored by cli is not moved back
+	anchor.SetHead(audit.Head{Seq: 10, Hash: "other"})
+	server.Close()
+	if anchor.head.Seq != 10 {
+		t.Error("ER : head moved back", anchor.head)
+	}
+	anchor.SetHead(audit.Head{Seq: record.Seq, Hash: record.Hash})
+
+	if count, err := audit.Verify(path, key, anchor); err != nil || count != 9 {
+		t.Error("ER : Verify", count, err)
+	}
+}
@@ -0,0 +1,187 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"github.com/colligence-io/signServer/util"
+	"github.com/colligence-io/signServer/vault"
+	stellarkp "github.com/stellar/go/keypair"
+	"strconv"
+)
+
+/*
+vault.auditPath/key  : privateKey (S...) and publicKey (G...) of audit key, generated on server start
+vault.auditPath/head : seq and hash of last record
+*/
+
+// New
+// open audit log file with audit key and head in vault auditPath, nil (audit disabled) if auditPath is not set
+func New(vc *vault.Client, auditPath string, logPath string) *Log {
+	if auditPath == "" {
+		logger.Warn("vault auditPath is not set, audit log disabled")
+		return nil
+	}
+
+	if !vc.IsConnected() {
+		vc.Connect()
+	}
+
+	key := loadKey(vc, auditPath)
+
+	log, e := Open(logPath, key, &vaultAnchor{vc: vc, path: auditPath + "/head"})
+	if e != nil {
+		logger.WithField("alert", "AUDIT").Error(e)
+		util.Die("Broken Audit : " + e.Error())
+	}
+
+	logger.Info("Audit log ", logPath, " opened, audit key ", key.Address())
+
+	return log
+}
+
+// ErrNotSetUp
+// audit key is not in vault auditPath, server has never started with audit log
+var ErrNotSetUp = errors.New("audit log is not set up")
+
+// OpenExisting
+// open audit log set up by server, audit key is never generated here
+// nil (audit disabled) if auditPath is not set, ErrNotSetUp if audit key is not found
+func OpenExisting(vc *vault.Client, auditPath string, logPath string) (*Log, error) {
+	if auditPath == "" {
+		logger.Warn("vault auditPath is not set, audit log disabled")
+		return nil, nil
+	}
+
+	if !vc.IsConnected() {
+		vc.Connect()
+	}
+
+	key, e := readKey(vc, auditPath)
+	if e != nil {
+		return nil, e
+	}
+	if key == nil {
+		return nil, ErrNotSetUp
+	}
+
+	return Open(logPath, key, &vaultAnchor{vc: vc, path: auditPath + "/head"})
+}
+
+// loadKey
+// audit key from vault, generated and written if not found
+func loadKey(vc *vault.Client, auditPath string) *stellarkp.Full {
+	key, e := readKey(vc, auditPath)
+	if e != nil {
+		util.Die("Broken Audit : " + e.Error())
+	}
+
+	if key == nil {
+		key, e = stellarkp.Random()
+		util.CheckAndDie(e)
+
+		_, e = vc.Logical().Write(auditPath+"/key", map[string]interface{}{
+			"privateKey": key.Seed(),
+			"publicKey":  key.Address(),
+		})
+		util.CheckAndDie(e)
+
+		logger.Info("Audit key generated : ", key.Address())
+	}
+
+	return key
+}
+
+// readKey
+// audit key from vault, nil without error if not found
+func readKey(vc *vault.Client, auditPath string) (*stellarkp.Full, error) {
+	keySecret, e := vc.Logical().Read(auditPath + "/key")
+	if e != nil {
+		return nil, e
+	}
+	if keySecret == nil || keySecret.Data == nil {
+		return nil, nil
+	}
+
+	privateKey, ok := keySecret.Data["privateKey"].(string)
+	if !ok {
+		return nil, errors.New("privateKey not found")
+	}
+
+	kp, e := stellarkp.Parse(privateKey)
+	if e != nil {
+		return nil, errors.New("privateKey parse error : " + e.Error())
+	}
+
+	key, ok := kp.(*stellarkp.Full)
+	if !ok {
+		return nil, errors.New("privateKey is not a private key")
+	}
+
+	return key, nil
+}
+
+// LoadVerifier
+// public key of audit key and head in vault auditPath, to verify log without writing
+func LoadVerifier(vc *vault.Client, auditPath string) (stellarkp.KP, Anchor, error) {
+	if auditPath == "" {
+		return nil, nil, errors.New("vault auditPath is not set")
+	}
+
+	if !vc.IsConnected() {
+		vc.Connect()
+	}
+
+	keySecret, e := vc.Logical().Read(auditPath + "/key")
+	if e != nil {
+		return nil, nil, e
+	}
+	if keySecret == nil || keySecret.Data == nil {
+		return nil, nil, errors.New("audit key not found in " + auditPath)
+	}
+
+	publicKey, ok := keySecret.Data["publicKey"].(string)
+	if !ok {
+		return nil, nil, errors.New("audit publicKey not found")
+	}
+
+	kp, e := stellarkp.Parse(publicKey)
+	if e != nil {
+		return nil, nil, e
+	}
+
+	return kp, &vaultAnchor{vc: vc, path: auditPath + "/head"}, nil
+}
+
+type vaultAnchor struct {
+	vc   *vault.Client
+	path string
+}
+
+func (anchor *vaultAnchor) Head() (Head, bool, error) {
+	headSecret, e := anchor.vc.Logical().Read(anchor.path)
+	if e != nil {
+		return Head{}, false, e
+	}
+	if headSecret == nil || headSecret.Data == nil {
+		return Head{}, false, nil
+	}
+
+	seq, e := strconv.ParseUint(fmt.Sprint(headSecret.Data["seq"]), 10, 64)
+	if e != nil {
+		return Head{}, false, errors.New("broken audit head : seq")
+	}
+	hash, ok := headSecret.Data["hash"].(string)
+	if !ok {
+		return Head{}, false, errors.New("broken audit head : hash")
+	}
+
+	return Head{Seq: seq, Hash: hash}, true, nil
+}
+
+func (anchor *vaultAnchor) SetHead(head Head) error {
+	_, e := anchor.vc.Logical().Write(anchor.path, map[string]interface{}{
+		"seq":  strconv.FormatUint(head.Seq, 10),
+		"hash": head.Hash,
+	})
+	return e
+}
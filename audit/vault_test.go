@@ -0,0 +1,62 @@
+package audit_test
+
+import (
+	"github.com/colligence-io/signServer/audit"
+	"github.com/colligence-io/signServer/config"
+	"github.com/colligence-io/signServer/vault"
+	"github.com/colligence-io/signServer/vault/vaulttest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenExisting(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fv := vaulttest.NewServer()
+	defer fv.Close()
+
+	cfg := &config.Configuration{
+		Vault: config.VaultConfig{Username: "user", Password: "pass", AppRole: "role", Address: fv.URL, AuditPath: "tss/audit"},
+	}
+	vc := vault.NewClient(cfg)
+	path := filepath.Join(dir, "audit.log")
+
+	// audit key is not created outside server start
+	if log, err := audit.OpenExisting(vc, cfg.Vault.AuditPath, path); err != audit.ErrNotSetUp || log != nil {
+		t.Error("ER : OpenExisting before set up", log, err)
+	}
+	if len(fv.Find(cfg.Vault.AuditPath)) != 0 {
+		t.Error("ER : audit key written by OpenExisting")
+	}
+
+	// disabled audit log
+	if log, err := audit.OpenExisting(vc, "", path); err != nil || log != nil {
+		t.Error("ER : OpenExisting without auditPath", log, err)
+	}
+
+	audit.New(vc, cfg.Vault.AuditPath, path).Close()
+
+	log, err := audit.OpenExisting(vc, cfg.Vault.AuditPath, path)
+	if err != nil {
+		t.Fatal("ER : OpenExisting after set up :", err)
+	}
+	record, err := log.Append(audit.EventAdmin, audit.Fields{"mode": "kplist"})
+	log.Close()
+	if err != nil || record.Seq != 1 {
+		t.Error("ER : Append", record, err)
+	}
+
+	publicKey, anchor, err := audit.LoadVerifier(vc, cfg.Vault.AuditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, err := audit.Verify(path, publicKey, anchor); err != nil || count != 1 {
+		t.Error("ER : Verify", count, err)
+	}
+}
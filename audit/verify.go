@@ -0,0 +1,76 @@
+package audit
+
+import (
+	"bufio"
+	"fmt"
+	stellarkp "github.com/stellar/go/keypair"
+	"os"
+)
+
+// Verify
+// check every record of log file : sequence, chain of hashes, signature by audit key, and head of anchor
+// returns number of records, error at first broken record
+func Verify(path string, publicKey stellarkp.KP, anchor Anchor) (uint64, error) {
+	file, e := os.Open(path)
+	if e != nil {
+		return 0, e
+	}
+	defer file.Close()
+
+	head, found, e := anchor.Head()
+	if e != nil {
+		return 0, e
+	}
+
+	reader := bufio.NewReader(file)
+	prevHash := GenesisHash
+	var seq uint64
+	headMatched := false
+
+	for line := 1; ; line++ {
+		lBytes, e := reader.ReadBytes('\n')
+		if len(lBytes) == 0 && e != nil {
+			break
+		}
+		if len(lBytes) > 0 && lBytes[len(lBytes)-1] != '\n' {
+			return seq, fmt.Errorf("line %d : incomplete record", line)
+		}
+
+		record, e := parseRecord(lBytes)
+		if e != nil {
+			return seq, fmt.Errorf("line %d : %s", line, e.Error())
+		}
+
+		if record.Seq != seq+1 {
+			return seq, fmt.Errorf("line %d : record %d follows record %d", line, record.Seq, seq)
+		}
+		if record.PrevHash != prevHash {
+			return seq, fmt.Errorf("line %d : record %d is not chained to previous record", line, record.Seq)
+		}
+		if e := record.Check(publicKey); e != nil {
+			return seq, fmt.Errorf("line %d : %s", line, e.Error())
+		}
+
+		if found && record.Seq == head.Seq {
+			if record.Hash != head.Hash {
+				return seq, fmt.Errorf("line %d : record %d does not match head", line, record.Seq)
+			}
+			headMatched = true
+		}
+
+		seq = record.Seq
+		prevHash = record.Hash
+	}
+
+	if !found {
+		if seq > 0 {
+			return seq, fmt.Errorf("audit log has %d records but head is not found", seq)
+		}
+		return seq, nil
+	}
+	if !headMatched {
+		return seq, fmt.Errorf("audit log is truncated : last record %d, head %d", seq, head.Seq)
+	}
+
+	return seq, nil
+}
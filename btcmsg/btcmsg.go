@@ -0,0 +1,128 @@
+package btcmsg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+)
+
+/*
+Bitcoin signed message (BIP137)
+
+hash = sha256d(varstr("Bitcoin Signed Message:\n") || varstr(message))
+signature = base64(header || R || S), header = base + recid
+  27 : P2PKH uncompressed
+  31 : P2PKH compressed
+  35 : P2SH-P2WPKH
+  39 : P2WPKH
+*/
+
+const messageMagic = "Bitcoin Signed Message:\n"
+
+const (
+	headerP2PKHUncompressed byte = 27
+	headerP2PKH             byte = 31
+	headerP2SHP2WPKH        byte = 35
+	headerP2WPKH            byte = 39
+)
+
+var ErrSignatureMismatch = errors.New("signature is not signed by address")
+
+// MessageHash
+// digest to sign
+func MessageHash(message string) []byte {
+	var buf bytes.Buffer
+	wire.WriteVarString(&buf, 0, messageMagic)
+	wire.WriteVarString(&buf, 0, message)
+	return chainhash.DoubleHashB(buf.Bytes())
+}
+
+// Signature
+// base64 compact signature of address from [R || S || V] signature of MessageHash, V is 0 or 1
+func Signature(signature []byte, address btcutil.Address) (string, error) {
+	if len(signature) != 65 || signature[64] > 1 {
+		return "", errors.New("signature must be [R || S || V] with V 0 or 1")
+	}
+
+	var header byte
+	switch address.(type) {
+	case *btcutil.AddressPubKeyHash:
+		header = headerP2PKH
+	case *btcutil.AddressScriptHash:
+		header = headerP2SHP2WPKH
+	case *btcutil.AddressWitnessPubKeyHash:
+		header = headerP2WPKH
+	default:
+		return "", fmt.Errorf("address %s is not supported", address.EncodeAddress())
+	}
+
+	compact := make([]byte, 65)
+	compact[0] = header + signature[64]
+	copy(compact[1:], signature[:64])
+
+	return base64.StdEncoding.EncodeToString(compact), nil
+}
+
+// Verify
+// check base64 compact signature of message is signed by address, address type must match signature header
+func Verify(address string, message string, signature string, netParams *chaincfg.Params) error {
+	decodedAddress, e := btcutil.DecodeAddress(address, netParams)
+	if e != nil || !decodedAddress.IsForNet(netParams) {
+		return fmt.Errorf("address %s is not for %s", address, netParams.Name)
+	}
+
+	compact, e := base64.StdEncoding.DecodeString(signature)
+	if e != nil || len(compact) != 65 {
+		return errors.New("signature must be base64 of 65 bytes")
+	}
+
+	header := compact[0]
+	if header < headerP2PKHUncompressed || header >= headerP2WPKH+4 {
+		return fmt.Errorf("invalid signature header %d", header)
+	}
+
+	// btcec takes 27 + recid (+ 4 if compressed)
+	compressed := header >= headerP2PKH
+	normalized := append([]byte{}, compact...)
+	normalized[0] = headerP2PKHUncompressed + (header-headerP2PKHUncompressed)%4
+	if compressed {
+		normalized[0] += 4
+	}
+
+	publicKey, _, e := btcec.RecoverCompact(btcec.S256(), normalized, MessageHash(message))
+	if e != nil {
+		return ErrSignatureMismatch
+	}
+
+	var pubKeyHash []byte
+	if compressed {
+		pubKeyHash = btcutil.Hash160(publicKey.SerializeCompressed())
+	} else {
+		pubKeyHash = btcutil.Hash160(publicKey.SerializeUncompressed())
+	}
+
+	var signer btcutil.Address
+	switch {
+	case header < headerP2SHP2WPKH:
+		signer, e = btcutil.NewAddressPubKeyHash(pubKeyHash, netParams)
+	case header < headerP2WPKH:
+		redeemScript := append([]byte{0x00, 0x14}, pubKeyHash...)
+		signer, e = btcutil.NewAddressScriptHash(redeemScript, netParams)
+	default:
+		signer, e = btcutil.NewAddressWitnessPubKeyHash(pubKeyHash, netParams)
+	}
+	if e != nil {
+		return e
+	}
+
+	if signer.EncodeAddress() != decodedAddress.EncodeAddress() {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package btcmsg_test
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil"
+	"github.com/colligence-io/signServer/btcmsg"
+	"github.com/ethereum/go-ethereum/crypto"
+	"testing"
+)
+
+const (
+	testPrivateKey = "4646464646464646464646464646464646464646464646464646464646464646"
+	testMessage    = "hello signServer"
+)
+
+func testAddresses(t *testing.T, publicKey []byte) []btcutil.Address {
+	pubKeyHash := btcutil.Hash160(publicKey)
+
+	p2pkh, err := btcutil.NewAddressPubKeyHash(pubKeyHash, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2sh, err := btcutil.NewAddressScriptHash(append([]byte{0x00, 0x14}, pubKeyHash...), &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2wpkh, err := btcutil.NewAddressWitnessPubKeyHash(pubKeyHash, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return []btcutil.Address{p2pkh, p2sh, p2wpkh}
+}
+
+func TestSignVerify(t *testing.T) {
+	hash := btcmsg.MessageHash(testMessage)
+	if hex.EncodeToString(hash) != "92f349bf6c40edb7eb18a4227be9182f441c9c29197af39915bd80faa81cc4c7" {
+		t.Error("ER : MessageHash", hex.EncodeToString(hash))
+	}
+
+	privateKey, _ := crypto.HexToECDSA(testPrivateKey)
+	// [R || S || V] as trustSigner returns
+	rsv, err := crypto.Sign(hash, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"HwFIrf0PXm6foke1yfZt0uujHiXBTlsECPA1KTTJneEcbp94usTND8yce+o2Oa9hLWUwwDbtpQ3UkXGNoyMHjq0=",
+		"IwFIrf0PXm6foke1yfZt0uujHiXBTlsECPA1KTTJneEcbp94usTND8yce+o2Oa9hLWUwwDbtpQ3UkXGNoyMHjq0=",
+		"JwFIrf0PXm6foke1yfZt0uujHiXBTlsECPA1KTTJneEcbp94usTND8yce+o2Oa9hLWUwwDbtpQ3UkXGNoyMHjq0=",
+	}
+
+	addresses := testAddresses(t, crypto.CompressPubkey(&privateKey.PublicKey))
+	for i, address := range addresses {
+		signature, err := btcmsg.Signature(rsv, address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if signature != expected[i] {
+			t.Error("ER : Signature", address.EncodeAddress(), ":", signature)
+		}
+
+		if err := btcmsg.Verify(address.EncodeAddress(), testMessage, signature, &chaincfg.MainNetParams); err != nil {
+			t.Error("ER : Verify", address.EncodeAddress(), ":", err)
+		}
+
+		// header is bound to address type
+		other := addresses[(i+1)%len(addresses)]
+		if err := btcmsg.Verify(other.EncodeAddress(), testMessage, signature, &chaincfg.MainNetParams); err != btcmsg.ErrSignatureMismatch {
+			t.Error("ER : signature of", address.EncodeAddress(), "verified for", other.EncodeAddress(), err)
+		}
+
+		if err := btcmsg.Verify(address.EncodeAddress(), testMessage+".", signature, &chaincfg.MainNetParams); err != btcmsg.ErrSignatureMismatch {
+			t.Error("ER : signature of other message verified", err)
+		}
+
+		if err := btcmsg.Verify(address.EncodeAddress(), testMessage, signature, &chaincfg.TestNet3Params); err == nil {
+			t.Error("ER : mainnet address verified on testnet")
+		}
+	}
+}
+
+// signature of btcec (as bitcoin core) is verified
+func TestVerifyCompact(t *testing.T) {
+	privateKey, _ := btcec.NewPrivateKey(btcec.S256())
+	hash := btcmsg.MessageHash(testMessage)
+
+	for _, compressed := range []bool{true, false} {
+		compact, err := btcec.SignCompact(btcec.S256(), privateKey, hash, compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var publicKey []byte
+		if compressed {
+			publicKey = privateKey.PubKey().SerializeCompressed()
+		} else {
+			publicKey = privateKey.PubKey().SerializeUncompressed()
+		}
+		address, _ := btcutil.NewAddressPubKeyHash(btcutil.Hash160(publicKey), &chaincfg.TestNet3Params)
+
+		if err := btcmsg.Verify(address.EncodeAddress(), testMessage, base64.StdEncoding.EncodeToString(compact), &chaincfg.TestNet3Params); err != nil {
+			t.Error("ER : Verify compressed", compressed, ":", err)
+		}
+	}
+}
+
+func TestInvalidSignature(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA(testPrivateKey)
+	address := testAddresses(t, crypto.CompressPubkey(&privateKey.PublicKey))[0].EncodeAddress()
+
+	for _, signature := range []string{"", "not base64", base64.StdEncoding.EncodeToString(make([]byte, 64)), base64.StdEncoding.EncodeToString(append([]byte{43}, make([]byte, 64)...))} {
+		if err := btcmsg.Verify(address, testMessage, signature, &chaincfg.MainNetParams); err == nil {
+			t.Error("ER : invalid signature accepted :", signature)
+		}
+	}
+
+	if _, err := btcmsg.Signature(make([]byte, 64), testAddresses(t, crypto.CompressPubkey(&privateKey.PublicKey))[0]); err == nil {
+		t.Error("ER : 64 byte signature accepted")
+	}
+}
@@ -0,0 +1,167 @@
+package client_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/colligence-io/signServer/client"
+	"github.com/colligence-io/signServer/whitebox"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	stellarkp "github.com/stellar/go/keypair"
+	"net/http"
+	"testing"
+)
+
+// signedBy
+// raw signature of digest is made by key of address
+func signedBy(signature string, digest string, address string) bool {
+	sBytes, _ := hex.DecodeString(signature)
+	dBytes, _ := hex.DecodeString(digest)
+	publicKey, err := crypto.SigToPub(dBytes, sBytes)
+	return err == nil && crypto.PubkeyToAddress(*publicKey) == common.HexToAddress(address)
+}
+
+func TestSignBatch(t *testing.T) {
+	ts := startServer(t)
+	defer ts.stop()
+
+	c := ts.client(t)
+
+	requests := []client.SignRequest{
+		{Type: "ETH", Network: "testnet", Address: ts.address, Data: hash(1)},
+		{Type: "ETH", Network: "testnet", Address: ts.address, Data: hash(2)},
+		{Type: "ETH", Network: "testnet", Address: ts.address, Data: hash(3), Format: "der"},
+	}
+
+	batch, err := c.SignBatch(requests, "")
+	if err != nil {
+		t.Fatal("ER : SignBatch", err)
+	}
+	if batch.Signed != 3 || batch.Pending != 0 || batch.Failed != 0 || len(batch.Results) != 3 {
+		t.Fatal("ER : batch counts", batch)
+	}
+
+	// results are in order of items
+	for i, result := range batch.Results {
+		if result.Index != i || result.Code != http.StatusOK {
+			t.Error("ER : result", i, result)
+		}
+		if !signedBy(result.Signature, requests[i].Data, ts.address) {
+			t.Error("ER : signature of item", i, result.Signature)
+		}
+	}
+	if batch.Results[2].Format != "der" || len(batch.Results[2].Signatures) != 1 {
+		t.Error("ER : format of item", batch.Results[2])
+	}
+}
+
+func TestSignBatchItemFailure(t *testing.T) {
+	ts := startServer(t)
+	defer ts.stop()
+
+	c := ts.client(t)
+
+	batch, err := c.SignBatch([]client.SignRequest{
+		{Type: "ETH", Network: "testnet", Address: ts.address, Data: "00"},
+		{Type: "ETH", Network: "testnet", Address: ts.address, Data: hash(1)},
+		{Type: "ETH", Network: "mainnet", Address: ts.address, Data: hash(2)},
+		{Type: "ETH", Network: "testnet", Address: "0x0000000000000000000000000000000000000001", KeyAddress: ts.address, Data: hash(3)},
+		{Type: "ETH", Network: "testnet", Address: ts.address, Data: hash(4)},
+	}, "")
+	if err != nil {
+		t.Fatal("ER : batch with bad items", err)
+	}
+	if batch.Signed != 2 || batch.Pending != 0 || batch.Failed != 3 {
+		t.Fatal("ER : batch counts", batch)
+	}
+
+	// bad items do not fail other items
+	for _, i := range []int{0, 2, 3} {
+		if result := batch.Results[i]; result.Code == http.StatusOK || result.Signature != "" || result.Error == "" {
+			t.Error("ER : bad item", i, result)
+		}
+	}
+	if !signedBy(batch.Results[1].Signature, hash(1), ts.address) || !signedBy(batch.Results[4].Signature, hash(4), ts.address) {
+		t.Error("ER : good items", batch.Results[1], batch.Results[4])
+	}
+
+	if _, err := c.SignBatch(nil, ""); err == nil {
+		t.Error("ER : empty batch accepted")
+	} else if _, ok := err.(*client.BadRequestError); !ok {
+		t.Error("ER : empty batch error type", err)
+	}
+}
+
+func TestSignBatchTooLarge(t *testing.T) {
+	ts := startServer(t)
+	defer ts.stop()
+
+	ts.cfg.Server.MaxBatchSize = 2
+	c := ts.client(t)
+
+	item := client.SignRequest{Type: "ETH", Network: "testnet", Address: ts.address, Data: hash(1)}
+
+	_, err := c.SignBatch([]client.SignRequest{item, item, item}, "")
+	if re, ok := err.(*client.ResponseError); !ok || re.Code != http.StatusRequestEntityTooLarge {
+		t.Fatal("ER : batch larger than maxBatchSize", err)
+	}
+
+	if batch, err := c.SignBatch([]client.SignRequest{item, item}, ""); err != nil || batch.Signed != 2 {
+		t.Error("ER : batch of maxBatchSize", batch, err)
+	}
+}
+
+func TestSignBatchMixed(t *testing.T) {
+	ts := startServer(t)
+	defer ts.stop()
+
+	approver, err := stellarkp.Random()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// second keypair is held for approval
+	whitebox.NewKeyStore(ts.cfg, ts.vc).GenerateKeypair("eth2", "ETH", "", "testnet")
+	heldKeyID := sha256.Sum256([]byte("eth2"))
+
+	ts.cfg.Vault.PolicyPath = "tss/policy"
+	ts.cfg.Vault.ApproverPath = "tss/approver"
+	ts.vault.Put("tss/policy/hold-eth2", map[string]interface{}{"keyID": hex.EncodeToString(heldKeyID[:]), "decision": "require-approval", "approvals": "1"})
+	ts.vault.Put("tss/approver/alice", map[string]interface{}{"publicKey": approver.Address()})
+	ts.restart()
+
+	c := ts.client(t)
+
+	var heldAddress string
+	addresses, _ := c.Addresses()
+	for _, address := range addresses {
+		if address != "ETH:"+ts.address {
+			heldAddress = address[len("ETH:"):]
+		}
+	}
+	if heldAddress == "" {
+		t.Fatal("ER : second keypair is not in welcome package", addresses)
+	}
+
+	batch, err := c.SignBatch([]client.SignRequest{
+		{Type: "ETH", Network: "testnet", Address: ts.address, Data: hash(1)},
+		{Type: "ETH", Network: "testnet", Address: heldAddress, Data: hash(2)},
+		{Type: "ETH", Network: "testnet", Address: ts.address, Data: "00"},
+	}, "")
+	if err != nil {
+		t.Fatal("ER : mixed batch", err)
+	}
+	if batch.Signed != 1 || batch.Pending != 1 || batch.Failed != 1 {
+		t.Fatal("ER : mixed batch counts", batch)
+	}
+
+	if !signedBy(batch.Results[0].Signature, hash(1), ts.address) {
+		t.Error("ER : signed item", batch.Results[0])
+	}
+	if held := batch.Results[1]; held.Code != http.StatusAccepted || held.PendingID == "" || held.Signature != "" {
+		t.Error("ER : held item", held)
+	}
+	if failed := batch.Results[2]; failed.Code != http.StatusBadRequest || failed.Error == "" {
+		t.Error("ER : failed item", failed)
+	}
+}
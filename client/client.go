@@ -0,0 +1,302 @@
+package client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	stellarkp "github.com/stellar/go/keypair"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+SignServer client
+
+handshake : POST /introduce (myNameIs) -> sign question with app key -> POST /answer -> jwt and welcomePackage
+welcomePackage has a quiz question for every keypair ("SYMBOL:address"), answer of quiz is base64 signature of question by app key
+every sign request carries answer of its keypair, session is logged in again before jwt expires
+*/
+
+// session is refreshed when it expires within
+const defaultRefreshBefore = 30 * time.Second
+
+const defaultTimeout = 60 * time.Second
+
+type Client struct {
+	baseURL       string
+	appName       string
+	keyPair       *stellarkp.Full
+	httpClient    *http.Client
+	refreshBefore time.Duration
+
+	mutex   sync.Mutex
+	session *session
+}
+
+type session struct {
+	token   string
+	expires time.Time
+	// "SYMBOL:address" of keypair -> quiz answer
+	answers map[string]string
+}
+
+type Option func(c *Client)
+
+// WithHTTPClient
+// http client of requests, default timeout is 60 seconds
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRefreshBefore
+// session is logged in again when jwt expires within d (default 30 seconds)
+func WithRefreshBefore(d time.Duration) Option {
+	return func(c *Client) {
+		c.refreshBefore = d
+	}
+}
+
+// New
+// client of app, privateKey is stellar seed (S...) of app given by appadd
+func New(baseURL string, appName string, privateKey string, options ...Option) (*Client, error) {
+	kp, e := stellarkp.Parse(privateKey)
+	if e != nil {
+		return nil, e
+	}
+
+	full, ok := kp.(*stellarkp.Full)
+	if !ok {
+		return nil, errors.New("private key of app is required")
+	}
+
+	c := &Client{
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		appName:       appName,
+		keyPair:       full,
+		httpClient:    &http.Client{Timeout: defaultTimeout},
+		refreshBefore: defaultRefreshBefore,
+	}
+	for _, option := range options {
+		option(c)
+	}
+
+	return c, nil
+}
+
+// Login
+// introduce and answer, new session replaces current one
+func (c *Client) Login() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.login()
+}
+
+// login
+// mutex must be held by caller
+func (c *Client) login() error {
+	var introduced struct {
+		Question string `json:"question"`
+		Expires  int64  `json:"expires"`
+	}
+	if e := c.post("/introduce", "", nil, map[string]string{"myNameIs": c.appName}, &introduced); e != nil {
+		return e
+	}
+
+	answer, e := c.answerOf(introduced.Question)
+	if e != nil {
+		return e
+	}
+
+	var welcome struct {
+		JWS          string            `json:"welcomePresent"`
+		KeyQuestions map[string]string `json:"welcomePackage"`
+		Expires      int64             `json:"expires"`
+	}
+	e = c.post("/answer", "", nil, map[string]string{
+		"myNameIs":        c.appName,
+		"yourQuestionWas": introduced.Question,
+		"myAnswerIs":      answer,
+	}, &welcome)
+	if e != nil {
+		return e
+	}
+
+	answers := make(map[string]string)
+	for key, question := range welcome.KeyQuestions {
+		if answers[key], e = c.answerOf(question); e != nil {
+			return e
+		}
+	}
+
+	c.session = &session{
+		token:   welcome.JWS,
+		expires: time.Unix(welcome.Expires, 0),
+		answers: answers,
+	}
+
+	return nil
+}
+
+// answerOf
+// base64 signature of base64 question by app key
+func (c *Client) answerOf(question string) (string, error) {
+	qBytes, e := base64.StdEncoding.DecodeString(question)
+	if e != nil {
+		return "", errors.New("question is not base64 : " + question)
+	}
+
+	signature, e := c.keyPair.Sign(qBytes)
+	if e != nil {
+		return "", e
+	}
+
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// currentSession
+// session logged in again if it expires soon
+func (c *Client) currentSession() (*session, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.session == nil || time.Now().Add(c.refreshBefore).After(c.session.expires) {
+		if e := c.login(); e != nil {
+			return nil, e
+		}
+	}
+
+	return c.session, nil
+}
+
+// dropSession
+// session rejected by server is not used again
+func (c *Client) dropSession(s *session) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.session == s {
+		c.session = nil
+	}
+}
+
+// SessionExpires
+// expiration of current session, zero if not logged in
+func (c *Client) SessionExpires() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.session == nil {
+		return time.Time{}
+	}
+	return c.session.expires
+}
+
+// Addresses
+// "SYMBOL:address" of keypairs of current session
+func (c *Client) Addresses() ([]string, error) {
+	s, e := c.currentSession()
+	if e != nil {
+		return nil, e
+	}
+
+	addresses := make([]string, 0, len(s.answers))
+	for key := range s.answers {
+		addresses = append(addresses, key)
+	}
+	return addresses, nil
+}
+
+// Answer
+// quiz answer of keypair address in current session
+func (c *Client) Answer(symbol string, address string) (string, error) {
+	s, e := c.currentSession()
+	if e != nil {
+		return "", e
+	}
+	return s.answer(symbol, address)
+}
+
+func (s *session) answer(symbol string, address string) (string, error) {
+	answer, found := s.answers[symbol+":"+address]
+	if !found {
+		return "", errors.New("keypair " + symbol + ":" + address + " is not in welcome package")
+	}
+	return answer, nil
+}
+
+// call
+// POST to protected endpoint, body is built for session (answers differ by session)
+// session rejected by server is logged in again once
+func (c *Client) call(path string, header http.Header, body func(s *session) (interface{}, error), out interface{}) error {
+	for attempt := 0; ; attempt++ {
+		s, e := c.currentSession()
+		if e != nil {
+			return e
+		}
+
+		request, e := body(s)
+		if e != nil {
+			return e
+		}
+
+		e = c.post(path, s.token, header, request, out)
+		if _, unauthorized := e.(*UnauthorizedError); unauthorized && attempt == 0 {
+			c.dropSession(s)
+			continue
+		}
+		return e
+	}
+}
+
+// post
+// POST JSON request, data of OK response is decoded into out
+func (c *Client) post(path string, token string, header http.Header, request interface{}, out interface{}) error {
+	rBytes, e := json.Marshal(request)
+	if e != nil {
+		return e
+	}
+
+	req, e := http.NewRequest(http.MethodPost, c.baseURL+path, bytes.NewReader(rBytes))
+	if e != nil {
+		return e
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, e := c.httpClient.Do(req)
+	if e != nil {
+		return e
+	}
+	defer res.Body.Close()
+
+	bBytes, e := ioutil.ReadAll(res.Body)
+	if e != nil {
+		return e
+	}
+
+	var entity responseEntity
+	if e := json.Unmarshal(bBytes, &entity); e != nil {
+		return &ServerError{ResponseError{Code: res.StatusCode, Message: strings.TrimSpace(string(bBytes))}}
+	}
+
+	if entity.Code != http.StatusOK {
+		return entity.err()
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(entity.Data, out)
+}
@@ -0,0 +1,451 @@
+package client_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/colligence-io/signServer/audit"
+	"github.com/colligence-io/signServer/client"
+	"github.com/colligence-io/signServer/config"
+	"github.com/colligence-io/signServer/psbt"
+	"github.com/colligence-io/signServer/server"
+	"github.com/colligence-io/signServer/server/approval"
+	"github.com/colligence-io/signServer/trustSigner"
+	"github.com/colligence-io/signServer/vault"
+	"github.com/colligence-io/signServer/vault/vaulttest"
+	"github.com/colligence-io/signServer/whitebox"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	stellarkp "github.com/stellar/go/keypair"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	appName     = "exchange"
+	whiteBoxKey = "eth1"
+	jwtExpires  = 3
+)
+
+type testServer struct {
+	*httptest.Server
+	vault      *vaulttest.Server
+	vc         *vault.Client
+	cfg        *config.Configuration
+	instance   *server.Instance
+	dir        string
+	privateKey string
+	address    string
+}
+
+// startServer
+// server.Instance with fake vault, one app and one ETH keypair
+func startServer(t *testing.T) *testServer {
+	dir, err := ioutil.TempDir("", "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fv := vaulttest.NewServer()
+
+	cfg := &config.Configuration{
+		Server: config.ServerConfig{
+			BlockChainNetwork: "testnet",
+			PolicyDefault:     "allow",
+			RateLimitState:    filepath.Join(dir, "ratelimit.state"),
+			LogAudit:          filepath.Join(dir, "audit.log"),
+		},
+		Auth: config.AuthConfig{JwtSecret: "jwt secret", JwtExpires: jwtExpires, QuestionExpires: 10},
+		Vault: config.VaultConfig{
+			Username:     "user",
+			Password:     "pass",
+			AppRole:      "role",
+			Address:      fv.URL,
+			WhiteBoxPath: "tss/whitebox",
+			AuthPath:     "tss/auth",
+			AuditPath:    "tss/audit",
+		},
+		Signer: config.SignerConfig{Backend: trustSigner.SoftwareBackend, SealKey: "seal key"},
+	}
+
+	if err := trustSigner.Configure(cfg.Signer); err != nil {
+		t.Fatal(err)
+	}
+
+	vc := vault.NewClient(cfg)
+	ks := whitebox.NewKeyStore(cfg, vc)
+	ks.AddAppAuth(appName, "127.0.0.1/32")
+	ks.GenerateKeypair(whiteBoxKey, "ETH", "", "testnet")
+
+	ts := &testServer{vault: fv, vc: vc, cfg: cfg, dir: dir}
+	ts.privateKey = fv.Get(cfg.Vault.AuthPath + "/" + appName)["privateKey"].(string)
+	ts.address = fv.Find(cfg.Vault.WhiteBoxPath)["address"].(string)
+
+	ts.instance = server.NewInstance(cfg, vc, ks)
+	ts.Server = httptest.NewServer(ts.instance.Handler())
+
+	return ts
+}
+
+func (ts *testServer) stop() {
+	ts.Server.Close()
+	ts.instance.Close()
+	ts.vault.Close()
+	_ = os.RemoveAll(ts.dir)
+}
+
+func (ts *testServer) client(t *testing.T, options ...client.Option) *client.Client {
+	c, err := client.New(ts.URL, appName, ts.privateKey, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func hash(b byte) string {
+	return hex.EncodeToString(append(make([]byte, 31), b))
+}
+
+func TestHandshakeAndSign(t *testing.T) {
+	ts := startServer(t)
+	defer ts.stop()
+
+	c := ts.client(t)
+
+	if now, err := c.Knock(); err != nil || now == 0 {
+		t.Fatal("ER : Knock", now, err)
+	}
+
+	addresses, err := c.Addresses()
+	if err != nil || len(addresses) != 1 || addresses[0] != "ETH:"+ts.address {
+		t.Error("ER : welcome package", addresses, err)
+	}
+
+	request := client.SignRequest{Type: "ETH", Network: "testnet", Address: ts.address, Data: hash(1) + hash(2)}
+	response, err := c.Sign(request, "")
+	if err != nil {
+		t.Fatal("ER : Sign", err)
+	}
+	if len(response.Signature) != 2*2*65 {
+		t.Error("ER : signature of 2 hashes", response.Signature)
+	}
+
+	request.Data = "0102"
+	if _, err := c.Sign(request, ""); err == nil {
+		t.Error("ER : bad data signed")
+	} else if _, ok := err.(*client.BadRequestError); !ok {
+		t.Error("ER : bad data error type", err)
+	}
+
+	other := client.SignRequest{Type: "ETH", Network: "testnet", Address: "0x0000000000000000000000000000000000000001", Data: hash(1)}
+	if _, err := c.Sign(other, ""); err == nil {
+		t.Error("ER : address not in welcome package signed")
+	}
+
+	batch, err := c.SignBatch([]client.SignRequest{
+		{Type: "ETH", Network: "testnet", Address: ts.address, Data: hash(3)},
+		{Type: "ETH", Network: "testnet", Address: ts.address, Data: "00"},
+	}, "")
+	if err != nil || batch.Signed != 1 || batch.Failed != 1 {
+		t.Error("ER : SignBatch", batch, err)
+	}
+
+	// every handshake and signature is in audit log, head is anchored in background
+	publicKey, anchor, err := audit.LoadVerifier(ts.vc, ts.cfg.Vault.AuditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count uint64
+	for deadline := time.Now().Add(3 * time.Second); ; time.Sleep(100 * time.Millisecond) {
+		if count, err = audit.Verify(ts.cfg.Server.LogAudit, publicKey, anchor); err == nil || time.Now().After(deadline) {
+			break
+		}
+	}
+	if err != nil || count == 0 {
+		t.Error("ER : audit log", count, err)
+	}
+}
+
+func TestSignDerivation(t *testing.T) {
+	ts := startServer(t)
+	defer ts.stop()
+
+	c := ts.client(t)
+
+	request := client.SignRequest{Type: "ETH", Network: "testnet", Address: ts.address, Derivation: &client.Derivation{Index: 5}, Data: hash(1)}
+	response, err := c.Sign(request, "")
+	if err != nil {
+		t.Fatal("ER : Sign with derivation", err)
+	}
+	if response.Address == "" || response.Address == ts.address {
+		t.Fatal("ER : derived address", response.Address)
+	}
+
+	// signed by key of derived address
+	signature, _ := hex.DecodeString(response.Signature)
+	digest, _ := hex.DecodeString(hash(1))
+	publicKey, err := crypto.SigToPub(digest, signature)
+	if err != nil || crypto.PubkeyToAddress(*publicKey) != common.HexToAddress(response.Address) {
+		t.Error("ER : signature of derived key", response.Address, err)
+	}
+
+	// derivation is bounded by maxDerivationIndex
+	request.Derivation = &client.Derivation{Index: whitebox.DefaultMaxDerivationIndex}
+	if _, err := c.Sign(request, ""); err == nil {
+		t.Error("ER : derivation over maxDerivationIndex signed")
+	} else if _, ok := err.(*client.BadRequestError); !ok {
+		t.Error("ER : derivation over maxDerivationIndex error type", err)
+	}
+
+	// derived address is tracked, signed by its own address with primary quiz answer
+	request = client.SignRequest{Type: "ETH", Network: "testnet", Address: response.Address, KeyAddress: ts.address, Data: hash(2)}
+	if _, err := c.Sign(request, ""); err != nil {
+		t.Error("ER : Sign by derived address", err)
+	}
+}
+
+func TestLoginRejected(t *testing.T) {
+	ts := startServer(t)
+	defer ts.stop()
+
+	other, _ := stellarkp.Random()
+	c, _ := client.New(ts.URL, appName, other.Seed())
+	if err := c.Login(); err == nil {
+		t.Error("ER : login by other key")
+	} else if _, ok := err.(*client.AnswerRejectedError); !ok {
+		t.Error("ER : login by other key error type", err)
+	}
+
+	c, _ = client.New(ts.URL, "unknown", other.Seed())
+	if _, err := c.Knock(); err == nil {
+		t.Error("ER : unknown app logged in")
+	} else if _, ok := err.(*client.BadRequestError); !ok {
+		t.Error("ER : unknown app error type", err)
+	}
+
+	if _, err := client.New(ts.URL, appName, other.Address()); err == nil {
+		t.Error("ER : client without private key")
+	}
+}
+
+func TestSessionRefresh(t *testing.T) {
+	ts := startServer(t)
+	defer ts.stop()
+
+	c := ts.client(t, client.WithRefreshBefore(2*time.Second))
+
+	if err := c.Login(); err != nil {
+		t.Fatal(err)
+	}
+	first := c.SessionExpires()
+
+	// session expiring within 2 seconds is refreshed
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := c.Knock(); err != nil {
+		t.Fatal("ER : Knock", err)
+	}
+	if !c.SessionExpires().After(first) {
+		t.Error("ER : session is not refreshed", first, c.SessionExpires())
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	ts := startServer(t)
+	defer ts.stop()
+
+	c := ts.client(t)
+	request := client.SignRequest{Type: "ETH", Network: "testnet", Address: ts.address, Data: hash(7)}
+
+	first, err := c.Sign(request, "payout-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// retry in new session has other quiz answer, still same request
+	if err := c.Login(); err != nil {
+		t.Fatal(err)
+	}
+	repeated, err := c.Sign(request, "payout-1")
+	if err != nil || repeated.Signature != first.Signature {
+		t.Error("ER : repeated request", repeated, err)
+	}
+
+	request.Data = hash(8)
+	if _, err := c.Sign(request, "payout-1"); err == nil {
+		t.Error("ER : other request with same key signed")
+	} else if _, ok := err.(*client.ConflictError); !ok {
+		t.Error("ER : conflict error type", err)
+	}
+}
+
+// restart
+// stop server and start new instance on same vault and files
+func (ts *testServer) restart() {
+	ts.Server.Close()
+	ts.instance.Close()
+
+	ks := whitebox.NewKeyStore(ts.cfg, ts.vc)
+	ts.instance = server.NewInstance(ts.cfg, ts.vc, ks)
+	ts.Server = httptest.NewServer(ts.instance.Handler())
+}
+
+func TestApprovalAfterRestart(t *testing.T) {
+	ts := startServer(t)
+	defer ts.stop()
+
+	approver, err := stellarkp.Random()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts.cfg.Vault.PolicyPath = "tss/policy"
+	ts.cfg.Vault.ApproverPath = "tss/approver"
+	ts.cfg.Server.ApprovalThreshold = 1
+	ts.vault.Put("tss/policy/hold-all", map[string]interface{}{"app": appName, "decision": "require-approval"})
+	ts.vault.Put("tss/approver/alice", map[string]interface{}{"publicKey": approver.Address()})
+	ts.restart()
+
+	c := ts.client(t)
+
+	_, err = c.Sign(client.SignRequest{Type: "ETH", Network: "testnet", Address: ts.address, Data: hash(7)}, "")
+	pending, ok := err.(*client.PendingApprovalError)
+	if !ok {
+		t.Fatal("ER : request is not held", err)
+	}
+
+	// held request survives restart and is signed by replay when approved
+	ts.restart()
+
+	message := approval.ApprovalMessage(approval.Approve, pending.PendingID, pending.Digest)
+	signature, err := approver.Sign([]byte(message))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := json.Marshal(map[string]string{
+		"approver":  "alice",
+		"id":        pending.PendingID,
+		"decision":  approval.Approve,
+		"signature": base64.StdEncoding.EncodeToString(signature),
+	})
+	res, err := http.Post(ts.URL+"/approval/decide", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var entity struct {
+		Code int              `json:"code"`
+		Data approval.Pending `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&entity); err != nil {
+		t.Fatal(err)
+	}
+	if entity.Code != http.StatusOK || entity.Data.Status != approval.StatusSigned || entity.Data.Result == nil {
+		t.Fatal("ER : approval after restart", entity)
+	}
+
+	result, _ := entity.Data.Result.Data.(map[string]interface{})
+	sigHex, _ := result["signature"].(string)
+	sigBytes, _ := hex.DecodeString(sigHex)
+	digest, _ := hex.DecodeString(hash(7))
+	publicKey, err := crypto.SigToPub(digest, sigBytes)
+	if err != nil || crypto.PubkeyToAddress(*publicKey) != common.HexToAddress(ts.address) {
+		t.Error("ER : signature of replayed request", sigHex, err)
+	}
+}
+
+// legacyPSBT
+// base64 psbt spending one P2PKH output of address
+func legacyPSBT(t *testing.T, address string) string {
+	addr, err := btcutil.DecodeAddress(address, &chaincfg.TestNet3Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkScript, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prevTx := wire.NewMsgTx(2)
+	prevTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1}, Index: 0}, nil, nil))
+	prevTx.AddTxOut(wire.NewTxOut(100000, pkScript))
+	prevHash := prevTx.TxHash()
+
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prevHash, 0), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(50000, []byte{txscript.OP_TRUE}))
+
+	var txBuf, prevBuf bytes.Buffer
+	if err := tx.SerializeNoWitness(&txBuf); err != nil {
+		t.Fatal(err)
+	}
+	if err := prevTx.Serialize(&prevBuf); err != nil {
+		t.Fatal(err)
+	}
+
+	packet := &psbt.Packet{
+		Global:  psbt.Map{{Key: []byte{psbt.GlobalUnsignedTx}, Value: txBuf.Bytes()}},
+		Inputs:  []psbt.Map{{}},
+		Outputs: []psbt.Map{{}},
+	}
+	packet.Inputs[0].Set(psbt.InputNonWitnessUtxo, nil, prevBuf.Bytes())
+
+	encoded, err := packet.EncodeBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded
+}
+
+func TestIdempotencyKeyPSBT(t *testing.T) {
+	ts := startServer(t)
+	defer ts.stop()
+
+	whitebox.NewKeyStore(ts.cfg, ts.vc).GenerateKeypair("btc1", "BTC", "", "testnet")
+	ts.restart()
+
+	c := ts.client(t)
+
+	addresses, err := c.Addresses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var btcAddress string
+	for _, address := range addresses {
+		if strings.HasPrefix(address, "BTC:") {
+			btcAddress = strings.TrimPrefix(address, "BTC:")
+		}
+	}
+	if btcAddress == "" {
+		t.Fatal("ER : BTC keypair is not in welcome package", addresses)
+	}
+
+	request := client.PSBTRequest{Network: "testnet", PSBT: legacyPSBT(t, btcAddress), KeyAddresses: []string{btcAddress}}
+
+	first, err := c.SignPSBT(request, "psbt-1")
+	if err != nil || len(first.SignedInputs) != 1 {
+		t.Fatal("ER : SignPSBT", first, err)
+	}
+
+	// retry in new session has other answers map, still same request
+	if err := c.Login(); err != nil {
+		t.Fatal(err)
+	}
+	repeated, err := c.SignPSBT(request, "psbt-1")
+	if err != nil || repeated.PSBT != first.PSBT {
+		t.Error("ER : repeated psbt request", repeated, err)
+	}
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+/*
+typed errors of response entity codes
+every error embeds ResponseError with code and message of server
+*/
+
+type responseEntity struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// ResponseError
+// response of server which is not OK
+type ResponseError struct {
+	Code    int
+	Message string
+}
+
+func (e ResponseError) Error() string {
+	return "signServer " + strconv.Itoa(e.Code) + " : " + e.Message
+}
+
+// UnauthorizedError
+// 401, session or app is not accepted (remote address, expired session)
+type UnauthorizedError struct{ ResponseError }
+
+// AnswerRejectedError
+// 406, signature of question is not made by app key
+type AnswerRejectedError struct{ ResponseError }
+
+// BadRequestError
+// 400, invalid request or wrong quiz answer
+type BadRequestError struct{ ResponseError }
+
+// PolicyDeniedError
+// 403, denied by signing policy
+type PolicyDeniedError struct{ ResponseError }
+
+// NotFoundError
+// 404
+type NotFoundError struct{ ResponseError }
+
+// ConflictError
+// 409, idempotency key is used for other request or in progress
+type ConflictError struct{ ResponseError }
+
+// RateLimitedError
+// 429, rate limit is exceeded
+type RateLimitedError struct{ ResponseError }
+
+// ServerError
+// 5xx
+type ServerError struct{ ResponseError }
+
+// PendingApprovalError
+// 202, request is held until approvers approve it, poll GET /approval/{PendingID} for result
+type PendingApprovalError struct {
+	ResponseError
+	PendingID string `json:"pendingId"`
+	Digest    string `json:"digest"`
+	Required  int    `json:"required"`
+	Expires   int64  `json:"expires"`
+}
+
+// err
+// typed error of response entity
+func (entity *responseEntity) err() error {
+	re := ResponseError{Code: entity.Code, Message: entity.Message}
+
+	switch entity.Code {
+	case http.StatusAccepted:
+		pending := &PendingApprovalError{}
+		_ = json.Unmarshal(entity.Data, pending)
+		pending.ResponseError = re
+		return pending
+	case http.StatusUnauthorized:
+		return &UnauthorizedError{re}
+	case http.StatusNotAcceptable:
+		return &AnswerRejectedError{re}
+	case http.StatusBadRequest:
+		return &BadRequestError{re}
+	case http.StatusForbidden:
+		return &PolicyDeniedError{re}
+	case http.StatusNotFound:
+		return &NotFoundError{re}
+	case http.StatusConflict:
+		return &ConflictError{re}
+	case http.StatusTooManyRequests:
+		return &RateLimitedError{re}
+	}
+
+	if entity.Code >= http.StatusInternalServerError {
+		return &ServerError{re}
+	}
+	return &re
+}
@@ -0,0 +1,48 @@
+package client_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/colligence-io/signServer/btcmsg"
+	"github.com/colligence-io/signServer/client"
+	"github.com/colligence-io/signServer/whitebox"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestSignBTCMessage(t *testing.T) {
+	ts := startServer(t)
+	defer ts.stop()
+
+	whitebox.NewKeyStore(ts.cfg, ts.vc).GenerateKeypair("btc1", "BTC", "p2wpkh", "testnet")
+	ts.restart()
+
+	btcAddress := ts.keypairAddress("btc1")
+	c := ts.client(t)
+
+	message := "proof of reserve 2026"
+	response, err := c.SignBTCMessage(client.BTCMessageRequest{Network: "testnet", Address: btcAddress, Message: message})
+	if err != nil {
+		t.Fatal("ER : SignBTCMessage", err)
+	}
+	if response.Address != btcAddress || response.Message != message {
+		t.Error("ER : message response", response)
+	}
+	if err := btcmsg.Verify(btcAddress, message, response.Signature, &chaincfg.TestNet3Params); err != nil {
+		t.Error("ER : message signature", err)
+	}
+
+	// recorded by shared signing path, digest of signed data as every signature
+	digest := sha256.Sum256(btcmsg.MessageHash(message))
+	auditLog, err := ioutil.ReadFile(ts.cfg.Server.LogAudit)
+	if err != nil || !strings.Contains(string(auditLog), hex.EncodeToString(digest[:])) {
+		t.Error("ER : message signature is not in audit log", err)
+	}
+
+	// address must be on network of keypair
+	if _, err := c.SignBTCMessage(client.BTCMessageRequest{Network: "mainnet", Address: btcAddress, Message: message}); err == nil {
+		t.Error("ER : message signed on other network")
+	}
+}
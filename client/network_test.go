@@ -0,0 +1,69 @@
+package client_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/colligence-io/signServer/client"
+	"github.com/colligence-io/signServer/whitebox"
+	"testing"
+)
+
+func TestSignNetwork(t *testing.T) {
+	ts := startServer(t)
+	defer ts.stop()
+
+	// keypairs of same symbol on other networks
+	ks := whitebox.NewKeyStore(ts.cfg, ts.vc)
+	ks.GenerateKeypair("eth-main", "ETH", "", "mainnet")
+	ks.GenerateKeypair("btc-reg", "BTC", "p2wpkh", "regtest")
+	ts.restart()
+
+	mainnetAddress := ts.keypairAddress("eth-main")
+	regtestAddress := ts.keypairAddress("btc-reg")
+	if mainnetAddress == "" || regtestAddress == "" {
+		t.Fatal("ER : keypairs are not generated", mainnetAddress, regtestAddress)
+	}
+
+	c := ts.client(t)
+
+	for _, tc := range []struct {
+		symbol  string
+		network string
+		address string
+		signed  bool
+	}{
+		{"ETH", "testnet", ts.address, true},
+		{"ETH", "mainnet", ts.address, false},
+		{"ETH", "mainnet", mainnetAddress, true},
+		{"ETH", "testnet", mainnetAddress, false},
+		{"BTC", "regtest", regtestAddress, true},
+		{"BTC", "testnet", regtestAddress, false},
+		{"BTC", "signet", regtestAddress, false},
+		{"BTC", "foonet", regtestAddress, false},
+	} {
+		response, err := c.Sign(client.SignRequest{Type: tc.symbol, Network: tc.network, Address: tc.address, Data: hash(1)}, "")
+		if !tc.signed {
+			if _, ok := err.(*client.BadRequestError); !ok {
+				t.Error("ER : sign request naming wrong network", tc.symbol, tc.network, tc.address, err)
+			}
+			continue
+		}
+		if err != nil || len(response.Signature) != 2*65 {
+			t.Error("ER : sign on network of keypair", tc.symbol, tc.network, tc.address, err)
+		}
+	}
+
+	// ETH signature is made by key of mainnet keypair
+	response, err := c.Sign(client.SignRequest{Type: "ETH", Network: "mainnet", Address: mainnetAddress, Data: hash(2)}, "")
+	if err != nil || !signedBy(response.Signature, hash(2), mainnetAddress) {
+		t.Error("ER : signature of mainnet keypair", err)
+	}
+}
+
+// keypairAddress
+// primary address of keypair of appID stored in vault
+func (ts *testServer) keypairAddress(appID string) string {
+	keyID := sha256.Sum256([]byte(appID))
+	address, _ := ts.vault.Get(ts.cfg.Vault.WhiteBoxPath + "/" + hex.EncodeToString(keyID[:]))["address"].(string)
+	return address
+}
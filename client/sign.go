@@ -0,0 +1,229 @@
+package client
+
+import (
+	"net/http"
+)
+
+// header of sign request to sign once per key
+const idempotencyHeader = "Idempotency-Key"
+
+// Derivation
+// change and address index of BIP44 path
+type Derivation struct {
+	Change uint32 `json:"change"`
+	Index  uint32 `json:"index"`
+}
+
+// SignRequest
+// Data is hex of 32*N bytes (hashes to sign), Format is raw (empty), der, compact or rsv
+// KeyAddress is primary address of keypair in welcome package when Address is derived (deposit) address
+// Derivation (optional) signs by key at derivation of keypair of Address
+type SignRequest struct {
+	Type        string
+	Network     string
+	Address     string
+	KeyAddress  string
+	Derivation  *Derivation
+	Data        string
+	Format      string
+	SigHashType *byte
+}
+
+type signRequest struct {
+	Type        string      `json:"type"`
+	Network     string      `json:"network"`
+	Address     string      `json:"address"`
+	Answer      string      `json:"answer"`
+	Derivation  *Derivation `json:"derivation,omitempty"`
+	Data        string      `json:"data"`
+	Format      string      `json:"format,omitempty"`
+	SigHashType *byte       `json:"sigHashType,omitempty"`
+}
+
+// SignResponse
+// Signature is hex of raw signatures (R||S||V), Signatures are in requested format
+// Address is derived address signed by, only for request with Derivation
+type SignResponse struct {
+	Signature  string        `json:"signature"`
+	Address    string        `json:"address,omitempty"`
+	Format     string        `json:"format,omitempty"`
+	Signatures []interface{} `json:"signatures,omitempty"`
+}
+
+// BatchResult
+// result of each batch item, Code is http status of item
+type BatchResult struct {
+	Index      int           `json:"index"`
+	Code       int           `json:"code"`
+	Signature  string        `json:"signature,omitempty"`
+	Address    string        `json:"address,omitempty"`
+	Format     string        `json:"format,omitempty"`
+	Signatures []interface{} `json:"signatures,omitempty"`
+	PendingID  string        `json:"pendingId,omitempty"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// PSBTRequest
+// PSBT is base64, KeyAddresses are primary addresses of BTC keypairs of inputs to sign (answered by session)
+type PSBTRequest struct {
+	Network      string
+	PSBT         string
+	KeyAddresses []string
+}
+
+type psbtRequest struct {
+	Network string            `json:"network"`
+	PSBT    string            `json:"psbt"`
+	Answers map[string]string `json:"answers"`
+}
+
+// PSBTResponse
+// PSBT (base64) with partial signatures of SignedInputs
+type PSBTResponse struct {
+	PSBT         string `json:"psbt"`
+	SignedInputs []int  `json:"signedInputs"`
+}
+
+// BTCMessageRequest
+// Address is tracked BTC address signing Message (BIP137)
+type BTCMessageRequest struct {
+	Network string
+	Address string
+	Message string
+}
+
+type btcMessageRequest struct {
+	Network string `json:"network"`
+	Address string `json:"address"`
+	Answer  string `json:"answer"`
+	Message string `json:"message"`
+}
+
+// BTCMessageResponse
+// Signature is base64 compact signature of Message by Address
+type BTCMessageResponse struct {
+	Address   string `json:"address"`
+	Message   string `json:"message"`
+	Signature string `json:"signature"`
+}
+
+type BatchResponse struct {
+	Signed  int           `json:"signed"`
+	Pending int           `json:"pending"`
+	Failed  int           `json:"failed"`
+	Results []BatchResult `json:"results"`
+}
+
+func (request SignRequest) build(s *session) (signRequest, error) {
+	keyAddress := request.KeyAddress
+	if keyAddress == "" {
+		keyAddress = request.Address
+	}
+
+	answer, e := s.answer(request.Type, keyAddress)
+	if e != nil {
+		return signRequest{}, e
+	}
+
+	return signRequest{
+		Type:        request.Type,
+		Network:     request.Network,
+		Address:     request.Address,
+		Answer:      answer,
+		Derivation:  request.Derivation,
+		Data:        request.Data,
+		Format:      request.Format,
+		SigHashType: request.SigHashType,
+	}, nil
+}
+
+func idempotencyKeyHeader(key string) http.Header {
+	if key == "" {
+		return nil
+	}
+	return http.Header{idempotencyHeader: []string{key}}
+}
+
+// Knock
+// server time (unix), checks session
+func (c *Client) Knock() (int64, error) {
+	var now int64
+	e := c.call("/knock", nil, func(s *session) (interface{}, error) {
+		return struct{}{}, nil
+	}, &now)
+	return now, e
+}
+
+// Sign
+// sign data by keypair of address, request held for approval returns *PendingApprovalError
+// idempotencyKey (optional) makes repeated request return first signature
+func (c *Client) Sign(request SignRequest, idempotencyKey string) (*SignResponse, error) {
+	response := &SignResponse{}
+	e := c.call("/sign", idempotencyKeyHeader(idempotencyKey), func(s *session) (interface{}, error) {
+		return request.build(s)
+	}, response)
+	if e != nil {
+		return nil, e
+	}
+	return response, nil
+}
+
+// SignBatch
+// sign list of requests, each item has its own result
+func (c *Client) SignBatch(requests []SignRequest, idempotencyKey string) (*BatchResponse, error) {
+	response := &BatchResponse{}
+	e := c.call("/sign/batch", idempotencyKeyHeader(idempotencyKey), func(s *session) (interface{}, error) {
+		items := make([]signRequest, len(requests))
+		for i, request := range requests {
+			item, e := request.build(s)
+			if e != nil {
+				return nil, e
+			}
+			items[i] = item
+		}
+		return map[string]interface{}{"items": items}, nil
+	}, response)
+	if e != nil {
+		return nil, e
+	}
+	return response, nil
+}
+
+// SignPSBT
+// sign inputs of keypairs in psbt, request held for approval returns *PendingApprovalError
+// idempotencyKey (optional) makes repeated request return first psbt
+func (c *Client) SignPSBT(request PSBTRequest, idempotencyKey string) (*PSBTResponse, error) {
+	response := &PSBTResponse{}
+	e := c.call("/sign/btc/psbt", idempotencyKeyHeader(idempotencyKey), func(s *session) (interface{}, error) {
+		answers := make(map[string]string, len(request.KeyAddresses))
+		for _, address := range request.KeyAddresses {
+			answer, e := s.answer("BTC", address)
+			if e != nil {
+				return nil, e
+			}
+			answers["BTC:"+address] = answer
+		}
+		return psbtRequest{Network: request.Network, PSBT: request.PSBT, Answers: answers}, nil
+	}, response)
+	if e != nil {
+		return nil, e
+	}
+	return response, nil
+}
+
+// SignBTCMessage
+// sign bitcoin message by address, request held for approval returns *PendingApprovalError
+func (c *Client) SignBTCMessage(request BTCMessageRequest) (*BTCMessageResponse, error) {
+	response := &BTCMessageResponse{}
+	e := c.call("/sign/btc/message", nil, func(s *session) (interface{}, error) {
+		answer, e := s.answer("BTC", request.Address)
+		if e != nil {
+			return nil, e
+		}
+		return btcMessageRequest{Network: request.Network, Address: request.Address, Answer: answer, Message: request.Message}, nil
+	}, response)
+	if e != nil {
+		return nil, e
+	}
+	return response, nil
+}
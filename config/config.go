@@ -24,13 +24,26 @@ type Configuration struct {
 	Server ServerConfig `json:"server"`
 	Auth   AuthConfig   `json:"auth"`
 	Vault  VaultConfig  `json:"vault"`
+	Signer SignerConfig `json:"signer"`
 }
 
 type ServerConfig struct {
-	LogPath           string `json:"log_path"`
-	LogAccess         string `json:"log_access"`
-	LogService        string `json:"log_service"`
-	BlockChainNetwork string `json:"bc_network"`
+	LogPath            string   `json:"log_path"`
+	LogAccess          string   `json:"log_access"`
+	LogService         string   `json:"log_service"`
+	LogAudit           string   `json:"log_audit"`
+	BlockChainNetwork  string   `json:"bc_network"`
+	MaxBatchSize       int      `json:"maxBatchSize"`
+	MaxDerivationIndex int      `json:"maxDerivationIndex"`
+	PolicyDefault      string   `json:"policyDefault"`
+	RateLimitState     string   `json:"rateLimitState"`
+	ApprovalThreshold  int      `json:"approvalThreshold"`
+	ApprovalExpires    int      `json:"approvalExpires"`
+	IdempotencyWindow  int      `json:"idempotencyWindow"`
+	JobWorkers         int      `json:"jobWorkers"`
+	JobRetention       int      `json:"jobRetention"`
+	JobCallbackSecret  string   `json:"jobCallbackSecret"`
+	CallbackHosts      []string `json:"callbackHosts"`
 }
 
 type AuthConfig struct {
@@ -40,12 +53,24 @@ type AuthConfig struct {
 }
 
 type VaultConfig struct {
-	Username     string `json:"username"`
-	Password     string `json:"password"`
-	AppRole      string `json:"approle"`
-	Address      string `json:"address"`
-	WhiteBoxPath string `json:"whiteboxPath"`
-	AuthPath     string `json:"authPath"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	AppRole       string `json:"approle"`
+	Address       string `json:"address"`
+	WhiteBoxPath  string `json:"whiteboxPath"`
+	AuthPath      string `json:"authPath"`
+	PolicyPath    string `json:"policyPath"`
+	RateLimitPath string `json:"rateLimitPath"`
+	ApproverPath  string `json:"approverPath"`
+	PendingPath   string `json:"pendingPath"`
+	AuditPath     string `json:"auditPath"`
+}
+
+type SignerConfig struct {
+	Backend     string `json:"backend"`
+	SealKey     string `json:"sealKey"`
+	MaxInFlight int    `json:"maxInFlight"`
+	MaxQueue    int    `json:"maxQueue"`
 }
 
 func setEnv(envName string, defaultValue string) string {
@@ -169,6 +194,24 @@ func (cfg *ServerConfig) GetAccessLogWriter() io.Writer {
 	return nil
 }
 
+// GetAuditLogPath
+// audit log file in log path, audit.log if log_audit is not set
+func (cfg *ServerConfig) GetAuditLogPath() string {
+	name := cfg.LogAudit
+	if name == "" {
+		name = "audit.log"
+	}
+	if strings.HasPrefix(name, "/") {
+		return name
+	}
+
+	path := getLogPath(cfg)
+	if path == "" {
+		path = "."
+	}
+	return path + "/" + name
+}
+
 func getLogPath(cfg *ServerConfig) string {
 	var path = cfg.LogPath
 
@@ -0,0 +1,353 @@
+package ethmsg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+Ethereum off-chain message
+
+EIP-191 personal_sign
+  keccak256("\x19Ethereum Signed Message:\n" || len(message) || message)
+EIP-712 eth_signTypedData_v4
+  keccak256(0x19 || 0x01 || hashStruct(EIP712Domain, domain) || hashStruct(primaryType, message))
+  hashStruct(type, data) = keccak256(typeHash || encodeData(type, data)), arrays are keccak256 of concatenated element encodings
+
+signature is returned as wallets do, [R || S || V] with V 27 or 28
+*/
+
+const domainType = "EIP712Domain"
+
+// PersonalHash
+// EIP-191 version 0x45 digest of message
+func PersonalHash(message []byte) common.Hash {
+	prefix := "\x19Ethereum Signed Message:\n" + strconv.Itoa(len(message))
+	return crypto.Keccak256Hash([]byte(prefix), message)
+}
+
+type TypedDataField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type TypedData struct {
+	Types       map[string][]TypedDataField `json:"types"`
+	PrimaryType string                      `json:"primaryType"`
+	Domain      map[string]interface{}      `json:"domain"`
+	Message     map[string]interface{}      `json:"message"`
+}
+
+// DecodeTypedData
+// eth_signTypedData_v4 JSON, numbers are kept as json.Number to keep uint256 precision
+func DecodeTypedData(data []byte) (*TypedData, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var td TypedData
+	if e := decoder.Decode(&td); e != nil {
+		return nil, fmt.Errorf("invalid typed data : %s", e.Error())
+	}
+
+	if _, found := td.Types[domainType]; !found {
+		return nil, errors.New("typed data must define " + domainType + " type")
+	}
+	if _, found := td.Types[td.PrimaryType]; !found {
+		return nil, fmt.Errorf("primary type %s is not defined", td.PrimaryType)
+	}
+	if td.Domain == nil || td.Message == nil {
+		return nil, errors.New("typed data must have domain and message")
+	}
+
+	return &td, nil
+}
+
+// Hash
+// EIP-712 digest to sign
+func (td *TypedData) Hash() (common.Hash, error) {
+	domainSeparator, e := td.HashStruct(domainType, td.Domain)
+	if e != nil {
+		return common.Hash{}, e
+	}
+
+	messageHash, e := td.HashStruct(td.PrimaryType, td.Message)
+	if e != nil {
+		return common.Hash{}, e
+	}
+
+	return crypto.Keccak256Hash([]byte{0x19, 0x01}, domainSeparator.Bytes(), messageHash.Bytes()), nil
+}
+
+// HashStruct
+// keccak256(typeHash || encodeData)
+func (td *TypedData) HashStruct(structType string, data map[string]interface{}) (common.Hash, error) {
+	encoded, e := td.encodeData(structType, data)
+	if e != nil {
+		return common.Hash{}, e
+	}
+	return crypto.Keccak256Hash(encoded), nil
+}
+
+// EncodeType
+// "Type(type1 name1,...)" of structType followed by referenced types in alphabetical order
+func (td *TypedData) EncodeType(structType string) (string, error) {
+	deps := make(map[string]bool)
+	if e := td.dependencies(structType, deps); e != nil {
+		return "", e
+	}
+	delete(deps, structType)
+
+	referenced := make([]string, 0, len(deps))
+	for dep := range deps {
+		referenced = append(referenced, dep)
+	}
+	sort.Strings(referenced)
+
+	var buffer strings.Builder
+	for _, t := range append([]string{structType}, referenced...) {
+		buffer.WriteString(t + "(")
+		for i, field := range td.Types[t] {
+			if i > 0 {
+				buffer.WriteString(",")
+			}
+			buffer.WriteString(field.Type + " " + field.Name)
+		}
+		buffer.WriteString(")")
+	}
+
+	return buffer.String(), nil
+}
+
+func (td *TypedData) dependencies(structType string, found map[string]bool) error {
+	if found[structType] {
+		return nil
+	}
+
+	fields, ok := td.Types[structType]
+	if !ok {
+		return fmt.Errorf("type %s is not defined", structType)
+	}
+	found[structType] = true
+
+	for _, field := range fields {
+		baseType := field.Type
+		if i := strings.Index(baseType, "["); i >= 0 {
+			baseType = baseType[:i]
+		}
+		if _, isStruct := td.Types[baseType]; isStruct {
+			if e := td.dependencies(baseType, found); e != nil {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+func (td *TypedData) encodeData(structType string, data map[string]interface{}) ([]byte, error) {
+	encodedType, e := td.EncodeType(structType)
+	if e != nil {
+		return nil, e
+	}
+
+	fields := td.Types[structType]
+	if len(data) > len(fields) {
+		return nil, fmt.Errorf("%s has undefined fields", structType)
+	}
+
+	encoded := crypto.Keccak256([]byte(encodedType))
+	for _, field := range fields {
+		value, found := data[field.Name]
+		if !found {
+			return nil, fmt.Errorf("%s.%s is missing", structType, field.Name)
+		}
+
+		encodedValue, e := td.encodeValue(field.Type, value)
+		if e != nil {
+			return nil, fmt.Errorf("%s.%s : %s", structType, field.Name, e.Error())
+		}
+		encoded = append(encoded, encodedValue...)
+	}
+
+	return encoded, nil
+}
+
+// encodeValue
+// 32 bytes encoding of value, dynamic and reference types are hashed
+func (td *TypedData) encodeValue(valueType string, value interface{}) ([]byte, error) {
+	// array
+	if strings.HasSuffix(valueType, "]") {
+		i := strings.LastIndex(valueType, "[")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid type %s", valueType)
+		}
+
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s value must be array", valueType)
+		}
+
+		if size := valueType[i+1 : len(valueType)-1]; size != "" {
+			length, e := strconv.Atoi(size)
+			if e != nil || length != len(items) {
+				return nil, fmt.Errorf("%s value must have %s items", valueType, size)
+			}
+		}
+
+		encoded := make([]byte, 0, 32*len(items))
+		for _, item := range items {
+			encodedItem, e := td.encodeValue(valueType[:i], item)
+			if e != nil {
+				return nil, e
+			}
+			encoded = append(encoded, encodedItem...)
+		}
+		return crypto.Keccak256(encoded), nil
+	}
+
+	// struct
+	if _, isStruct := td.Types[valueType]; isStruct {
+		data, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s value must be object", valueType)
+		}
+		hash, e := td.HashStruct(valueType, data)
+		return hash.Bytes(), e
+	}
+
+	switch valueType {
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return nil, errors.New("string value must be string")
+		}
+		return crypto.Keccak256([]byte(s)), nil
+
+	case "bytes":
+		b, e := decodeHex(value)
+		if e != nil {
+			return nil, e
+		}
+		return crypto.Keccak256(b), nil
+
+	case "bool":
+		b, ok := value.(bool)
+		if !ok {
+			return nil, errors.New("bool value must be boolean")
+		}
+		if b {
+			return math.PaddedBigBytes(big.NewInt(1), 32), nil
+		}
+		return make([]byte, 32), nil
+
+	case "address":
+		s, ok := value.(string)
+		if !ok || !common.IsHexAddress(s) {
+			return nil, errors.New("address value must be hex address")
+		}
+		return common.HexToAddress(s).Hash().Bytes(), nil
+	}
+
+	if strings.HasPrefix(valueType, "bytes") {
+		size, e := strconv.Atoi(valueType[len("bytes"):])
+		if e != nil || size < 1 || size > 32 {
+			return nil, fmt.Errorf("invalid type %s", valueType)
+		}
+
+		b, e := decodeHex(value)
+		if e != nil {
+			return nil, e
+		}
+		if len(b) != size {
+			return nil, fmt.Errorf("%s value must be %d bytes", valueType, size)
+		}
+		return common.RightPadBytes(b, 32), nil
+	}
+
+	if strings.HasPrefix(valueType, "uint") || strings.HasPrefix(valueType, "int") {
+		return encodeInteger(valueType, value)
+	}
+
+	return nil, fmt.Errorf("type %s is not defined", valueType)
+}
+
+func encodeInteger(valueType string, value interface{}) ([]byte, error) {
+	signed := strings.HasPrefix(valueType, "int")
+
+	size, e := strconv.Atoi(strings.TrimPrefix(strings.TrimPrefix(valueType, "u"), "int"))
+	if e != nil || size < 8 || size > 256 || size%8 != 0 {
+		return nil, fmt.Errorf("invalid type %s", valueType)
+	}
+
+	var n *big.Int
+	switch v := value.(type) {
+	case json.Number:
+		n, _ = new(big.Int).SetString(string(v), 10)
+	case string:
+		if strings.HasPrefix(v, "0x") || strings.HasPrefix(v, "0X") {
+			n, _ = new(big.Int).SetString(v[2:], 16)
+		} else {
+			n, _ = new(big.Int).SetString(v, 10)
+		}
+	case float64:
+		if v == float64(int64(v)) {
+			n = big.NewInt(int64(v))
+		}
+	}
+	if n == nil {
+		return nil, fmt.Errorf("%s value must be integer", valueType)
+	}
+
+	// range of intN / uintN
+	min, max := new(big.Int), new(big.Int).Lsh(big.NewInt(1), uint(size))
+	if signed {
+		max.Rsh(max, 1)
+		min.Neg(max)
+	}
+	if n.Cmp(min) < 0 || n.Cmp(max) >= 0 {
+		return nil, fmt.Errorf("%s value out of range", valueType)
+	}
+
+	// two's complement
+	return math.PaddedBigBytes(math.U256(n), 32), nil
+}
+
+func decodeHex(value interface{}) ([]byte, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, errors.New("bytes value must be hex string")
+	}
+	b, e := hexutil.Decode(s)
+	if e != nil {
+		return nil, fmt.Errorf("bytes value must be hex string : %s", e.Error())
+	}
+	return b, nil
+}
+
+// Signature
+// wallet form signature of hash from [R || S || V] signature with V 0 or 1, and its recovered signer
+func Signature(hash common.Hash, signature []byte) ([]byte, common.Address, error) {
+	if len(signature) != 65 || signature[64] > 1 {
+		return nil, common.Address{}, errors.New("signature must be [R || S || V] with V 0 or 1")
+	}
+
+	publicKey, e := crypto.SigToPub(hash.Bytes(), signature)
+	if e != nil {
+		return nil, common.Address{}, e
+	}
+
+	walletSignature := make([]byte, 65)
+	copy(walletSignature, signature)
+	walletSignature[64] += 27
+
+	return walletSignature, crypto.PubkeyToAddress(*publicKey), nil
+}
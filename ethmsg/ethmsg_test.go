@@ -0,0 +1,203 @@
+package ethmsg_test
+
+import (
+	"encoding/hex"
+	"github.com/colligence-io/signServer/ethmsg"
+	"github.com/ethereum/go-ethereum/crypto"
+	"strings"
+	"testing"
+)
+
+// example of EIP-712, signed by keccak256("cow")
+const mailTypedData = `{
+	"types": {
+		"EIP712Domain": [{"name": "name", "type": "string"}, {"name": "version", "type": "string"}, {"name": "chainId", "type": "uint256"}, {"name": "verifyingContract", "type": "address"}],
+		"Person": [{"name": "name", "type": "string"}, {"name": "wallet", "type": "address"}],
+		"Mail": [{"name": "from", "type": "Person"}, {"name": "to", "type": "Person"}, {"name": "contents", "type": "string"}]
+	},
+	"primaryType": "Mail",
+	"domain": {"name": "Ether Mail", "version": "1", "chainId": 1, "verifyingContract": "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"},
+	"message": {
+		"from": {"name": "Cow", "wallet": "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"},
+		"to": {"name": "Bob", "wallet": "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"},
+		"contents": "Hello, Bob!"
+	}
+}`
+
+// v4 arrays, signed integer, bytes and bytesN
+const arrayTypedData = `{
+	"types": {
+		"EIP712Domain": [{"name": "name", "type": "string"}, {"name": "version", "type": "string"}, {"name": "chainId", "type": "uint256"}, {"name": "verifyingContract", "type": "address"}, {"name": "salt", "type": "bytes32"}],
+		"Person": [{"name": "name", "type": "string"}, {"name": "wallets", "type": "address[]"}],
+		"Mail": [{"name": "from", "type": "Person"}, {"name": "to", "type": "Person[]"}, {"name": "contents", "type": "string"}, {"name": "amount", "type": "uint256"}, {"name": "delta", "type": "int64"}, {"name": "urgent", "type": "bool"}, {"name": "attachment", "type": "bytes"}, {"name": "tags", "type": "bytes4[2]"}, {"name": "matrix", "type": "uint8[][]"}]
+	},
+	"primaryType": "Mail",
+	"domain": {"name": "Ether Mail", "version": "1", "chainId": 5, "verifyingContract": "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC", "salt": "0x0101010101010101010101010101010101010101010101010101010101010101"},
+	"message": {
+		"from": {"name": "Cow", "wallets": ["0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826", "0xDeaDbeefdEAdbeefdEadbEEFdeadbeEFdEaDbeeF"]},
+		"to": [{"name": "Bob", "wallets": ["0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB", "0xB0BdaBea57B0BDABeA57b0bdABEA57b0BDabEa57", "0xB0B0b0b0b0b0B000000000000000000000000000"]}],
+		"contents": "Hello, Bob!",
+		"amount": "0xde0b6b3a7640000",
+		"delta": -42,
+		"urgent": true,
+		"attachment": "0xdeadbeef",
+		"tags": ["0x01020304", "0xaabbccdd"],
+		"matrix": [[1, 2], [3]]
+	}
+}`
+
+var typedDataVectors = []struct {
+	name       string
+	typedData  string
+	privateKey string
+	encodeType string
+	domain     string
+	hash       string
+	signature  string
+	address    string
+}{
+	{
+		name:       "mail",
+		typedData:  mailTypedData,
+		privateKey: "c85ef7d79691fe79573b1a7064c19c1a9819ebdbd1faaab1a8ec92344438aaf4",
+		encodeType: "Mail(Person from,Person to,string contents)Person(string name,address wallet)",
+		domain:     "f2cee375fa42b42143804025fc449deafd50cc031ca257e0b194a650a912090f",
+		hash:       "be609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2",
+		signature:  "4355c47d63924e8a72e509b65029052eb6c299d53a04e167c5775fd466751c9d07299936d304c153f6443dfa05f40ff007d72911b6f72307f996231605b915621c",
+		address:    "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826",
+	},
+	{
+		name:       "arrays",
+		typedData:  arrayTypedData,
+		privateKey: "4646464646464646464646464646464646464646464646464646464646464646",
+		encodeType: "Mail(Person from,Person[] to,string contents,uint256 amount,int64 delta,bool urgent,bytes attachment,bytes4[2] tags,uint8[][] matrix)Person(string name,address[] wallets)",
+		domain:     "4d61ff4ecb361571fb2f61e421982811c76554f9105148f53b43c15ce68c9233",
+		hash:       "fe580bf900bbb9eb3ede684b12b690827ac2d83f9a51b98ed54d5f46c762e0f4",
+		signature:  "44305b61a824f256e1333cc9da9f1432fbdb12ccd7ed28bcda5aef52eb9eccfc12e4c85deea819b28b77f4a16dab7bb437db4b2356cd2ac7d79fa734409bf4bd1b",
+		address:    "0x9d8A62f656a8d1615C1294fd71e9CFb3E4855A4F",
+	},
+}
+
+func TestTypedData(t *testing.T) {
+	for _, v := range typedDataVectors {
+		td, err := ethmsg.DecodeTypedData([]byte(v.typedData))
+		if err != nil {
+			t.Fatal("ER : DecodeTypedData", v.name, ":", err)
+		}
+
+		encodeType, err := td.EncodeType(td.PrimaryType)
+		if err != nil || encodeType != v.encodeType {
+			t.Error("ER : EncodeType", v.name, ":", encodeType, err)
+		}
+
+		domain, err := td.HashStruct("EIP712Domain", td.Domain)
+		if err != nil || hex.EncodeToString(domain.Bytes()) != v.domain {
+			t.Error("ER : domain separator", v.name, ":", domain.Hex(), err)
+		}
+
+		hash, err := td.Hash()
+		if err != nil {
+			t.Fatal("ER : Hash", v.name, ":", err)
+		}
+		if hex.EncodeToString(hash.Bytes()) != v.hash {
+			t.Error("ER : Hash", v.name, ":", hash.Hex())
+		}
+
+		checkSignature(t, v.name, v.privateKey, hash.Bytes(), v.signature, v.address)
+	}
+}
+
+func TestPersonalHash(t *testing.T) {
+	hash := ethmsg.PersonalHash([]byte("hello signServer"))
+	if hex.EncodeToString(hash.Bytes()) != "bb1f47d8be4b4389846f053e87984d68e2a19cb725522e9d3327e104dabbfe84" {
+		t.Error("ER : PersonalHash", hash.Hex())
+	}
+
+	checkSignature(t, "personal", "4646464646464646464646464646464646464646464646464646464646464646", hash.Bytes(),
+		"9defecd144e5f0b73edf65b8479d7749642d75c37a4b3503049d15621a8689f077ea8377a983c25e48953b29dafd883380bc5261e128da8ae68b87384c12d91b1b",
+		"0x9d8A62f656a8d1615C1294fd71e9CFb3E4855A4F")
+}
+
+func checkSignature(t *testing.T, name string, privateKeyHex string, hash []byte, expectedSignature string, expectedAddress string) {
+	privateKey, err := crypto.HexToECDSA(privateKeyHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsv, err := crypto.Sign(hash, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var h [32]byte
+	copy(h[:], hash)
+	signature, address, err := ethmsg.Signature(h, rsv)
+	if err != nil {
+		t.Fatal("ER : Signature", name, ":", err)
+	}
+
+	if hex.EncodeToString(signature) != expectedSignature {
+		t.Error("ER : signature", name, ":", hex.EncodeToString(signature))
+	}
+	if !strings.EqualFold(address.Hex(), expectedAddress) {
+		t.Error("ER : recovered address", name, ":", address.Hex())
+	}
+}
+
+func TestTypedDataInvalid(t *testing.T) {
+	invalid := map[string]string{
+		"uint8 overflow":    `"matrix": [[256]]`,
+		"int64 underflow":   `"delta": -9223372036854775809`,
+		"fixed array size":  `"tags": ["0x01020304"]`,
+		"bytes4 size":       `"tags": ["0x010203", "0xaabbccdd"]`,
+		"address":           `"from": {"name": "Cow", "wallets": ["0x1234"]}`,
+		"bool type":         `"urgent": "true"`,
+		"fractional number": `"delta": 1.5`,
+		"undefined field":   `"contents": "Hello, Bob!", "extra": 1`,
+	}
+
+	for name, replacement := range invalid {
+		field := replacement[:strings.Index(replacement, ":")]
+		data := replaceField(arrayTypedData, field, replacement)
+
+		td, err := ethmsg.DecodeTypedData([]byte(data))
+		if err != nil {
+			continue
+		}
+		if _, err := td.Hash(); err == nil {
+			t.Error("ER : invalid typed data accepted :", name)
+		}
+	}
+
+	if _, err := ethmsg.DecodeTypedData([]byte(`{"types": {"Mail": []}, "primaryType": "Mail", "domain": {}, "message": {}}`)); err == nil {
+		t.Error("ER : typed data without EIP712Domain accepted")
+	}
+
+	missing := strings.Replace(mailTypedData, `"contents": "Hello, Bob!"`, `"contents2": "Hello, Bob!"`, 1)
+	td, _ := ethmsg.DecodeTypedData([]byte(missing))
+	if _, err := td.Hash(); err == nil {
+		t.Error("ER : missing field accepted")
+	}
+
+	var hash [32]byte
+	if _, _, err := ethmsg.Signature(hash, make([]byte, 64)); err == nil {
+		t.Error("ER : 64 byte signature accepted")
+	}
+}
+
+// replaceField
+// replace line of message field in arrayTypedData
+func replaceField(data string, field string, replacement string) string {
+	lines := strings.Split(data, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), field+":") {
+			suffix := ""
+			if strings.HasSuffix(line, ",") {
+				suffix = ","
+			}
+			lines[i] = "\t\t" + replacement + suffix
+			return strings.Join(lines, "\n")
+		}
+	}
+	return data
+}
@@ -0,0 +1,314 @@
+package ethtx
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"math/big"
+)
+
+/*
+Unsigned ethereum transaction
+
+encoded here with go-ethereum rlp, EIP-1559 is not supported by go-ethereum in use
+(and core/types drags database dependencies into signServer)
+
+legacy with EIP-155 replay protection
+  signing : rlp([nonce, gasPrice, gas, to, value, data, chainId, 0, 0])
+  signed  : rlp([nonce, gasPrice, gas, to, value, data, chainId*2+35+recid, r, s])
+EIP-1559 (type 0x02)
+  signing : 0x02 || rlp([chainId, nonce, maxPriorityFeePerGas, maxFeePerGas, gas, to, value, data, accessList])
+  signed  : 0x02 || rlp([chainId, nonce, maxPriorityFeePerGas, maxFeePerGas, gas, to, value, data, accessList, yParity, r, s])
+*/
+
+const (
+	LegacyTxType     byte = 0x00
+	DynamicFeeTxType byte = 0x02
+)
+
+var ErrUnsupportedTxType = errors.New("transaction type is not supported")
+
+type AccessTuple struct {
+	Address     common.Address
+	StorageKeys []common.Hash
+}
+
+type Transaction struct {
+	Type    byte
+	ChainID *big.Int
+	Nonce   uint64
+	// legacy only
+	GasPrice *big.Int
+	// EIP-1559 only
+	MaxPriorityFeePerGas *big.Int
+	MaxFeePerGas         *big.Int
+	Gas                  uint64
+	// nil for contract creation
+	To         *common.Address
+	Value      *big.Int
+	Data       []byte
+	AccessList []AccessTuple
+}
+
+// legacyUnsigned
+// [nonce, gasPrice, gas, to, value, data] or EIP-155 signing form [..., chainId, 0, 0]
+type legacyUnsigned struct {
+	Nonce    uint64
+	GasPrice *big.Int
+	Gas      uint64
+	To       []byte
+	Value    *big.Int
+	Data     []byte
+	Tail     []rlp.RawValue `rlp:"tail"`
+}
+
+type legacyFields struct {
+	Nonce    uint64
+	GasPrice *big.Int
+	Gas      uint64
+	To       []byte
+	Value    *big.Int
+	Data     []byte
+	V        *big.Int
+	R        *big.Int
+	S        *big.Int
+}
+
+type dynamicFeeUnsigned struct {
+	ChainID              *big.Int
+	Nonce                uint64
+	MaxPriorityFeePerGas *big.Int
+	MaxFeePerGas         *big.Int
+	Gas                  uint64
+	To                   []byte
+	Value                *big.Int
+	Data                 []byte
+	AccessList           []AccessTuple
+}
+
+type dynamicFeeSigned struct {
+	ChainID              *big.Int
+	Nonce                uint64
+	MaxPriorityFeePerGas *big.Int
+	MaxFeePerGas         *big.Int
+	Gas                  uint64
+	To                   []byte
+	Value                *big.Int
+	Data                 []byte
+	AccessList           []AccessTuple
+	V                    *big.Int
+	R                    *big.Int
+	S                    *big.Int
+}
+
+// Decode
+// unsigned legacy or EIP-1559 transaction, transaction must be for chainID
+func Decode(raw []byte, chainID *big.Int) (*Transaction, error) {
+	if chainID == nil || chainID.Sign() <= 0 {
+		return nil, errors.New("chain ID must be positive")
+	}
+
+	if len(raw) == 0 {
+		return nil, errors.New("transaction is empty")
+	}
+
+	// legacy transaction is rlp list, typed transaction starts with type byte
+	if raw[0] >= 0xc0 {
+		return decodeLegacy(raw, chainID)
+	}
+
+	if raw[0] == DynamicFeeTxType {
+		return decodeDynamicFee(raw[1:], chainID)
+	}
+
+	return nil, ErrUnsupportedTxType
+}
+
+func decodeLegacy(raw []byte, chainID *big.Int) (*Transaction, error) {
+	var unsigned legacyUnsigned
+	if e := rlp.DecodeBytes(raw, &unsigned); e != nil {
+		return nil, fmt.Errorf("invalid legacy transaction : %s", e.Error())
+	}
+
+	switch len(unsigned.Tail) {
+	case 0:
+	case 3:
+		var txChainID, r, s big.Int
+		for i, v := range []*big.Int{&txChainID, &r, &s} {
+			if e := rlp.DecodeBytes(unsigned.Tail[i], v); e != nil {
+				return nil, fmt.Errorf("invalid legacy transaction : %s", e.Error())
+			}
+		}
+		if txChainID.Cmp(chainID) != 0 || r.Sign() != 0 || s.Sign() != 0 {
+			return nil, errors.New("legacy transaction is not EIP-155 signing form of chain ID")
+		}
+	default:
+		return nil, errors.New("legacy transaction must have 6 or 9 fields")
+	}
+
+	to, e := decodeTo(unsigned.To)
+	if e != nil {
+		return nil, e
+	}
+
+	return &Transaction{
+		Type:     LegacyTxType,
+		ChainID:  chainID,
+		Nonce:    unsigned.Nonce,
+		GasPrice: unsigned.GasPrice,
+		Gas:      unsigned.Gas,
+		To:       to,
+		Value:    unsigned.Value,
+		Data:     unsigned.Data,
+	}, nil
+}
+
+func decodeDynamicFee(payload []byte, chainID *big.Int) (*Transaction, error) {
+	var unsigned dynamicFeeUnsigned
+	if e := rlp.DecodeBytes(payload, &unsigned); e != nil {
+		return nil, fmt.Errorf("invalid EIP-1559 transaction : %s", e.Error())
+	}
+
+	if unsigned.ChainID.Cmp(chainID) != 0 {
+		return nil, fmt.Errorf("EIP-1559 transaction chain ID %s is not %s", unsigned.ChainID, chainID)
+	}
+
+	to, e := decodeTo(unsigned.To)
+	if e != nil {
+		return nil, e
+	}
+
+	return &Transaction{
+		Type:                 DynamicFeeTxType,
+		ChainID:              chainID,
+		Nonce:                unsigned.Nonce,
+		MaxPriorityFeePerGas: unsigned.MaxPriorityFeePerGas,
+		MaxFeePerGas:         unsigned.MaxFeePerGas,
+		Gas:                  unsigned.Gas,
+		To:                   to,
+		Value:                unsigned.Value,
+		Data:                 unsigned.Data,
+		AccessList:           unsigned.AccessList,
+	}, nil
+}
+
+func decodeTo(to []byte) (*common.Address, error) {
+	switch len(to) {
+	case 0:
+		return nil, nil
+	case common.AddressLength:
+		address := common.BytesToAddress(to)
+		return &address, nil
+	default:
+		return nil, errors.New("transaction recipient must be 20 bytes or empty")
+	}
+}
+
+// SigningHash
+// digest to sign
+func (tx *Transaction) SigningHash() (common.Hash, error) {
+	var unsigned []byte
+	var e error
+
+	if tx.Type == LegacyTxType {
+		// EIP-155 : chainId, 0, 0 in place of v, r, s
+		unsigned, e = rlp.EncodeToBytes(tx.legacy(tx.ChainID, new(big.Int), new(big.Int)))
+	} else {
+		unsigned, e = rlp.EncodeToBytes(tx.dynamicFee())
+		unsigned = append([]byte{DynamicFeeTxType}, unsigned...)
+	}
+
+	if e != nil {
+		return common.Hash{}, e
+	}
+
+	return crypto.Keccak256Hash(unsigned), nil
+}
+
+// Sign
+// signed raw transaction and its hash from [R || S || V] signature of SigningHash, V is 0 or 1
+// V is normalized to chainId*2+35+V for legacy, yParity for EIP-1559
+func (tx *Transaction) Sign(signature []byte) ([]byte, common.Hash, error) {
+	if len(signature) != 65 || signature[64] > 1 {
+		return nil, common.Hash{}, errors.New("signature must be [R || S || V] with V 0 or 1")
+	}
+
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:64])
+
+	var raw []byte
+	var e error
+
+	if tx.Type == LegacyTxType {
+		v := new(big.Int).Mul(tx.ChainID, big.NewInt(2))
+		v.Add(v, big.NewInt(35+int64(signature[64])))
+
+		raw, e = rlp.EncodeToBytes(tx.legacy(v, r, s))
+	} else {
+		unsigned := tx.dynamicFee()
+
+		raw, e = rlp.EncodeToBytes(dynamicFeeSigned{
+			ChainID:              unsigned.ChainID,
+			Nonce:                unsigned.Nonce,
+			MaxPriorityFeePerGas: unsigned.MaxPriorityFeePerGas,
+			MaxFeePerGas:         unsigned.MaxFeePerGas,
+			Gas:                  unsigned.Gas,
+			To:                   unsigned.To,
+			Value:                unsigned.Value,
+			Data:                 unsigned.Data,
+			AccessList:           unsigned.AccessList,
+			V:                    new(big.Int).SetUint64(uint64(signature[64])),
+			R:                    r,
+			S:                    s,
+		})
+		raw = append([]byte{DynamicFeeTxType}, raw...)
+	}
+
+	if e != nil {
+		return nil, common.Hash{}, e
+	}
+
+	return raw, crypto.Keccak256Hash(raw), nil
+}
+
+func (tx *Transaction) to() []byte {
+	if tx.To == nil {
+		return []byte{}
+	}
+	return tx.To.Bytes()
+}
+
+func (tx *Transaction) legacy(v *big.Int, r *big.Int, s *big.Int) legacyFields {
+	return legacyFields{
+		Nonce:    tx.Nonce,
+		GasPrice: tx.GasPrice,
+		Gas:      tx.Gas,
+		To:       tx.to(),
+		Value:    tx.Value,
+		Data:     tx.Data,
+		V:        v,
+		R:        r,
+		S:        s,
+	}
+}
+
+func (tx *Transaction) dynamicFee() dynamicFeeUnsigned {
+	accessList := tx.AccessList
+	if accessList == nil {
+		accessList = []AccessTuple{}
+	}
+
+	return dynamicFeeUnsigned{
+		ChainID:              tx.ChainID,
+		Nonce:                tx.Nonce,
+		MaxPriorityFeePerGas: tx.MaxPriorityFeePerGas,
+		MaxFeePerGas:         tx.MaxFeePerGas,
+		Gas:                  tx.Gas,
+		To:                   tx.to(),
+		Value:                tx.Value,
+		Data:                 tx.Data,
+		AccessList:           accessList,
+	}
+}
@@ -0,0 +1,131 @@
+package ethtx_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/colligence-io/signServer/ethtx"
+	"github.com/ethereum/go-ethereum/crypto"
+	"math/big"
+	"testing"
+)
+
+// private key of EIP-155 example
+const testPrivateKey = "4646464646464646464646464646464646464646464646464646464646464646"
+
+var vectors = []struct {
+	name     string
+	chainID  int64
+	unsigned string
+	sigHash  string
+	signed   string
+	txHash   string
+}{
+	{
+		// EIP-155 example, 9 field signing form
+		name:     "legacy eip155",
+		chainID:  1,
+		unsigned: "ec098504a817c800825208943535353535353535353535353535353535353535880de0b6b3a764000080018080",
+		sigHash:  "daf5a779ae972f972197303d7b574746c7ef83eadac0f2791ad23db92e4c8e53",
+		signed:   "f86c098504a817c800825208943535353535353535353535353535353535353535880de0b6b3a76400008025a028ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa636276a067cbe9d8997f761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d83",
+		txHash:   "33469b22e9f636356c4160a87eb19df52b7412e8eac32a4a55ffe88ea8350788",
+	},
+	{
+		// EIP-155 example, 6 field form
+		name:     "legacy",
+		chainID:  1,
+		unsigned: "e9098504a817c800825208943535353535353535353535353535353535353535880de0b6b3a764000080",
+		sigHash:  "daf5a779ae972f972197303d7b574746c7ef83eadac0f2791ad23db92e4c8e53",
+		signed:   "f86c098504a817c800825208943535353535353535353535353535353535353535880de0b6b3a76400008025a028ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa636276a067cbe9d8997f761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d83",
+		txHash:   "33469b22e9f636356c4160a87eb19df52b7412e8eac32a4a55ffe88ea8350788",
+	},
+	{
+		name:     "eip1559 access list",
+		chainID:  5,
+		unsigned: "02f88a052a847735940085174876e80082c35094353535353535353535353535353535353535353582303984a9059cbbf85bf85994de0b295669a9fd93d5f28d9ec85e40f4cb697baef842a00000000000000000000000000000000000000000000000000000000000000003a00000000000000000000000000000000000000000000000000000000000000007",
+		sigHash:  "663a3c441baecc91f8d4a2d183312ac13b6bab0dd432182eb56f25de29f96585",
+		signed:   "02f8cd052a847735940085174876e80082c35094353535353535353535353535353535353535353582303984a9059cbbf85bf85994de0b295669a9fd93d5f28d9ec85e40f4cb697baef842a00000000000000000000000000000000000000000000000000000000000000003a0000000000000000000000000000000000000000000000000000000000000000780a0d2143f2c6533390e6b55d75bf8c48dfd71958a825f7c4d0989d84624bcdc9f5ca03e8c442390bdb7810c4b8bfeebf21d9aae68a7c7ac1372031c561f94845a5c2a",
+		txHash:   "24a0981b9d7d20a1d2f2f2c2c2e2b57c7823171716a2f658a134a03d6e9f218e",
+	},
+	{
+		name:     "eip1559 contract creation",
+		chainID:  1,
+		unsigned: "02cd0180010282cf088080826080c0",
+		signed:   "02f8500180010282cf088080826080c001a029a6dd1bca5339c09f8ed8e7d77400b4afb3b73f770246b2edd65dc6c27ce380a00d2cee704059ec7e9502847ccefa1cd78502ddc991527c7e5c80374ee782d116",
+		txHash:   "a359ee224f76093cdba2169f8ef893eb7c4dbea2e862145129dd3304c866b3c7",
+	},
+}
+
+func TestSignVectors(t *testing.T) {
+	privateKey, err := crypto.HexToECDSA(testPrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range vectors {
+		unsigned, _ := hex.DecodeString(v.unsigned)
+
+		tx, err := ethtx.Decode(unsigned, big.NewInt(v.chainID))
+		if err != nil {
+			t.Error("ER : Decode", v.name, ":", err)
+			continue
+		}
+
+		sigHash, err := tx.SigningHash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.sigHash != "" && hex.EncodeToString(sigHash.Bytes()) != v.sigHash {
+			t.Error("ER : SigningHash", v.name, ":", sigHash.Hex())
+		}
+
+		signature, err := crypto.Sign(sigHash.Bytes(), privateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		raw, txHash, err := tx.Sign(signature)
+		if err != nil {
+			t.Error("ER : Sign", v.name, ":", err)
+			continue
+		}
+
+		if hex.EncodeToString(raw) != v.signed {
+			t.Error("ER : signed transaction", v.name, ":", hex.EncodeToString(raw))
+		}
+		if hex.EncodeToString(txHash.Bytes()) != v.txHash {
+			t.Error("ER : transaction hash", v.name, ":", txHash.Hex())
+		}
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	legacy155, _ := hex.DecodeString(vectors[0].unsigned)
+	dynamicFee, _ := hex.DecodeString(vectors[2].unsigned)
+
+	if _, err := ethtx.Decode(legacy155, big.NewInt(3)); err == nil {
+		t.Error("ER : legacy transaction of other chain accepted")
+	}
+	if _, err := ethtx.Decode(dynamicFee, big.NewInt(1)); err == nil {
+		t.Error("ER : EIP-1559 transaction of other chain accepted")
+	}
+	if _, err := ethtx.Decode(legacy155, big.NewInt(0)); err == nil {
+		t.Error("ER : zero chain ID accepted")
+	}
+	if _, err := ethtx.Decode(append([]byte{0x01}, dynamicFee[1:]...), big.NewInt(5)); err != ethtx.ErrUnsupportedTxType {
+		t.Error("ER : EIP-2930 transaction accepted", err)
+	}
+	if _, err := ethtx.Decode(append(append([]byte{}, dynamicFee...), 0x80), big.NewInt(5)); err == nil {
+		t.Error("ER : trailing data accepted")
+	}
+
+	// signed legacy transaction is not unsigned signing form
+	signed, _ := hex.DecodeString(vectors[0].signed)
+	if _, err := ethtx.Decode(signed, big.NewInt(1)); err == nil {
+		t.Error("ER : signed transaction accepted")
+	}
+
+	tx, _ := ethtx.Decode(dynamicFee, big.NewInt(5))
+	if _, _, err := tx.Sign(bytes.Repeat([]byte{1}, 64)); err == nil {
+		t.Error("ER : 64 byte signature accepted")
+	}
+}
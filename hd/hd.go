@@ -229,18 +229,30 @@ func FromBIP32ExtendedKey(data string) (*Wallet, error) {
 //	return ByteCheck(base58.Decode(key))
 //}
 
+// networks of accepted extended key version bytes (signet uses testnet3 version bytes)
+var hdNetworks = []*chaincfg.Params{
+	&chaincfg.MainNetParams,
+	&chaincfg.TestNet3Params,
+	&chaincfg.RegressionNetParams,
+}
+
 func ByteCheck(dbin []byte) error {
 	// check proper length
 	if len(dbin) != 82 {
 		return errors.New("invalid string")
 	}
 	// check for correct Public or Private vbytes
-	if bytes.Compare(dbin[:4], chaincfg.MainNetParams.HDPublicKeyID[:]) != 0 && bytes.Compare(dbin[:4], chaincfg.MainNetParams.HDPrivateKeyID[:]) != 0 && bytes.Compare(dbin[:4], chaincfg.TestNet3Params.HDPublicKeyID[:]) != 0 && bytes.Compare(dbin[:4], chaincfg.TestNet3Params.HDPrivateKeyID[:]) != 0 {
+	isPublic, isPrivate := false, false
+	for _, net := range hdNetworks {
+		isPublic = isPublic || bytes.Compare(dbin[:4], net.HDPublicKeyID[:]) == 0
+		isPrivate = isPrivate || bytes.Compare(dbin[:4], net.HDPrivateKeyID[:]) == 0
+	}
+	if !isPublic && !isPrivate {
 		return errors.New("invalid string")
 	}
 	// if Public, check x coord is on curve
 	x, y := expand(dbin[45:78])
-	if bytes.Compare(dbin[:4], chaincfg.MainNetParams.HDPublicKeyID[:]) == 0 || bytes.Compare(dbin[:4], chaincfg.TestNet3Params.HDPublicKeyID[:]) == 0 {
+	if isPublic {
 		if !onCurve(x, y) {
 			return errors.New("invalid string")
 		}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"github.com/colligence-io/signServer/audit"
 	"github.com/colligence-io/signServer/config"
+	"github.com/colligence-io/signServer/trustSigner"
 	"github.com/colligence-io/signServer/util"
 	"github.com/colligence-io/signServer/vault"
 	"github.com/colligence-io/signServer/whitebox"
@@ -21,6 +23,11 @@ const (
 	MODE_KEYPAIR_LIST    Mode = "kplist"
 	MODE_KEYPAIR_BACKUP  Mode = "kpbackup"
 	MODE_KEYPAIR_RECOVER Mode = "kprecover"
+	MODE_DEPOSIT         Mode = "deposit"
+	MODE_KEYPAIR_EXPORT  Mode = "kpexport"
+	MODE_MESSAGE_SIGN    Mode = "msgsign"
+	MODE_MESSAGE_VERIFY  Mode = "msgverify"
+	MODE_AUDIT_VERIFY    Mode = "auditverify"
 )
 
 var Modes = map[string]Mode{
@@ -32,6 +39,19 @@ var Modes = map[string]Mode{
 	string(MODE_KEYPAIR_LIST):    MODE_KEYPAIR_LIST,
 	string(MODE_KEYPAIR_BACKUP):  MODE_KEYPAIR_BACKUP,
 	string(MODE_KEYPAIR_RECOVER): MODE_KEYPAIR_RECOVER,
+	string(MODE_DEPOSIT):         MODE_DEPOSIT,
+	string(MODE_KEYPAIR_EXPORT):  MODE_KEYPAIR_EXPORT,
+	string(MODE_MESSAGE_SIGN):    MODE_MESSAGE_SIGN,
+	string(MODE_MESSAGE_VERIFY):  MODE_MESSAGE_VERIFY,
+	string(MODE_AUDIT_VERIFY):    MODE_AUDIT_VERIFY,
+}
+
+// modes which change nothing in vault
+var readOnlyModes = map[Mode]bool{
+	MODE_KEYPAIR_SHOW:   true,
+	MODE_KEYPAIR_LIST:   true,
+	MODE_KEYPAIR_EXPORT: true,
+	MODE_MESSAGE_VERIFY: true,
 }
 
 func main() {
@@ -66,7 +86,13 @@ func main() {
 		cfg, e := config.GetConfig(config.ReadLaunchingKey())
 		util.CheckAndDie(e)
 
-		_, wbks := initModule(cfg)
+		vc, wbks := initModule(cfg)
+		defer wbks.Close()
+
+		// every admin action is recorded to audit log before it runs
+		if mode != MODE_AUDIT_VERIFY {
+			recordAdmin(vc, cfg, mode)
+		}
 
 		switch mode {
 		case MODE_APPADD:
@@ -78,7 +104,16 @@ func main() {
 			if len(os.Args) < 4 {
 				usage()
 			}
-			wbks.GenerateKeypair(os.Args[2], os.Args[3])
+			// addressType and network are optional, told apart by value
+			addressType, network := "", ""
+			for _, arg := range os.Args[4:] {
+				if _, isNetwork := trustSigner.BCNetworkTypes[arg]; isNetwork {
+					network = arg
+				} else {
+					addressType = arg
+				}
+			}
+			wbks.GenerateKeypair(os.Args[2], os.Args[3], addressType, network)
 		case MODE_KEYPAIR_SHOW:
 			if len(os.Args) < 3 {
 				usage()
@@ -99,6 +134,47 @@ func main() {
 				usage()
 			}
 			wbks.RecoverKeyPair(os.Args[2])
+		case MODE_DEPOSIT:
+			if len(os.Args) < 4 {
+				usage()
+			}
+			wbks.Load()
+			wbks.IssueDepositAddress(os.Args[2], os.Args[3])
+		case MODE_KEYPAIR_EXPORT:
+			count := whitebox.DefaultExportCount
+			if len(os.Args) > 2 {
+				count, e = strconv.Atoi(os.Args[2])
+				if e != nil {
+					usage()
+				}
+			}
+			format := whitebox.ExportJSON
+			if len(os.Args) > 3 {
+				format = os.Args[3]
+			}
+			wbks.Load()
+			wbks.ExportKeyPairs(count, format)
+		case MODE_MESSAGE_SIGN:
+			if len(os.Args) < 4 {
+				usage()
+			}
+			wbks.Load()
+			wbks.SignMessageProof(os.Args[2], os.Args[3])
+		case MODE_MESSAGE_VERIFY:
+			if len(os.Args) < 5 {
+				usage()
+			}
+			network := ""
+			if len(os.Args) > 5 {
+				network = os.Args[5]
+			}
+			wbks.VerifyMessageProof(os.Args[2], os.Args[3], os.Args[4], network)
+		case MODE_AUDIT_VERIFY:
+			path := cfg.Server.GetAuditLogPath()
+			if len(os.Args) > 2 {
+				path = os.Args[2]
+			}
+			verifyAuditLog(vc, cfg.Vault.AuditPath, path)
 		default:
 			usage()
 		}
@@ -106,11 +182,51 @@ func main() {
 }
 
 func initModule(cfg *config.Configuration) (*vault.Client, *whitebox.KeyStore) {
+	_, e := trustSigner.ParseNetwork(cfg.Server.BlockChainNetwork)
+	util.CheckAndDie(e)
+
+	util.CheckAndDie(trustSigner.Configure(cfg.Signer))
 	vc := vault.NewClient(cfg)
 	wbks := whitebox.NewKeyStore(cfg, vc)
 	return vc, wbks
 }
 
+// recordAdmin
+// append admin event to audit log set up by server, audit key is not created here
+// read-only modes run without record if audit log is not set up, others die
+func recordAdmin(vc *vault.Client, cfg *config.Configuration, mode Mode) {
+	auditLog, e := audit.OpenExisting(vc, cfg.Vault.AuditPath, cfg.Server.GetAuditLogPath())
+	if e == audit.ErrNotSetUp && readOnlyModes[mode] {
+		return
+	}
+	if e == audit.ErrNotSetUp {
+		util.Die("audit key not found in " + cfg.Vault.AuditPath + ", start server once to set up audit log")
+	}
+	if e != nil {
+		util.Die("Broken Audit : " + e.Error())
+	}
+
+	e = auditLog.Record(audit.EventAdmin, audit.Fields{"mode": mode, "args": os.Args[2:]})
+	auditLog.Close()
+	if e != nil {
+		util.Die("admin action is not recorded to audit log : " + e.Error())
+	}
+}
+
+// verifyAuditLog
+// check chain, signatures and head of audit log, die at first broken record
+func verifyAuditLog(vc *vault.Client, auditPath string, path string) {
+	publicKey, anchor, e := audit.LoadVerifier(vc, auditPath)
+	util.CheckAndDie(e)
+
+	count, e := audit.Verify(path, publicKey, anchor)
+	if e != nil {
+		util.Die("audit log " + path + " is broken : " + e.Error())
+	}
+
+	fmt.Println("audit log", path, "verified :", count, "records, signed by", publicKey.Address())
+}
+
 func usage() {
 	fmt.Printf("Usage : %s [mode] [option]\n\n", os.Args[0])
 	fmt.Printf(" Server Administration\n")
@@ -121,10 +237,14 @@ func usage() {
 	fmt.Printf(" application add mode : %s %s [appName] [cidr]\n", os.Args[0], MODE_APPADD)
 	fmt.Printf("    appName : application name\n")
 	fmt.Printf("    cidr : application bind CIDR\n")
+	fmt.Printf(" audit verify mode : %s %s [filePath]\n", os.Args[0], MODE_AUDIT_VERIFY)
+	fmt.Printf("    filePath : (optional) audit log path, default log_audit of config\n")
 	fmt.Printf("\n KeyPair Administration\n")
-	fmt.Printf(" generate mode : %s %s [kpID] [symbol]\n", os.Args[0], MODE_KEYPAIR_GEN)
+	fmt.Printf(" generate mode : %s %s [kpID] [symbol] [addressType] [network]\n", os.Args[0], MODE_KEYPAIR_GEN)
 	fmt.Printf("    kpID : keypair ID\n")
 	fmt.Printf("    symbol : Blockchain symbol\n")
+	fmt.Printf("    addressType : (optional, BTC) p2pkh(default), p2sh-p2wpkh, p2wpkh\n")
+	fmt.Printf("    network : (optional) mainnet, testnet, regtest, signet, default bc_network of config\n")
 	fmt.Printf(" show mode : %s %s [kpID]\n", os.Args[0], MODE_KEYPAIR_SHOW)
 	fmt.Printf("    kpID : keypair ID\n")
 	fmt.Printf(" list mode : %s %s\n", os.Args[0], MODE_KEYPAIR_SHOW)
@@ -132,6 +252,18 @@ func usage() {
 	fmt.Printf("    kpID : keypair ID\n")
 	fmt.Printf(" recover mode : %s %s [filePath]\n", os.Args[0], MODE_KEYPAIR_SHOW)
 	fmt.Printf("    filePath : recovery file path\n")
+	fmt.Printf(" deposit address mode : %s %s [kpID] [label]\n", os.Args[0], MODE_DEPOSIT)
+	fmt.Printf("    kpID : keypair ID\n")
+	fmt.Printf("    label : owner label, same label gets same address\n")
+	fmt.Printf(" export mode : %s %s [count] [format]\n", os.Args[0], MODE_KEYPAIR_EXPORT)
+	fmt.Printf("    count : (optional) number of addresses per keypair, default %d\n", whitebox.DefaultExportCount)
+	fmt.Printf("    format : (optional) json(default), csv\n")
+	fmt.Printf(" message sign mode : %s %s [kpID] [message]\n", os.Args[0], MODE_MESSAGE_SIGN)
+	fmt.Printf("    kpID : BTC keypair ID, signed by keypair address\n")
+	fmt.Printf("    message : message to sign (BIP137)\n")
+	fmt.Printf(" message verify mode : %s %s [address] [message] [signature] [network]\n", os.Args[0], MODE_MESSAGE_VERIFY)
+	fmt.Printf("    signature : base64 signature\n")
+	fmt.Printf("    network : (optional) default bc_network of config\n")
 
 	os.Exit(-1)
 }
@@ -0,0 +1,241 @@
+package psbt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/wire"
+	"io"
+)
+
+/*
+Minimal BIP174 Partially Signed Bitcoin Transaction
+
+only fields needed for signing are interpreted, every key-value pair is kept as is
+so that re-encoded PSBT differs from decoded one only by added partial signatures
+*/
+
+// magic bytes "psbt" 0xff
+var magic = []byte{0x70, 0x73, 0x62, 0x74, 0xff}
+
+// global types
+const (
+	GlobalUnsignedTx byte = 0x00
+)
+
+// input types
+const (
+	InputNonWitnessUtxo     byte = 0x00
+	InputWitnessUtxo        byte = 0x01
+	InputPartialSig         byte = 0x02
+	InputSighashType        byte = 0x03
+	InputRedeemScript       byte = 0x04
+	InputWitnessScript      byte = 0x05
+	InputBip32Derivation    byte = 0x06
+	InputFinalScriptSig     byte = 0x07
+	InputFinalScriptWitness byte = 0x08
+)
+
+// max length of key or value
+const maxFieldLength = wire.MaxMessagePayload
+
+var (
+	ErrInvalidMagic      = errors.New("psbt magic bytes not found")
+	ErrDuplicateKey      = errors.New("psbt has duplicate key")
+	ErrNoUnsignedTx      = errors.New("psbt has no unsigned transaction")
+	ErrScriptNotEmpty    = errors.New("psbt unsigned transaction has scriptSig or witness")
+	ErrInputOutOfRange   = errors.New("psbt input index out of range")
+	ErrInputFinalized    = errors.New("psbt input is already finalized")
+	ErrInvalidFieldValue = errors.New("psbt field value is invalid")
+)
+
+type KeyValue struct {
+	Key   []byte
+	Value []byte
+}
+
+// Map
+// key-value pairs of global, input or output in encoded order
+type Map []KeyValue
+
+type Packet struct {
+	UnsignedTx *wire.MsgTx
+	Global     Map
+	Inputs     []Map
+	Outputs    []Map
+}
+
+// Get
+// value of key (type || keyData)
+func (m Map) Get(keyType byte, keyData []byte) ([]byte, bool) {
+	key := append([]byte{keyType}, keyData...)
+	for _, kv := range m {
+		if bytes.Equal(kv.Key, key) {
+			return kv.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Has
+// true if any key of keyType exists
+func (m Map) Has(keyType byte) bool {
+	for _, kv := range m {
+		if kv.Key[0] == keyType {
+			return true
+		}
+	}
+	return false
+}
+
+// Set
+// replace value of existing key or append new key
+func (m *Map) Set(keyType byte, keyData []byte, value []byte) {
+	key := append([]byte{keyType}, keyData...)
+	for i, kv := range *m {
+		if bytes.Equal(kv.Key, key) {
+			(*m)[i].Value = value
+			return
+		}
+	}
+	*m = append(*m, KeyValue{Key: key, Value: value})
+}
+
+func DecodeBase64(s string) (*Packet, error) {
+	b, e := base64.StdEncoding.DecodeString(s)
+	if e != nil {
+		return nil, e
+	}
+	return Decode(b)
+}
+
+func Decode(b []byte) (*Packet, error) {
+	if len(b) < len(magic) || !bytes.Equal(b[:len(magic)], magic) {
+		return nil, ErrInvalidMagic
+	}
+
+	r := bytes.NewReader(b[len(magic):])
+
+	global, e := readMap(r)
+	if e != nil {
+		return nil, e
+	}
+
+	txBytes, found := global.Get(GlobalUnsignedTx, nil)
+	if !found {
+		return nil, ErrNoUnsignedTx
+	}
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+	if e := tx.DeserializeNoWitness(bytes.NewReader(txBytes)); e != nil {
+		return nil, fmt.Errorf("psbt unsigned transaction is invalid : %s", e.Error())
+	}
+
+	for _, txIn := range tx.TxIn {
+		if len(txIn.SignatureScript) != 0 || len(txIn.Witness) != 0 {
+			return nil, ErrScriptNotEmpty
+		}
+	}
+
+	packet := &Packet{
+		UnsignedTx: tx,
+		Global:     global,
+		Inputs:     make([]Map, len(tx.TxIn)),
+		Outputs:    make([]Map, len(tx.TxOut)),
+	}
+
+	for i := range packet.Inputs {
+		if packet.Inputs[i], e = readMap(r); e != nil {
+			return nil, fmt.Errorf("psbt input %d : %s", i, e.Error())
+		}
+	}
+
+	for i := range packet.Outputs {
+		if packet.Outputs[i], e = readMap(r); e != nil {
+			return nil, fmt.Errorf("psbt output %d : %s", i, e.Error())
+		}
+	}
+
+	if r.Len() != 0 {
+		return nil, errors.New("psbt has trailing data")
+	}
+
+	return packet, nil
+}
+
+// readMap
+// key-value pairs until 0x00 separator
+func readMap(r io.Reader) (Map, error) {
+	m := Map{}
+	keys := make(map[string]bool)
+
+	for {
+		key, e := wire.ReadVarBytes(r, 0, maxFieldLength, "key")
+		if e != nil {
+			return nil, e
+		}
+
+		// separator
+		if len(key) == 0 {
+			return m, nil
+		}
+
+		if keys[string(key)] {
+			return nil, ErrDuplicateKey
+		}
+		keys[string(key)] = true
+
+		value, e := wire.ReadVarBytes(r, 0, maxFieldLength, "value")
+		if e != nil {
+			return nil, e
+		}
+
+		m = append(m, KeyValue{Key: key, Value: value})
+	}
+}
+
+func (p *Packet) Encode() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(magic)
+
+	maps := append([]Map{p.Global}, p.Inputs...)
+	maps = append(maps, p.Outputs...)
+
+	for _, m := range maps {
+		for _, kv := range m {
+			if e := wire.WriteVarBytes(&buf, 0, kv.Key); e != nil {
+				return nil, e
+			}
+			if e := wire.WriteVarBytes(&buf, 0, kv.Value); e != nil {
+				return nil, e
+			}
+		}
+		buf.WriteByte(0x00)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (p *Packet) EncodeBase64() (string, error) {
+	b, e := p.Encode()
+	if e != nil {
+		return "", e
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// AddPartialSig
+// signature is DER encoded signature with sighash type byte
+func (p *Packet) AddPartialSig(index int, publicKey []byte, signature []byte) error {
+	if index < 0 || index >= len(p.Inputs) {
+		return ErrInputOutOfRange
+	}
+
+	if p.Inputs[index].Has(InputFinalScriptSig) || p.Inputs[index].Has(InputFinalScriptWitness) {
+		return ErrInputFinalized
+	}
+
+	p.Inputs[index].Set(InputPartialSig, publicKey, signature)
+	return nil
+}
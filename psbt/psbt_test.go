@@ -0,0 +1,282 @@
+package psbt_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"github.com/colligence-io/signServer/psbt"
+	"testing"
+)
+
+type testInput struct {
+	pkScript     []byte
+	redeemScript []byte
+	value        int64
+	legacy       bool
+}
+
+// buildPacket
+// unsigned transaction spending one output of each funding transaction
+func buildPacket(t *testing.T, inputs []testInput) (*psbt.Packet, []*wire.MsgTx) {
+	tx := wire.NewMsgTx(2)
+	prevTxs := make([]*wire.MsgTx, len(inputs))
+
+	for i, input := range inputs {
+		prevTx := wire.NewMsgTx(2)
+		prevTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{byte(i + 1)}, Index: 0}, nil, nil))
+		prevTx.AddTxOut(wire.NewTxOut(1000, []byte{txscript.OP_TRUE}))
+		prevTx.AddTxOut(wire.NewTxOut(input.value, input.pkScript))
+		prevTxs[i] = prevTx
+
+		prevHash := prevTx.TxHash()
+		tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&prevHash, 1), nil, nil))
+	}
+	tx.AddTxOut(wire.NewTxOut(50000, []byte{txscript.OP_TRUE}))
+
+	var txBuf bytes.Buffer
+	if err := tx.SerializeNoWitness(&txBuf); err != nil {
+		t.Fatal(err)
+	}
+
+	packet := &psbt.Packet{
+		Global:  psbt.Map{{Key: []byte{psbt.GlobalUnsignedTx}, Value: txBuf.Bytes()}},
+		Inputs:  make([]psbt.Map, len(inputs)),
+		Outputs: []psbt.Map{{}},
+	}
+
+	for i, input := range inputs {
+		if input.legacy {
+			var prevBuf bytes.Buffer
+			if err := prevTxs[i].Serialize(&prevBuf); err != nil {
+				t.Fatal(err)
+			}
+			packet.Inputs[i].Set(psbt.InputNonWitnessUtxo, nil, prevBuf.Bytes())
+		} else {
+			var outBuf bytes.Buffer
+			binary.Write(&outBuf, binary.LittleEndian, input.value)
+			wire.WriteVarBytes(&outBuf, 0, input.pkScript)
+			packet.Inputs[i].Set(psbt.InputWitnessUtxo, nil, outBuf.Bytes())
+		}
+		if input.redeemScript != nil {
+			packet.Inputs[i].Set(psbt.InputRedeemScript, nil, input.redeemScript)
+		}
+	}
+
+	// decode from bytes, as server does
+	encoded, err := packet.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := psbt.Decode(encoded)
+	if err != nil {
+		t.Fatal("ER : Decode :", err)
+	}
+
+	return decoded, prevTxs
+}
+
+func TestSignInputs(t *testing.T) {
+	privateKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey := privateKey.PubKey().SerializeCompressed()
+	pubKeyHash := btcutil.Hash160(publicKey)
+
+	p2pkh, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_DUP).AddOp(txscript.OP_HASH160).AddData(pubKeyHash).AddOp(txscript.OP_EQUALVERIFY).AddOp(txscript.OP_CHECKSIG).Script()
+	p2wpkh, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(pubKeyHash).Script()
+	p2sh, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_HASH160).AddData(btcutil.Hash160(p2wpkh)).AddOp(txscript.OP_EQUAL).Script()
+
+	inputs := []testInput{
+		{pkScript: p2pkh, value: 10000, legacy: true},
+		{pkScript: p2wpkh, value: 20000},
+		{pkScript: p2sh, redeemScript: p2wpkh, value: 30000},
+		{pkScript: []byte{txscript.OP_TRUE}, value: 40000},
+	}
+
+	packet, _ := buildPacket(t, inputs)
+	sigHashes := packet.NewTxSigHashes()
+
+	for i, input := range inputs {
+		sigHash, err := packet.InputSigHash(i, sigHashes)
+		if i == 3 {
+			if err != psbt.ErrUnsupportedScript {
+				t.Error("ER : unsupported script accepted", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal("ER : InputSigHash", i, ":", err)
+		}
+		if sigHash.Witness == input.legacy {
+			t.Error("ER : input", i, "witness", sigHash.Witness)
+		}
+
+		sig, err := privateKey.Sign(sigHash.Hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// [R || S || V] as trustSigner returns
+		rsv := make([]byte, 65)
+		r, s := sig.R.Bytes(), sig.S.Bytes()
+		copy(rsv[32-len(r):32], r)
+		copy(rsv[64-len(s):64], s)
+
+		partialSig, err := psbt.SerializeSignature(rsv, sigHash.HashType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := packet.AddPartialSig(i, publicKey, partialSig); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// partial signatures survive encoding
+	encoded, err := packet.EncodeBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := psbt.DecodeBase64(encoded)
+	if err != nil {
+		t.Fatal("ER : Decode signed :", err)
+	}
+
+	// finalize and run script engine
+	tx := signed.UnsignedTx
+	for i, input := range inputs[:3] {
+		partialSig, found := signed.Inputs[i].Get(psbt.InputPartialSig, publicKey)
+		if !found {
+			t.Fatal("ER : partial signature not found", i)
+		}
+
+		switch {
+		case input.legacy:
+			tx.TxIn[i].SignatureScript, _ = txscript.NewScriptBuilder().AddData(partialSig).AddData(publicKey).Script()
+		case input.redeemScript != nil:
+			tx.TxIn[i].SignatureScript, _ = txscript.NewScriptBuilder().AddData(input.redeemScript).Script()
+			tx.TxIn[i].Witness = wire.TxWitness{partialSig, publicKey}
+		default:
+			tx.TxIn[i].Witness = wire.TxWitness{partialSig, publicKey}
+		}
+	}
+
+	verifyHashes := txscript.NewTxSigHashes(tx)
+	for i, input := range inputs[:3] {
+		vm, err := txscript.NewEngine(input.pkScript, tx, i, txscript.StandardVerifyFlags, nil, verifyHashes, input.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := vm.Execute(); err != nil {
+			t.Error("ER : input", i, "signature is not valid :", err)
+		}
+	}
+}
+
+func TestRedeemScriptMismatch(t *testing.T) {
+	p2wpkh := append([]byte{txscript.OP_0, 0x14}, make([]byte, 20)...)
+	other := append([]byte{txscript.OP_0, 0x14}, bytes.Repeat([]byte{1}, 20)...)
+	p2sh, _ := txscript.NewScriptBuilder().AddOp(txscript.OP_HASH160).AddData(btcutil.Hash160(p2wpkh)).AddOp(txscript.OP_EQUAL).Script()
+
+	packet, _ := buildPacket(t, []testInput{{pkScript: p2sh, redeemScript: other, value: 1}})
+
+	if _, err := packet.InputSigHash(0, packet.NewTxSigHashes()); err == nil {
+		t.Error("ER : redeem script not committed by output accepted")
+	}
+}
+
+func TestCommitsOutputs(t *testing.T) {
+	p2wpkh := append([]byte{txscript.OP_0, 0x14}, make([]byte, 20)...)
+	packet, _ := buildPacket(t, []testInput{{pkScript: p2wpkh, value: 1}})
+
+	hashTypes := map[txscript.SigHashType]bool{
+		txscript.SigHashAll: true,
+		txscript.SigHashAll | txscript.SigHashAnyOneCanPay: true,
+		txscript.SigHashNone: false,
+		txscript.SigHashNone | txscript.SigHashAnyOneCanPay:   false,
+		txscript.SigHashSingle:                                false,
+		txscript.SigHashSingle | txscript.SigHashAnyOneCanPay: false,
+	}
+
+	for hashType, commits := range hashTypes {
+		value := make([]byte, 4)
+		binary.LittleEndian.PutUint32(value, uint32(hashType))
+		packet.Inputs[0].Set(psbt.InputSighashType, nil, value)
+
+		sigHash, err := packet.InputSigHash(0, packet.NewTxSigHashes())
+		if err != nil {
+			t.Fatal("ER : InputSigHash", hashType, ":", err)
+		}
+		if sigHash.CommitsOutputs() != commits {
+			t.Error("ER : sighash type", hashType, "commits outputs", !commits)
+		}
+	}
+}
+
+func TestDecodeRoundTrip(t *testing.T) {
+	p2wpkh := append([]byte{txscript.OP_0, 0x14}, make([]byte, 20)...)
+	packet, _ := buildPacket(t, []testInput{{pkScript: p2wpkh, value: 1}})
+
+	// unknown fields are kept as is
+	packet.Global.Set(0xfc, []byte("proprietary"), []byte{1, 2, 3})
+	packet.Inputs[0].Set(psbt.InputBip32Derivation, []byte{2, 3}, []byte{4, 5})
+
+	encoded, err := packet.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := psbt.Decode(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reencoded, err := decoded.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(encoded, reencoded) {
+		t.Error("ER : re-encoded psbt differs")
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	p2wpkh := append([]byte{txscript.OP_0, 0x14}, make([]byte, 20)...)
+	packet, _ := buildPacket(t, []testInput{{pkScript: p2wpkh, value: 1}})
+	valid, _ := packet.Encode()
+
+	if _, err := psbt.Decode(valid[1:]); err != psbt.ErrInvalidMagic {
+		t.Error("ER : invalid magic accepted", err)
+	}
+
+	if _, err := psbt.Decode(valid[:len(valid)-1]); err == nil {
+		t.Error("ER : truncated psbt accepted")
+	}
+
+	if _, err := psbt.Decode(append(append([]byte{}, valid...), 0x00)); err == nil {
+		t.Error("ER : trailing data accepted")
+	}
+
+	// duplicate key in global map
+	duplicate := &psbt.Packet{Global: append(psbt.Map{}, packet.Global[0], packet.Global[0]), Inputs: packet.Inputs, Outputs: packet.Outputs}
+	duplicateBytes, _ := duplicate.Encode()
+	if _, err := psbt.Decode(duplicateBytes); err != psbt.ErrDuplicateKey {
+		t.Error("ER : duplicate key accepted", err)
+	}
+
+	// unsigned transaction with scriptSig
+	tx := packet.UnsignedTx.Copy()
+	tx.TxIn[0].SignatureScript = []byte{txscript.OP_TRUE}
+	var txBuf bytes.Buffer
+	tx.SerializeNoWitness(&txBuf)
+	scripted := &psbt.Packet{Global: psbt.Map{{Key: []byte{psbt.GlobalUnsignedTx}, Value: txBuf.Bytes()}}, Inputs: packet.Inputs, Outputs: packet.Outputs}
+	scriptedBytes, _ := scripted.Encode()
+	if _, err := psbt.Decode(scriptedBytes); err != psbt.ErrScriptNotEmpty {
+		t.Error("ER : unsigned transaction with scriptSig accepted", err)
+	}
+}
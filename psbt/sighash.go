@@ -0,0 +1,176 @@
+package psbt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/btcsuite/btcutil"
+	"math/big"
+)
+
+var ErrUnsupportedScript = errors.New("psbt input script is not supported")
+
+// SigHash
+// digest to sign for input
+type SigHash struct {
+	// script of spent output, owner is found by address of this script
+	PkScript []byte
+	HashType txscript.SigHashType
+	// true for segwit v0 (BIP143) digest
+	Witness bool
+	Hash    []byte
+}
+
+// InputSigHash
+// compute digest of input spending P2PKH (legacy), P2WPKH or P2SH-P2WPKH (segwit v0)
+func (p *Packet) InputSigHash(index int, sigHashes *txscript.TxSigHashes) (*SigHash, error) {
+	if index < 0 || index >= len(p.Inputs) {
+		return nil, ErrInputOutOfRange
+	}
+
+	input := p.Inputs[index]
+
+	if input.Has(InputFinalScriptSig) || input.Has(InputFinalScriptWitness) {
+		return nil, ErrInputFinalized
+	}
+
+	hashType, e := inputHashType(input)
+	if e != nil {
+		return nil, e
+	}
+
+	prevOut, e := p.spentOutput(index)
+	if e != nil {
+		return nil, e
+	}
+
+	sigHash := &SigHash{PkScript: prevOut.PkScript, HashType: hashType}
+
+	switch txscript.GetScriptClass(prevOut.PkScript) {
+	case txscript.PubKeyHashTy:
+		sigHash.Hash, e = txscript.CalcSignatureHash(prevOut.PkScript, hashType, p.UnsignedTx, index)
+
+	case txscript.WitnessV0PubKeyHashTy:
+		sigHash.Witness = true
+		sigHash.Hash, e = txscript.CalcWitnessSigHash(prevOut.PkScript, sigHashes, hashType, p.UnsignedTx, index, prevOut.Value)
+
+	case txscript.ScriptHashTy:
+		redeemScript, found := input.Get(InputRedeemScript, nil)
+		if !found || !txscript.IsPayToWitnessPubKeyHash(redeemScript) {
+			return nil, ErrUnsupportedScript
+		}
+
+		// redeem script must be the one committed by output
+		if !bytes.Equal(prevOut.PkScript[2:22], btcutil.Hash160(redeemScript)) {
+			return nil, errors.New("psbt redeem script does not match spent output")
+		}
+
+		sigHash.Witness = true
+		sigHash.Hash, e = txscript.CalcWitnessSigHash(redeemScript, sigHashes, hashType, p.UnsignedTx, index, prevOut.Value)
+
+	default:
+		return nil, ErrUnsupportedScript
+	}
+
+	if e != nil {
+		return nil, e
+	}
+
+	return sigHash, nil
+}
+
+// CommitsOutputs
+// true if signature commits every output (SIGHASH_ALL, with or without ANYONECANPAY)
+// outputs of SIGHASH_NONE and SIGHASH_SINGLE signature can be changed after signing
+func (h *SigHash) CommitsOutputs() bool {
+	return h.HashType&^txscript.SigHashAnyOneCanPay == txscript.SigHashAll
+}
+
+// NewTxSigHashes
+// BIP143 midstate of unsigned transaction, shared by all inputs
+func (p *Packet) NewTxSigHashes() *txscript.TxSigHashes {
+	return txscript.NewTxSigHashes(p.UnsignedTx)
+}
+
+// spentOutput
+// non-witness utxo is preferred, it must be the transaction referenced by input
+func (p *Packet) spentOutput(index int) (*wire.TxOut, error) {
+	input := p.Inputs[index]
+	outPoint := p.UnsignedTx.TxIn[index].PreviousOutPoint
+
+	if txBytes, found := input.Get(InputNonWitnessUtxo, nil); found {
+		prevTx := wire.NewMsgTx(wire.TxVersion)
+		if e := prevTx.Deserialize(bytes.NewReader(txBytes)); e != nil {
+			return nil, fmt.Errorf("psbt input %d non-witness utxo is invalid : %s", index, e.Error())
+		}
+
+		if prevTx.TxHash() != outPoint.Hash {
+			return nil, fmt.Errorf("psbt input %d non-witness utxo does not match previous outpoint", index)
+		}
+
+		if outPoint.Index >= uint32(len(prevTx.TxOut)) {
+			return nil, fmt.Errorf("psbt input %d previous output index out of range", index)
+		}
+
+		return prevTx.TxOut[outPoint.Index], nil
+	}
+
+	if outBytes, found := input.Get(InputWitnessUtxo, nil); found {
+		r := bytes.NewReader(outBytes)
+
+		var value int64
+		if e := binary.Read(r, binary.LittleEndian, &value); e != nil {
+			return nil, ErrInvalidFieldValue
+		}
+
+		pkScript, e := wire.ReadVarBytes(r, 0, maxFieldLength, "pkScript")
+		if e != nil || r.Len() != 0 {
+			return nil, ErrInvalidFieldValue
+		}
+
+		return wire.NewTxOut(value, pkScript), nil
+	}
+
+	return nil, fmt.Errorf("psbt input %d has no utxo", index)
+}
+
+// inputHashType
+// SIGHASH_ALL if not specified
+func inputHashType(input Map) (txscript.SigHashType, error) {
+	value, found := input.Get(InputSighashType, nil)
+	if !found {
+		return txscript.SigHashAll, nil
+	}
+
+	if len(value) != 4 {
+		return 0, ErrInvalidFieldValue
+	}
+
+	hashType := txscript.SigHashType(binary.LittleEndian.Uint32(value))
+
+	switch hashType &^ txscript.SigHashAnyOneCanPay {
+	case txscript.SigHashAll, txscript.SigHashNone, txscript.SigHashSingle:
+		return hashType, nil
+	default:
+		return 0, fmt.Errorf("psbt sighash type %d is not supported", hashType)
+	}
+}
+
+// SerializeSignature
+// [R || S || V] signature into DER with sighash type byte, S is normalized to low S
+func SerializeSignature(signature []byte, hashType txscript.SigHashType) ([]byte, error) {
+	if len(signature) < 64 {
+		return nil, errors.New("signature must be [R || S] or [R || S || V]")
+	}
+
+	sig := &btcec.Signature{
+		R: new(big.Int).SetBytes(signature[:32]),
+		S: new(big.Int).SetBytes(signature[32:64]),
+	}
+
+	return append(sig.Serialize(), byte(hashType)), nil
+}
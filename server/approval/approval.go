@@ -0,0 +1,536 @@
+package approval
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/colligence-io/signServer/server/job"
+	"github.com/colligence-io/signServer/server/rr"
+	"github.com/colligence-io/signServer/vault"
+	"github.com/sirupsen/logrus"
+	"io"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+PENDING APPROVAL
+
+sign request flagged by policy (require-approval) is held with its decoded payload until M of N approvers approve it
+approvers are stored in vault (vault.approverPath/{name}, publicKey = stellar public key G...)
+approver signs "approve:{id}:{digest}" or "reject:{id}:{digest}" with own key (base64 ed25519 signature)
+digest is sha256 of pending request, so that approval is bound to payload the approver has seen
+when M approvals arrive, request is signed and result is kept for polling, and posted to callback URL if given
+any rejection or expiration ends pending request without signature
+
+requests are kept in vault (vault.pendingPath/{id}) with replay record given by server, so that restart does not drop them
+request which was being signed when server stopped is signed again by replay at start
+callback is signed with server.jobCallbackSecret and its host is checked as job callback
+*/
+
+var logger = logrus.WithField("module", "Approval")
+
+type Status string
+
+const (
+	StatusPending  Status = "pending"
+	StatusSigning  Status = "signing"
+	StatusSigned   Status = "signed"
+	StatusFailed   Status = "failed"
+	StatusRejected Status = "rejected"
+	StatusExpired  Status = "expired"
+)
+
+const (
+	Approve = "approve"
+	Reject  = "reject"
+)
+
+// signed list request of approver must be made within
+const listTimeWindow = 60
+
+var (
+	ErrNotFound         = errors.New("pending request not found")
+	ErrNotPending       = errors.New("request is not pending")
+	ErrUnknownApprover  = errors.New("approver not found")
+	ErrInvalidSignature = errors.New("approver signature is invalid")
+	ErrAlreadyApproved  = errors.New("request is already approved by approver")
+	ErrInvalidDecision  = errors.New("decision must be approve or reject")
+)
+
+// Request
+// sign request to hold, Payload is decoded request shown to approvers
+// Required is M of request (threshold of store if 0), Callback is URL to POST Pending when request is finished (optional)
+// Replay is given back to Resolver to sign request again after restart
+type Request struct {
+	App          string
+	Operation    string
+	Symbol       string
+	KeyIDs       []string
+	Rule         string
+	Required     int
+	Destinations []string
+	Amount       *big.Int
+	Payload      interface{}
+	Callback     string
+	Replay       json.RawMessage
+}
+
+// Pending
+// held request and its approval state
+type Pending struct {
+	ID           string             `json:"id"`
+	App          string             `json:"app"`
+	Operation    string             `json:"operation"`
+	Symbol       string             `json:"symbol"`
+	KeyIDs       []string           `json:"keyIDs"`
+	Rule         string             `json:"rule"`
+	Destinations []string           `json:"destinations,omitempty"`
+	Amount       string             `json:"amount,omitempty"`
+	Payload      interface{}        `json:"payload"`
+	Digest       string             `json:"digest"`
+	Required     int                `json:"required"`
+	Approvals    []string           `json:"approvals"`
+	RejectedBy   string             `json:"rejectedBy,omitempty"`
+	Status       Status             `json:"status"`
+	Created      int64              `json:"created"`
+	Expires      int64              `json:"expires"`
+	Result       *rr.ResponseEntity `json:"result,omitempty"`
+}
+
+type entry struct {
+	pending  Pending
+	callback string
+	replay   json.RawMessage
+	execute  func() rr.ResponseEntity
+	watchers []func(Pending)
+}
+
+type Store struct {
+	approvers map[string]*Approver
+	threshold int
+	expires   time.Duration
+	notifier  *job.Notifier
+	// nil keeps requests in memory only
+	persister *persister
+
+	mutex   sync.Mutex
+	entries map[string]*entry
+}
+
+// New
+// load approvers from vault approverPath, expired and finished requests are removed after another expires
+// requests are kept in vault pendingPath after Persist
+func New(vc *vault.Client, approverPath string, threshold int, expires time.Duration, notifier *job.Notifier) *Store {
+	approvers := make(map[string]*Approver)
+	if approverPath != "" {
+		approvers = loadApprovers(vc, approverPath)
+	}
+
+	list := make([]*Approver, 0, len(approvers))
+	for _, approver := range approvers {
+		list = append(list, approver)
+	}
+
+	store := NewStore(list, threshold, expires, notifier)
+	store.autoCleanup()
+	return store
+}
+
+// NewStore
+// store of approvers, threshold is default M, finished request is posted to callback by notifier
+func NewStore(approvers []*Approver, threshold int, expires time.Duration, notifier *job.Notifier) *Store {
+	store := &Store{
+		approvers: make(map[string]*Approver),
+		threshold: threshold,
+		expires:   expires,
+		notifier:  notifier,
+		entries:   make(map[string]*entry),
+	}
+	for _, approver := range approvers {
+		store.approvers[approver.Name] = approver
+	}
+
+	if threshold > len(store.approvers) {
+		logger.Warn(fmt.Sprintf("approval threshold %d is larger than %d approvers", threshold, len(store.approvers)))
+	}
+
+	return store
+}
+
+// Submit
+// hold request until approved, execute is called once when M approvals arrive
+func (store *Store) Submit(request Request, execute func() rr.ResponseEntity) (Pending, error) {
+	required := request.Required
+	if required <= 0 {
+		required = store.threshold
+	}
+	if required <= 0 || required > len(store.approvers) {
+		return Pending{}, fmt.Errorf("%d approvals required but %d approvers registered", required, len(store.approvers))
+	}
+
+	if request.Callback != "" {
+		if e := store.notifier.Check(request.Callback); e != nil {
+			return Pending{}, e
+		}
+	}
+
+	idBytes := make([]byte, 16)
+	if _, e := io.ReadFull(rand.Reader, idBytes); e != nil {
+		return Pending{}, e
+	}
+
+	now := time.Now().UTC()
+
+	pending, e := newPending(request, hex.EncodeToString(idBytes), required, now.Unix(), now.Add(store.expires).Unix())
+	if e != nil {
+		return Pending{}, e
+	}
+
+	submitted := &entry{pending: pending, callback: request.Callback, replay: request.Replay, execute: execute}
+
+	store.mutex.Lock()
+	if e := store.save(submitted); e != nil {
+		store.mutex.Unlock()
+		return Pending{}, e
+	}
+	store.entries[pending.ID] = submitted
+	store.mutex.Unlock()
+
+	logger.WithFields(logrus.Fields{
+		"id":        pending.ID,
+		"app":       pending.App,
+		"operation": pending.Operation,
+		"keyIDs":    pending.KeyIDs,
+		"rule":      pending.Rule,
+		"required":  pending.Required,
+	}).Info("request is pending approval")
+
+	return pending, nil
+}
+
+// newPending
+// pending request of request with its digest
+func newPending(request Request, id string, required int, created int64, expires int64) (Pending, error) {
+	pending := Pending{
+		ID:           id,
+		App:          request.App,
+		Operation:    request.Operation,
+		Symbol:       request.Symbol,
+		KeyIDs:       request.KeyIDs,
+		Rule:         request.Rule,
+		Destinations: request.Destinations,
+		Payload:      request.Payload,
+		Required:     required,
+		Approvals:    []string{},
+		Status:       StatusPending,
+		Created:      created,
+		Expires:      expires,
+	}
+	if request.Amount != nil {
+		pending.Amount = request.Amount.String()
+	}
+
+	digest, e := digestOf(pending)
+	if e != nil {
+		return Pending{}, e
+	}
+	pending.Digest = digest
+
+	return pending, nil
+}
+
+// Matches
+// request is same as held request of id, replay after restart must match before it is signed
+func (store *Store) Matches(id string, request Request) bool {
+	store.mutex.Lock()
+	e, found := store.entries[id]
+	if !found {
+		store.mutex.Unlock()
+		return false
+	}
+	pending := e.pending
+	store.mutex.Unlock()
+
+	// rule may have changed since request was held
+	request.Rule = pending.Rule
+	replayed, err := newPending(request, pending.ID, pending.Required, pending.Created, pending.Expires)
+	return err == nil && replayed.Digest == pending.Digest
+}
+
+// digestOf
+// sha256 of request part of pending, approval state excluded
+func digestOf(pending Pending) (string, error) {
+	pending.Digest = ""
+	pending.Approvals = nil
+	pending.Status = ""
+	pending.Result = nil
+
+	pBytes, e := json.Marshal(pending)
+	if e != nil {
+		return "", e
+	}
+	digest := sha256.Sum256(pBytes)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+// ApprovalMessage
+// message approver signs for decision on pending request
+func ApprovalMessage(decision string, id string, digest string) string {
+	return decision + ":" + id + ":" + digest
+}
+
+// ListMessage
+// message approver signs to list pending requests, unix time must be within 60 seconds of server
+func ListMessage(unixTime int64) string {
+	return "pending:" + strconv.FormatInt(unixTime, 10)
+}
+
+// Get
+// pending request of id
+func (store *Store) Get(id string) (Pending, bool) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	e, found := store.entries[id]
+	if !found {
+		return Pending{}, false
+	}
+	store.expire(e)
+	return e.pending, true
+}
+
+// ListPending
+// requests waiting for approval, request must be signed by approver
+func (store *Store) ListPending(approverName string, unixTime int64, signature string) ([]Pending, error) {
+	approver, found := store.approvers[approverName]
+	if !found {
+		return nil, ErrUnknownApprover
+	}
+
+	if diff := time.Now().Unix() - unixTime; diff > listTimeWindow || diff < -listTimeWindow {
+		return nil, ErrInvalidSignature
+	}
+
+	if !approver.Verify(ListMessage(unixTime), signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	list := make([]Pending, 0)
+	for _, e := range store.entries {
+		store.expire(e)
+		if e.pending.Status == StatusPending {
+			list = append(list, e.pending)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Created < list[j].Created
+	})
+
+	return list, nil
+}
+
+// Decide
+// approve or reject pending request by approver, request is signed when approvals reach required
+func (store *Store) Decide(id string, approverName string, decision string, signature string) (Pending, error) {
+	if decision != Approve && decision != Reject {
+		return Pending{}, ErrInvalidDecision
+	}
+
+	approver, found := store.approvers[approverName]
+	if !found {
+		return Pending{}, ErrUnknownApprover
+	}
+
+	store.mutex.Lock()
+
+	e, found := store.entries[id]
+	if !found {
+		store.mutex.Unlock()
+		return Pending{}, ErrNotFound
+	}
+
+	store.expire(e)
+	if e.pending.Status != StatusPending {
+		store.mutex.Unlock()
+		return e.pending, ErrNotPending
+	}
+
+	if !approver.Verify(ApprovalMessage(decision, id, e.pending.Digest), signature) {
+		store.mutex.Unlock()
+		return e.pending, ErrInvalidSignature
+	}
+
+	for _, name := range e.pending.Approvals {
+		if name == approverName {
+			store.mutex.Unlock()
+			return e.pending, ErrAlreadyApproved
+		}
+	}
+
+	entryLogger := logger.WithFields(logrus.Fields{"id": id, "approver": approverName, "app": e.pending.App, "rule": e.pending.Rule})
+
+	if decision == Reject {
+		e.pending.Status = StatusRejected
+		e.pending.RejectedBy = approverName
+		if err := store.save(e); err != nil {
+			entryLogger.Error("rejection is not kept : ", err)
+		}
+		pending := e.pending
+		watchers := takeWatchers(e)
+		store.mutex.Unlock()
+
+		entryLogger.Warn("pending request rejected")
+		store.notify(e.callback, pending, watchers)
+		return pending, nil
+	}
+
+	e.pending.Approvals = append(e.pending.Approvals, approverName)
+
+	// signing status keeps other approvers out while whitebox signs
+	if len(e.pending.Approvals) >= e.pending.Required {
+		e.pending.Status = StatusSigning
+	}
+
+	// approval which is not kept is not counted, approver can approve again
+	if err := store.save(e); err != nil {
+		e.pending.Approvals = e.pending.Approvals[:len(e.pending.Approvals)-1]
+		e.pending.Status = StatusPending
+		store.mutex.Unlock()
+		return Pending{}, err
+	}
+
+	entryLogger.Info(fmt.Sprintf("pending request approved (%d/%d)", len(e.pending.Approvals), e.pending.Required))
+
+	if e.pending.Status == StatusPending {
+		pending := e.pending
+		store.mutex.Unlock()
+		return pending, nil
+	}
+	store.mutex.Unlock()
+
+	return store.sign(e, entryLogger), nil
+}
+
+// sign
+// execute approved request and keep its result, entry must be in signing status
+func (store *Store) sign(e *entry, entryLogger *logrus.Entry) Pending {
+	result := e.execute()
+
+	store.mutex.Lock()
+	e.pending.Result = &result
+	if result.Code == http.StatusOK {
+		e.pending.Status = StatusSigned
+	} else {
+		e.pending.Status = StatusFailed
+	}
+	e.execute = nil
+	if err := store.save(e); err != nil {
+		entryLogger.Error("result is not kept : ", err)
+	}
+	pending := e.pending
+	watchers := takeWatchers(e)
+	store.mutex.Unlock()
+
+	entryLogger.Info("approved request ", pending.Status)
+	store.notify(e.callback, pending, watchers)
+
+	return pending
+}
+
+// expire
+// pending request past its expiration is expired, store must be locked
+func (store *Store) expire(e *entry) {
+	if e.pending.Status == StatusPending && time.Now().Unix() >= e.pending.Expires {
+		e.pending.Status = StatusExpired
+		e.execute = nil
+		logger.WithField("id", e.pending.ID).Warn("pending request expired")
+		if err := store.save(e); err != nil {
+			logger.WithField("id", e.pending.ID).Error("expiration is not kept : ", err)
+		}
+		store.notify(e.callback, e.pending, takeWatchers(e))
+	}
+}
+
+// Watch
+// watcher is called once when pending request is finished (signed, failed, rejected or expired)
+func (store *Store) Watch(id string, watcher func(Pending)) error {
+	store.mutex.Lock()
+
+	e, found := store.entries[id]
+	if !found {
+		store.mutex.Unlock()
+		return ErrNotFound
+	}
+
+	store.expire(e)
+	if e.pending.Status == StatusPending || e.pending.Status == StatusSigning {
+		e.watchers = append(e.watchers, watcher)
+		store.mutex.Unlock()
+		return nil
+	}
+
+	pending := e.pending
+	store.mutex.Unlock()
+
+	go watcher(pending)
+	return nil
+}
+
+// takeWatchers
+// watchers of finished entry, store must be locked
+func takeWatchers(e *entry) []func(Pending) {
+	watchers := e.watchers
+	e.watchers = nil
+	return watchers
+}
+
+// notify
+// call watchers and POST pending to callback URL
+func (store *Store) notify(callback string, pending Pending, watchers []func(Pending)) {
+	for _, watcher := range watchers {
+		go watcher(pending)
+	}
+
+	store.notifier.Notify(callback, "approval "+pending.ID, pending)
+}
+
+func (store *Store) autoCleanup() {
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+			store.removeFinished()
+		}
+	}()
+}
+
+// removeFinished
+// expire pending requests, and remove finished requests after expires since expiration
+func (store *Store) removeFinished() {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	retention := int64(store.expires / time.Second)
+	now := time.Now().Unix()
+
+	for id, e := range store.entries {
+		store.expire(e)
+		if e.pending.Status != StatusPending && e.pending.Status != StatusSigning && now >= e.pending.Expires+retention {
+			if err := store.remove(id); err != nil {
+				logger.WithField("id", id).Error("finished request is not removed : ", err)
+				continue
+			}
+			delete(store.entries, id)
+		}
+	}
+}
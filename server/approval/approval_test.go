@@ -0,0 +1,319 @@
+package approval_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/colligence-io/signServer/config"
+	"github.com/colligence-io/signServer/server/approval"
+	"github.com/colligence-io/signServer/server/job"
+	"github.com/colligence-io/signServer/server/rr"
+	"github.com/colligence-io/signServer/vault"
+	"github.com/colligence-io/signServer/vault/vaulttest"
+	stellarkp "github.com/stellar/go/keypair"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type testApprover struct {
+	name string
+	kp   *stellarkp.Full
+}
+
+func newApprovers(t *testing.T, names ...string) ([]testApprover, []*approval.Approver) {
+	var keys []testApprover
+	var approvers []*approval.Approver
+	for _, name := range names {
+		kp, err := stellarkp.Random()
+		if err != nil {
+			t.Fatal(err)
+		}
+		public, _ := stellarkp.Parse(kp.Address())
+		keys = append(keys, testApprover{name: name, kp: kp})
+		approvers = append(approvers, &approval.Approver{Name: name, KeyPair: public})
+	}
+	return keys, approvers
+}
+
+func (a testApprover) sign(t *testing.T, message string) string {
+	signature, err := a.kp.Sign([]byte(message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(signature)
+}
+
+func (a testApprover) decide(t *testing.T, store *approval.Store, decision string, pending approval.Pending) (approval.Pending, error) {
+	return store.Decide(pending.ID, a.name, decision, a.sign(t, approval.ApprovalMessage(decision, pending.ID, pending.Digest)))
+}
+
+func submit(t *testing.T, store *approval.Store, callback string, executed *int) approval.Pending {
+	pending, err := store.Submit(approval.Request{
+		App:          "exchange",
+		Operation:    "eth.tx",
+		Symbol:       "ETH",
+		KeyIDs:       []string{"hot1"},
+		Rule:         "large-eth",
+		Destinations: []string{"0xabcd000000000000000000000000000000000001"},
+		Amount:       big.NewInt(5000),
+		Payload:      map[string]interface{}{"nonce": 1},
+		Callback:     callback,
+		Replay:       json.RawMessage(`{"path":"/sign"}`),
+	}, func() rr.ResponseEntity {
+		*executed++
+		return rr.OkResponse("signed")
+	})
+	if err != nil {
+		t.Fatal("ER : Submit :", err)
+	}
+	return pending
+}
+
+func TestApprove(t *testing.T) {
+	keys, approvers := newApprovers(t, "alice", "bob", "carol")
+	store := approval.NewStore(approvers, 2, time.Hour, job.NewNotifier("", nil))
+
+	executed := 0
+	pending := submit(t, store, "", &executed)
+	if pending.Status != approval.StatusPending || pending.Required != 2 || pending.Amount != "5000" {
+		t.Fatal("ER : submitted", pending)
+	}
+
+	now := time.Now().Unix()
+	list, err := store.ListPending("carol", now, keys[2].sign(t, approval.ListMessage(now)))
+	if err != nil || len(list) != 1 || list[0].ID != pending.ID {
+		t.Fatal("ER : ListPending", list, err)
+	}
+
+	// signature of other approver, other request or other digest
+	if _, err := store.Decide(pending.ID, "alice", approval.Approve, keys[1].sign(t, approval.ApprovalMessage(approval.Approve, pending.ID, pending.Digest))); err != approval.ErrInvalidSignature {
+		t.Error("ER : signature of other approver accepted", err)
+	}
+	if _, err := store.Decide(pending.ID, "alice", approval.Approve, keys[0].sign(t, approval.ApprovalMessage(approval.Approve, pending.ID, "00"))); err != approval.ErrInvalidSignature {
+		t.Error("ER : approval of other digest accepted", err)
+	}
+	if _, err := store.Decide(pending.ID, "mallory", approval.Approve, ""); err != approval.ErrUnknownApprover {
+		t.Error("ER : unknown approver accepted", err)
+	}
+
+	pending, err = keys[0].decide(t, store, approval.Approve, pending)
+	if err != nil || pending.Status != approval.StatusPending || executed != 0 {
+		t.Fatal("ER : first approval", pending, err)
+	}
+
+	if _, err := keys[0].decide(t, store, approval.Approve, pending); err != approval.ErrAlreadyApproved {
+		t.Error("ER : approved twice by same approver", err)
+	}
+
+	pending, err = keys[1].decide(t, store, approval.Approve, pending)
+	if err != nil || pending.Status != approval.StatusSigned || executed != 1 {
+		t.Fatal("ER : second approval", pending, err)
+	}
+	if pending.Result == nil || pending.Result.Data != "signed" {
+		t.Error("ER : result is not kept", pending.Result)
+	}
+
+	if _, err := keys[2].decide(t, store, approval.Approve, pending); err != approval.ErrNotPending || executed != 1 {
+		t.Error("ER : signed request approved again", err)
+	}
+
+	polled, found := store.Get(pending.ID)
+	if !found || polled.Status != approval.StatusSigned {
+		t.Error("ER : Get", polled)
+	}
+}
+
+func TestRejectAndExpire(t *testing.T) {
+	keys, approvers := newApprovers(t, "alice", "bob")
+	store := approval.NewStore(approvers, 2, time.Second, job.NewNotifier("", nil))
+
+	executed := 0
+	pending := submit(t, store, "", &executed)
+
+	pending, err := keys[1].decide(t, store, approval.Reject, pending)
+	if err != nil || pending.Status != approval.StatusRejected || pending.RejectedBy != "bob" {
+		t.Fatal("ER : reject", pending, err)
+	}
+	if _, err := keys[0].decide(t, store, approval.Approve, pending); err != approval.ErrNotPending {
+		t.Error("ER : rejected request approved", err)
+	}
+
+	pending = submit(t, store, "", &executed)
+	time.Sleep(1100 * time.Millisecond)
+	if _, err := keys[0].decide(t, store, approval.Approve, pending); err != approval.ErrNotPending {
+		t.Error("ER : expired request approved", err)
+	}
+	if polled, _ := store.Get(pending.ID); polled.Status != approval.StatusExpired {
+		t.Error("ER : request is not expired", polled.Status)
+	}
+
+	if executed != 0 {
+		t.Error("ER : request executed without approval")
+	}
+}
+
+func TestSubmitInvalid(t *testing.T) {
+	_, approvers := newApprovers(t, "alice")
+	store := approval.NewStore(approvers, 2, time.Hour, job.NewNotifier("", nil))
+
+	if _, err := store.Submit(approval.Request{App: "exchange"}, nil); err == nil {
+		t.Error("ER : more approvals than approvers accepted")
+	}
+	if _, err := store.Submit(approval.Request{App: "exchange", Required: 1, Callback: "file:///etc/passwd"}, nil); err == nil {
+		t.Error("ER : non-http callback accepted")
+	}
+
+	keys, approvers := newApprovers(t, "alice")
+	store = approval.NewStore(approvers, 1, time.Hour, job.NewNotifier("", nil))
+	old := time.Now().Unix() - 120
+	if _, err := store.ListPending("alice", old, keys[0].sign(t, approval.ListMessage(old))); err != approval.ErrInvalidSignature {
+		t.Error("ER : old list request accepted", err)
+	}
+}
+
+func TestCallback(t *testing.T) {
+	secret := "callback-secret"
+
+	received := make(chan approval.Pending, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		if req.Header.Get(job.SignatureHeader) != job.CallbackSignature([]byte(secret), req.Header.Get(job.SignatureTimestampHeader), body) {
+			t.Error("ER : callback signature")
+		}
+		var pending approval.Pending
+		if err := json.Unmarshal(body, &pending); err != nil {
+			t.Error(err)
+		}
+		received <- pending
+	}))
+	defer server.Close()
+
+	keys, approvers := newApprovers(t, "alice")
+
+	// unsigned callback and callback to host not allowed are refused
+	executed := 0
+	if _, err := approval.NewStore(approvers, 1, time.Hour, job.NewNotifier("", []string{"127.0.0.1"})).Submit(approval.Request{App: "exchange", Callback: server.URL}, nil); err != job.ErrNoCallbackSecret {
+		t.Error("ER : callback without secret accepted", err)
+	}
+	if _, err := approval.NewStore(approvers, 1, time.Hour, job.NewNotifier(secret, []string{"hooks.example.com"})).Submit(approval.Request{App: "exchange", Callback: server.URL}, nil); err != job.ErrCallbackNotAllowed {
+		t.Error("ER : callback to other host accepted", err)
+	}
+
+	store := approval.NewStore(approvers, 1, time.Hour, job.NewNotifier(secret, []string{"127.0.0.1"}))
+
+	pending := submit(t, store, server.URL, &executed)
+	if _, err := keys[0].decide(t, store, approval.Approve, pending); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case posted := <-received:
+		if posted.ID != pending.ID || posted.Status != approval.StatusSigned || posted.Result == nil {
+			t.Error("ER : callback", posted)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("ER : callback is not posted")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	keys, approvers := newApprovers(t, "alice")
+	store := approval.NewStore(approvers, 1, time.Hour, job.NewNotifier("", nil))
+
+	executed := 0
+	pending := submit(t, store, "", &executed)
+
+	finished := make(chan approval.Pending, 2)
+	if err := store.Watch(pending.ID, func(p approval.Pending) { finished <- p }); err != nil {
+		t.Fatal("ER : Watch", err)
+	}
+	if err := store.Watch("unknown", func(approval.Pending) {}); err != approval.ErrNotFound {
+		t.Error("ER : Watch of unknown request", err)
+	}
+
+	if _, err := keys[0].decide(t, store, approval.Approve, pending); err != nil {
+		t.Fatal(err)
+	}
+
+	// watch after finished is called at once
+	if err := store.Watch(pending.ID, func(p approval.Pending) { finished <- p }); err != nil {
+		t.Fatal("ER : Watch of finished request", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case p := <-finished:
+			if p.Status != approval.StatusSigned || p.Result == nil {
+				t.Error("ER : watched", p)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("ER : watcher is not called")
+		}
+	}
+}
+
+func TestPersist(t *testing.T) {
+	fv := vaulttest.NewServer()
+	defer fv.Close()
+
+	cfg := &config.Configuration{
+		Vault: config.VaultConfig{Username: "user", Password: "pass", AppRole: "role", Address: fv.URL},
+	}
+	vc := vault.NewClient(cfg)
+	vc.Connect()
+	pendingPath := "tss/approver-pending"
+
+	keys, approvers := newApprovers(t, "alice", "bob")
+	notifier := job.NewNotifier("", nil)
+
+	store := approval.NewStore(approvers, 2, time.Hour, notifier)
+	if err := store.Persist(vc, pendingPath, nil); err != nil {
+		t.Fatal("ER : Persist", err)
+	}
+
+	executed := 0
+	pending := submit(t, store, "", &executed)
+	if _, err := keys[0].decide(t, store, approval.Approve, pending); err != nil {
+		t.Fatal(err)
+	}
+	if len(fv.Find(pendingPath)) != 1 {
+		t.Fatal("ER : pending request is not kept in vault")
+	}
+
+	// restart : request is restored with its approval, and signed by replay
+	replayed := 0
+	restarted := approval.NewStore(approvers, 2, time.Hour, notifier)
+	if err := restarted.Persist(vc, pendingPath, func(p approval.Pending, replay json.RawMessage) (func() rr.ResponseEntity, error) {
+		if p.ID != pending.ID || string(replay) != `{"path":"/sign"}` {
+			t.Error("ER : restored request", p, string(replay))
+		}
+		return func() rr.ResponseEntity {
+			replayed++
+			return rr.OkResponse("signed after restart")
+		}, nil
+	}); err != nil {
+		t.Fatal("ER : Persist after restart", err)
+	}
+
+	restored, found := restarted.Get(pending.ID)
+	if !found || restored.Status != approval.StatusPending || len(restored.Approvals) != 1 || restored.Digest != pending.Digest {
+		t.Fatal("ER : restored", restored)
+	}
+
+	signed, err := keys[1].decide(t, restarted, approval.Approve, restored)
+	if err != nil || signed.Status != approval.StatusSigned || replayed != 1 || executed != 0 {
+		t.Fatal("ER : approval after restart", signed, err)
+	}
+
+	// finished request is kept for polling after another restart
+	again := approval.NewStore(approvers, 2, time.Hour, notifier)
+	if err := again.Persist(vc, pendingPath, nil); err != nil {
+		t.Fatal(err)
+	}
+	if polled, found := again.Get(pending.ID); !found || polled.Status != approval.StatusSigned || polled.Result == nil {
+		t.Error("ER : finished request after restart", polled)
+	}
+}
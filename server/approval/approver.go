@@ -0,0 +1,71 @@
+package approval
+
+import (
+	"encoding/base64"
+	"github.com/colligence-io/signServer/util"
+	"github.com/colligence-io/signServer/vault"
+	stellarkp "github.com/stellar/go/keypair"
+)
+
+// Approver
+// person who approves pending requests with own ed25519 key, server knows public key only
+type Approver struct {
+	Name    string
+	KeyPair stellarkp.KP
+}
+
+// Verify
+// base64 ed25519 signature of message by approver
+func (approver *Approver) Verify(message string, signature string) bool {
+	sBytes, e := base64.StdEncoding.DecodeString(signature)
+	if e != nil {
+		return false
+	}
+	return approver.KeyPair.Verify([]byte(message), sBytes) == nil
+}
+
+func loadApprovers(vc *vault.Client, approverPath string) map[string]*Approver {
+	approvers := make(map[string]*Approver)
+
+	approverList, e := vc.Logical().List(approverPath)
+	util.CheckAndDie(e)
+
+	if approverList == nil || approverList.Data == nil {
+		logger.Warn("no approver found in ", approverPath)
+		return approvers
+	}
+
+	keys, _ := approverList.Data["keys"].([]interface{})
+	for _, ik := range keys {
+		approverName := ik.(string)
+
+		approverSecret, e := vc.Logical().Read(approverPath + "/" + approverName)
+		util.CheckAndDie(e)
+
+		if approverSecret == nil || approverSecret.Data == nil {
+			util.Die("Broken Approver : Data is null - " + approverName)
+		}
+
+		// public key (G...) only, private key is kept by approver
+		publicKey, ok := approverSecret.Data["publicKey"].(string)
+		if !ok {
+			util.Die("Broken Approver : publicKey not found - " + approverName)
+		}
+
+		kp, e := stellarkp.Parse(publicKey)
+		if e != nil {
+			logger.Error(e)
+			util.Die("Broken Approver : publicKey parse error - " + approverName)
+		}
+
+		if _, isFull := kp.(*stellarkp.Full); isFull {
+			util.Die("Broken Approver : private key must not be stored - " + approverName)
+		}
+
+		approvers[approverName] = &Approver{Name: approverName, KeyPair: kp}
+
+		logger.Info("Approver " + approverName + " loaded")
+	}
+
+	return approvers
+}
@@ -0,0 +1,141 @@
+package approval
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/colligence-io/signServer/server/rr"
+	"github.com/colligence-io/signServer/vault"
+	"github.com/sirupsen/logrus"
+)
+
+// Resolver
+// rebuild execute of request kept before restart from its replay record
+type Resolver func(pending Pending, replay json.RawMessage) (func() rr.ResponseEntity, error)
+
+// record
+// pending request kept in vault
+type record struct {
+	Pending  Pending         `json:"pending"`
+	Callback string          `json:"callback,omitempty"`
+	Replay   json.RawMessage `json:"replay,omitempty"`
+}
+
+type persister struct {
+	vc   *vault.Client
+	path string
+}
+
+// Persist
+// keep requests in vault pendingPath, requests kept before restart are loaded with execute rebuilt by resolve
+// request which was being signed is signed again in background
+func (store *Store) Persist(vc *vault.Client, pendingPath string, resolve Resolver) error {
+	p := &persister{vc: vc, path: pendingPath}
+
+	records, e := p.load()
+	if e != nil {
+		return e
+	}
+
+	var signing []*entry
+
+	store.mutex.Lock()
+	store.persister = p
+	for _, r := range records {
+		e := &entry{pending: r.Pending, callback: r.Callback, replay: r.Replay}
+		entryLogger := logger.WithFields(logrus.Fields{"id": r.Pending.ID, "app": r.Pending.App, "rule": r.Pending.Rule})
+
+		if e.pending.Status == StatusPending || e.pending.Status == StatusSigning {
+			execute, err := resolve(e.pending, e.replay)
+			if err != nil {
+				entryLogger.Error("pending request cannot be restored : ", err)
+				result := rr.ErrorResponse(err)
+				e.pending.Result = &result
+				e.pending.Status = StatusFailed
+				if err := store.save(e); err != nil {
+					entryLogger.Error("result is not kept : ", err)
+				}
+			}
+			e.execute = execute
+		}
+
+		store.entries[e.pending.ID] = e
+		store.expire(e)
+
+		if e.pending.Status == StatusSigning {
+			signing = append(signing, e)
+		}
+	}
+	store.mutex.Unlock()
+
+	logger.Info(len(records), " approval requests loaded from ", pendingPath)
+
+	for _, e := range signing {
+		entryLogger := logger.WithFields(logrus.Fields{"id": e.pending.ID, "app": e.pending.App, "rule": e.pending.Rule})
+		entryLogger.Warn("approved request was not signed before restart, signing again")
+		go store.sign(e, entryLogger)
+	}
+
+	return nil
+}
+
+// save
+// keep entry in vault, store must be locked
+func (store *Store) save(e *entry) error {
+	if store.persister == nil {
+		return nil
+	}
+
+	rBytes, err := json.Marshal(record{Pending: e.pending, Callback: e.callback, Replay: e.replay})
+	if err != nil {
+		return err
+	}
+
+	_, err = store.persister.vc.Logical().Write(store.persister.path+"/"+e.pending.ID, map[string]interface{}{
+		"record": string(rBytes),
+	})
+	return err
+}
+
+// remove
+// remove entry of id from vault, store must be locked
+func (store *Store) remove(id string) error {
+	if store.persister == nil {
+		return nil
+	}
+
+	_, err := store.persister.vc.Logical().Delete(store.persister.path + "/" + id)
+	return err
+}
+
+func (p *persister) load() ([]record, error) {
+	idList, e := p.vc.Logical().List(p.path)
+	if e != nil {
+		return nil, e
+	}
+	if idList == nil || idList.Data == nil {
+		return nil, nil
+	}
+
+	keys, _ := idList.Data["keys"].([]interface{})
+	records := make([]record, 0, len(keys))
+	for _, ik := range keys {
+		id, _ := ik.(string)
+
+		secret, e := p.vc.Logical().Read(p.path + "/" + id)
+		if e != nil {
+			return nil, e
+		}
+		if secret == nil || secret.Data == nil {
+			continue
+		}
+
+		rString, _ := secret.Data["record"].(string)
+		var r record
+		if e := json.Unmarshal([]byte(rString), &r); e != nil || r.Pending.ID != id {
+			return nil, errors.New("broken approval request " + p.path + "/" + id)
+		}
+		records = append(records, r)
+	}
+
+	return records, nil
+}
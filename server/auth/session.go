@@ -8,6 +8,8 @@ type Session struct {
 	// key = symbol:address
 	Quizzes map[string]Quiz
 	Expires time.Time
+	// id of approved request replayed after restart, set by server only
+	Approved string
 }
 
 type Quiz struct {
@@ -20,3 +22,23 @@ type Quiz struct {
 func (s *Session) IsExpired() bool {
 	return s.Expires.Before(time.Now())
 }
+
+// find quiz for keyID
+func (s *Session) GetQuiz(keyID string) (Quiz, bool) {
+	for _, quiz := range s.Quizzes {
+		if quiz.KeyID == keyID {
+			return quiz, true
+		}
+	}
+	return Quiz{}, false
+}
+
+// find quiz key (symbol:address) for keyID
+func (s *Session) GetQuizKey(keyID string) (string, bool) {
+	for quizKey, quiz := range s.Quizzes {
+		if quiz.KeyID == keyID {
+			return quizKey, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,137 @@
+package idempotency
+
+import (
+	"errors"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+/*
+IDEMPOTENCY KEY
+
+response of request with Idempotency-Key is kept per app for window
+repeat with same key and same request (digest) gets kept response, repeat with other request is conflict
+key is reserved while first request is in progress, repeat at that time is conflict too
+response which is not final (server error, rate limited) releases key, so that request can be retried
+*/
+
+var logger = logrus.WithField("module", "Idempotency")
+
+// longest key accepted
+const MaxKeyLength = 255
+
+var (
+	ErrInvalidKey = errors.New("idempotency key must be 1 to 255 characters")
+	ErrConflict   = errors.New("idempotency key is already used for other request")
+	ErrInProgress = errors.New("request of idempotency key is in progress")
+)
+
+// Response
+// response as written to client
+type Response struct {
+	Code int
+	Body []byte
+}
+
+type entry struct {
+	digest   string
+	response *Response
+	expires  time.Time
+}
+
+type Store struct {
+	window time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]*entry
+}
+
+// New
+// store with expired keys removed every minute
+func New(window time.Duration) *Store {
+	store := NewStore(window)
+	store.autoCleanup()
+	return store
+}
+
+// NewStore
+// store keeping responses for window
+func NewStore(window time.Duration) *Store {
+	return &Store{
+		window:  window,
+		entries: make(map[string]*entry),
+	}
+}
+
+func entryKey(app string, key string) string {
+	return app + "\x00" + key
+}
+
+// Begin
+// kept response of key if request is repeated, otherwise key is reserved for request (nil response)
+func (store *Store) Begin(app string, key string, digest string, now time.Time) (*Response, error) {
+	if key == "" || len(key) > MaxKeyLength {
+		return nil, ErrInvalidKey
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if e, found := store.entries[entryKey(app, key)]; found && now.Before(e.expires) {
+		if e.digest != digest {
+			return nil, ErrConflict
+		}
+		if e.response == nil {
+			return nil, ErrInProgress
+		}
+
+		logger.WithFields(logrus.Fields{"app": app, "key": key}).Info("repeated request, kept response returned")
+		return e.response, nil
+	}
+
+	store.entries[entryKey(app, key)] = &entry{digest: digest, expires: now.Add(store.window)}
+	return nil, nil
+}
+
+// Finish
+// keep response of reserved key until window ends
+func (store *Store) Finish(app string, key string, response Response) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if e, found := store.entries[entryKey(app, key)]; found {
+		e.response = &response
+	}
+}
+
+// Release
+// remove reserved key without response, so that request can be retried
+func (store *Store) Release(app string, key string) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.entries, entryKey(app, key))
+}
+
+func (store *Store) autoCleanup() {
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+			store.removeExpired(time.Now())
+		}
+	}()
+}
+
+// removeExpired
+// remove finished keys past window, keys in progress are kept
+func (store *Store) removeExpired(now time.Time) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for k, e := range store.entries {
+		if e.response != nil && !now.Before(e.expires) {
+			delete(store.entries, k)
+		}
+	}
+}
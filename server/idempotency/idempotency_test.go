@@ -0,0 +1,67 @@
+package idempotency_test
+
+import (
+	"github.com/colligence-io/signServer/server/idempotency"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepeat(t *testing.T) {
+	store := idempotency.NewStore(time.Hour)
+	now := time.Now()
+
+	response, err := store.Begin("exchange", "payout-1", "digest-a", now)
+	if response != nil || err != nil {
+		t.Fatal("ER : first request", response, err)
+	}
+
+	if _, err := store.Begin("exchange", "payout-1", "digest-a", now); err != idempotency.ErrInProgress {
+		t.Error("ER : repeat in progress", err)
+	}
+
+	store.Finish("exchange", "payout-1", idempotency.Response{Code: 200, Body: []byte("signature")})
+
+	response, err = store.Begin("exchange", "payout-1", "digest-a", now.Add(time.Minute))
+	if err != nil || response == nil || string(response.Body) != "signature" {
+		t.Error("ER : repeat", response, err)
+	}
+
+	if _, err := store.Begin("exchange", "payout-1", "digest-b", now); err != idempotency.ErrConflict {
+		t.Error("ER : other request with same key", err)
+	}
+
+	// keys are per app
+	if response, err := store.Begin("wallet", "payout-1", "digest-b", now); response != nil || err != nil {
+		t.Error("ER : same key of other app", response, err)
+	}
+
+	// window is over
+	if response, err := store.Begin("exchange", "payout-1", "digest-b", now.Add(time.Hour)); response != nil || err != nil {
+		t.Error("ER : key after window", response, err)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	store := idempotency.NewStore(time.Hour)
+	now := time.Now()
+
+	if _, err := store.Begin("exchange", "payout-1", "digest-a", now); err != nil {
+		t.Fatal(err)
+	}
+	store.Release("exchange", "payout-1")
+
+	if response, err := store.Begin("exchange", "payout-1", "digest-a", now); response != nil || err != nil {
+		t.Error("ER : retry after release", response, err)
+	}
+}
+
+func TestInvalidKey(t *testing.T) {
+	store := idempotency.NewStore(time.Hour)
+
+	for _, key := range []string{"", strings.Repeat("k", idempotency.MaxKeyLength+1)} {
+		if _, err := store.Begin("exchange", key, "digest", time.Now()); err != idempotency.ErrInvalidKey {
+			t.Error("ER : invalid key accepted", len(key))
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package job
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+/*
+finished job (and finished approval) is POSTed to callback URL
+X-Signature-Timestamp : unix time of callback
+X-Signature : hex HMAC-SHA256 of "{timestamp}.{body}" with server.jobCallbackSecret
+
+callback host must be one of server.callbackHosts
+without callbackHosts, any host is accepted but connection is made to public address only (no loopback, private, link-local)
+*/
+
+const (
+	SignatureHeader          = "X-Signature"
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+)
+
+// callback attempts
+const callbackAttempts = 3
+
+var (
+	ErrNoCallbackSecret    = errors.New("job callback secret is not configured")
+	ErrInvalidCallback     = errors.New("callback must be http(s) URL")
+	ErrCallbackNotAllowed  = errors.New("callback host is not allowed")
+	errNonPublicConnection = errors.New("callback to non-public address is refused")
+)
+
+// Notifier
+// POSTs signed callback, shared by jobs and approvals
+type Notifier struct {
+	secret []byte
+	hosts  map[string]bool
+	client *http.Client
+}
+
+// NewNotifier
+// callback signed with secret, allowedHosts empty means any public host
+func NewNotifier(secret string, allowedHosts []string) *Notifier {
+	n := &Notifier{
+		secret: []byte(secret),
+		hosts:  make(map[string]bool),
+	}
+	for _, host := range allowedHosts {
+		n.hosts[strings.ToLower(host)] = true
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if len(n.hosts) == 0 {
+		dialer.Control = publicOnly
+	}
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConns:        10,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	n.client = &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+		// redirect could lead callback to other host
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return n
+}
+
+func (n *Notifier) enabled() bool {
+	return len(n.secret) > 0
+}
+
+// Check
+// callback URL can be notified
+func (n *Notifier) Check(callback string) error {
+	u, e := url.Parse(callback)
+	if e != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidCallback
+	}
+	if !n.enabled() {
+		return ErrNoCallbackSecret
+	}
+	if len(n.hosts) > 0 && !n.hosts[strings.ToLower(u.Hostname())] {
+		return ErrCallbackNotAllowed
+	}
+	return nil
+}
+
+// publicOnly
+// dialer control refusing non-public address, checked after name resolution
+func publicOnly(network string, address string, c syscall.RawConn) error {
+	host, _, e := net.SplitHostPort(address)
+	if e != nil {
+		return e
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || isPrivate(ip) {
+		return errNonPublicConnection
+	}
+	return nil
+}
+
+// private networks, RFC 1918, RFC 6598 (shared) and RFC 4193 (unique local)
+var privateNetworks = parseNetworks("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7")
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, e := net.ParseCIDR(cidr)
+		if e != nil {
+			panic(e)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+func isPrivate(ip net.IP) bool {
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// CallbackSignature
+// hex HMAC-SHA256 of timestamp and body of callback
+func CallbackSignature(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notify
+// POST value as JSON to callback URL, retried on failure, name identifies callback in log
+func (n *Notifier) Notify(callback string, name string, value interface{}) {
+	if callback == "" {
+		return
+	}
+
+	// callback of request accepted before restart or config change is checked again
+	if e := n.Check(callback); e != nil {
+		logger.Error("callback of ", name, " is not posted : ", e)
+		return
+	}
+
+	go func() {
+		vBytes, e := json.Marshal(value)
+		if e != nil {
+			logger.Error(e)
+			return
+		}
+
+		for attempt := 1; attempt <= callbackAttempts; attempt++ {
+			if e = n.post(callback, vBytes); e == nil {
+				return
+			}
+			logger.Error("callback of ", name, " failed (", attempt, "/", callbackAttempts, ") : ", e)
+			if isNonPublic(e) {
+				return
+			}
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+	}()
+}
+
+// isNonPublic
+// error of connection refused by publicOnly
+func isNonPublic(e error) bool {
+	if urlErr, ok := e.(*url.Error); ok {
+		e = urlErr.Err
+	}
+	if opErr, ok := e.(*net.OpError); ok {
+		e = opErr.Err
+	}
+	return e == errNonPublicConnection
+}
+
+func (n *Notifier) post(callback string, body []byte) error {
+	req, e := http.NewRequest(http.MethodPost, callback, bytes.NewReader(body))
+	if e != nil {
+		return e
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureTimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, CallbackSignature(n.secret, timestamp, body))
+
+	res, e := n.client.Do(req)
+	if e != nil {
+		return e
+	}
+	_ = res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return errors.New("callback responded " + res.Status)
+	}
+	return nil
+}
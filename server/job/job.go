@@ -0,0 +1,337 @@
+package job
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/colligence-io/signServer/server/rr"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/*
+ASYNC JOB
+
+request is accepted as job and run by workers, client polls job or gets result by callback
+jobs wait in unbounded queue, so that busy signer pool does not reject them : task returns ErrRetry and job is queued again with backoff
+task returns ErrWaiting when its result comes later (approval), and Complete is called with result
+job which is not finished within retention expires, finished job is removed after retention
+*/
+
+var logger = logrus.WithField("module", "Job")
+
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusWaiting   Status = "waiting"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusExpired   Status = "expired"
+)
+
+var (
+	// task is not run this time, run it again later
+	ErrRetry = errors.New("job will be retried")
+	// task result is given by Complete later
+	ErrWaiting  = errors.New("job is waiting")
+	ErrNotFound = errors.New("job not found")
+)
+
+// backoff of retry
+const (
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+)
+
+// Task
+// work of job, id is given to complete waiting job
+type Task func(id string) (rr.ResponseEntity, error)
+
+// Job
+type Job struct {
+	ID       string             `json:"id"`
+	App      string             `json:"app"`
+	Request  string             `json:"request"`
+	Status   Status             `json:"status"`
+	Attempts int                `json:"attempts"`
+	Created  int64              `json:"created"`
+	Finished int64              `json:"finished,omitempty"`
+	Expires  int64              `json:"expires"`
+	Result   *rr.ResponseEntity `json:"result,omitempty"`
+}
+
+func (job *Job) finished() bool {
+	return job.Status == StatusSucceeded || job.Status == StatusFailed || job.Status == StatusExpired
+}
+
+type entry struct {
+	job      Job
+	task     Task
+	callback string
+	backoff  time.Duration
+}
+
+type Store struct {
+	retention time.Duration
+	notifier  *Notifier
+
+	mutex   sync.Mutex
+	entries map[string]*entry
+	queue   []string
+	ready   chan struct{}
+}
+
+// New
+// store with workers running jobs, and finished jobs removed every minute
+func New(workers int, retention time.Duration, notifier *Notifier) *Store {
+	store := NewStore(workers, retention, notifier)
+	store.autoCleanup()
+	return store
+}
+
+// NewStore
+// store with workers running jobs, finished job is posted to callback by notifier
+func NewStore(workers int, retention time.Duration, notifier *Notifier) *Store {
+	if workers <= 0 {
+		workers = 1
+	}
+
+	store := &Store{
+		retention: retention,
+		notifier:  notifier,
+		entries:   make(map[string]*entry),
+		ready:     make(chan struct{}, 1),
+	}
+
+	for i := 0; i < workers; i++ {
+		go store.work()
+	}
+
+	return store
+}
+
+// Submit
+// queue task of app, request describes what job does, callback is URL to POST finished job (optional)
+func (store *Store) Submit(app string, request string, callback string, task Task) (Job, error) {
+	if callback != "" {
+		if e := store.notifier.Check(callback); e != nil {
+			return Job{}, e
+		}
+	}
+
+	idBytes := make([]byte, 16)
+	if _, e := io.ReadFull(rand.Reader, idBytes); e != nil {
+		return Job{}, e
+	}
+
+	now := time.Now().UTC()
+
+	job := Job{
+		ID:      hex.EncodeToString(idBytes),
+		App:     app,
+		Request: request,
+		Status:  StatusQueued,
+		Created: now.Unix(),
+		Expires: now.Add(store.retention).Unix(),
+	}
+
+	store.mutex.Lock()
+	store.entries[job.ID] = &entry{job: job, task: task, callback: callback, backoff: minBackoff}
+	store.mutex.Unlock()
+
+	logger.WithFields(logrus.Fields{"id": job.ID, "app": app, "request": request}).Info("job queued")
+
+	store.enqueue(job.ID)
+
+	return job, nil
+}
+
+// Get
+// job of id
+func (store *Store) Get(id string) (Job, bool) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	e, found := store.entries[id]
+	if !found {
+		return Job{}, false
+	}
+	store.expire(e, time.Now())
+	return e.job, true
+}
+
+// Complete
+// result of waiting job
+func (store *Store) Complete(id string, result rr.ResponseEntity) error {
+	store.mutex.Lock()
+
+	e, found := store.entries[id]
+	if !found {
+		store.mutex.Unlock()
+		return ErrNotFound
+	}
+	// result may come before task returns ErrWaiting
+	if e.job.Status != StatusWaiting && e.job.Status != StatusRunning {
+		store.mutex.Unlock()
+		return errors.New("job is not waiting")
+	}
+
+	store.finish(e, result)
+	store.mutex.Unlock()
+
+	return nil
+}
+
+func (store *Store) enqueue(id string) {
+	store.mutex.Lock()
+	store.queue = append(store.queue, id)
+	store.mutex.Unlock()
+
+	store.signal()
+}
+
+// signal
+// wake one worker, queue is checked again by woken worker
+func (store *Store) signal() {
+	select {
+	case store.ready <- struct{}{}:
+	default:
+	}
+}
+
+// next
+// next queued entry, nil if queue is empty
+func (store *Store) next() *entry {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for len(store.queue) > 0 {
+		id := store.queue[0]
+		store.queue = store.queue[1:]
+
+		e, found := store.entries[id]
+		if !found {
+			continue
+		}
+		store.expire(e, time.Now())
+		if e.job.Status != StatusQueued {
+			continue
+		}
+
+		e.job.Status = StatusRunning
+		e.job.Attempts++
+		return e
+	}
+
+	return nil
+}
+
+func (store *Store) work() {
+	for range store.ready {
+		for {
+			e := store.next()
+			if e == nil {
+				break
+			}
+			// other workers can take rest of queue
+			store.signal()
+			store.run(e)
+		}
+	}
+}
+
+func (store *Store) run(e *entry) {
+	result, err := e.task(e.job.ID)
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	switch err {
+	case nil:
+		store.finish(e, result)
+
+	case ErrWaiting:
+		// Complete may be called before task returns
+		if e.job.Status == StatusRunning {
+			e.job.Status = StatusWaiting
+		}
+
+	case ErrRetry:
+		e.job.Status = StatusQueued
+		backoff := e.backoff
+		if e.backoff *= 2; e.backoff > maxBackoff {
+			e.backoff = maxBackoff
+		}
+		logger.WithFields(logrus.Fields{"id": e.job.ID, "attempts": e.job.Attempts}).Warn("job is retried after ", backoff)
+		id := e.job.ID
+		time.AfterFunc(backoff, func() { store.enqueue(id) })
+
+	default:
+		store.finish(e, rr.ErrorResponse(err))
+	}
+}
+
+// finish
+// keep result and notify callback, store must be locked
+func (store *Store) finish(e *entry, result rr.ResponseEntity) {
+	now := time.Now().UTC()
+
+	e.job.Result = &result
+	if result.Code/100 == 2 {
+		e.job.Status = StatusSucceeded
+	} else {
+		e.job.Status = StatusFailed
+	}
+	e.job.Finished = now.Unix()
+	e.job.Expires = now.Add(store.retention).Unix()
+	e.task = nil
+
+	logger.WithFields(logrus.Fields{"id": e.job.ID, "app": e.job.App, "code": result.Code}).Info("job ", e.job.Status)
+
+	store.notifier.Notify(e.callback, "job "+e.job.ID, e.job)
+}
+
+// expire
+// unfinished job past its expiration is expired, store must be locked
+// waiting job is not expired, its result comes from approval which expires by itself
+func (store *Store) expire(e *entry, now time.Time) {
+	if e.job.Status == StatusQueued && now.Unix() >= e.job.Expires {
+		result := rr.KoResponse(http.StatusGatewayTimeout, "job is not finished within retention")
+		e.job.Result = &result
+		e.job.Status = StatusExpired
+		e.job.Finished = now.Unix()
+		e.job.Expires = now.Add(store.retention).Unix()
+		e.task = nil
+
+		logger.WithField("id", e.job.ID).Warn("job expired")
+		store.notifier.Notify(e.callback, "job "+e.job.ID, e.job)
+	}
+}
+
+func (store *Store) autoCleanup() {
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+			store.removeFinished(time.Now())
+		}
+	}()
+}
+
+// removeFinished
+// expire unfinished jobs, and remove finished jobs past retention
+func (store *Store) removeFinished(now time.Time) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for id, e := range store.entries {
+		store.expire(e, now)
+		if e.job.finished() && now.Unix() >= e.job.Expires {
+			delete(store.entries, id)
+		}
+	}
+}
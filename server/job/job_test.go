@@ -0,0 +1,172 @@
+package job_test
+
+import (
+	"encoding/json"
+	"github.com/colligence-io/signServer/server/job"
+	"github.com/colligence-io/signServer/server/rr"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// wait until job is finished
+func waitFinished(t *testing.T, store *job.Store, id string) job.Job {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		j, found := store.Get(id)
+		if !found {
+			t.Fatal("ER : job not found", id)
+		}
+		if j.Status == job.StatusSucceeded || j.Status == job.StatusFailed || j.Status == job.StatusExpired {
+			return j
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("ER : job is not finished", id)
+	return job.Job{}
+}
+
+func TestRun(t *testing.T) {
+	store := job.NewStore(2, time.Hour, job.NewNotifier("", nil))
+
+	submitted, err := store.Submit("exchange", "POST /sign", "", func(id string) (rr.ResponseEntity, error) {
+		return rr.OkResponse("signed"), nil
+	})
+	if err != nil || submitted.Status != job.StatusQueued {
+		t.Fatal("ER : Submit", submitted, err)
+	}
+
+	finished := waitFinished(t, store, submitted.ID)
+	if finished.Status != job.StatusSucceeded || finished.Result == nil || finished.Result.Data != "signed" || finished.Attempts != 1 {
+		t.Error("ER : finished", finished)
+	}
+
+	failed, _ := store.Submit("exchange", "POST /sign", "", func(id string) (rr.ResponseEntity, error) {
+		return rr.KoResponse(http.StatusForbidden, "denied"), nil
+	})
+	if j := waitFinished(t, store, failed.ID); j.Status != job.StatusFailed || j.Result.Code != http.StatusForbidden {
+		t.Error("ER : failed", j)
+	}
+
+	if _, found := store.Get("unknown"); found {
+		t.Error("ER : unknown job found")
+	}
+}
+
+func TestRetry(t *testing.T) {
+	store := job.NewStore(1, time.Hour, job.NewNotifier("", nil))
+
+	attempts := 0
+	submitted, _ := store.Submit("exchange", "POST /sign", "", func(id string) (rr.ResponseEntity, error) {
+		if attempts++; attempts == 1 {
+			return rr.ResponseEntity{}, job.ErrRetry
+		}
+		return rr.OkResponse("signed"), nil
+	})
+
+	if j := waitFinished(t, store, submitted.ID); j.Status != job.StatusSucceeded || j.Attempts != 2 {
+		t.Error("ER : retried", j)
+	}
+}
+
+func TestWaiting(t *testing.T) {
+	store := job.NewStore(1, time.Hour, job.NewNotifier("", nil))
+
+	submitted, _ := store.Submit("exchange", "POST /sign", "", func(id string) (rr.ResponseEntity, error) {
+		return rr.ResponseEntity{}, job.ErrWaiting
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for j, _ := store.Get(submitted.ID); j.Status != job.StatusWaiting; j, _ = store.Get(submitted.ID) {
+		if time.Now().After(deadline) {
+			t.Fatal("ER : job is not waiting", j)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := store.Complete(submitted.ID, rr.OkResponse("approved")); err != nil {
+		t.Fatal("ER : Complete", err)
+	}
+	if j := waitFinished(t, store, submitted.ID); j.Status != job.StatusSucceeded || j.Result.Data != "approved" {
+		t.Error("ER : completed", j)
+	}
+	if err := store.Complete(submitted.ID, rr.OkResponse("again")); err == nil {
+		t.Error("ER : finished job completed again")
+	}
+}
+
+func TestCallback(t *testing.T) {
+	secret := "callback-secret"
+
+	received := make(chan job.Job, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		if req.Header.Get(job.SignatureHeader) != job.CallbackSignature([]byte(secret), req.Header.Get(job.SignatureTimestampHeader), body) {
+			t.Error("ER : callback signature")
+		}
+		var j job.Job
+		if err := json.Unmarshal(body, &j); err != nil {
+			t.Error(err)
+		}
+		received <- j
+	}))
+	defer server.Close()
+
+	if _, err := job.NewStore(1, time.Hour, job.NewNotifier("", nil)).Submit("exchange", "POST /sign", server.URL, nil); err == nil {
+		t.Error("ER : callback without secret accepted")
+	}
+
+	// test server listens on loopback, which is refused unless allowed
+	store := job.NewStore(1, time.Hour, job.NewNotifier(secret, []string{"127.0.0.1"}))
+	if _, err := store.Submit("exchange", "POST /sign", "ftp://example.com", nil); err == nil {
+		t.Error("ER : non-http callback accepted")
+	}
+
+	submitted, err := store.Submit("exchange", "POST /sign", server.URL, func(id string) (rr.ResponseEntity, error) {
+		return rr.OkResponse("signed"), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case posted := <-received:
+		if posted.ID != submitted.ID || posted.Status != job.StatusSucceeded {
+			t.Error("ER : callback", posted)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("ER : callback is not posted")
+	}
+}
+
+func TestCallbackHosts(t *testing.T) {
+	allowed := job.NewNotifier("secret", []string{"hooks.example.com"})
+	if err := allowed.Check("https://hooks.example.com/done"); err != nil {
+		t.Error("ER : allowed host", err)
+	}
+	if err := allowed.Check("https://hooks.example.com.evil.io/done"); err != job.ErrCallbackNotAllowed {
+		t.Error("ER : host not in list accepted", err)
+	}
+
+	received := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		received <- struct{}{}
+	}))
+	defer server.Close()
+
+	// without allow list, loopback of test server is refused at connection
+	store := job.NewStore(1, time.Hour, job.NewNotifier("secret", nil))
+	if _, err := store.Submit("exchange", "POST /sign", server.URL, func(id string) (rr.ResponseEntity, error) {
+		return rr.OkResponse("signed"), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-received:
+		t.Error("ER : callback posted to loopback")
+	case <-time.After(time.Second):
+	}
+}
@@ -0,0 +1,188 @@
+package policy
+
+import (
+	"github.com/colligence-io/signServer/vault"
+	"github.com/sirupsen/logrus"
+	"math/big"
+	"sort"
+	"time"
+)
+
+/*
+SIGNING POLICY
+
+rules are stored in vault (vault.policyPath/{ruleName}) and evaluated before every signature
+rules are tried in priority order (lower first, then name), first matching rule decides
+if no rule matches, server.policyDefault decides (deny if not set)
+no rule (or no policyPath) is same, so that policy is turned off only by explicit policyDefault allow
+*/
+
+var logger = logrus.WithField("module", "Policy")
+
+type Decision string
+
+const (
+	Allow           Decision = "allow"
+	Deny            Decision = "deny"
+	RequireApproval Decision = "require-approval"
+)
+
+var Decisions = map[string]Decision{
+	string(Allow):           Allow,
+	string(Deny):            Deny,
+	string(RequireApproval): RequireApproval,
+}
+
+type Operation string
+
+const (
+	OpSign         Operation = "sign"
+	OpBTCPSBT      Operation = "btc.psbt"
+	OpBTCMessage   Operation = "btc.message"
+	OpETHTx        Operation = "eth.tx"
+	OpETHMessage   Operation = "eth.message"
+	OpETHTypedData Operation = "eth.typedData"
+	OpXLMEnvelope  Operation = "xlm.envelope"
+)
+
+var Operations = map[Operation]bool{
+	OpSign:         true,
+	OpBTCPSBT:      true,
+	OpBTCMessage:   true,
+	OpETHTx:        true,
+	OpETHMessage:   true,
+	OpETHTypedData: true,
+	OpXLMEnvelope:  true,
+}
+
+const defaultRuleName = "(default)"
+
+// Request
+// what is about to be signed, Destinations and Amount are known for decoded transaction only
+type Request struct {
+	App       string
+	KeyID     string
+	Symbol    string
+	Operation Operation
+	// nil if not known, empty if nothing leaves keystore
+	Destinations []string
+	// in base unit of chain (satoshi, wei, stroop), nil if not known
+	Amount *big.Int
+	Time   time.Time
+}
+
+type Result struct {
+	Decision Decision
+	Rule     string
+	// M of require-approval, default threshold if 0
+	Approvals int
+}
+
+type Engine struct {
+	rules           []*Rule
+	defaultDecision Decision
+}
+
+// New
+// load rules from vault policyPath, every request is decided by defaultDecision if path is empty
+func New(vc *vault.Client, policyPath string, defaultDecision string) *Engine {
+	var rules []*Rule
+	if policyPath != "" {
+		rules = loadRules(vc, policyPath)
+	}
+	return NewEngine(rules, defaultDecision)
+}
+
+// NewEngine
+// engine of rules, defaultDecision is deny if empty
+func NewEngine(rules []*Rule, defaultDecision string) *Engine {
+	decision, found := Decisions[defaultDecision]
+	if !found {
+		if defaultDecision != "" {
+			logger.Warn("invalid policy default decision ", defaultDecision, ", deny is used")
+		}
+		decision = Deny
+	}
+
+	if len(rules) == 0 {
+		logger.Warn("no policy rule, every request is decided by default decision ", decision)
+	}
+
+	sorted := append([]*Rule{}, rules...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Priority != sorted[j].Priority {
+			return sorted[i].Priority < sorted[j].Priority
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	return &Engine{rules: sorted, defaultDecision: decision}
+}
+
+// Evaluate
+// decision of first matching rule, every decision is logged with its rule
+func (engine *Engine) Evaluate(request Request) Result {
+	result := engine.evaluate(request)
+
+	entry := logger.WithFields(logrus.Fields{
+		"decision":  result.Decision,
+		"rule":      result.Rule,
+		"app":       request.App,
+		"keyID":     request.KeyID,
+		"symbol":    request.Symbol,
+		"operation": request.Operation,
+	})
+	if request.Destinations != nil {
+		entry = entry.WithField("destinations", request.Destinations)
+	}
+	if request.Amount != nil {
+		entry = entry.WithField("amount", request.Amount.String())
+	}
+
+	if result.Decision == Allow {
+		entry.Info("policy decision")
+	} else {
+		entry.Warn("policy decision")
+	}
+
+	return result
+}
+
+func (engine *Engine) evaluate(request Request) Result {
+	if request.Time.IsZero() {
+		request.Time = time.Now()
+	}
+
+	for _, rule := range engine.rules {
+		if rule.Match(request) {
+			return Result{Decision: rule.Decision, Rule: rule.Name, Approvals: rule.Approvals}
+		}
+	}
+
+	return Result{Decision: engine.defaultDecision, Rule: defaultRuleName}
+}
+
+// Combine
+// most restrictive result, deny > require-approval (more approvals) > allow
+func Combine(results ...Result) Result {
+	combined := Result{Decision: Allow}
+	for i, result := range results {
+		if i == 0 || rank(result.Decision) > rank(combined.Decision) {
+			combined = result
+		} else if result.Decision == RequireApproval && combined.Decision == RequireApproval && result.Approvals > combined.Approvals {
+			combined = result
+		}
+	}
+	return combined
+}
+
+func rank(decision Decision) int {
+	switch decision {
+	case Allow:
+		return 0
+	case RequireApproval:
+		return 1
+	default:
+		return 2
+	}
+}
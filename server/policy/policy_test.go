@@ -0,0 +1,195 @@
+package policy_test
+
+import (
+	"encoding/json"
+	"github.com/colligence-io/signServer/server/policy"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func mustParse(t *testing.T, name string, data map[string]interface{}) *policy.Rule {
+	rule, err := policy.ParseRule(name, data)
+	if err != nil {
+		t.Fatal("ER : ParseRule", name, ":", err)
+	}
+	return rule
+}
+
+// 2019-03-04 is monday
+var monday = time.Date(2019, 3, 4, 10, 30, 0, 0, time.UTC)
+
+func TestEvaluate(t *testing.T) {
+	engine := policy.NewEngine([]*policy.Rule{
+		mustParse(t, "large", map[string]interface{}{
+			"app":        "exchange",
+			"keyID":      "hot1",
+			"operations": "eth.tx",
+			"decision":   "require-approval",
+			"approvals":  json.Number("3"),
+			"priority":   json.Number("20"),
+		}),
+		mustParse(t, "small", map[string]interface{}{
+			"app":          "exchange",
+			"keyID":        "hot1",
+			"operations":   []interface{}{"eth.tx"},
+			"destinations": "0xAbCd000000000000000000000000000000000001, 0xabcd000000000000000000000000000000000002",
+			"maxAmount":    "1000",
+			"timeWindows":  "09:00-18:00",
+			"weekdays":     "mon,tue,wed,thu,fri",
+			"decision":     "allow",
+			"priority":     "10",
+		}),
+		mustParse(t, "messages", map[string]interface{}{
+			"app":        "*",
+			"operations": "eth.message,btc.message",
+			"decision":   "allow",
+		}),
+	}, "")
+
+	request := policy.Request{
+		App:          "exchange",
+		KeyID:        "hot1",
+		Symbol:       "ETH",
+		Operation:    policy.OpETHTx,
+		Destinations: []string{"0xabcd000000000000000000000000000000000001"},
+		Amount:       big.NewInt(1000),
+		Time:         monday,
+	}
+
+	expect := func(name string, request policy.Request, decision policy.Decision, rule string) {
+		result := engine.Evaluate(request)
+		if result.Decision != decision || result.Rule != rule {
+			t.Error("ER :", name, ":", result)
+		}
+	}
+
+	expect("small", request, policy.Allow, "small")
+
+	over := request
+	over.Amount = big.NewInt(1001)
+	expect("amount over", over, policy.RequireApproval, "large")
+	if result := engine.Evaluate(over); result.Approvals != 3 {
+		t.Error("ER : approvals of rule", result)
+	}
+
+	unknown := request
+	unknown.Amount = nil
+	expect("amount unknown", unknown, policy.RequireApproval, "large")
+
+	other := request
+	other.Destinations = []string{"0xabcd000000000000000000000000000000000001", "0x0000000000000000000000000000000000000003"}
+	expect("other destination", other, policy.RequireApproval, "large")
+
+	creation := request
+	creation.Destinations = nil
+	expect("contract creation", creation, policy.RequireApproval, "large")
+
+	night := request
+	night.Time = monday.Add(9 * time.Hour)
+	expect("out of time window", night, policy.RequireApproval, "large")
+
+	sunday := request
+	sunday.Time = monday.Add(-24 * time.Hour)
+	expect("out of weekdays", sunday, policy.RequireApproval, "large")
+
+	otherKey := request
+	otherKey.KeyID = "cold1"
+	expect("other keypair", otherKey, policy.Deny, "(default)")
+
+	message := policy.Request{App: "wallet", KeyID: "cold1", Symbol: "BTC", Operation: policy.OpBTCMessage, Time: monday}
+	expect("any app", message, policy.Allow, "messages")
+
+	sign := message
+	sign.Operation = policy.OpSign
+	expect("default", sign, policy.Deny, "(default)")
+}
+
+func TestNoPolicy(t *testing.T) {
+	// empty policy is decided by default, deny if not set
+	for _, defaultDecision := range []string{"", "deny"} {
+		result := policy.NewEngine(nil, defaultDecision).Evaluate(policy.Request{App: "exchange", Operation: policy.OpSign})
+		if result.Decision != policy.Deny || result.Rule != "(default)" {
+			t.Error("ER : empty policy with default", defaultDecision, result)
+		}
+	}
+	result := policy.NewEngine(nil, "allow").Evaluate(policy.Request{App: "exchange", Operation: policy.OpSign})
+	if result.Decision != policy.Allow || result.Rule != "(default)" {
+		t.Error("ER : empty policy with default allow", result)
+	}
+
+	rule := mustParse(t, "deny-sign", map[string]interface{}{"operations": "sign", "decision": "deny"})
+	result = policy.NewEngine([]*policy.Rule{rule}, "allow").Evaluate(policy.Request{App: "exchange", Operation: policy.OpETHTx})
+	if result.Decision != policy.Allow || result.Rule != "(default)" {
+		t.Error("ER : default decision is not used", result)
+	}
+}
+
+func TestTimeWindow(t *testing.T) {
+	rule := mustParse(t, "night", map[string]interface{}{"timeWindows": "22:00-06:00", "decision": "allow"})
+
+	for hour, in := range map[int]bool{21: false, 22: true, 23: true, 0: true, 5: true, 6: false, 12: false} {
+		request := policy.Request{Time: time.Date(2019, 3, 4, hour, 0, 0, 0, time.UTC)}
+		if rule.Match(request) != in {
+			t.Error("ER : overnight window at", hour)
+		}
+	}
+
+	// time windows are in UTC
+	rule = mustParse(t, "office", map[string]interface{}{"timeWindows": "09:00-18:00", "decision": "allow"})
+	seoul := time.FixedZone("KST", 9*60*60)
+	if rule.Match(policy.Request{Time: time.Date(2019, 3, 4, 10, 0, 0, 0, seoul)}) {
+		t.Error("ER : time window is not in UTC")
+	}
+
+	rule = mustParse(t, "evening", map[string]interface{}{"timeWindows": "18:00-24:00", "decision": "allow"})
+	if !rule.Match(policy.Request{Time: time.Date(2019, 3, 4, 23, 59, 0, 0, time.UTC)}) {
+		t.Error("ER : 24:00 is not end of day")
+	}
+}
+
+func TestCombine(t *testing.T) {
+	result := policy.Combine(
+		policy.Result{Decision: policy.Allow, Rule: "a"},
+		policy.Result{Decision: policy.RequireApproval, Rule: "b"},
+		policy.Result{Decision: policy.Allow, Rule: "c"},
+	)
+	if result.Decision != policy.RequireApproval || result.Rule != "b" {
+		t.Error("ER : Combine", result)
+	}
+
+	result = policy.Combine(
+		policy.Result{Decision: policy.RequireApproval, Rule: "a", Approvals: 2},
+		policy.Result{Decision: policy.RequireApproval, Rule: "b", Approvals: 3},
+	)
+	if result.Rule != "b" {
+		t.Error("ER : Combine approvals", result)
+	}
+
+	result = policy.Combine(policy.Result{Decision: policy.RequireApproval, Rule: "a"}, policy.Result{Decision: policy.Deny, Rule: "b"})
+	if result.Decision != policy.Deny || result.Rule != "b" {
+		t.Error("ER : Combine", result)
+	}
+}
+
+func TestParseRuleInvalid(t *testing.T) {
+	invalid := map[string]map[string]interface{}{
+		"no decision":        {"operations": "sign"},
+		"unknown decision":   {"decision": "maybe"},
+		"unknown operation":  {"operations": "sign,eth.call", "decision": "allow"},
+		"negative amount":    {"maxAmount": "-1", "decision": "allow"},
+		"decimal amount":     {"maxAmount": "1.5", "decision": "allow"},
+		"time window":        {"timeWindows": "9-18", "decision": "allow"},
+		"weekday":            {"weekdays": "monday", "decision": "allow"},
+		"priority":           {"priority": "first", "decision": "allow"},
+		"list item":          {"destinations": []interface{}{1}, "decision": "allow"},
+		"approvals":          {"approvals": "0", "decision": "require-approval"},
+		"approvals of allow": {"approvals": "2", "decision": "allow"},
+	}
+
+	for name, data := range invalid {
+		if _, err := policy.ParseRule(name, data); err == nil {
+			t.Error("ER : invalid rule parsed :", name)
+		}
+	}
+}
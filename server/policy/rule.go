@@ -0,0 +1,340 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/colligence-io/signServer/util"
+	"github.com/colligence-io/signServer/vault"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const anyApp = "*"
+
+// Rule
+// every non-empty condition must hold for rule to match
+type Rule struct {
+	Name     string
+	Priority int64
+	Decision Decision
+	// M of require-approval, default threshold if 0
+	Approvals int
+
+	// scope, empty matches any
+	App   string
+	KeyID string
+
+	// conditions, empty allows any
+	Operations   map[Operation]bool
+	Destinations map[string]bool
+	MaxAmount    *big.Int
+	TimeWindows  []TimeWindow
+	Weekdays     map[time.Weekday]bool
+}
+
+// TimeWindow
+// minutes of day in UTC, From > To wraps midnight
+type TimeWindow struct {
+	From int
+	To   int
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+func loadRules(vc *vault.Client, policyPath string) []*Rule {
+	var rules []*Rule
+
+	ruleList, e := vc.Logical().List(policyPath)
+	util.CheckAndDie(e)
+
+	if ruleList == nil || ruleList.Data == nil {
+		logger.Warn("no policy rule found in ", policyPath)
+		return rules
+	}
+
+	keys, _ := ruleList.Data["keys"].([]interface{})
+	for _, ik := range keys {
+		ruleName := ik.(string)
+
+		ruleSecret, e := vc.Logical().Read(policyPath + "/" + ruleName)
+		util.CheckAndDie(e)
+
+		if ruleSecret == nil || ruleSecret.Data == nil {
+			util.Die("Broken Policy : Data is null - " + ruleName)
+		}
+
+		rule, e := ParseRule(ruleName, ruleSecret.Data)
+		if e != nil {
+			util.Die("Broken Policy : " + e.Error() + " - " + ruleName)
+		}
+
+		rules = append(rules, rule)
+
+		logger.Info("Policy rule " + ruleName + " loaded : " + string(rule.Decision))
+	}
+
+	return rules
+}
+
+// ParseRule
+// rule from vault secret data
+func ParseRule(name string, data map[string]interface{}) (*Rule, error) {
+	rule := &Rule{Name: name}
+
+	decision, found := Decisions[stringValue(data["decision"])]
+	if !found {
+		return nil, fmt.Errorf("decision must be one of allow, deny, require-approval")
+	}
+	rule.Decision = decision
+
+	if approvals := stringValue(data["approvals"]); approvals != "" {
+		a, e := strconv.Atoi(approvals)
+		if e != nil || a <= 0 {
+			return nil, fmt.Errorf("approvals must be positive integer")
+		}
+		if rule.Decision != RequireApproval {
+			return nil, fmt.Errorf("approvals is only for require-approval")
+		}
+		rule.Approvals = a
+	}
+
+	if priority := stringValue(data["priority"]); priority != "" {
+		p, e := strconv.ParseInt(priority, 10, 64)
+		if e != nil {
+			return nil, fmt.Errorf("invalid priority %s", priority)
+		}
+		rule.Priority = p
+	}
+
+	rule.App = stringValue(data["app"])
+	if rule.App == anyApp {
+		rule.App = ""
+	}
+	rule.KeyID = stringValue(data["keyID"])
+
+	operations, e := listValue(data["operations"])
+	if e != nil {
+		return nil, fmt.Errorf("operations : %s", e.Error())
+	}
+	if len(operations) > 0 {
+		rule.Operations = make(map[Operation]bool)
+		for _, operation := range operations {
+			if !Operations[Operation(operation)] {
+				return nil, fmt.Errorf("invalid operation %s", operation)
+			}
+			rule.Operations[Operation(operation)] = true
+		}
+	}
+
+	destinations, e := listValue(data["destinations"])
+	if e != nil {
+		return nil, fmt.Errorf("destinations : %s", e.Error())
+	}
+	if len(destinations) > 0 {
+		rule.Destinations = make(map[string]bool)
+		for _, destination := range destinations {
+			rule.Destinations[normalizeDestination(destination)] = true
+		}
+	}
+
+	if maxAmount := stringValue(data["maxAmount"]); maxAmount != "" {
+		amount, ok := new(big.Int).SetString(maxAmount, 10)
+		if !ok || amount.Sign() < 0 {
+			return nil, fmt.Errorf("maxAmount must be non-negative integer in base unit")
+		}
+		rule.MaxAmount = amount
+	}
+
+	timeWindows, e := listValue(data["timeWindows"])
+	if e != nil {
+		return nil, fmt.Errorf("timeWindows : %s", e.Error())
+	}
+	for _, tw := range timeWindows {
+		window, e := parseTimeWindow(tw)
+		if e != nil {
+			return nil, e
+		}
+		rule.TimeWindows = append(rule.TimeWindows, window)
+	}
+
+	days, e := listValue(data["weekdays"])
+	if e != nil {
+		return nil, fmt.Errorf("weekdays : %s", e.Error())
+	}
+	if len(days) > 0 {
+		rule.Weekdays = make(map[time.Weekday]bool)
+		for _, day := range days {
+			weekday, found := weekdays[strings.ToLower(day)]
+			if !found {
+				return nil, fmt.Errorf("invalid weekday %s", day)
+			}
+			rule.Weekdays[weekday] = true
+		}
+	}
+
+	return rule, nil
+}
+
+// Match
+// true if request is in scope of rule and every condition holds
+func (rule *Rule) Match(request Request) bool {
+	if rule.App != "" && rule.App != request.App {
+		return false
+	}
+
+	if rule.KeyID != "" && rule.KeyID != request.KeyID {
+		return false
+	}
+
+	if rule.Operations != nil && !rule.Operations[request.Operation] {
+		return false
+	}
+
+	// destinations must be known to be allowed
+	if rule.Destinations != nil {
+		if request.Destinations == nil {
+			return false
+		}
+		for _, destination := range request.Destinations {
+			if !rule.Destinations[normalizeDestination(destination)] {
+				return false
+			}
+		}
+	}
+
+	// amount must be known to be limited
+	if rule.MaxAmount != nil {
+		if request.Amount == nil || request.Amount.Cmp(rule.MaxAmount) > 0 {
+			return false
+		}
+	}
+
+	utc := request.Time.UTC()
+
+	if rule.Weekdays != nil && !rule.Weekdays[utc.Weekday()] {
+		return false
+	}
+
+	if len(rule.TimeWindows) > 0 {
+		minute := utc.Hour()*60 + utc.Minute()
+		inWindow := false
+		for _, window := range rule.TimeWindows {
+			if window.Contains(minute) {
+				inWindow = true
+				break
+			}
+		}
+		if !inWindow {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Contains
+// true if minute of day is in [From, To)
+func (window TimeWindow) Contains(minute int) bool {
+	if window.From <= window.To {
+		return minute >= window.From && minute < window.To
+	}
+	return minute >= window.From || minute < window.To
+}
+
+// parseTimeWindow
+// HH:MM-HH:MM in UTC
+func parseTimeWindow(s string) (TimeWindow, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return TimeWindow{}, fmt.Errorf("time window must be HH:MM-HH:MM : %s", s)
+	}
+
+	from, e := parseMinuteOfDay(parts[0])
+	if e != nil {
+		return TimeWindow{}, fmt.Errorf("time window must be HH:MM-HH:MM : %s", s)
+	}
+
+	to, e := parseMinuteOfDay(parts[1])
+	if e != nil {
+		return TimeWindow{}, fmt.Errorf("time window must be HH:MM-HH:MM : %s", s)
+	}
+
+	return TimeWindow{From: from, To: to}, nil
+}
+
+func parseMinuteOfDay(s string) (int, error) {
+	t, e := time.Parse("15:04", strings.TrimSpace(s))
+	if e != nil {
+		// 24:00 is end of day
+		if strings.TrimSpace(s) == "24:00" {
+			return 24 * 60, nil
+		}
+		return 0, e
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// normalizeDestination
+// hex addresses are compared case-insensitively
+func normalizeDestination(destination string) string {
+	destination = strings.TrimSpace(destination)
+	if strings.HasPrefix(destination, "0x") || strings.HasPrefix(destination, "0X") {
+		return strings.ToLower(destination)
+	}
+	return destination
+}
+
+func stringValue(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return strings.TrimSpace(value)
+	case json.Number:
+		return value.String()
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// listValue
+// list of strings from json array or comma separated string
+func listValue(v interface{}) ([]string, error) {
+	var list []string
+
+	switch value := v.(type) {
+	case nil:
+	case string:
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("list item must be string")
+			}
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("must be list or comma separated string")
+	}
+
+	return list, nil
+}
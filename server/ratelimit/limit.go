@@ -0,0 +1,142 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/colligence-io/signServer/util"
+	"github.com/colligence-io/signServer/vault"
+	"math/big"
+	"strings"
+)
+
+type Kind string
+
+const (
+	RequestsPerMinute Kind = "requestsPerMinute"
+	SignaturesPerDay  Kind = "signaturesPerDay"
+	ValuePerDay       Kind = "valuePerDay"
+)
+
+var Kinds = map[string]Kind{
+	string(RequestsPerMinute): RequestsPerMinute,
+	string(SignaturesPerDay):  SignaturesPerDay,
+	string(ValuePerDay):       ValuePerDay,
+}
+
+type Scope string
+
+const (
+	Global Scope = "global"
+	App    Scope = "app"
+	Key    Scope = "key"
+)
+
+var Scopes = map[string]Scope{
+	string(Global): Global,
+	string(App):    App,
+	string(Key):    Key,
+}
+
+// Limit
+// counted separately for each app (app scope), keypair (key scope) or once for all (global scope)
+type Limit struct {
+	Name  string
+	Kind  Kind
+	Scope Scope
+	Max   *big.Int
+
+	// requests counted by limit, empty matches any
+	App    string
+	KeyID  string
+	Symbol string
+}
+
+func loadLimits(vc *vault.Client, rateLimitPath string) []*Limit {
+	var limits []*Limit
+
+	limitList, e := vc.Logical().List(rateLimitPath)
+	util.CheckAndDie(e)
+
+	if limitList == nil || limitList.Data == nil {
+		logger.Warn("no rate limit found in ", rateLimitPath)
+		return limits
+	}
+
+	keys, _ := limitList.Data["keys"].([]interface{})
+	for _, ik := range keys {
+		limitName := ik.(string)
+
+		limitSecret, e := vc.Logical().Read(rateLimitPath + "/" + limitName)
+		util.CheckAndDie(e)
+
+		if limitSecret == nil || limitSecret.Data == nil {
+			util.Die("Broken RateLimit : Data is null - " + limitName)
+		}
+
+		limit, e := ParseLimit(limitName, limitSecret.Data)
+		if e != nil {
+			util.Die("Broken RateLimit : " + e.Error() + " - " + limitName)
+		}
+
+		limits = append(limits, limit)
+
+		logger.Info("Rate limit " + limitName + " loaded : " + limit.Max.String() + " " + string(limit.Kind) + " per " + string(limit.Scope))
+	}
+
+	return limits
+}
+
+// ParseLimit
+// limit from vault secret data
+func ParseLimit(name string, data map[string]interface{}) (*Limit, error) {
+	if strings.Contains(name, "|") {
+		return nil, fmt.Errorf("limit name must not contain |")
+	}
+
+	limit := &Limit{Name: name}
+
+	kind, found := Kinds[stringValue(data["kind"])]
+	if !found {
+		return nil, fmt.Errorf("kind must be one of requestsPerMinute, signaturesPerDay, valuePerDay")
+	}
+	limit.Kind = kind
+
+	scope, found := Scopes[stringValue(data["scope"])]
+	if !found {
+		return nil, fmt.Errorf("scope must be one of global, app, key")
+	}
+	limit.Scope = scope
+
+	max, ok := new(big.Int).SetString(stringValue(data["limit"]), 10)
+	if !ok || max.Sign() < 0 {
+		return nil, fmt.Errorf("limit must be non-negative integer")
+	}
+	limit.Max = max
+
+	limit.App = stringValue(data["app"])
+	if limit.App == "*" {
+		limit.App = ""
+	}
+	limit.KeyID = stringValue(data["keyID"])
+	limit.Symbol = stringValue(data["symbol"])
+
+	// values of different chains are not comparable
+	if limit.Kind == ValuePerDay && limit.Symbol == "" {
+		return nil, fmt.Errorf("symbol is required for valuePerDay")
+	}
+
+	return limit, nil
+}
+
+func stringValue(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return strings.TrimSpace(value)
+	case json.Number:
+		return value.String()
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,432 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/colligence-io/signServer/util"
+	"github.com/colligence-io/signServer/vault"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+RATE LIMIT
+
+limits are stored in vault (vault.rateLimitPath/{limitName}), every sign request is counted by every matching limit
+requestsPerMinute : requests per UTC minute
+signaturesPerDay  : signatures per UTC day
+valuePerDay       : value (satoshi, wei, stroop) of decoded transactions per UTC day
+
+request is rejected without being counted if any limit would be exceeded, first exceeded limit in configured order is reported
+request counted but not signed because signer is busy is released
+counters are saved to state file every flushInterval and on Close (not on request path), so that restart does not reset them
+counted requests of last flushInterval are lost if process is killed without Close
+*/
+
+var logger = logrus.WithField("module", "RateLimit")
+
+const (
+	minute = 60
+	day    = 24 * 60 * 60
+)
+
+// interval of saving changed counters to state file
+var flushInterval = time.Second
+
+// Request
+// sign request to be counted
+type Request struct {
+	App    string
+	Symbol string
+	// signatures to make per keyID
+	Signatures map[string]int
+	// in base unit of chain, nil if not known
+	Value *big.Int
+	Time  time.Time
+}
+
+// ExceededError
+// limit which is exceeded by request
+type ExceededError struct {
+	Limit   *Limit
+	Counter string
+	Used    *big.Int
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("rate limit %s exceeded : %s %s of %s", e.Limit.Name, e.Used.String(), e.Limit.Kind, e.Limit.Max.String())
+}
+
+type counter struct {
+	Window int64  `json:"window"`
+	Used   string `json:"used"`
+}
+
+type Limiter struct {
+	limits    []*Limit
+	statePath string
+
+	mutex    sync.Mutex
+	counters map[string]*big.Int
+	windows  map[string]int64
+	// counters changed since last save
+	dirty bool
+
+	// serializes state file writes
+	saveMutex sync.Mutex
+	stop      chan struct{}
+	stopped   chan struct{}
+}
+
+// New
+// load limits from vault rateLimitPath and counters from statePath, empty rateLimitPath disables rate limit
+func New(vc *vault.Client, rateLimitPath string, statePath string) *Limiter {
+	var limits []*Limit
+	if rateLimitPath != "" {
+		limits = loadLimits(vc, rateLimitPath)
+	}
+
+	limiter := NewLimiter(limits, statePath)
+	if statePath != "" {
+		util.CheckAndDie(limiter.Load())
+		limiter.stop = make(chan struct{})
+		limiter.stopped = make(chan struct{})
+		go limiter.flushLoop(limiter.stop, limiter.stopped)
+	} else if len(limits) > 0 {
+		logger.Warn("rate limit state file is not set, counters are reset on restart")
+	}
+
+	return limiter
+}
+
+// NewLimiter
+// limiter of limits with empty counters, counters are saved to statePath (if not empty) by Flush
+func NewLimiter(limits []*Limit, statePath string) *Limiter {
+	return &Limiter{
+		limits:    limits,
+		statePath: statePath,
+		counters:  make(map[string]*big.Int),
+		windows:   make(map[string]int64),
+	}
+}
+
+// Take
+// count request by every matching limit, nothing is counted and *ExceededError is returned if any limit would be exceeded
+func (limiter *Limiter) Take(request Request) error {
+	if len(limiter.limits) == 0 {
+		return nil
+	}
+
+	if request.Time.IsZero() {
+		request.Time = time.Now()
+	}
+
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	// counters in order of limits, so that first exceeded limit is always same
+	type increment struct {
+		key    string
+		amount *big.Int
+		window int64
+		limit  *Limit
+	}
+	var increments []increment
+
+	for _, limit := range limiter.limits {
+		usage := limit.usage(request)
+		keys := make([]string, 0, len(usage))
+		for key := range usage {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			increments = append(increments, increment{key: key, amount: usage[key], window: limit.window(request.Time), limit: limit})
+		}
+	}
+
+	for _, inc := range increments {
+		used := new(big.Int).Add(limiter.used(inc.key, inc.window), inc.amount)
+		if used.Cmp(inc.limit.Max) > 0 {
+			exceeded := &ExceededError{Limit: inc.limit, Counter: inc.key, Used: used}
+			logger.WithFields(logrus.Fields{
+				"alert":   "RATE_LIMIT",
+				"limit":   inc.limit.Name,
+				"kind":    inc.limit.Kind,
+				"scope":   inc.limit.Scope,
+				"counter": inc.key,
+				"app":     request.App,
+				"symbol":  request.Symbol,
+				"used":    used.String(),
+				"max":     inc.limit.Max.String(),
+			}).Warn("rate limit exceeded")
+			return exceeded
+		}
+	}
+
+	if len(increments) == 0 {
+		return nil
+	}
+
+	for _, inc := range increments {
+		limiter.counters[inc.key] = new(big.Int).Add(limiter.used(inc.key, inc.window), inc.amount)
+		limiter.windows[inc.key] = inc.window
+	}
+	limiter.dirty = true
+
+	return nil
+}
+
+// Release
+// give back what Take counted for request which is not signed (signer busy), request must be same as taken
+// counters of past windows are not changed
+func (limiter *Limiter) Release(request Request) {
+	if len(limiter.limits) == 0 || request.Time.IsZero() {
+		return
+	}
+
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	released := false
+	for _, limit := range limiter.limits {
+		window := limit.window(request.Time)
+		for key, amount := range limit.usage(request) {
+			if limiter.windows[key] != window || limiter.counters[key] == nil {
+				continue
+			}
+
+			used := new(big.Int).Sub(limiter.counters[key], amount)
+			if used.Sign() < 0 {
+				used.SetInt64(0)
+			}
+			limiter.counters[key] = used
+			released = true
+		}
+	}
+
+	if released {
+		limiter.dirty = true
+	}
+}
+
+// used
+// counter value in window, counter of past window is zero
+func (limiter *Limiter) used(key string, window int64) *big.Int {
+	if used, found := limiter.counters[key]; found && limiter.windows[key] == window {
+		return used
+	}
+	return new(big.Int)
+}
+
+// usage
+// amount to count for each counter of limit, empty if limit does not count request
+func (limit *Limit) usage(request Request) map[string]*big.Int {
+	usage := make(map[string]*big.Int)
+
+	if limit.App != "" && limit.App != request.App {
+		return usage
+	}
+	if limit.Symbol != "" && limit.Symbol != request.Symbol {
+		return usage
+	}
+
+	var amount *big.Int
+	switch limit.Kind {
+	case RequestsPerMinute:
+		amount = big.NewInt(1)
+	case SignaturesPerDay:
+		amount = new(big.Int)
+	case ValuePerDay:
+		// value of undecoded data is not known
+		if request.Value == nil {
+			return usage
+		}
+		amount = request.Value
+	}
+
+	switch limit.Scope {
+	case Global, App:
+		if limit.KeyID != "" && request.Signatures[limit.KeyID] == 0 {
+			return usage
+		}
+
+		key := limit.Name
+		if limit.Scope == App {
+			key += "|" + request.App
+		}
+
+		if limit.Kind == SignaturesPerDay {
+			for keyID, signatures := range request.Signatures {
+				if limit.KeyID == "" || limit.KeyID == keyID {
+					amount.Add(amount, big.NewInt(int64(signatures)))
+				}
+			}
+		}
+		usage[key] = amount
+
+	case Key:
+		for keyID, signatures := range request.Signatures {
+			if limit.KeyID != "" && limit.KeyID != keyID {
+				continue
+			}
+			if limit.Kind == SignaturesPerDay {
+				usage[limit.Name+"|"+keyID] = big.NewInt(int64(signatures))
+			} else {
+				usage[limit.Name+"|"+keyID] = amount
+			}
+		}
+	}
+
+	return usage
+}
+
+// window
+// start of current window in unix time
+func (limit *Limit) window(t time.Time) int64 {
+	length := int64(day)
+	if limit.Kind == RequestsPerMinute {
+		length = minute
+	}
+	unix := t.Unix()
+	return unix - unix%length
+}
+
+// Load
+// counters from state file, missing file is empty state
+func (limiter *Limiter) Load() error {
+	if !util.File.Exists(limiter.statePath) {
+		return nil
+	}
+
+	stateBytes, e := util.File.Read(limiter.statePath)
+	if e != nil {
+		return e
+	}
+
+	var state map[string]counter
+	if e := json.Unmarshal(stateBytes, &state); e != nil {
+		return fmt.Errorf("broken rate limit state %s : %s", limiter.statePath, e.Error())
+	}
+
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	for key, c := range state {
+		used, ok := new(big.Int).SetString(c.Used, 10)
+		if !ok {
+			return fmt.Errorf("broken rate limit state %s : counter %s", limiter.statePath, key)
+		}
+		limiter.counters[key] = used
+		limiter.windows[key] = c.Window
+	}
+
+	logger.Info(len(state), " rate limit counters loaded from ", limiter.statePath)
+
+	return nil
+}
+
+// flushLoop
+// save changed counters every flushInterval until Close
+func (limiter *Limiter) flushLoop(stop chan struct{}, stopped chan struct{}) {
+	defer close(stopped)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if e := limiter.Flush(); e != nil {
+				logger.Error("rate limit state save failed : ", e)
+			}
+		}
+	}
+}
+
+// Flush
+// write counters of current windows to state file if changed, replaced atomically
+// file is written outside of limiter mutex, so that requests are not blocked by disk
+func (limiter *Limiter) Flush() error {
+	if limiter.statePath == "" {
+		return nil
+	}
+
+	limiter.saveMutex.Lock()
+	defer limiter.saveMutex.Unlock()
+
+	limiter.mutex.Lock()
+	if !limiter.dirty {
+		limiter.mutex.Unlock()
+		return nil
+	}
+
+	now := time.Now().Unix()
+	state := make(map[string]counter, len(limiter.counters))
+	for key, used := range limiter.counters {
+		// past windows are dropped
+		if limiter.windows[key]+day <= now {
+			delete(limiter.counters, key)
+			delete(limiter.windows, key)
+			continue
+		}
+		state[key] = counter{Window: limiter.windows[key], Used: used.String()}
+	}
+	limiter.dirty = false
+	limiter.mutex.Unlock()
+
+	e := limiter.save(state)
+	if e != nil {
+		// saved again by next flush
+		limiter.mutex.Lock()
+		limiter.dirty = true
+		limiter.mutex.Unlock()
+	}
+	return e
+}
+
+// save
+// write state to state file, replaced atomically
+func (limiter *Limiter) save(state map[string]counter) error {
+	stateBytes, e := json.Marshal(state)
+	if e != nil {
+		return e
+	}
+
+	tmpPath := limiter.statePath + ".tmp"
+	if e := ioutil.WriteFile(tmpPath, stateBytes, 0600); e != nil {
+		return e
+	}
+
+	return os.Rename(tmpPath, limiter.statePath)
+}
+
+// Close
+// stop periodic save and save counters
+func (limiter *Limiter) Close() {
+	if limiter == nil {
+		return
+	}
+
+	limiter.mutex.Lock()
+	stop := limiter.stop
+	limiter.stop = nil
+	limiter.mutex.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-limiter.stopped
+	}
+
+	if e := limiter.Flush(); e != nil {
+		logger.Error("rate limit state save failed : ", e)
+	}
+}
@@ -0,0 +1,196 @@
+package ratelimit_test
+
+import (
+	"github.com/colligence-io/signServer/server/ratelimit"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func mustParse(t *testing.T, name string, data map[string]interface{}) *ratelimit.Limit {
+	limit, err := ratelimit.ParseLimit(name, data)
+	if err != nil {
+		t.Fatal("ER : ParseLimit", name, ":", err)
+	}
+	return limit
+}
+
+var noon = time.Date(2019, 3, 4, 12, 0, 0, 0, time.UTC)
+
+func exceeded(t *testing.T, err error, name string) {
+	t.Helper()
+	exceededError, ok := err.(*ratelimit.ExceededError)
+	if !ok || exceededError.Limit.Name != name {
+		t.Error("ER : expected", name, "exceeded :", err)
+	}
+}
+
+func TestRequestsPerMinute(t *testing.T) {
+	limiter := ratelimit.NewLimiter([]*ratelimit.Limit{
+		mustParse(t, "rpm", map[string]interface{}{"kind": "requestsPerMinute", "scope": "app", "limit": "2"}),
+	}, "")
+
+	request := ratelimit.Request{App: "exchange", Symbol: "BTC", Signatures: map[string]int{"hot1": 1}, Time: noon}
+
+	for i := 0; i < 2; i++ {
+		if err := limiter.Take(request); err != nil {
+			t.Fatal("ER : request", i, err)
+		}
+	}
+	exceeded(t, limiter.Take(request), "rpm")
+
+	// other app is counted separately
+	other := request
+	other.App = "wallet"
+	if err := limiter.Take(other); err != nil {
+		t.Error("ER : other app limited", err)
+	}
+
+	// next minute
+	request.Time = noon.Add(time.Minute)
+	if err := limiter.Take(request); err != nil {
+		t.Error("ER : next minute limited", err)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	limiter := ratelimit.NewLimiter([]*ratelimit.Limit{
+		mustParse(t, "rpm", map[string]interface{}{"kind": "requestsPerMinute", "scope": "app", "limit": "1"}),
+		mustParse(t, "spd", map[string]interface{}{"kind": "signaturesPerDay", "scope": "key", "limit": "3"}),
+		mustParse(t, "value", map[string]interface{}{"kind": "valuePerDay", "scope": "global", "symbol": "BTC", "limit": "100"}),
+	}, "")
+
+	request := ratelimit.Request{App: "exchange", Symbol: "BTC", Signatures: map[string]int{"hot1": 3}, Value: big.NewInt(100), Time: noon}
+
+	if err := limiter.Take(request); err != nil {
+		t.Fatal(err)
+	}
+	exceeded(t, limiter.Take(request), "rpm")
+
+	// every counter is given back
+	limiter.Release(request)
+	if err := limiter.Take(request); err != nil {
+		t.Error("ER : released request limited", err)
+	}
+
+	// release of request in past minute does not change current minute
+	past := request
+	past.Time = noon.Add(-time.Hour)
+	limiter.Release(past)
+	exceeded(t, limiter.Take(request), "rpm")
+}
+
+func TestSignaturesPerDay(t *testing.T) {
+	limiter := ratelimit.NewLimiter([]*ratelimit.Limit{
+		mustParse(t, "spd-key", map[string]interface{}{"kind": "signaturesPerDay", "scope": "key", "limit": "10"}),
+		mustParse(t, "spd-global", map[string]interface{}{"kind": "signaturesPerDay", "scope": "global", "limit": "15"}),
+	}, "")
+
+	take := func(app string, keyID string, signatures int) error {
+		return limiter.Take(ratelimit.Request{App: app, Symbol: "ETH", Signatures: map[string]int{keyID: signatures}, Time: noon})
+	}
+
+	if err := take("exchange", "hot1", 8); err != nil {
+		t.Fatal(err)
+	}
+	exceeded(t, take("exchange", "hot1", 3), "spd-key")
+
+	// rejected request is not counted
+	if err := take("exchange", "hot1", 2); err != nil {
+		t.Error("ER : rejected request counted", err)
+	}
+
+	if err := take("wallet", "hot2", 5); err != nil {
+		t.Fatal(err)
+	}
+	exceeded(t, take("wallet", "hot3", 1), "spd-global")
+
+	// next UTC day
+	if err := limiter.Take(ratelimit.Request{App: "wallet", Symbol: "ETH", Signatures: map[string]int{"hot3": 1}, Time: noon.Add(12 * time.Hour)}); err != nil {
+		t.Error("ER : next day limited", err)
+	}
+}
+
+func TestValuePerDay(t *testing.T) {
+	limiter := ratelimit.NewLimiter([]*ratelimit.Limit{
+		mustParse(t, "btc-value", map[string]interface{}{"kind": "valuePerDay", "scope": "app", "app": "exchange", "symbol": "BTC", "limit": "100000000"}),
+	}, "")
+
+	request := ratelimit.Request{App: "exchange", Symbol: "BTC", Signatures: map[string]int{"hot1": 1, "hot2": 1}, Value: big.NewInt(60000000), Time: noon}
+	if err := limiter.Take(request); err != nil {
+		t.Fatal(err)
+	}
+	exceeded(t, limiter.Take(request), "btc-value")
+
+	// value of undecoded data, other chain and other app are not counted
+	unknown := request
+	unknown.Value = nil
+	eth := request
+	eth.Symbol = "ETH"
+	wallet := request
+	wallet.App = "wallet"
+	for _, r := range []ratelimit.Request{unknown, eth, wallet} {
+		if err := limiter.Take(r); err != nil {
+			t.Error("ER : not counted request limited", err)
+		}
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ratelimit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	statePath := filepath.Join(dir, "ratelimit.state")
+
+	limits := []*ratelimit.Limit{
+		mustParse(t, "spd", map[string]interface{}{"kind": "signaturesPerDay", "scope": "key", "limit": "3"}),
+	}
+	request := ratelimit.Request{App: "exchange", Symbol: "XLM", Signatures: map[string]int{"hot1": 2}, Time: time.Now()}
+
+	limiter := ratelimit.NewLimiter(limits, statePath)
+	if err := limiter.Take(request); err != nil {
+		t.Fatal(err)
+	}
+
+	// state is not written on request path
+	if _, err := os.Stat(statePath); !os.IsNotExist(err) {
+		t.Error("ER : state written by Take", err)
+	}
+	limiter.Close()
+
+	// restarted
+	restarted := ratelimit.NewLimiter(limits, statePath)
+	if err := restarted.Load(); err != nil {
+		t.Fatal(err)
+	}
+	exceeded(t, restarted.Take(request), "spd")
+
+	if err := ioutil.WriteFile(statePath, []byte("{broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ratelimit.NewLimiter(limits, statePath).Load(); err == nil {
+		t.Error("ER : broken state loaded")
+	}
+}
+
+func TestParseLimitInvalid(t *testing.T) {
+	invalid := map[string]map[string]interface{}{
+		"no kind":         {"scope": "app", "limit": "1"},
+		"unknown scope":   {"kind": "signaturesPerDay", "scope": "session", "limit": "1"},
+		"no limit":        {"kind": "signaturesPerDay", "scope": "app"},
+		"negative limit":  {"kind": "signaturesPerDay", "scope": "app", "limit": "-1"},
+		"value no symbol": {"kind": "valuePerDay", "scope": "global", "limit": "1"},
+		"name|pipe":       {"kind": "signaturesPerDay", "scope": "app", "limit": "1"},
+	}
+
+	for name, data := range invalid {
+		if _, err := ratelimit.ParseLimit(name, data); err == nil {
+			t.Error("ER : invalid limit parsed :", name)
+		}
+	}
+}
@@ -1,9 +1,11 @@
 package server
 
-import "C"
 import (
+	"context"
 	"fmt"
+	"github.com/colligence-io/signServer/audit"
 	"github.com/colligence-io/signServer/config"
+	"github.com/colligence-io/signServer/server/ratelimit"
 	"github.com/colligence-io/signServer/server/rr"
 	"github.com/colligence-io/signServer/util"
 	"github.com/colligence-io/signServer/vault"
@@ -14,8 +16,10 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"runtime/debug"
 	"strconv"
+	"syscall"
 	"time"
 )
 
@@ -25,6 +29,9 @@ type Instance struct {
 	config *config.Configuration
 	vc     *vault.Client
 	ks     *whitebox.KeyStore
+	audit  *audit.Log
+	// rate limit counters are saved on Close
+	limiter *ratelimit.Limiter
 }
 
 func NewInstance(cfg *config.Configuration, vaultClient *vault.Client, keyStore *whitebox.KeyStore) *Instance {
@@ -36,11 +43,33 @@ func NewInstance(cfg *config.Configuration, vaultClient *vault.Client, keyStore
 }
 
 func (instance *Instance) Launch(port int) {
+	handler := instance.Handler()
+
+	srv := &http.Server{Addr: ":" + strconv.Itoa(port), Handler: handler}
+	shutdown := instance.shutdownOnSignal(srv)
+
+	logger.Info("SignServer started (default network ", instance.config.Server.BlockChainNetwork, ") : listen ", port)
+	err := srv.ListenAndServe()
+	if err != http.ErrServerClosed {
+		util.CheckAndDie(err)
+	}
+
+	// wait for in-flight requests, then release whiteboxes
+	<-shutdown
+	instance.Close()
+	logger.Info("SignServer stopped")
+}
+
+// Handler
+// connect vault, load keystore and build routes of server
+func (instance *Instance) Handler() http.Handler {
 	if !instance.vc.IsConnected() {
 		instance.vc.Connect()
 		instance.vc.StartAutoRenew()
 	}
 
+	instance.audit = audit.New(instance.vc, instance.config.Vault.AuditPath, instance.config.Server.GetAuditLogPath())
+
 	r := chi.NewRouter()
 
 	r.Use(middleware.RequestID)
@@ -60,11 +89,14 @@ func (instance *Instance) Launch(port int) {
 
 	authService := NewAuthService(instance)
 	protectedService := NewProtectedService(instance, authService)
+	instance.limiter = protectedService.limiter
 
 	// Public Group
 	r.Group(func(r chi.Router) {
 		r.Post("/introduce", authService.IntroduceHandler)
 		r.Post("/answer", authService.AnswerHandler)
+		r.Post("/approval/pending", protectedService.ListPendingApprovalHandler)
+		r.Post("/approval/decide", protectedService.DecideApprovalHandler)
 	})
 
 	// Protected Group
@@ -73,7 +105,28 @@ func (instance *Instance) Launch(port int) {
 		r.Use(authService.JwtAuthenticator)
 
 		r.Post("/knock", protectedService.KnockHandler)
-		r.Post("/sign", protectedService.SignHandler)
+		r.Post("/verify/btc/message", protectedService.VerifyBTCMessageHandler)
+
+		// Sign Group (Idempotency-Key, async job)
+		r.Group(func(r chi.Router) {
+			r.Use(protectedService.Idempotent)
+			r.Use(protectedService.Async)
+
+			r.Post("/sign", protectedService.SignHandler)
+			r.Post("/sign/batch", protectedService.SignBatchHandler)
+			r.Post("/sign/btc/psbt", protectedService.SignPSBTHandler)
+			r.Post("/sign/btc/message", protectedService.SignBTCMessageHandler)
+			r.Post("/sign/eth/tx", protectedService.SignETHTxHandler)
+			r.Post("/sign/eth/message", protectedService.SignETHMessageHandler)
+			r.Post("/sign/eth/typedData", protectedService.SignETHTypedDataHandler)
+			r.Post("/sign/xlm/envelope", protectedService.SignXLMEnvelopeHandler)
+		})
+
+		r.Post("/deposit", protectedService.DepositHandler)
+		r.Get("/stats", protectedService.StatsHandler)
+		r.Get("/keys", protectedService.KeysHandler)
+		r.Get("/approval/{id}", protectedService.ApprovalHandler)
+		r.Get("/jobs/{id}", protectedService.JobHandler)
 		//
 		//// FIXME : this should be sealed, dangerous to reveal
 		//r.Get("/reload", protectedService.Reload)
@@ -84,9 +137,40 @@ func (instance *Instance) Launch(port int) {
 		logger.Info(_ksd)
 	}
 
-	logger.Info("SignServer ", instance.config.Server.BlockChainNetwork, " started : listen ", port)
-	err := http.ListenAndServe(":"+strconv.Itoa(port), r)
-	util.CheckAndDie(err)
+	// approved request held before restart may be signed at once
+	protectedService.restoreApprovals()
+
+	return r
+}
+
+// Close
+// release whiteboxes, save rate limit counters and close audit log
+func (instance *Instance) Close() {
+	instance.ks.Close()
+	instance.limiter.Close()
+	instance.audit.Close()
+}
+
+// shutdownOnSignal
+// gracefully shutdown srv on SIGINT/SIGTERM, returned channel is closed when shutdown is finished
+func (instance *Instance) shutdownOnSignal(srv *http.Server) <-chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		logger.Info("Shutting down SignServer : ", <-sig)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if e := srv.Shutdown(ctx); e != nil {
+			logger.Error("SignServer shutdown : ", e)
+		}
+		close(done)
+	}()
+
+	return done
 }
 
 // dontPanic
@@ -0,0 +1,254 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/colligence-io/signServer/audit"
+	"github.com/colligence-io/signServer/server/approval"
+	"github.com/colligence-io/signServer/server/auth"
+	"github.com/colligence-io/signServer/server/rr"
+	"github.com/colligence-io/signServer/util"
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+/*
+Approval services
+approvers are not apps, so approver endpoints are not behind jwt, every approver request is signed by approver key
+app polls its own pending request with session
+held request is kept with its endpoint, decoded request and session quizzes of its keypairs,
+so that approved request is signed by same endpoint after restart (payload must match approved digest)
+*/
+
+// header of sign request, URL to POST result of request held for approval
+const callbackHeader = "X-Callback-URL"
+
+const (
+	defaultApprovalThreshold = 2
+	defaultApprovalExpires   = 24 * 60 * 60
+)
+
+func approvalThreshold(threshold int) int {
+	if threshold > 0 {
+		return threshold
+	}
+	return defaultApprovalThreshold
+}
+
+func approvalExpires(expires int) time.Duration {
+	if expires > 0 {
+		return time.Duration(expires) * time.Second
+	}
+	return defaultApprovalExpires * time.Second
+}
+
+// approvalPendingPath
+// held requests are kept next to approvers unless configured
+func approvalPendingPath(approverPath string, pendingPath string) string {
+	if pendingPath == "" {
+		return approverPath + "-pending"
+	}
+	return pendingPath
+}
+
+// restoreApprovals
+// keep held requests in vault and restore requests held before restart, keystore must be loaded
+func (svcp *ProtectedService) restoreApprovals() {
+	if svcp.instance.config.Vault.ApproverPath == "" {
+		return
+	}
+	pendingPath := approvalPendingPath(svcp.instance.config.Vault.ApproverPath, svcp.instance.config.Vault.PendingPath)
+	util.CheckAndDie(svcp.approval.Persist(svcp.instance.vc, pendingPath, svcp.replayApproved))
+}
+
+// replayRecord
+// what is needed to sign held request again after restart
+type replayRecord struct {
+	Path    string               `json:"path"`
+	Request json.RawMessage      `json:"request"`
+	Quizzes map[string]auth.Quiz `json:"quizzes"`
+}
+
+// replayRecordOf
+// replay record of signing, quizzes of signing keypairs only
+func replayRecordOf(session *auth.Session, s signing) (json.RawMessage, error) {
+	rBytes, err := json.Marshal(s.request)
+	if err != nil {
+		return nil, err
+	}
+
+	quizzes := make(map[string]auth.Quiz)
+	for quizKey, quiz := range session.Quizzes {
+		if _, found := s.signatures[quiz.KeyID]; found {
+			quizzes[quizKey] = quiz
+		}
+	}
+
+	return json.Marshal(replayRecord{Path: s.path, Request: rBytes, Quizzes: quizzes})
+}
+
+// approvalRequestOf
+// request to hold signing, rule and approvals are of policy result
+func approvalRequestOf(session *auth.Session, s signing, keyIDs []string) approval.Request {
+	return approval.Request{
+		App:          session.AppName,
+		Operation:    string(s.operation),
+		Symbol:       string(s.symbol),
+		KeyIDs:       keyIDs,
+		Destinations: s.destinations,
+		Amount:       s.amount,
+		Payload:      s.payload,
+	}
+}
+
+// replayHandlers
+// endpoints which can sign approved request again after restart, key = path
+func (svcp *ProtectedService) replayHandlers() map[string]func(session *auth.Session, req *http.Request) rr.ResponseEntity {
+	return map[string]func(session *auth.Session, req *http.Request) rr.ResponseEntity{
+		"/sign":               svcp.sign,
+		"/sign/btc/psbt":      svcp.signPSBT,
+		"/sign/btc/message":   svcp.signBTCMessage,
+		"/sign/eth/tx":        svcp.signETHTx,
+		"/sign/eth/message":   svcp.signETHMessage,
+		"/sign/eth/typedData": svcp.signETHTypedData,
+		"/sign/xlm/envelope":  svcp.signXLMEnvelope,
+	}
+}
+
+// replayApproved
+// approval.Resolver, request kept before restart is signed by its endpoint with session of its quizzes
+func (svcp *ProtectedService) replayApproved(pending approval.Pending, replay json.RawMessage) (func() rr.ResponseEntity, error) {
+	var record replayRecord
+	if err := json.Unmarshal(replay, &record); err != nil {
+		return nil, err
+	}
+
+	handler, found := svcp.replayHandlers()[record.Path]
+	if !found {
+		return nil, errors.New("request of " + record.Path + " cannot be replayed")
+	}
+
+	return func() rr.ResponseEntity {
+		session := &auth.Session{
+			AppName:  pending.App,
+			Quizzes:  record.Quizzes,
+			Expires:  time.Now().Add(time.Minute),
+			Approved: pending.ID,
+		}
+
+		req, err := http.NewRequest(http.MethodPost, record.Path, bytes.NewReader(record.Request))
+		if err != nil {
+			return rr.ErrorResponse(err)
+		}
+
+		logger.Info("approved request ", pending.ID, " of ", pending.App, " is replayed to ", record.Path)
+		return handler(session, req)
+	}, nil
+}
+
+// signApproved
+// sign replayed request if it is same as approved one
+func (svcp *ProtectedService) signApproved(session *auth.Session, s signing, sign func() rr.ResponseEntity) rr.ResponseEntity {
+	if !svcp.approval.Matches(session.Approved, approvalRequestOf(session, s, s.keyIDs())) {
+		logger.WithFields(logrus.Fields{"alert": "APPROVAL_REPLAY", "id": session.Approved, "app": session.AppName}).Error("ALERT : replayed request does not match approved request")
+		return rr.KoResponse(http.StatusConflict, "replayed request does not match approved request")
+	}
+
+	return sign()
+}
+
+// approvalErrorResponse
+// response of approval.Store error
+func approvalErrorResponse(err error) rr.ResponseEntity {
+	switch err {
+	case approval.ErrNotFound:
+		return rr.KoResponse(http.StatusNotFound, err.Error())
+	case approval.ErrUnknownApprover, approval.ErrInvalidSignature:
+		return rr.KoResponse(http.StatusUnauthorized, err.Error())
+	case approval.ErrNotPending, approval.ErrAlreadyApproved:
+		return rr.KoResponse(http.StatusConflict, err.Error())
+	case approval.ErrInvalidDecision:
+		return rr.KoResponse(http.StatusBadRequest, err.Error())
+	default:
+		return rr.ErrorResponse(err)
+	}
+}
+
+// ListPendingApproval
+// requests waiting for approval with decoded payload, signed by approver
+func (svcp *ProtectedService) ListPendingApprovalHandler(rw http.ResponseWriter, req *http.Request) {
+	rr.WriteResponseEntity(rw, svcp.listPendingApproval(req))
+}
+func (svcp *ProtectedService) listPendingApproval(req *http.Request) rr.ResponseEntity {
+	var request struct {
+		Approver  string `json:"approver"`
+		Time      int64  `json:"time"`
+		Signature string `json:"signature"`
+	}
+
+	// Parse request
+	if err := rr.ReadRequestBody(req, &request); err != nil {
+		return rr.ErrorResponse(err)
+	}
+
+	list, err := svcp.approval.ListPending(request.Approver, request.Time, request.Signature)
+	if err != nil {
+		logger.Error("approver " + request.Approver + "'s pending list request : " + err.Error())
+		return approvalErrorResponse(err)
+	}
+
+	return rr.OkResponse(list)
+}
+
+// DecideApproval
+// approve or reject pending request, signed by approver
+func (svcp *ProtectedService) DecideApprovalHandler(rw http.ResponseWriter, req *http.Request) {
+	rr.WriteResponseEntity(rw, svcp.decideApproval(req))
+}
+func (svcp *ProtectedService) decideApproval(req *http.Request) rr.ResponseEntity {
+	var request struct {
+		Approver  string `json:"approver"`
+		ID        string `json:"id"`
+		Decision  string `json:"decision"`
+		Signature string `json:"signature"`
+	}
+
+	// Parse request
+	if err := rr.ReadRequestBody(req, &request); err != nil {
+		return rr.ErrorResponse(err)
+	}
+
+	pending, err := svcp.approval.Decide(request.ID, request.Approver, request.Decision, request.Signature)
+
+	record := audit.Fields{"id": request.ID, "approver": request.Approver, "decision": request.Decision, "status": pending.Status}
+	if err != nil {
+		record["error"] = err.Error()
+	}
+	svcp.instance.audit.Record(audit.EventApproval, record)
+
+	if err != nil {
+		logger.Error("approver " + request.Approver + "'s decision on " + request.ID + " : " + err.Error())
+		return approvalErrorResponse(err)
+	}
+
+	return rr.OkResponse(pending)
+}
+
+// Approval
+// status and result of app's pending request
+func (svcp *ProtectedService) ApprovalHandler(rw http.ResponseWriter, req *http.Request) {
+	svcp.handlerClosure(rw, req, svcp.getApproval)
+}
+func (svcp *ProtectedService) getApproval(session *auth.Session, req *http.Request) rr.ResponseEntity {
+	pending, found := svcp.approval.Get(chi.URLParam(req, "id"))
+
+	// other app's request is not found
+	if !found || pending.App != session.AppName {
+		return approvalErrorResponse(approval.ErrNotFound)
+	}
+
+	return rr.OkResponse(pending)
+}
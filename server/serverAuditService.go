@@ -0,0 +1,97 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/colligence-io/signServer/audit"
+	"github.com/colligence-io/signServer/server/auth"
+	"github.com/colligence-io/signServer/server/rr"
+	"github.com/colligence-io/signServer/trustSigner"
+	"net/http"
+)
+
+/*
+Audit records
+handshake outcomes, decision on every sign request and every whitebox signature are appended to audit log
+signing fails closed : nothing is signed if allow decision is not recorded, signature is not returned if it is not recorded
+*/
+
+var errAuditFailed = errors.New("audit record failed")
+
+// auditAuth
+// outcome of introduce or answer
+func (svc *AuthService) auditAuth(event string, appName string, req *http.Request, entity rr.ResponseEntity) {
+	_ = svc.instance.audit.Record(event, audit.Fields{
+		"app":        appName,
+		"remoteAddr": req.RemoteAddr,
+		"code":       entity.Code,
+		"message":    entity.Message,
+	})
+}
+
+// auditSigning
+// decision on sign request, payload is recorded as its digest
+func (svcp *ProtectedService) auditSigning(session *auth.Session, s signing, keyIDs []string, decision string, rule string, fields audit.Fields) error {
+	record := audit.Fields{
+		"app":           session.AppName,
+		"operation":     s.operation,
+		"symbol":        s.symbol,
+		"keyIDs":        keyIDs,
+		"payloadDigest": payloadDigest(s.payload),
+		"decision":      decision,
+		"rule":          rule,
+	}
+	if s.destinations != nil {
+		record["destinations"] = s.destinations
+	}
+	if s.amount != nil {
+		record["amount"] = s.amount.String()
+	}
+	for k, v := range fields {
+		record[k] = v
+	}
+
+	return svcp.instance.audit.Record(audit.EventSignReq, record)
+}
+
+// auditSignature
+// whitebox signature of data digest, or error of signing
+func (svcp *ProtectedService) auditSignature(session *auth.Session, bcType trustSigner.BlockChainType, network trustSigner.BlockChainNetworkType, address string, derivation trustSigner.Derivation, digest string, signature string, err error) error {
+	keyID, _, _ := svcp.instance.ks.LookupAddress(bcType, network, address)
+
+	record := audit.Fields{
+		"app":        session.AppName,
+		"keyID":      keyID,
+		"type":       bcType,
+		"network":    network,
+		"address":    address,
+		"derivation": derivation.String(),
+		"digest":     digest,
+		"signature":  signature,
+	}
+	if err != nil {
+		record["error"] = err.Error()
+	}
+
+	return svcp.instance.audit.Record(audit.EventSign, record)
+}
+
+// payloadDigest
+// sha256 hex of JSON payload
+func payloadDigest(payload interface{}) string {
+	pBytes, e := json.Marshal(payload)
+	if e != nil {
+		return ""
+	}
+	digest := sha256.Sum256(pBytes)
+	return hex.EncodeToString(digest[:])
+}
+
+// dataDigest
+// sha256 hex of data to sign
+func dataDigest(data []byte) string {
+	digest := sha256.Sum256(data)
+	return hex.EncodeToString(digest[:])
+}
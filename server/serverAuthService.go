@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"github.com/colligence-io/signServer/audit"
 	"github.com/colligence-io/signServer/server/auth"
 	"github.com/colligence-io/signServer/server/rr"
 	"github.com/colligence-io/signServer/util"
@@ -113,11 +114,13 @@ func (svc *AuthService) handlerClosure(rw http.ResponseWriter, req *http.Request
 func (svc *AuthService) IntroduceHandler(rw http.ResponseWriter, r *http.Request) {
 	svc.handlerClosure(rw, r, svc.introduce)
 }
-func (svc *AuthService) introduce(req *http.Request) rr.ResponseEntity {
+func (svc *AuthService) introduce(req *http.Request) (entity rr.ResponseEntity) {
 	var request struct {
 		AppName string `json:"myNameIs"`
 	}
 
+	defer func() { svc.auditAuth(audit.EventIntroduce, request.AppName, req, entity) }()
+
 	var response struct {
 		Question string `json:"question"`
 		Expires  int64  `json:"expires"`
@@ -181,13 +184,15 @@ func (svc *AuthService) introduce(req *http.Request) rr.ResponseEntity {
 func (svc *AuthService) AnswerHandler(rw http.ResponseWriter, r *http.Request) {
 	svc.handlerClosure(rw, r, svc.answer)
 }
-func (svc *AuthService) answer(req *http.Request) rr.ResponseEntity {
+func (svc *AuthService) answer(req *http.Request) (entity rr.ResponseEntity) {
 	var request struct {
 		AppName   string `json:"myNameIs"`
 		Question  string `json:"yourQuestionWas"`
 		Signature string `json:"myAnswerIs"`
 	}
 
+	defer func() { svc.auditAuth(audit.EventAnswer, request.AppName, req, entity) }()
+
 	var response struct {
 		JWS          string            `json:"welcomePresent"`
 		KeyQuestions map[string]string `json:"welcomePackage"`
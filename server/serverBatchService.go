@@ -0,0 +1,118 @@
+package server
+
+import (
+	"fmt"
+	"github.com/colligence-io/signServer/server/auth"
+	"github.com/colligence-io/signServer/server/rr"
+	"github.com/colligence-io/signServer/trustSigner"
+	"github.com/colligence-io/signServer/trustSigner/sigformat"
+	"net/http"
+	"sync"
+)
+
+// default max items of /sign/batch when server.maxBatchSize is not set
+const defaultMaxBatchSize = 100
+
+type batchSignResult struct {
+	Index      int              `json:"index"`
+	Code       int              `json:"code"`
+	Signature  string           `json:"signature,omitempty"`
+	Address    string           `json:"address,omitempty"`
+	Format     sigformat.Format `json:"format,omitempty"`
+	Signatures []interface{}    `json:"signatures,omitempty"`
+	PendingID  string           `json:"pendingId,omitempty"`
+	Error      string           `json:"error,omitempty"`
+}
+
+func (svcp *ProtectedService) maxBatchSize() int {
+	if size := svcp.instance.config.Server.MaxBatchSize; size > 0 {
+		return size
+	}
+	return defaultMaxBatchSize
+}
+
+// SignBatch
+// sign list of /sign requests, each item has its own result so that bad item does not fail batch
+func (svcp *ProtectedService) SignBatchHandler(rw http.ResponseWriter, req *http.Request) {
+	svcp.handlerClosure(rw, req, svcp.signBatch)
+}
+func (svcp *ProtectedService) signBatch(session *auth.Session, req *http.Request) rr.ResponseEntity {
+	var request struct {
+		Items []signRequest `json:"items"`
+	}
+
+	var response struct {
+		Signed  int               `json:"signed"`
+		Pending int               `json:"pending"`
+		Failed  int               `json:"failed"`
+		Results []batchSignResult `json:"results"`
+	}
+
+	// Parse request
+	if err := rr.ReadRequestBody(req, &request); err != nil {
+		return rr.ErrorResponse(err)
+	}
+
+	if len(request.Items) == 0 {
+		return rr.KoResponse(http.StatusBadRequest, "items is empty")
+	}
+
+	if maxSize := svcp.maxBatchSize(); len(request.Items) > maxSize {
+		logger.Error(session.AppName + "'s batch is too large : " + fmt.Sprint(len(request.Items)))
+		return rr.KoResponse(http.StatusRequestEntityTooLarge, fmt.Sprintf("batch size must be 1 ~ %d", maxSize))
+	}
+
+	logger.Info("batch sign request from ", session.AppName, " : ", len(request.Items), " items")
+
+	response.Results = make([]batchSignResult, len(request.Items))
+
+	// items held for approval are reported to same callback one by one
+	callback := req.Header.Get(callbackHeader)
+
+	// no more items in flight than pool slots, so that batch does not fill pool queue by itself
+	slots := make(chan struct{}, trustSigner.Stats().MaxInFlight)
+	var wg sync.WaitGroup
+
+	for i, item := range request.Items {
+		wg.Add(1)
+		slots <- struct{}{}
+
+		go func(i int, item signRequest) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			result := batchSignResult{Index: i}
+
+			entity := svcp.signData(session, callback, item)
+			result.Code = entity.Code
+			if signed, ok := entity.Data.(signResponse); ok {
+				result.Signature = signed.Signature
+				result.Address = signed.Address
+				result.Format = signed.Format
+				result.Signatures = signed.Signatures
+			} else if pending, ok := entity.Data.(pendingResponse); ok {
+				result.PendingID = pending.PendingID
+			} else {
+				result.Error = entity.Message
+			}
+
+			response.Results[i] = result
+		}(i, item)
+	}
+
+	wg.Wait()
+
+	for _, result := range response.Results {
+		if result.Signature != "" {
+			response.Signed++
+		} else if result.PendingID != "" {
+			response.Pending++
+		} else {
+			response.Failed++
+		}
+	}
+
+	return rr.OkResponse(response)
+}
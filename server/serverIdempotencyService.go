@@ -0,0 +1,154 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/colligence-io/signServer/server/idempotency"
+	"github.com/colligence-io/signServer/server/rr"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+/*
+Idempotency of sign requests
+sign request with Idempotency-Key header is signed once per app and key within window, repeat gets first response
+*/
+
+const (
+	idempotencyHeader         = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+)
+
+const defaultIdempotencyWindow = 24 * 60 * 60
+
+func idempotencyWindow(window int) time.Duration {
+	if window > 0 {
+		return time.Duration(window) * time.Second
+	}
+	return defaultIdempotencyWindow * time.Second
+}
+
+// responseRecorder
+// keeps status code and body written through ResponseWriter
+type responseRecorder struct {
+	http.ResponseWriter
+	code int
+	body bytes.Buffer
+}
+
+func (recorder *responseRecorder) WriteHeader(code int) {
+	recorder.code = code
+	recorder.ResponseWriter.WriteHeader(code)
+}
+
+func (recorder *responseRecorder) Write(b []byte) (int, error) {
+	if recorder.code == 0 {
+		recorder.code = http.StatusOK
+	}
+	recorder.body.Write(b)
+	return recorder.ResponseWriter.Write(b)
+}
+
+// Idempotent
+// middleware of sign endpoints, request without Idempotency-Key passes through
+func (svcp *ProtectedService) Idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		key := req.Header.Get(idempotencyHeader)
+		if key == "" {
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		session := svcp.session(req)
+		if session == nil {
+			rr.WriteResponseEntity(rw, rr.UnauthorizedResponse)
+			return
+		}
+
+		bBytes, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			rr.WriteResponseEntity(rw, rr.ErrorResponse(err))
+			return
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(bBytes))
+
+		kept, err := svcp.idempotency.Begin(session.AppName, key, requestDigest(req, bBytes), time.Now())
+		switch err {
+		case nil:
+		case idempotency.ErrInvalidKey:
+			rr.WriteResponseEntity(rw, rr.KoResponse(http.StatusBadRequest, err.Error()))
+			return
+		default:
+			logger.Error(session.AppName + "'s idempotency key " + key + " : " + err.Error())
+			rr.WriteResponseEntity(rw, rr.KoResponse(http.StatusConflict, err.Error()))
+			return
+		}
+
+		if kept != nil {
+			rw.Header().Set(idempotencyReplayedHeader, "true")
+			rw.WriteHeader(kept.Code)
+			_, _ = rw.Write(kept.Body)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: rw}
+
+		// key is released if handler panics or response is not final
+		defer func() {
+			if isFinalResponse(recorder.code) {
+				svcp.idempotency.Finish(session.AppName, key, idempotency.Response{Code: recorder.code, Body: recorder.body.Bytes()})
+			} else {
+				svcp.idempotency.Release(session.AppName, key)
+			}
+		}()
+
+		next.ServeHTTP(recorder, req)
+	})
+}
+
+// isFinalResponse
+// server errors and rate limited responses can be retried with same key
+func isFinalResponse(code int) bool {
+	return code != 0 && code < http.StatusInternalServerError && code != http.StatusTooManyRequests
+}
+
+// requestDigest
+// sha256 of endpoint and body, quiz answers are excluded because they change with session
+// (retry after new handshake is same request)
+func requestDigest(req *http.Request, body []byte) string {
+	canonical := body
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var decoded interface{}
+	if decoder.Decode(&decoded) == nil {
+		if cBytes, e := json.Marshal(withoutAnswers(decoded)); e == nil {
+			canonical = cBytes
+		}
+	}
+
+	// same key on other endpoint is other request
+	digest := sha256.Sum256(append([]byte(req.Method+" "+req.URL.Path+"\n"), canonical...))
+	return hex.EncodeToString(digest[:])
+}
+
+// withoutAnswers
+// remove answer fields (answer of /sign, answers map of /sign/btc/psbt) of decoded JSON at any depth
+func withoutAnswers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		delete(v, "answer")
+		delete(v, "answers")
+		for k, item := range v {
+			v[k] = withoutAnswers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = withoutAnswers(item)
+		}
+	}
+	return value
+}
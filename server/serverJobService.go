@@ -0,0 +1,197 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/colligence-io/signServer/server/approval"
+	"github.com/colligence-io/signServer/server/auth"
+	"github.com/colligence-io/signServer/server/job"
+	"github.com/colligence-io/signServer/server/rr"
+	"github.com/go-chi/chi"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+/*
+Async jobs
+sign request with "Prefer: respond-async" header is accepted as job (202 with job), and signed by job workers without request timeout
+job waits for approval of request held by policy, and is retried while signer pool is busy
+app polls GET /jobs/{id}, or gets finished job POSTed to X-Callback-URL signed with server.jobCallbackSecret
+*/
+
+const (
+	preferHeader            = "Prefer"
+	preferenceAppliedHeader = "Preference-Applied"
+	respondAsync            = "respond-async"
+)
+
+const (
+	defaultJobWorkers   = 4
+	defaultJobRetention = 24 * 60 * 60
+)
+
+func jobWorkers(workers int) int {
+	if workers > 0 {
+		return workers
+	}
+	return defaultJobWorkers
+}
+
+func jobRetention(retention int) time.Duration {
+	if retention > 0 {
+		return time.Duration(retention) * time.Second
+	}
+	return defaultJobRetention * time.Second
+}
+
+// prefersAsync
+// Prefer header has respond-async
+func prefersAsync(req *http.Request) bool {
+	for _, value := range req.Header[preferHeader] {
+		for _, preference := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(preference), respondAsync) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jobResponseWriter
+// response of request run by job
+type jobResponseWriter struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (w *jobResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *jobResponseWriter) WriteHeader(code int) {
+	w.code = code
+}
+
+func (w *jobResponseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+// Async
+// middleware of sign endpoints, request without Prefer: respond-async passes through
+func (svcp *ProtectedService) Async(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if !prefersAsync(req) {
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		session := svcp.session(req)
+		if session == nil {
+			rr.WriteResponseEntity(rw, rr.UnauthorizedResponse)
+			return
+		}
+
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			rr.WriteResponseEntity(rw, rr.ErrorResponse(err))
+			return
+		}
+
+		// callback is for job, request held for approval is reported by job
+		callback := req.Header.Get(callbackHeader)
+		header := make(http.Header)
+		for k, v := range req.Header {
+			header[k] = v
+		}
+		header.Del(preferHeader)
+		header.Del(callbackHeader)
+
+		submitted, err := svcp.jobs.Submit(session.AppName, req.Method+" "+req.URL.Path, callback, func(id string) (rr.ResponseEntity, error) {
+			return svcp.runJob(next, session, req, header, body, id)
+		})
+		if err != nil {
+			logger.Error(session.AppName + "'s job is not accepted : " + err.Error())
+			rr.WriteResponseEntity(rw, rr.KoResponse(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		rw.Header().Set(preferenceAppliedHeader, respondAsync)
+		rw.Header().Set("Location", "/jobs/"+submitted.ID)
+		rr.WriteResponseEntity(rw, rr.ResponseEntity{Code: http.StatusAccepted, Message: "job accepted", Data: submitted})
+	})
+}
+
+// runJob
+// run sign request detached from client request, so that it is not cut by request timeout
+func (svcp *ProtectedService) runJob(next http.Handler, session *auth.Session, req *http.Request, header http.Header, body []byte, id string) (result rr.ResponseEntity, err error) {
+	defer func() {
+		if rvr := recover(); rvr != nil {
+			logger.Error("job ", id, " panic : ", rvr)
+			result, err = rr.InternalServerErrorResponse, nil
+		}
+	}()
+
+	inner := req.WithContext(context.WithValue(context.Background(), svcp.authService.ctxSessionKey, session))
+	inner.Header = header
+	inner.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	w := &jobResponseWriter{header: make(http.Header)}
+	next.ServeHTTP(w, inner)
+
+	if e := json.Unmarshal(w.body.Bytes(), &result); e != nil {
+		return rr.ErrorResponse(e), nil
+	}
+
+	// signer pool queue is full, job waits for its turn
+	if result.Code == http.StatusServiceUnavailable {
+		return result, job.ErrRetry
+	}
+
+	// held for approval, job is finished by approval
+	if result.Code == http.StatusAccepted {
+		if data, ok := result.Data.(map[string]interface{}); ok {
+			if pendingID, ok := data["pendingId"].(string); ok {
+				if e := svcp.approval.Watch(pendingID, func(pending approval.Pending) {
+					_ = svcp.jobs.Complete(id, approvalResult(pending))
+				}); e == nil {
+					return result, job.ErrWaiting
+				}
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// approvalResult
+// result of finished pending request
+func approvalResult(pending approval.Pending) rr.ResponseEntity {
+	switch {
+	case pending.Result != nil:
+		return *pending.Result
+	case pending.Status == approval.StatusRejected:
+		return rr.KoResponse(http.StatusForbidden, "rejected by approver "+pending.RejectedBy)
+	default:
+		return rr.KoResponse(http.StatusGone, "approval "+string(pending.Status))
+	}
+}
+
+// Job
+// status and result of app's job
+func (svcp *ProtectedService) JobHandler(rw http.ResponseWriter, req *http.Request) {
+	svcp.handlerClosure(rw, req, svcp.getJob)
+}
+func (svcp *ProtectedService) getJob(session *auth.Session, req *http.Request) rr.ResponseEntity {
+	j, found := svcp.jobs.Get(chi.URLParam(req, "id"))
+
+	// other app's job is not found
+	if !found || j.App != session.AppName {
+		return rr.KoResponse(http.StatusNotFound, job.ErrNotFound.Error())
+	}
+
+	return rr.OkResponse(j)
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"encoding/hex"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/colligence-io/signServer/audit"
+	"github.com/colligence-io/signServer/psbt"
+	"github.com/colligence-io/signServer/server/auth"
+	"github.com/colligence-io/signServer/server/job"
+	"github.com/colligence-io/signServer/server/policy"
+	"github.com/colligence-io/signServer/server/ratelimit"
+	"github.com/colligence-io/signServer/server/rr"
+	"github.com/colligence-io/signServer/trustSigner"
+	"math/big"
+	"net/http"
+	"sort"
+	"time"
+)
+
+/*
+Signing policy, rate limit and approval enforcement
+every sign request is evaluated by policy engine and counted by rate limits after its keypair is authorized and before whitebox signs
+decision on every sign request is recorded to audit log
+*/
+
+// signing
+// what whitebox is about to sign, payload is decoded request shown to approvers
+type signing struct {
+	operation    policy.Operation
+	symbol       trustSigner.BlockChainType
+	signatures   map[string]int
+	destinations []string
+	amount       *big.Int
+	payload      interface{}
+	// endpoint and decoded request, to sign approved request again after restart
+	path    string
+	request interface{}
+}
+
+// keyIDs
+// sorted keyIDs of signing keypairs
+func (s signing) keyIDs() []string {
+	keyIDs := make([]string, 0, len(s.signatures))
+	for keyID := range s.signatures {
+		keyIDs = append(keyIDs, keyID)
+	}
+	sort.Strings(keyIDs)
+	return keyIDs
+}
+
+type pendingResponse struct {
+	PendingID string `json:"pendingId"`
+	Digest    string `json:"digest"`
+	Required  int    `json:"required"`
+	Expires   int64  `json:"expires"`
+}
+
+// authorizeSigning
+// evaluate policy for every signing keypair (most restrictive decision wins) and count rate limits,
+// sign is called if allowed, or held with payload until approved if policy requires approval (202 with pending id)
+func (svcp *ProtectedService) authorizeSigning(session *auth.Session, callback string, s signing, sign func() rr.ResponseEntity) rr.ResponseEntity {
+	// approved request replayed after restart was evaluated, counted and recorded when it was held
+	if session.Approved != "" {
+		return svcp.signApproved(session, s, sign)
+	}
+
+	// request which cannot be signed now is not evaluated, counted nor recorded
+	if trustSigner.Busy() {
+		return signErrorResponse(trustSigner.ErrPoolBusy)
+	}
+
+	now := time.Now()
+
+	keyIDs := s.keyIDs()
+
+	results := make([]policy.Result, 0, len(keyIDs))
+	for _, keyID := range keyIDs {
+		results = append(results, svcp.policy.Evaluate(policy.Request{
+			App:          session.AppName,
+			KeyID:        keyID,
+			Symbol:       string(s.symbol),
+			Operation:    s.operation,
+			Destinations: s.destinations,
+			Amount:       s.amount,
+			Time:         now,
+		}))
+	}
+	result := policy.Combine(results...)
+
+	if result.Decision != policy.Allow && result.Decision != policy.RequireApproval {
+		_ = svcp.auditSigning(session, s, keyIDs, string(result.Decision), result.Rule, nil)
+		return rr.KoResponse(http.StatusForbidden, "denied by policy rule "+result.Rule)
+	}
+
+	limitRequest := ratelimit.Request{App: session.AppName, Symbol: string(s.symbol), Signatures: s.signatures, Value: s.amount, Time: now}
+	if err := svcp.limiter.Take(limitRequest); err != nil {
+		_ = svcp.auditSigning(session, s, keyIDs, "rate-limited", result.Rule, audit.Fields{"limit": err.Error()})
+		return rr.KoResponse(http.StatusTooManyRequests, err.Error())
+	}
+
+	if result.Decision == policy.Allow {
+		if err := svcp.auditSigning(session, s, keyIDs, string(result.Decision), result.Rule, nil); err != nil {
+			svcp.limiter.Release(limitRequest)
+			return rr.ErrorResponse(errAuditFailed)
+		}
+
+		// signer became busy after request was counted, nothing is signed
+		response := sign()
+		if response.Code == http.StatusServiceUnavailable {
+			svcp.limiter.Release(limitRequest)
+		}
+		return response
+	}
+
+	replay, err := replayRecordOf(session, s)
+	if err != nil {
+		return rr.ErrorResponse(err)
+	}
+
+	approvalRequest := approvalRequestOf(session, s, keyIDs)
+	approvalRequest.Rule = result.Rule
+	approvalRequest.Required = result.Approvals
+	approvalRequest.Callback = callback
+	approvalRequest.Replay = replay
+
+	pending, err := svcp.approval.Submit(approvalRequest, sign)
+	if err != nil {
+		logger.Error(session.AppName + "'s request cannot be held for approval : " + err.Error())
+		_ = svcp.auditSigning(session, s, keyIDs, string(result.Decision), result.Rule, audit.Fields{"error": err.Error()})
+		svcp.limiter.Release(limitRequest)
+		switch err {
+		case job.ErrInvalidCallback, job.ErrNoCallbackSecret, job.ErrCallbackNotAllowed:
+			return rr.KoResponse(http.StatusBadRequest, err.Error())
+		default:
+			return rr.ErrorResponse(err)
+		}
+	}
+
+	_ = svcp.auditSigning(session, s, keyIDs, string(result.Decision), result.Rule, audit.Fields{"pendingId": pending.ID, "digest": pending.Digest})
+
+	return rr.ResponseEntity{
+		Code:    http.StatusAccepted,
+		Message: "approval required by policy rule " + result.Rule,
+		Data:    pendingResponse{PendingID: pending.ID, Digest: pending.Digest, Required: pending.Required, Expires: pending.Expires},
+	}
+}
+
+// psbtDestinations
+// outputs not owned by keystore (change excluded) and sum of their values
+// outputs without standard address are identified by hex of script
+func (svcp *ProtectedService) psbtDestinations(packet *psbt.Packet, network trustSigner.BlockChainNetworkType, netParam *chaincfg.Params) ([]string, *big.Int) {
+	destinations := make([]string, 0, len(packet.UnsignedTx.TxOut))
+	amount := new(big.Int)
+
+	for _, txOut := range packet.UnsignedTx.TxOut {
+		destination := hex.EncodeToString(txOut.PkScript)
+
+		_, addresses, _, err := txscript.ExtractPkScriptAddrs(txOut.PkScript, netParam)
+		if err == nil && len(addresses) == 1 {
+			destination = addresses[0].EncodeAddress()
+			if _, _, found := svcp.instance.ks.LookupAddress(trustSigner.BTC, network, destination); found {
+				continue
+			}
+		}
+
+		destinations = append(destinations, destination)
+		amount.Add(amount, big.NewInt(txOut.Value))
+	}
+
+	return destinations, amount
+}
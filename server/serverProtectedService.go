@@ -2,10 +2,22 @@ package server
 
 import (
 	"encoding/hex"
+	"errors"
+	"github.com/colligence-io/signServer/audit"
+	"github.com/colligence-io/signServer/config"
+	"github.com/colligence-io/signServer/server/approval"
 	"github.com/colligence-io/signServer/server/auth"
+	"github.com/colligence-io/signServer/server/idempotency"
+	"github.com/colligence-io/signServer/server/job"
+	"github.com/colligence-io/signServer/server/policy"
+	"github.com/colligence-io/signServer/server/ratelimit"
 	"github.com/colligence-io/signServer/server/rr"
 	"github.com/colligence-io/signServer/trustSigner"
+	"github.com/colligence-io/signServer/trustSigner/sigformat"
+	"github.com/colligence-io/signServer/whitebox"
+	"github.com/sirupsen/logrus"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -13,25 +25,60 @@ import (
 type ProtectedService struct {
 	instance    *Instance
 	authService *AuthService
+	policy      *policy.Engine
+	limiter     *ratelimit.Limiter
+	approval    *approval.Store
+	idempotency *idempotency.Store
+	jobs        *job.Store
 	handlerType interface{}
 }
 
 // NewProtectedService
 func NewProtectedService(instance *Instance, authService *AuthService) *ProtectedService {
-	return &ProtectedService{instance: instance, authService: authService}
+	// jobs and approvals post callback with same secret and host list
+	notifier := job.NewNotifier(instance.config.Server.JobCallbackSecret, instance.config.Server.CallbackHosts)
+
+	return &ProtectedService{
+		instance:    instance,
+		authService: authService,
+		policy:      policy.New(instance.vc, instance.config.Vault.PolicyPath, instance.config.Server.PolicyDefault),
+		limiter:     ratelimit.New(instance.vc, instance.config.Vault.RateLimitPath, rateLimitStatePath(instance.config.Server.RateLimitState)),
+		approval:    approval.New(instance.vc, instance.config.Vault.ApproverPath, approvalThreshold(instance.config.Server.ApprovalThreshold), approvalExpires(instance.config.Server.ApprovalExpires), notifier),
+		idempotency: idempotency.New(idempotencyWindow(instance.config.Server.IdempotencyWindow)),
+		jobs:        job.New(jobWorkers(instance.config.Server.JobWorkers), jobRetention(instance.config.Server.JobRetention), notifier),
+	}
+}
+
+// rateLimitStatePath
+// rate limit counters are kept next to config unless configured
+func rateLimitStatePath(statePath string) string {
+	if statePath == "" {
+		return config.ROOTPATH + "/etc/ratelimit.state"
+	}
+	return statePath
 }
 
 // handlerClosure
 // closure to simplify http.HandlerFunc
 func (svcp *ProtectedService) handlerClosure(rw http.ResponseWriter, req *http.Request, handler func(session *auth.Session, req *http.Request) rr.ResponseEntity) {
-	session, ok := req.Context().Value(svcp.authService.ctxSessionKey).(*auth.Session)
-	if !ok || session == nil {
+	session := svcp.session(req)
+	if session == nil {
 		rr.WriteResponseEntity(rw, rr.UnauthorizedResponse)
 		return
 	}
 	rr.WriteResponseEntity(rw, handler(session, req))
 }
 
+// session
+// session of authenticated request, nil if not found
+func (svcp *ProtectedService) session(req *http.Request) *auth.Session {
+	session, ok := req.Context().Value(svcp.authService.ctxSessionKey).(*auth.Session)
+	if !ok {
+		return nil
+	}
+	return session
+}
+
 // KnockHandler
 // knock knock
 func (svcp *ProtectedService) KnockHandler(rw http.ResponseWriter, req *http.Request) {
@@ -41,33 +88,136 @@ func (svcp *ProtectedService) knock(session *auth.Session, req *http.Request) rr
 	return rr.OkResponse(time.Now().UTC().Unix())
 }
 
+// Stats
+// trustSigner pool queue depth and audit log counters
+func (svcp *ProtectedService) StatsHandler(rw http.ResponseWriter, req *http.Request) {
+	svcp.handlerClosure(rw, req, svcp.stats)
+}
+func (svcp *ProtectedService) stats(session *auth.Session, req *http.Request) rr.ResponseEntity {
+	return rr.OkResponse(struct {
+		trustSigner.PoolStats
+		Audit audit.Stats `json:"audit"`
+	}{trustSigner.Stats(), svcp.instance.audit.Stats()})
+}
+
+// Keys
+// watch-only export of keypairs, ?count=N&format=json|csv
+func (svcp *ProtectedService) KeysHandler(rw http.ResponseWriter, req *http.Request) {
+	session := svcp.session(req)
+	if session == nil {
+		rr.WriteResponseEntity(rw, rr.UnauthorizedResponse)
+		return
+	}
+
+	count := whitebox.DefaultExportCount
+	if countString := req.URL.Query().Get("count"); countString != "" {
+		var err error
+		if count, err = strconv.Atoi(countString); err != nil {
+			rr.WriteResponseEntity(rw, rr.KoResponse(http.StatusBadRequest, "count must be number"))
+			return
+		}
+	}
+
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = whitebox.ExportJSON
+	}
+	if format != whitebox.ExportJSON && format != whitebox.ExportCSV {
+		rr.WriteResponseEntity(rw, rr.KoResponse(http.StatusBadRequest, "format must be json or csv"))
+		return
+	}
+
+	logger.Info("keys export request from ", session.AppName, " : ", count, " ", format)
+
+	exports, err := svcp.instance.ks.ExportKeys(count)
+	if err != nil {
+		logger.Error(err)
+		rr.WriteResponseEntity(rw, rr.KoResponse(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	if format == whitebox.ExportCSV {
+		rw.Header().Set("Content-type", "text/csv; charset=utf8")
+		rw.WriteHeader(http.StatusOK)
+		if err := whitebox.WriteKeyExportCSV(rw, exports); err != nil {
+			logger.Error(err)
+		}
+		return
+	}
+
+	rr.WriteResponseEntity(rw, rr.OkResponse(exports))
+}
+
+type signRequest struct {
+	Type             trustSigner.BlockChainType        `json:"type"`
+	Network          trustSigner.BlockChainNetworkType `json:"network"`
+	Address          string                            `json:"address"`
+	RequestSignature string                            `json:"answer"`
+	Data             string                            `json:"data"`
+	// sign by key at derivation of keypair of address (optional), derived address is tracked
+	Derivation *trustSigner.Derivation `json:"derivation"`
+	// output format of signature (raw if empty), sighash type byte is appended to der
+	Format      string `json:"format"`
+	SigHashType *byte  `json:"sigHashType"`
+}
+
+type signResponse struct {
+	// raw signature data
+	Signature string `json:"signature"`
+	// derived address signed by, only for request with derivation
+	Address string `json:"address,omitempty"`
+	// each signature in requested format, omitted for raw
+	Format     sigformat.Format `json:"format,omitempty"`
+	Signatures []interface{}    `json:"signatures,omitempty"`
+}
+
 // Sign
 // sign requested message
 func (svcp *ProtectedService) SignHandler(rw http.ResponseWriter, req *http.Request) {
 	svcp.handlerClosure(rw, req, svcp.sign)
 }
 func (svcp *ProtectedService) sign(session *auth.Session, req *http.Request) rr.ResponseEntity {
-	var request struct {
-		Type             trustSigner.BlockChainType `json:"type"`
-		Address          string                     `json:"address"`
-		RequestSignature string                     `json:"answer"`
-		Data             string                     `json:"data"`
-	}
-
-	var response struct {
-		Signature string `json:"signature"`
-	}
+	var request signRequest
 
 	// Parse request
 	if err := rr.ReadRequestBody(req, &request); err != nil {
 		return rr.ErrorResponse(err)
 	}
 
+	return svcp.signData(session, req.Header.Get(callbackHeader), request)
+}
+
+// signData
+// sign data of request by whitebox of requested address, response data is signResponse (pendingResponse if held for approval)
+func (svcp *ProtectedService) signData(session *auth.Session, callback string, request signRequest) rr.ResponseEntity {
 	logger.Info("sign request from ", session.AppName, " : ", request.Data)
 
-	requestKey := string(request.Type) + ":" + request.Address
+	requestKey := string(request.Type) + ":" + string(request.Network) + ":" + request.Address
 
-	quiz, found := session.Quizzes[requestKey]
+	if _, err := trustSigner.ParseNetwork(string(request.Network)); err != nil {
+		logger.Error(session.AppName + "'s request " + requestKey + " : " + err.Error())
+		return rr.KoResponse(http.StatusBadRequest, err.Error())
+	}
+
+	format, err := sigformat.ParseFormat(request.Format)
+	if err != nil {
+		return rr.KoResponse(http.StatusBadRequest, err.Error())
+	}
+	if format != sigformat.Raw && trustSigner.SignatureLength(request.Type) != sigformat.RecoverableLength {
+		return rr.KoResponse(http.StatusBadRequest, "signature format "+string(format)+" is not for "+string(request.Type))
+	}
+	if request.SigHashType != nil && format != sigformat.DER {
+		return rr.KoResponse(http.StatusBadRequest, "sigHashType is only for der format")
+	}
+
+	// address may be primary or derived address of keypair, keypair must be on requested network
+	keyID, derivation, found := svcp.instance.ks.LookupAddress(request.Type, request.Network, request.Address)
+	if !found {
+		logger.Error(session.AppName + "'s request address " + requestKey + " not found")
+		return rr.BadRequestResponse
+	}
+
+	quiz, found := session.GetQuiz(keyID)
 	if !found {
 		logger.Error(session.AppName + "'s quiz " + requestKey + " not found")
 		return rr.BadRequestResponse
@@ -78,6 +228,19 @@ func (svcp *ProtectedService) sign(session *auth.Session, req *http.Request) rr.
 		return rr.BadRequestResponse
 	}
 
+	address := request.Address
+	if request.Derivation != nil {
+		derivation = *request.Derivation
+		address, err = svcp.instance.ks.DeriveAddress(keyID, derivation)
+		if err != nil {
+			logger.Error(session.AppName + "'s request " + requestKey + " derivation " + derivation.String() + " : " + err.Error())
+			if err == whitebox.ErrDerivationNotAllowed {
+				return rr.KoResponse(http.StatusBadRequest, err.Error())
+			}
+			return signErrorResponse(err)
+		}
+	}
+
 	// get data to sign
 	dataToSign, err := hex.DecodeString(request.Data)
 
@@ -98,17 +261,140 @@ func (svcp *ProtectedService) sign(session *auth.Session, req *http.Request) rr.
 		return rr.InternalServerErrorResponse
 	}
 
-	// sign message with trustSigner
-	signature, err := trustSigner.GetWBSignatureData(wb, request.Type, dataToSign)
+	s := signing{
+		path:       "/sign",
+		request:    request,
+		operation:  policy.OpSign,
+		symbol:     request.Type,
+		signatures: map[string]int{keyID: len(dataToSign) / 32},
+		payload: map[string]interface{}{
+			"type":    request.Type,
+			"network": request.Network,
+			"address": address,
+			"data":    request.Data,
+			"format":  format,
+		},
+	}
+
+	return svcp.authorizeSigning(session, callback, s, func() rr.ResponseEntity {
+		// sign message with trustSigner
+		signature, err := svcp.signVerified(session, wb, request.Type, request.Network, address, derivation, dataToSign)
+		if err != nil {
+			logger.Error(err)
+			return signErrorResponse(err)
+		}
+
+		response := signResponse{Signature: hex.EncodeToString(signature)}
+		if request.Derivation != nil {
+			response.Address = address
+		}
+
+		if format != sigformat.Raw {
+			response.Format = format
+			response.Signatures, err = sigformat.Convert(format, trustSigner.SignatureLength(request.Type), signature, request.SigHashType)
+			if err != nil {
+				logger.Error(err)
+				return rr.ErrorResponse(err)
+			}
+		}
+
+		// OK, send signature
+		return rr.OkResponse(response)
+	})
+}
+
+var errSignatureVerification = errors.New("signature verification failed")
+
+// signErrorResponse
+// busy signer pool is 503, so that request can be retried later (job is queued again)
+func signErrorResponse(err error) rr.ResponseEntity {
+	if err == trustSigner.ErrPoolBusy {
+		return rr.KoResponse(http.StatusServiceUnavailable, err.Error())
+	}
+	return rr.ErrorResponse(err)
+}
+
+// signVerified
+// sign data with whitebox, signature is verified with public key of tracked address before it is returned
+// ECDSA signatures are normalized to low-S, every signature is recorded to audit log
+func (svcp *ProtectedService) signVerified(session *auth.Session, wb *trustSigner.WhiteBox, bcType trustSigner.BlockChainType, network trustSigner.BlockChainNetworkType, address string, derivation trustSigner.Derivation, data []byte) ([]byte, error) {
+	publicKey, found := svcp.instance.ks.LookupPublicKey(bcType, network, address)
+	if !found {
+		return nil, errors.New("public key of " + address + " not found")
+	}
+
+	signature, err := trustSigner.GetWBSignatureData(wb, bcType, derivation, data)
 	if err != nil {
-		logger.Error(err)
+		_ = svcp.auditSignature(session, bcType, network, address, derivation, dataDigest(data), "", err)
+		return nil, err
+	}
+
+	verified, err := trustSigner.VerifySignatureData(bcType, publicKey, data, signature)
+	if err != nil {
+		logger.WithFields(logrus.Fields{
+			"alert":      "SIGNATURE_VERIFICATION",
+			"app":        session.AppName,
+			"type":       bcType,
+			"network":    network,
+			"address":    address,
+			"derivation": derivation.String(),
+		}).Error("ALERT : whitebox signature is not verified : ", err)
+		_ = svcp.auditSignature(session, bcType, network, address, derivation, dataDigest(data), hex.EncodeToString(signature), errSignatureVerification)
+		return nil, errSignatureVerification
+	}
+
+	// signature is withheld if it is not recorded
+	if err := svcp.auditSignature(session, bcType, network, address, derivation, dataDigest(data), hex.EncodeToString(verified), nil); err != nil {
+		return nil, errAuditFailed
+	}
+
+	return verified, nil
+}
+
+// Deposit
+// issue deposit address of keypair for label
+func (svcp *ProtectedService) DepositHandler(rw http.ResponseWriter, req *http.Request) {
+	svcp.handlerClosure(rw, req, svcp.deposit)
+}
+func (svcp *ProtectedService) deposit(session *auth.Session, req *http.Request) rr.ResponseEntity {
+	var request struct {
+		Type             trustSigner.BlockChainType `json:"type"`
+		Address          string                     `json:"address"`
+		RequestSignature string                     `json:"answer"`
+		Label            string                     `json:"label"`
+	}
+
+	// Parse request
+	if err := rr.ReadRequestBody(req, &request); err != nil {
 		return rr.ErrorResponse(err)
 	}
 
-	// OK, send signature
-	response.Signature = hex.EncodeToString(signature)
+	requestKey := string(request.Type) + ":" + request.Address
+
+	quiz, found := session.Quizzes[requestKey]
+	if !found {
+		logger.Error(session.AppName + "'s quiz " + requestKey + " not found")
+		return rr.BadRequestResponse
+	}
+
+	if request.RequestSignature != quiz.Answer {
+		logger.Error(session.AppName + "'s answer " + request.RequestSignature + " is wrong")
+		return rr.BadRequestResponse
+	}
+
+	if request.Label == "" {
+		return rr.KoResponse(http.StatusBadRequest, "label is required")
+	}
+
+	logger.Info("deposit address request from ", session.AppName, " : ", requestKey, " ", request.Label)
+
+	deposit, err := svcp.instance.ks.AllocateDepositAddress(quiz.KeyID, request.Label)
+	if err != nil {
+		logger.Error(err)
+		return rr.ErrorResponse(err)
+	}
 
-	return rr.OkResponse(response)
+	return rr.OkResponse(deposit)
 }
 
 // Reload
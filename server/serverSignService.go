@@ -0,0 +1,694 @@
+package server
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/colligence-io/signServer/btcmsg"
+	"github.com/colligence-io/signServer/ethmsg"
+	"github.com/colligence-io/signServer/ethtx"
+	"github.com/colligence-io/signServer/hd"
+	"github.com/colligence-io/signServer/psbt"
+	"github.com/colligence-io/signServer/server/auth"
+	"github.com/colligence-io/signServer/server/policy"
+	"github.com/colligence-io/signServer/server/rr"
+	"github.com/colligence-io/signServer/trustSigner"
+	"github.com/colligence-io/signServer/whitebox"
+	"github.com/colligence-io/signServer/xlmtx"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stellar/go/network"
+	"math/big"
+	"net/http"
+	"strings"
+)
+
+/*
+Transaction signing services
+server computes digest from transaction, so that it knows what it signs
+*/
+
+// checkAnswers
+// every keypair used for signing must be answered with session quiz, answers key = symbol:address of welcome package
+func (svcp *ProtectedService) checkAnswers(session *auth.Session, keyIDs map[string]bool, answers map[string]string) bool {
+	for keyID := range keyIDs {
+		quizKey, found := session.GetQuizKey(keyID)
+		if !found {
+			logger.Error(session.AppName + "'s quiz for " + keyID + " not found")
+			return false
+		}
+
+		if answers[quizKey] != session.Quizzes[quizKey].Answer {
+			logger.Error(session.AppName + "'s answer for " + quizKey + " is wrong")
+			return false
+		}
+	}
+	return true
+}
+
+// authorizeAddress
+// whitebox, keyID and derivation of tracked address, session quiz of its keypair must be answered
+func (svcp *ProtectedService) authorizeAddress(session *auth.Session, bcType trustSigner.BlockChainType, network trustSigner.BlockChainNetworkType, address string, answer string) (*trustSigner.WhiteBox, string, trustSigner.Derivation, bool) {
+	requestKey := string(bcType) + ":" + string(network) + ":" + address
+
+	keyID, derivation, found := svcp.instance.ks.LookupAddress(bcType, network, address)
+	if !found {
+		logger.Error(session.AppName + "'s request address " + requestKey + " not found")
+		return nil, keyID, derivation, false
+	}
+
+	quiz, found := session.GetQuiz(keyID)
+	if !found {
+		logger.Error(session.AppName + "'s quiz " + requestKey + " not found")
+		return nil, keyID, derivation, false
+	}
+
+	if answer != quiz.Answer {
+		logger.Error(session.AppName + "'s answer " + answer + " is wrong")
+		return nil, keyID, derivation, false
+	}
+
+	wb := svcp.instance.ks.GetWhiteBoxData(keyID, bcType)
+	if wb == nil {
+		logger.Error("whitebox " + keyID + " not found")
+		return nil, keyID, derivation, false
+	}
+
+	return wb, keyID, derivation, true
+}
+
+// SignPSBT
+// sign inputs of BIP174 PSBT owned by keypairs
+func (svcp *ProtectedService) SignPSBTHandler(rw http.ResponseWriter, req *http.Request) {
+	svcp.handlerClosure(rw, req, svcp.signPSBT)
+}
+func (svcp *ProtectedService) signPSBT(session *auth.Session, req *http.Request) rr.ResponseEntity {
+	var request struct {
+		Network trustSigner.BlockChainNetworkType `json:"network"`
+		PSBT    string                            `json:"psbt"`
+		Answers map[string]string                 `json:"answers"`
+	}
+
+	var response struct {
+		PSBT         string `json:"psbt"`
+		SignedInputs []int  `json:"signedInputs"`
+	}
+
+	// Parse request
+	if err := rr.ReadRequestBody(req, &request); err != nil {
+		return rr.ErrorResponse(err)
+	}
+
+	netParam, err := trustSigner.NetParams(trustSigner.BTC, request.Network)
+	if err != nil {
+		return rr.KoResponse(http.StatusBadRequest, err.Error())
+	}
+
+	packet, err := psbt.DecodeBase64(request.PSBT)
+	if err != nil {
+		logger.Error(session.AppName + "'s psbt is invalid : " + err.Error())
+		return rr.KoResponse(http.StatusBadRequest, err.Error())
+	}
+
+	type inputToSign struct {
+		index      int
+		keyID      string
+		address    string
+		derivation trustSigner.Derivation
+		sigHash    *psbt.SigHash
+	}
+
+	sigHashes := packet.NewTxSigHashes()
+	inputs := make([]inputToSign, 0, len(packet.Inputs))
+	keyIDs := make(map[string]bool)
+
+	// find inputs owned by keypairs, others are left for other signers
+	for i := range packet.Inputs {
+		sigHash, err := packet.InputSigHash(i, sigHashes)
+		if err == psbt.ErrUnsupportedScript || err == psbt.ErrInputFinalized {
+			continue
+		}
+		if err != nil {
+			logger.Error(session.AppName + "'s psbt input is invalid : " + err.Error())
+			return rr.KoResponse(http.StatusBadRequest, err.Error())
+		}
+
+		_, addresses, _, err := txscript.ExtractPkScriptAddrs(sigHash.PkScript, netParam)
+		if err != nil || len(addresses) != 1 {
+			continue
+		}
+
+		address := addresses[0].EncodeAddress()
+		keyID, derivation, found := svcp.instance.ks.LookupAddress(trustSigner.BTC, request.Network, address)
+		if !found {
+			continue
+		}
+
+		inputs = append(inputs, inputToSign{index: i, keyID: keyID, address: address, derivation: derivation, sigHash: sigHash})
+		keyIDs[keyID] = true
+	}
+
+	if len(inputs) == 0 {
+		return rr.KoResponse(http.StatusBadRequest, "no input to sign")
+	}
+
+	if !svcp.checkAnswers(session, keyIDs, request.Answers) {
+		return rr.BadRequestResponse
+	}
+
+	destinations, amount := svcp.psbtDestinations(packet, request.Network, netParam)
+
+	// outputs not committed by signature are unknown, destination and amount rules cannot match
+	for _, input := range inputs {
+		if !input.sigHash.CommitsOutputs() {
+			destinations, amount = nil, nil
+			break
+		}
+	}
+
+	// every signing keypair signs whole transaction
+	signatures := make(map[string]int, len(keyIDs))
+	signInputs := make([]int, 0, len(inputs))
+	for _, input := range inputs {
+		signatures[input.keyID]++
+		signInputs = append(signInputs, input.index)
+	}
+
+	txHash := packet.UnsignedTx.TxHash().String()
+
+	s := signing{
+		path:         "/sign/btc/psbt",
+		request:      request,
+		operation:    policy.OpBTCPSBT,
+		symbol:       trustSigner.BTC,
+		signatures:   signatures,
+		destinations: destinations,
+		amount:       amount,
+		payload: map[string]interface{}{
+			"network":    request.Network,
+			"txid":       txHash,
+			"psbt":       request.PSBT,
+			"signInputs": signInputs,
+		},
+	}
+
+	return svcp.authorizeSigning(session, req.Header.Get(callbackHeader), s, func() rr.ResponseEntity {
+		logger.Info("psbt sign request from ", session.AppName, " : ", txHash, " ", len(inputs), " inputs")
+
+		response.SignedInputs = make([]int, 0, len(inputs))
+
+		for _, input := range inputs {
+			wb := svcp.instance.ks.GetWhiteBoxData(input.keyID, trustSigner.BTC)
+			if wb == nil {
+				logger.Error("whitebox " + input.keyID + " not found")
+				return rr.InternalServerErrorResponse
+			}
+
+			publicKey, err := svcp.publicKeyBytes(wb, trustSigner.BTC, input.derivation)
+			if err != nil {
+				logger.Error(err)
+				return signErrorResponse(err)
+			}
+
+			signature, err := svcp.signVerified(session, wb, trustSigner.BTC, request.Network, input.address, input.derivation, input.sigHash.Hash)
+			if err != nil {
+				logger.Error(err)
+				return signErrorResponse(err)
+			}
+
+			partialSig, err := psbt.SerializeSignature(signature, input.sigHash.HashType)
+			if err != nil {
+				logger.Error(err)
+				return rr.ErrorResponse(err)
+			}
+
+			if err := packet.AddPartialSig(input.index, publicKey, partialSig); err != nil {
+				logger.Error(err)
+				return rr.ErrorResponse(err)
+			}
+
+			response.SignedInputs = append(response.SignedInputs, input.index)
+		}
+
+		var err error
+		response.PSBT, err = packet.EncodeBase64()
+		if err != nil {
+			logger.Error(err)
+			return rr.ErrorResponse(err)
+		}
+
+		return rr.OkResponse(response)
+	})
+}
+
+// publicKeyBytes
+// compressed secp256k1 public key of derivation
+func (svcp *ProtectedService) publicKeyBytes(wb *trustSigner.WhiteBox, bcType trustSigner.BlockChainType, derivation trustSigner.Derivation) ([]byte, error) {
+	extendedKey, err := trustSigner.GetWBPublicKey(wb, bcType, derivation)
+	if err != nil {
+		return nil, err
+	}
+
+	wallet, err := hd.FromBIP32ExtendedKey(extendedKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key of %s : %s", derivation, err.Error())
+	}
+
+	return wallet.Key, nil
+}
+
+// SignETHTx
+// sign unsigned RLP encoded legacy (EIP-155) or EIP-1559 transaction
+func (svcp *ProtectedService) SignETHTxHandler(rw http.ResponseWriter, req *http.Request) {
+	svcp.handlerClosure(rw, req, svcp.signETHTx)
+}
+func (svcp *ProtectedService) signETHTx(session *auth.Session, req *http.Request) rr.ResponseEntity {
+	var request struct {
+		Network          trustSigner.BlockChainNetworkType `json:"network"`
+		Address          string                            `json:"address"`
+		RequestSignature string                            `json:"answer"`
+		ChainID          uint64                            `json:"chainId"`
+		Transaction      string                            `json:"transaction"`
+	}
+
+	var response struct {
+		RawTransaction string `json:"rawTransaction"`
+		Hash           string `json:"hash"`
+	}
+
+	// Parse request
+	if err := rr.ReadRequestBody(req, &request); err != nil {
+		return rr.ErrorResponse(err)
+	}
+
+	unsigned, err := hex.DecodeString(strings.TrimPrefix(request.Transaction, "0x"))
+	if err != nil {
+		return rr.KoResponse(http.StatusBadRequest, "transaction must be hex string")
+	}
+
+	tx, err := ethtx.Decode(unsigned, new(big.Int).SetUint64(request.ChainID))
+	if err != nil {
+		logger.Error(session.AppName + "'s transaction is invalid : " + err.Error())
+		return rr.KoResponse(http.StatusBadRequest, err.Error())
+	}
+
+	wb, keyID, derivation, ok := svcp.authorizeAddress(session, trustSigner.ETH, request.Network, request.Address, request.RequestSignature)
+	if !ok {
+		return rr.BadRequestResponse
+	}
+
+	sigHash, err := tx.SigningHash()
+	if err != nil {
+		logger.Error(err)
+		return rr.ErrorResponse(err)
+	}
+
+	payload := map[string]interface{}{
+		"network":  request.Network,
+		"address":  request.Address,
+		"chainId":  request.ChainID,
+		"type":     tx.Type,
+		"nonce":    tx.Nonce,
+		"gas":      tx.Gas,
+		"value":    tx.Value.String(),
+		"data":     "0x" + hex.EncodeToString(tx.Data),
+		"sigHash":  sigHash.Hex(),
+		"unsigned": request.Transaction,
+	}
+
+	s := signing{path: "/sign/eth/tx", request: request, operation: policy.OpETHTx, symbol: trustSigner.ETH, signatures: map[string]int{keyID: 1}, amount: tx.Value, payload: payload}
+
+	// destination of contract creation is not known
+	if tx.To != nil {
+		s.destinations = []string{tx.To.Hex()}
+		payload["to"] = tx.To.Hex()
+	}
+
+	return svcp.authorizeSigning(session, req.Header.Get(callbackHeader), s, func() rr.ResponseEntity {
+		logger.Info("eth transaction sign request from ", session.AppName, " : ", request.Address, " type ", tx.Type, " chain ", request.ChainID, " ", sigHash.Hex())
+
+		signature, err := svcp.signVerified(session, wb, trustSigner.ETH, request.Network, request.Address, derivation, sigHash.Bytes())
+		if err != nil {
+			logger.Error(err)
+			return signErrorResponse(err)
+		}
+
+		raw, txHash, err := tx.Sign(signature)
+		if err != nil {
+			logger.Error(err)
+			return rr.ErrorResponse(err)
+		}
+
+		response.RawTransaction = "0x" + hex.EncodeToString(raw)
+		response.Hash = txHash.Hex()
+
+		return rr.OkResponse(response)
+	})
+}
+
+// stellar network passphrase of network, other networks (private network) accept any passphrase
+var xlmNetworkPassphrases = map[trustSigner.BlockChainNetworkType]string{
+	trustSigner.MAINNET: network.PublicNetworkPassphrase,
+	trustSigner.TESTNET: network.TestNetworkPassphrase,
+}
+
+// SignXLMEnvelope
+// sign base64 XDR TransactionEnvelope for network passphrase
+func (svcp *ProtectedService) SignXLMEnvelopeHandler(rw http.ResponseWriter, req *http.Request) {
+	svcp.handlerClosure(rw, req, svcp.signXLMEnvelope)
+}
+func (svcp *ProtectedService) signXLMEnvelope(session *auth.Session, req *http.Request) rr.ResponseEntity {
+	var request struct {
+		Network           trustSigner.BlockChainNetworkType `json:"network"`
+		Address           string                            `json:"address"`
+		RequestSignature  string                            `json:"answer"`
+		NetworkPassphrase string                            `json:"networkPassphrase"`
+		Envelope          string                            `json:"envelope"`
+	}
+
+	var response struct {
+		Envelope string `json:"envelope"`
+		Hash     string `json:"hash"`
+	}
+
+	// Parse request
+	if err := rr.ReadRequestBody(req, &request); err != nil {
+		return rr.ErrorResponse(err)
+	}
+
+	if passphrase, found := xlmNetworkPassphrases[request.Network]; found && passphrase != request.NetworkPassphrase {
+		logger.Error(session.AppName + "'s network passphrase is not for " + string(request.Network))
+		return rr.KoResponse(http.StatusBadRequest, "network passphrase is not for "+string(request.Network))
+	}
+
+	envelope, err := xlmtx.DecodeBase64(request.Envelope)
+	if err != nil {
+		logger.Error(session.AppName + "'s envelope is invalid : " + err.Error())
+		return rr.KoResponse(http.StatusBadRequest, "invalid envelope : "+err.Error())
+	}
+
+	txHash, err := envelope.Hash(request.NetworkPassphrase)
+	if err != nil {
+		return rr.KoResponse(http.StatusBadRequest, err.Error())
+	}
+
+	wb, keyID, derivation, ok := svcp.authorizeAddress(session, trustSigner.XLM, request.Network, request.Address, request.RequestSignature)
+	if !ok {
+		return rr.BadRequestResponse
+	}
+
+	destinations, amount := envelope.Destinations()
+
+	s := signing{
+		path:         "/sign/xlm/envelope",
+		request:      request,
+		operation:    policy.OpXLMEnvelope,
+		symbol:       trustSigner.XLM,
+		signatures:   map[string]int{keyID: 1},
+		destinations: destinations,
+		amount:       amount,
+		payload: map[string]interface{}{
+			"network":           request.Network,
+			"address":           request.Address,
+			"networkPassphrase": request.NetworkPassphrase,
+			"envelope":          request.Envelope,
+			"hash":              hex.EncodeToString(txHash[:]),
+		},
+	}
+
+	return svcp.authorizeSigning(session, req.Header.Get(callbackHeader), s, func() rr.ResponseEntity {
+		logger.Info("xlm envelope sign request from ", session.AppName, " : ", request.Address, " ", hex.EncodeToString(txHash[:]))
+
+		signature, err := svcp.signVerified(session, wb, trustSigner.XLM, request.Network, request.Address, derivation, txHash[:])
+		if err != nil {
+			logger.Error(err)
+			return signErrorResponse(err)
+		}
+
+		if err := envelope.AddSignature(request.Address, signature); err != nil {
+			logger.Error(err)
+			return rr.ErrorResponse(err)
+		}
+
+		response.Envelope, err = envelope.EncodeBase64()
+		if err != nil {
+			logger.Error(err)
+			return rr.ErrorResponse(err)
+		}
+		response.Hash = hex.EncodeToString(txHash[:])
+
+		return rr.OkResponse(response)
+	})
+}
+
+type ethMessageSignature struct {
+	Hash      string `json:"hash"`
+	Signature string `json:"signature"`
+	Address   string `json:"address"`
+}
+
+// signETHMessageHash
+// sign message digest, signature is returned with V 27 or 28 and recovered signer address
+func (svcp *ProtectedService) signETHMessageHash(session *auth.Session, wb *trustSigner.WhiteBox, network trustSigner.BlockChainNetworkType, address string, derivation trustSigner.Derivation, hash common.Hash) rr.ResponseEntity {
+	signature, err := svcp.signVerified(session, wb, trustSigner.ETH, network, address, derivation, hash.Bytes())
+	if err != nil {
+		logger.Error(err)
+		return signErrorResponse(err)
+	}
+
+	walletSignature, signer, err := ethmsg.Signature(hash, signature)
+	if err != nil {
+		logger.Error(err)
+		return rr.ErrorResponse(err)
+	}
+
+	return rr.OkResponse(ethMessageSignature{
+		Hash:      hash.Hex(),
+		Signature: "0x" + hex.EncodeToString(walletSignature),
+		Address:   signer.Hex(),
+	})
+}
+
+// SignETHMessage
+// sign EIP-191 personal message (personal_sign)
+func (svcp *ProtectedService) SignETHMessageHandler(rw http.ResponseWriter, req *http.Request) {
+	svcp.handlerClosure(rw, req, svcp.signETHMessage)
+}
+func (svcp *ProtectedService) signETHMessage(session *auth.Session, req *http.Request) rr.ResponseEntity {
+	var request struct {
+		Network          trustSigner.BlockChainNetworkType `json:"network"`
+		Address          string                            `json:"address"`
+		RequestSignature string                            `json:"answer"`
+		Message          string                            `json:"message"`
+		Encoding         string                            `json:"encoding"`
+	}
+
+	// Parse request
+	if err := rr.ReadRequestBody(req, &request); err != nil {
+		return rr.ErrorResponse(err)
+	}
+
+	var message []byte
+	switch request.Encoding {
+	case "", "utf8":
+		message = []byte(request.Message)
+	case "hex":
+		var err error
+		message, err = hex.DecodeString(strings.TrimPrefix(request.Message, "0x"))
+		if err != nil {
+			return rr.KoResponse(http.StatusBadRequest, "message must be hex string")
+		}
+	default:
+		return rr.KoResponse(http.StatusBadRequest, "encoding must be utf8 or hex")
+	}
+
+	wb, keyID, derivation, ok := svcp.authorizeAddress(session, trustSigner.ETH, request.Network, request.Address, request.RequestSignature)
+	if !ok {
+		return rr.BadRequestResponse
+	}
+
+	hash := ethmsg.PersonalHash(message)
+
+	s := signing{
+		path:       "/sign/eth/message",
+		request:    request,
+		operation:  policy.OpETHMessage,
+		symbol:     trustSigner.ETH,
+		signatures: map[string]int{keyID: 1},
+		payload: map[string]interface{}{
+			"network":  request.Network,
+			"address":  request.Address,
+			"message":  request.Message,
+			"encoding": request.Encoding,
+			"hash":     hash.Hex(),
+		},
+	}
+
+	return svcp.authorizeSigning(session, req.Header.Get(callbackHeader), s, func() rr.ResponseEntity {
+		logger.Info("eth personal message sign request from ", session.AppName, " : ", request.Address, " ", hash.Hex())
+
+		return svcp.signETHMessageHash(session, wb, request.Network, request.Address, derivation, hash)
+	})
+}
+
+// SignETHTypedData
+// sign EIP-712 typed data (eth_signTypedData_v4)
+func (svcp *ProtectedService) SignETHTypedDataHandler(rw http.ResponseWriter, req *http.Request) {
+	svcp.handlerClosure(rw, req, svcp.signETHTypedData)
+}
+func (svcp *ProtectedService) signETHTypedData(session *auth.Session, req *http.Request) rr.ResponseEntity {
+	var request struct {
+		Network          trustSigner.BlockChainNetworkType `json:"network"`
+		Address          string                            `json:"address"`
+		RequestSignature string                            `json:"answer"`
+		TypedData        json.RawMessage                   `json:"typedData"`
+	}
+
+	// Parse request
+	if err := rr.ReadRequestBody(req, &request); err != nil {
+		return rr.ErrorResponse(err)
+	}
+
+	typedData, err := ethmsg.DecodeTypedData(request.TypedData)
+	if err != nil {
+		logger.Error(session.AppName + "'s typed data is invalid : " + err.Error())
+		return rr.KoResponse(http.StatusBadRequest, err.Error())
+	}
+
+	hash, err := typedData.Hash()
+	if err != nil {
+		logger.Error(session.AppName + "'s typed data is invalid : " + err.Error())
+		return rr.KoResponse(http.StatusBadRequest, err.Error())
+	}
+
+	wb, keyID, derivation, ok := svcp.authorizeAddress(session, trustSigner.ETH, request.Network, request.Address, request.RequestSignature)
+	if !ok {
+		return rr.BadRequestResponse
+	}
+
+	s := signing{
+		path:       "/sign/eth/typedData",
+		request:    request,
+		operation:  policy.OpETHTypedData,
+		symbol:     trustSigner.ETH,
+		signatures: map[string]int{keyID: 1},
+		payload: map[string]interface{}{
+			"network":   request.Network,
+			"address":   request.Address,
+			"typedData": request.TypedData,
+			"hash":      hash.Hex(),
+		},
+	}
+
+	return svcp.authorizeSigning(session, req.Header.Get(callbackHeader), s, func() rr.ResponseEntity {
+		logger.Info("eth typed data sign request from ", session.AppName, " : ", request.Address, " ", typedData.PrimaryType, " ", hash.Hex())
+
+		return svcp.signETHMessageHash(session, wb, request.Network, request.Address, derivation, hash)
+	})
+}
+
+// SignBTCMessage
+// sign BIP137 bitcoin signed message
+func (svcp *ProtectedService) SignBTCMessageHandler(rw http.ResponseWriter, req *http.Request) {
+	svcp.handlerClosure(rw, req, svcp.signBTCMessage)
+}
+func (svcp *ProtectedService) signBTCMessage(session *auth.Session, req *http.Request) rr.ResponseEntity {
+	var request struct {
+		Network          trustSigner.BlockChainNetworkType `json:"network"`
+		Address          string                            `json:"address"`
+		RequestSignature string                            `json:"answer"`
+		Message          string                            `json:"message"`
+	}
+
+	var response struct {
+		Address   string `json:"address"`
+		Message   string `json:"message"`
+		Signature string `json:"signature"`
+	}
+
+	// Parse request
+	if err := rr.ReadRequestBody(req, &request); err != nil {
+		return rr.ErrorResponse(err)
+	}
+
+	wb, keyID, derivation, ok := svcp.authorizeAddress(session, trustSigner.BTC, request.Network, request.Address, request.RequestSignature)
+	if !ok {
+		return rr.BadRequestResponse
+	}
+
+	messageHash := hex.EncodeToString(btcmsg.MessageHash(request.Message))
+
+	s := signing{
+		path:       "/sign/btc/message",
+		request:    request,
+		operation:  policy.OpBTCMessage,
+		symbol:     trustSigner.BTC,
+		signatures: map[string]int{keyID: 1},
+		payload: map[string]interface{}{
+			"network": request.Network,
+			"address": request.Address,
+			"message": request.Message,
+			"hash":    messageHash,
+		},
+	}
+
+	return svcp.authorizeSigning(session, req.Header.Get(callbackHeader), s, func() rr.ResponseEntity {
+		logger.Info("btc message sign request from ", session.AppName, " : ", request.Address, " ", messageHash)
+
+		// verified and recorded as any other signature, then encoded as message signature
+		verified, err := svcp.signVerified(session, wb, trustSigner.BTC, request.Network, request.Address, derivation, btcmsg.MessageHash(request.Message))
+		if err != nil {
+			logger.Error(err)
+			return signErrorResponse(err)
+		}
+
+		signature, err := whitebox.BitcoinMessageSignature(request.Network, request.Address, request.Message, verified)
+		if err != nil {
+			logger.Error(err)
+			return rr.ErrorResponse(err)
+		}
+
+		response.Address = request.Address
+		response.Message = request.Message
+		response.Signature = signature
+
+		return rr.OkResponse(response)
+	})
+}
+
+// VerifyBTCMessage
+// verify BIP137 bitcoin signed message of any address
+func (svcp *ProtectedService) VerifyBTCMessageHandler(rw http.ResponseWriter, req *http.Request) {
+	svcp.handlerClosure(rw, req, svcp.verifyBTCMessage)
+}
+func (svcp *ProtectedService) verifyBTCMessage(session *auth.Session, req *http.Request) rr.ResponseEntity {
+	var request struct {
+		Network   trustSigner.BlockChainNetworkType `json:"network"`
+		Address   string                            `json:"address"`
+		Message   string                            `json:"message"`
+		Signature string                            `json:"signature"`
+	}
+
+	var response struct {
+		Valid  bool   `json:"valid"`
+		Reason string `json:"reason,omitempty"`
+	}
+
+	// Parse request
+	if err := rr.ReadRequestBody(req, &request); err != nil {
+		return rr.ErrorResponse(err)
+	}
+
+	netParams, err := trustSigner.NetParams(trustSigner.BTC, request.Network)
+	if err != nil {
+		return rr.KoResponse(http.StatusBadRequest, err.Error())
+	}
+
+	if err := btcmsg.Verify(request.Address, request.Message, request.Signature, netParams); err != nil {
+		response.Reason = err.Error()
+	} else {
+		response.Valid = true
+	}
+
+	return rr.OkResponse(response)
+}
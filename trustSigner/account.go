@@ -0,0 +1,80 @@
+package trustSigner
+
+import (
+	"errors"
+	"github.com/btcsuite/btcutil/hdkeychain"
+)
+
+/*
+watch-only derivation from account extended public key (m/44'/coin'/0') of secp256k1 chains
+done in software, so that deriving many addresses does not hold signer pool
+*/
+
+// DeriveAccountPublicKey
+// public key of derivation (change/index) from account key of GetWBAccountPublicKey, same as GetWBPublicKey
+// ed25519 (XLM) has no public derivation
+func DeriveAccountPublicKey(bcType BlockChainType, accountKey string, derivation Derivation) (string, error) {
+	if bcType == XLM {
+		return "", errors.New("public derivation is not supported by " + string(bcType))
+	}
+
+	account, e := hdkeychain.NewKeyFromString(accountKey)
+	if e != nil {
+		return "", e
+	}
+
+	if account.IsPrivate() {
+		return "", errors.New("account key must be public key")
+	}
+
+	if derivation.Change >= hdkeychain.HardenedKeyStart || derivation.Index >= hdkeychain.HardenedKeyStart {
+		return "", errors.New("hardened derivation is not supported")
+	}
+
+	change, e := account.Child(derivation.Change)
+	if e != nil {
+		return "", e
+	}
+
+	child, e := change.Child(derivation.Index)
+	if e != nil {
+		return "", e
+	}
+
+	return child.String(), nil
+}
+
+// EncodeAccountPublicKey
+// account key with extended public key version of network (xpub, tpub, ...)
+// chains without own version bytes (LTC, BCH, DOGE, ETH) use bitcoin version of network
+func EncodeAccountPublicKey(bcType BlockChainType, network BlockChainNetworkType, accountKey string) (string, error) {
+	if bcType == XLM {
+		return accountKey, nil
+	}
+
+	networks, utxo := utxoNetParams[bcType]
+	if !utxo {
+		networks = utxoNetParams[BTC]
+	}
+
+	netParam, found := networks[network]
+	if !found {
+		return "", errors.New("network " + string(network) + " is not supported by " + string(bcType))
+	}
+	if netParam.HDPublicKeyID == [4]byte{} {
+		netParam = utxoNetParams[BTC][network]
+	}
+
+	account, e := hdkeychain.NewKeyFromString(accountKey)
+	if e != nil {
+		return "", e
+	}
+
+	if account.IsPrivate() {
+		return "", errors.New("account key must be public key")
+	}
+
+	account.SetNet(netParam)
+
+	return account.String(), nil
+}
@@ -0,0 +1,90 @@
+package trustSigner
+
+import (
+	"errors"
+	"strings"
+)
+
+// CashAddr
+// https://github.com/bitcoincashorg/bitcoincash.org/blob/master/spec/cashaddr.md
+
+const cashAddrCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// version byte = type << 3 | size, type 0 = P2PKH, size 0 = 160 bit hash
+const cashAddrP2PKH byte = 0
+
+func encodeCashAddr(prefix string, addrType byte, hash []byte) (string, error) {
+	if len(hash) != 20 {
+		return "", errors.New("cashaddr hash must be 160 bits")
+	}
+
+	payload := convertBits(append([]byte{addrType}, hash...), 8, 5)
+
+	checksumInput := make([]byte, 0, len(prefix)+1+len(payload)+8)
+	for _, c := range strings.ToLower(prefix) {
+		checksumInput = append(checksumInput, byte(c)&0x1f)
+	}
+	checksumInput = append(checksumInput, 0)
+	checksumInput = append(checksumInput, payload...)
+	checksumInput = append(checksumInput, make([]byte, 8)...)
+
+	mod := cashAddrPolyMod(checksumInput)
+
+	var sb strings.Builder
+	sb.WriteString(prefix)
+	sb.WriteByte(':')
+	for _, b := range payload {
+		sb.WriteByte(cashAddrCharset[b])
+	}
+	for i := 0; i < 8; i++ {
+		sb.WriteByte(cashAddrCharset[(mod>>uint(5*(7-i)))&0x1f])
+	}
+
+	return sb.String(), nil
+}
+
+func cashAddrPolyMod(v []byte) uint64 {
+	c := uint64(1)
+	for _, d := range v {
+		c0 := byte(c >> 35)
+		c = ((c & 0x07ffffffff) << 5) ^ uint64(d)
+		if c0&0x01 != 0 {
+			c ^= 0x98f2bc8e61
+		}
+		if c0&0x02 != 0 {
+			c ^= 0x79b76d99e2
+		}
+		if c0&0x04 != 0 {
+			c ^= 0xf33e5fb3c4
+		}
+		if c0&0x08 != 0 {
+			c ^= 0xae2eabe2a8
+		}
+		if c0&0x10 != 0 {
+			c ^= 0x1e4f43e470
+		}
+	}
+	return c ^ 1
+}
+
+// convertBits
+// regroup bits, last group is padded with zero
+func convertBits(data []byte, fromBits uint, toBits uint) []byte {
+	var acc uint32
+	var bits uint
+	maxValue := uint32(1)<<toBits - 1
+
+	out := make([]byte, 0, len(data)*int(fromBits)/int(toBits)+1)
+	for _, b := range data {
+		acc = acc<<fromBits | uint32(b)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			out = append(out, byte(acc>>bits&maxValue))
+		}
+	}
+	if bits > 0 {
+		out = append(out, byte(acc<<(toBits-bits)&maxValue))
+	}
+	return out
+}
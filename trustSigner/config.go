@@ -2,6 +2,7 @@ package trustSigner
 
 import (
 	"bytes"
+	"fmt"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcutil"
 	"github.com/colligence-io/signServer/hd"
@@ -12,57 +13,97 @@ type BlockChainNetworkType string
 
 const MAINNET BlockChainNetworkType = "mainnet"
 const TESTNET BlockChainNetworkType = "testnet"
+const REGTEST BlockChainNetworkType = "regtest"
+const SIGNET BlockChainNetworkType = "signet"
+
+var BCNetworkTypes = map[string]BlockChainNetworkType{
+	string(MAINNET): MAINNET,
+	string(TESTNET): TESTNET,
+	string(REGTEST): REGTEST,
+	string(SIGNET):  SIGNET,
+}
 
 type BlockChainType string
 
 const (
-	BTC BlockChainType = "BTC"
-	ETH BlockChainType = "ETH"
-	XLM BlockChainType = "XLM"
+	BTC  BlockChainType = "BTC"
+	ETH  BlockChainType = "ETH"
+	XLM  BlockChainType = "XLM"
+	LTC  BlockChainType = "LTC"
+	BCH  BlockChainType = "BCH"
+	DOGE BlockChainType = "DOGE"
 )
 
 var BCTypes = map[string]BlockChainType{
-	string(BTC): BTC,
-	string(ETH): ETH,
-	string(XLM): XLM,
+	string(BTC):  BTC,
+	string(ETH):  ETH,
+	string(XLM):  XLM,
+	string(LTC):  LTC,
+	string(BCH):  BCH,
+	string(DOGE): DOGE,
 }
 
+type AddressType string
+
+const (
+	P2PKH       AddressType = "p2pkh"
+	P2SH_P2WPKH AddressType = "p2sh-p2wpkh"
+	P2WPKH      AddressType = "p2wpkh"
+)
+
+type addressEncoder func(publicKey []byte, netParam *chaincfg.Params) (string, error)
+
 var bcConfig = map[BlockChainType]struct {
 	PublicKeyLength int
 	SignatureLength int
 	HDDepth         int
-	Address         func(publicKey string, network BlockChainNetworkType) (string, error)
+	HDCoinType      uint32
+	// supported address types, first one is default (empty for account based chains)
+	AddressTypes []AddressType
+	Address      func(publicKey string, network BlockChainNetworkType, addrType AddressType) (string, error)
 }{
 	BTC: {
 		PublicKeyLength: 111,
 		SignatureLength: 65,
 		HDDepth:         5,
-		Address: func(publicKey string, network BlockChainNetworkType) (string, error) {
-			wallet, err := hd.FromBIP32ExtendedKey(publicKey)
-			if err != nil {
-				return "", nil
-			}
-
-			var netParam *chaincfg.Params
-			if network != MAINNET || bytes.Compare(wallet.Vbytes[:], chaincfg.TestNet3Params.HDPublicKeyID[:]) == 0 || bytes.Compare(wallet.Vbytes[:], chaincfg.TestNet3Params.HDPrivateKeyID[:]) == 0 {
-				netParam = &chaincfg.TestNet3Params
-			} else {
-				netParam = &chaincfg.MainNetParams
-			}
-
-			address, err := btcutil.NewAddressPubKey(wallet.Key, netParam)
-			if err != nil {
-				return "", err
-			} else {
-				return address.EncodeAddress(), nil
-			}
-		},
+		HDCoinType:      0,
+		AddressTypes:    []AddressType{P2PKH, P2SH_P2WPKH, P2WPKH},
+		Address: utxoAddress(utxoNetParams[BTC], map[AddressType]addressEncoder{
+			P2PKH:       encodeP2PKH,
+			P2SH_P2WPKH: encodeP2SHP2WPKH,
+			P2WPKH:      encodeP2WPKH,
+		}),
+	},
+	LTC: {
+		PublicKeyLength: 111,
+		SignatureLength: 65,
+		HDDepth:         5,
+		HDCoinType:      2,
+		AddressTypes:    []AddressType{P2PKH},
+		Address:         utxoAddress(utxoNetParams[LTC], map[AddressType]addressEncoder{P2PKH: encodeP2PKH}),
+	},
+	BCH: {
+		PublicKeyLength: 111,
+		SignatureLength: 65,
+		HDDepth:         5,
+		HDCoinType:      145,
+		AddressTypes:    []AddressType{P2PKH},
+		Address:         utxoAddress(utxoNetParams[BCH], map[AddressType]addressEncoder{P2PKH: encodeCashAddrP2PKH}),
+	},
+	DOGE: {
+		PublicKeyLength: 111,
+		SignatureLength: 65,
+		HDDepth:         5,
+		HDCoinType:      3,
+		AddressTypes:    []AddressType{P2PKH},
+		Address:         utxoAddress(utxoNetParams[DOGE], map[AddressType]addressEncoder{P2PKH: encodeP2PKH}),
 	},
 	ETH: {
 		PublicKeyLength: 111,
 		SignatureLength: 65,
 		HDDepth:         5,
-		Address: func(publicKey string, network BlockChainNetworkType) (string, error) {
+		HDCoinType:      60,
+		Address: func(publicKey string, network BlockChainNetworkType, addrType AddressType) (string, error) {
 			wallet, err := hd.FromBIP32ExtendedKey(publicKey)
 			if err != nil {
 				return "", err
@@ -81,17 +122,118 @@ var bcConfig = map[BlockChainType]struct {
 		PublicKeyLength: 56,
 		SignatureLength: 64,
 		HDDepth:         3,
-		Address: func(publicKey string, network BlockChainNetworkType) (string, error) {
+		HDCoinType:      148,
+		Address: func(publicKey string, network BlockChainNetworkType, addrType AddressType) (string, error) {
 			return publicKey, nil
 		},
 	},
 }
 
-func chooseNetwork(bcNetwork string) BlockChainNetworkType {
-	if bcNetwork == (string)(MAINNET) {
-		return MAINNET
+// SignatureLength
+// length of signature per 32 bytes message, 0 if bcType is invalid
+func SignatureLength(bcType BlockChainType) int {
+	return bcConfig[bcType].SignatureLength
+}
+
+// ResolveAddressType
+// check addrType is supported by bcType, empty addrType resolves to default address type
+func ResolveAddressType(bcType BlockChainType, addrType AddressType) (AddressType, error) {
+	types := bcConfig[bcType].AddressTypes
+
+	if addrType == "" {
+		if len(types) == 0 {
+			return "", nil
+		}
+		return types[0], nil
+	}
+
+	for _, t := range types {
+		if t == addrType {
+			return addrType, nil
+		}
+	}
+
+	return "", fmt.Errorf("address type %s is not supported by %s", addrType, bcType)
+}
+
+// utxoAddress
+// address function of bitcoin family
+// testnet extended key is never encoded as mainnet address
+func utxoAddress(networks map[BlockChainNetworkType]*chaincfg.Params, encoders map[AddressType]addressEncoder) func(publicKey string, network BlockChainNetworkType, addrType AddressType) (string, error) {
+	return func(publicKey string, network BlockChainNetworkType, addrType AddressType) (string, error) {
+		encode, found := encoders[addrType]
+		if !found {
+			return "", fmt.Errorf("address type %s is not supported", addrType)
+		}
+
+		wallet, err := hd.FromBIP32ExtendedKey(publicKey)
+		if err != nil {
+			return "", err
+		}
+
+		if network == MAINNET && (bytes.Compare(wallet.Vbytes[:], chaincfg.TestNet3Params.HDPublicKeyID[:]) == 0 || bytes.Compare(wallet.Vbytes[:], chaincfg.TestNet3Params.HDPrivateKeyID[:]) == 0) {
+			network = TESTNET
+		}
+
+		netParam, found := networks[network]
+		if !found {
+			return "", fmt.Errorf("network %s is not supported", network)
+		}
+
+		return encode(wallet.Key, netParam)
+	}
+}
+
+func encodeP2PKH(publicKey []byte, netParam *chaincfg.Params) (string, error) {
+	address, err := btcutil.NewAddressPubKey(publicKey, netParam)
+	if err != nil {
+		return "", err
+	} else {
+		return address.EncodeAddress(), nil
+	}
+}
+
+// P2WPKH nested in P2SH (BIP49)
+func encodeP2SHP2WPKH(publicKey []byte, netParam *chaincfg.Params) (string, error) {
+	redeemScript := append([]byte{0x00, 0x14}, btcutil.Hash160(publicKey)...)
+
+	address, err := btcutil.NewAddressScriptHash(redeemScript, netParam)
+	if err != nil {
+		return "", err
 	} else {
-		return TESTNET
+		return address.EncodeAddress(), nil
 	}
+}
 
+// native segwit v0 bech32 (BIP84)
+func encodeP2WPKH(publicKey []byte, netParam *chaincfg.Params) (string, error) {
+	address, err := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(publicKey), netParam)
+	if err != nil {
+		return "", err
+	} else {
+		return address.EncodeAddress(), nil
+	}
+}
+
+func encodeCashAddrP2PKH(publicKey []byte, netParam *chaincfg.Params) (string, error) {
+	return encodeCashAddr(netParam.Name, cashAddrP2PKH, btcutil.Hash160(publicKey))
+}
+
+// NetParams
+// chaincfg params of bitcoin family network
+func NetParams(bcType BlockChainType, network BlockChainNetworkType) (*chaincfg.Params, error) {
+	netParam, found := utxoNetParams[bcType][network]
+	if !found {
+		return nil, fmt.Errorf("network %s is not supported by %s", network, bcType)
+	}
+	return netParam, nil
+}
+
+// ParseNetwork
+// unknown network is error, never falls back to other network
+func ParseNetwork(bcNetwork string) (BlockChainNetworkType, error) {
+	if network, found := BCNetworkTypes[bcNetwork]; found {
+		return network, nil
+	}
+	return "", fmt.Errorf("unknown blockchain network %s", bcNetwork)
 }
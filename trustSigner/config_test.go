@@ -0,0 +1,86 @@
+package trustSigner_test
+
+import (
+	"github.com/colligence-io/signServer/trustSigner"
+	"testing"
+)
+
+// BIP32 test vector 1, master public key
+// public key 0339a36013301597daef41fbe593a02cc513d0b55527ec2df1050e2e8ff49c85c2
+const testVectorXPub = "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8"
+
+func TestDeriveAddressVectors(t *testing.T) {
+	vectors := []struct {
+		bcType   trustSigner.BlockChainType
+		addrType trustSigner.AddressType
+		network  string
+		address  string
+	}{
+		{trustSigner.BTC, "", "mainnet", "15mKKb2eos1hWa6tisdPwwDC1a5J1y9nma"},
+		{trustSigner.BTC, trustSigner.P2PKH, "testnet", "mkHGce7dctSxHgaWSSbmmrRWsZfzz7MxMk"},
+		{trustSigner.BTC, trustSigner.P2SH_P2WPKH, "mainnet", "3PpgpssV7mcAGpZRWiCWhodUTnjpoSZg7a"},
+		{trustSigner.BTC, trustSigner.P2SH_P2WPKH, "testnet", "2NFNttcoWjE7WUcByBqpPKkcjg8wzgnU5HE"},
+		{trustSigner.BTC, trustSigner.P2WPKH, "mainnet", "bc1qx3ppj0smkuy3d6g525sh9n2w9k7fm7q3x30rtg"},
+		{trustSigner.BTC, trustSigner.P2WPKH, "testnet", "tb1qx3ppj0smkuy3d6g525sh9n2w9k7fm7q3vh5ssm"},
+		{trustSigner.LTC, "", "mainnet", "LPzGaoLUtXFkmNo3u1chDxGxDnSaBQTTxm"},
+		{trustSigner.LTC, "", "testnet", "mkHGce7dctSxHgaWSSbmmrRWsZfzz7MxMk"},
+		{trustSigner.BCH, "", "mainnet", "bitcoincash:qq6yyxf7rwmsj9hfz32jzukdfckme80czyn2pwwpfn"},
+		{trustSigner.BCH, "", "testnet", "bchtest:qq6yyxf7rwmsj9hfz32jzukdfckme80czyhc9fvkw0"},
+		{trustSigner.DOGE, "", "mainnet", "D9uQrqyJ7Guz3aHVTTcxVhNnthobME3o4w"},
+		{trustSigner.DOGE, "", "testnet", "nYxUariD3FNhvYrgVHGQk6y68aBtLHP87b"},
+		{trustSigner.BTC, trustSigner.P2PKH, "regtest", "mkHGce7dctSxHgaWSSbmmrRWsZfzz7MxMk"},
+		{trustSigner.BTC, trustSigner.P2SH_P2WPKH, "regtest", "2NFNttcoWjE7WUcByBqpPKkcjg8wzgnU5HE"},
+		{trustSigner.BTC, trustSigner.P2WPKH, "regtest", "bcrt1qx3ppj0smkuy3d6g525sh9n2w9k7fm7q3w7da8j"},
+		{trustSigner.BTC, trustSigner.P2PKH, "signet", "mkHGce7dctSxHgaWSSbmmrRWsZfzz7MxMk"},
+		{trustSigner.BTC, trustSigner.P2WPKH, "signet", "tb1qx3ppj0smkuy3d6g525sh9n2w9k7fm7q3vh5ssm"},
+		{trustSigner.LTC, "", "regtest", "mkHGce7dctSxHgaWSSbmmrRWsZfzz7MxMk"},
+		{trustSigner.BCH, "", "regtest", "bchreg:qq6yyxf7rwmsj9hfz32jzukdfckme80czydyng09df"},
+		{trustSigner.DOGE, "", "regtest", "mkHGce7dctSxHgaWSSbmmrRWsZfzz7MxMk"},
+	}
+
+	for _, v := range vectors {
+		address, err := trustSigner.DeriveAddress(v.bcType, v.addrType, testVectorXPub, v.network)
+		if err != nil {
+			t.Error("ER : DeriveAddress", v.bcType, v.network, ":", err)
+			continue
+		}
+		if address != v.address {
+			t.Error("ER : DeriveAddress", v.bcType, v.network, ":", address, "!=", v.address)
+		}
+	}
+}
+
+func TestDeriveAddressInvalidKey(t *testing.T) {
+	for _, bcType := range []trustSigner.BlockChainType{trustSigner.BTC, trustSigner.LTC, trustSigner.BCH, trustSigner.DOGE} {
+		if _, err := trustSigner.DeriveAddress(bcType, "", "xpub-invalid", "mainnet"); err == nil {
+			t.Error("ER : DeriveAddress accepted invalid key for", bcType)
+		}
+	}
+}
+
+func TestDeriveAddressInvalidNetwork(t *testing.T) {
+	if _, err := trustSigner.DeriveAddress(trustSigner.BTC, "", testVectorXPub, "testnet4"); err == nil {
+		t.Error("ER : DeriveAddress accepted unknown network")
+	}
+	if _, err := trustSigner.DeriveAddress(trustSigner.BTC, "", testVectorXPub, ""); err == nil {
+		t.Error("ER : DeriveAddress accepted empty network")
+	}
+	if _, err := trustSigner.DeriveAddress(trustSigner.LTC, "", testVectorXPub, "signet"); err == nil {
+		t.Error("ER : LTC accepted signet")
+	}
+}
+
+func TestResolveAddressType(t *testing.T) {
+	if addrType, err := trustSigner.ResolveAddressType(trustSigner.BTC, ""); err != nil || addrType != trustSigner.P2PKH {
+		t.Error("ER : BTC default address type", addrType, err)
+	}
+	if addrType, err := trustSigner.ResolveAddressType(trustSigner.ETH, ""); err != nil || addrType != "" {
+		t.Error("ER : ETH default address type", addrType, err)
+	}
+	if _, err := trustSigner.ResolveAddressType(trustSigner.LTC, trustSigner.P2WPKH); err == nil {
+		t.Error("ER : LTC accepted p2wpkh")
+	}
+	if _, err := trustSigner.ResolveAddressType(trustSigner.ETH, trustSigner.P2PKH); err == nil {
+		t.Error("ER : ETH accepted p2pkh")
+	}
+}
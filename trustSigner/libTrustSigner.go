@@ -0,0 +1,204 @@
+//go:build libtrustsigner
+// +build libtrustsigner
+
+package trustSigner
+
+/*
+#cgo LDFLAGS: -L${SRCDIR} -Wl,-rpath=\$ORIGIN/trustSigner -ltrustsigner
+
+#include <stdlib.h>
+#include <string.h>
+
+unsigned char *TrustSigner_getWBInitializeData(char *app_id);
+char *TrustSigner_getWBPublicKey(char *app_id, unsigned char *wb_data, char *coin_symbol, int hd_depth, int hd_change, int hd_index);
+unsigned char *TrustSigner_getWBSignatureData(char *app_id, unsigned char *wb_data, char *coin_symbol, int hd_depth, int hd_change, int hd_index, unsigned char *hash_message, int hash_len);
+char *TrustSigner_getWBRecoveryData(char *app_id, unsigned char *wb_data, char *user_key, char *server_key);
+unsigned char *TrustSigner_setWBRecoveryData(char *app_id, char *user_key, char *recovery_data);
+*/
+import "C"
+import (
+	"errors"
+	"github.com/colligence-io/signServer/config"
+	"unsafe"
+)
+
+// libSigner
+// Signer backed by libtrustsigner.so
+// concurrency is controlled by signer pool
+type libSigner struct{}
+
+func init() {
+	backends[LibraryBackend] = backend{
+		newSigner: func(cfg config.SignerConfig) (Signer, error) {
+			return &libSigner{}, nil
+		},
+		// library is not known to be thread safe, raise with signer.maxInFlight if it is
+		maxInFlight: 1,
+	}
+	defaultBackend = LibraryBackend
+	signer = &libSigner{}
+	allocWhiteBox = cAllocWhiteBox
+}
+
+// cAllocWhiteBox
+// whitebox data and app ID are allocated in C memory, so that GC never moves or copies them
+func cAllocWhiteBox(appID string, wbBytes []byte) (*WhiteBox, error) {
+	if len(wbBytes) == 0 {
+		return nil, errors.New("whitebox data of " + appID + " is empty")
+	}
+	if len(wbBytes) >= 1<<30 {
+		return nil, errors.New("whitebox data of " + appID + " is too large")
+	}
+
+	cPtrData := C.malloc(C.size_t(len(wbBytes)))
+	if cPtrData == nil {
+		return nil, errors.New("whitebox memory allocation failed")
+	}
+	data := (*[1 << 30]byte)(cPtrData)[:len(wbBytes):len(wbBytes)]
+	copy(data, wbBytes)
+
+	cPtrCharAppID := C.CString(appID)
+
+	return &WhiteBox{
+		AppID:  appID,
+		data:   data,
+		cAppID: unsafe.Pointer(cPtrCharAppID),
+		free: func(wb *WhiteBox) {
+			zero(wb.data)
+			C.memset(wb.cAppID, 0, C.strlen((*C.char)(wb.cAppID)))
+
+			C.free(cPtrData)
+			C.free(wb.cAppID)
+		},
+	}, nil
+}
+
+//unsigned char *TrustSigner_getWBInitializeData(char *app_id);
+func (ls *libSigner) InitializeData(appId string) ([]byte, error) {
+	cPtrCharAppID := C.CString(appId)
+	defer C.free(unsafe.Pointer(cPtrCharAppID))
+
+	cUcharPtrResult := C.TrustSigner_getWBInitializeData(cPtrCharAppID)
+	defer C.free(unsafe.Pointer(cUcharPtrResult))
+
+	return ptrToWhiteboxData(cUcharPtrResult)
+}
+
+func ptrToWhiteboxData(ptr *C.uchar) ([]byte, error) {
+	if ptr == nil {
+		return nil, errors.New("whitebox initialization failed")
+	}
+
+	wbLength := *(*int32)(unsafe.Pointer(ptr))
+	cIntWBLength := C.int(wbLength)
+
+	wbData := C.GoBytes(unsafe.Pointer(ptr), cIntWBLength)
+
+	if wbData != nil {
+		return wbData, nil
+	} else {
+		return nil, errors.New("whitebox initialization failed")
+	}
+}
+
+//char *TrustSigner_getWBPublicKey(char *app_id, unsigned char *wb_data, char *coin_symbol, int hd_depth, int hd_change, int hd_index);
+func (ls *libSigner) PublicKey(wb *WhiteBox, bcType BlockChainType, derivation Derivation) (string, error) {
+	cPtrCharAppID := (*C.char)(wb.cAppID)
+
+	cPtrCharSymbol := C.CString(string(bcType))
+	defer C.free(unsafe.Pointer(cPtrCharSymbol))
+
+	cCharPtrResult := C.TrustSigner_getWBPublicKey(cPtrCharAppID, (*C.uchar)(unsafe.Pointer(&wb.data[0])), cPtrCharSymbol, C.int(bcConfig[bcType].HDDepth), C.int(derivation.Change), C.int(derivation.Index))
+	defer C.free(unsafe.Pointer(cCharPtrResult))
+
+	if cCharPtrResult != nil {
+		publicKey := C.GoBytes(unsafe.Pointer(cCharPtrResult), C.int(bcConfig[bcType].PublicKeyLength))
+
+		return string(publicKey), nil
+	} else {
+		return "", errors.New("public key generation failed")
+	}
+}
+
+// AccountPublicKey
+// same library call with account depth, depth of XLM is already account depth
+func (ls *libSigner) AccountPublicKey(wb *WhiteBox, bcType BlockChainType) (string, error) {
+	cPtrCharAppID := (*C.char)(wb.cAppID)
+
+	cPtrCharSymbol := C.CString(string(bcType))
+	defer C.free(unsafe.Pointer(cPtrCharSymbol))
+
+	cCharPtrResult := C.TrustSigner_getWBPublicKey(cPtrCharAppID, (*C.uchar)(unsafe.Pointer(&wb.data[0])), cPtrCharSymbol, C.int(accountHDDepth), C.int(0), C.int(0))
+	defer C.free(unsafe.Pointer(cCharPtrResult))
+
+	if cCharPtrResult != nil {
+		publicKey := C.GoBytes(unsafe.Pointer(cCharPtrResult), C.int(bcConfig[bcType].PublicKeyLength))
+
+		return string(publicKey), nil
+	} else {
+		return "", errors.New("public key generation failed")
+	}
+}
+
+//unsigned char *TrustSigner_getWBSignatureData(char *app_id, unsigned char *wb_data, char *coin_symbol, int hd_depth, int hd_change, int hd_index, unsigned char *hash_message, int hash_len);
+func (ls *libSigner) SignatureData(wb *WhiteBox, bcType BlockChainType, derivation Derivation, message []byte) ([]byte, error) {
+	if len(message) == 0 || len(message)%32 != 0 {
+		return nil, errors.New("message length must be 32*N")
+	}
+
+	cPtrCharAppID := (*C.char)(wb.cAppID)
+
+	cPtrCharSymbol := C.CString(string(bcType))
+	defer C.free(unsafe.Pointer(cPtrCharSymbol))
+
+	numMessage := len(message) / 32
+
+	cCharPtrResult := C.TrustSigner_getWBSignatureData(cPtrCharAppID, (*C.uchar)(unsafe.Pointer(&wb.data[0])), cPtrCharSymbol, C.int(bcConfig[bcType].HDDepth), C.int(derivation.Change), C.int(derivation.Index), (*C.uchar)(unsafe.Pointer(&message[0])), C.int(C.size_t(len(message))))
+	defer C.free(unsafe.Pointer(cCharPtrResult))
+
+	if cCharPtrResult != nil {
+		return C.GoBytes(unsafe.Pointer(cCharPtrResult), C.int(bcConfig[bcType].SignatureLength*numMessage)), nil
+	} else {
+		return nil, errors.New("signing error")
+	}
+}
+
+//char *TrustSigner_getWBRecoveryData(char *app_id, unsigned char *wb_data, char *user_key, char *server_key);
+func (ls *libSigner) RecoveryData(wb *WhiteBox, recoveryKey []byte) ([]byte, error) {
+	cPtrCharAppID := (*C.char)(wb.cAppID)
+
+	cCharPtrResult := C.TrustSigner_getWBRecoveryData(cPtrCharAppID, (*C.uchar)(unsafe.Pointer(&wb.data[0])), (*C.char)(unsafe.Pointer(&recoveryKey[0])), (*C.char)(unsafe.Pointer(&recoveryKey[0])))
+	defer C.free(unsafe.Pointer(cCharPtrResult))
+
+	if cCharPtrResult != nil {
+		rBytes := C.GoBytes(unsafe.Pointer(cCharPtrResult), C.int(recoveryDataLength))
+		nt := clen(rBytes)
+		if nt == 0 {
+			return nil, errors.New("recovery data generation returned null")
+		} else {
+			return rBytes[:nt], nil
+		}
+	} else {
+		return nil, errors.New("recovery data generation failed")
+	}
+}
+
+func clen(n []byte) int {
+	for i := 0; i < len(n); i++ {
+		if n[i] == 0 {
+			return i
+		}
+	}
+	return len(n)
+}
+
+//unsigned char *TrustSigner_setWBRecoveryData(char *app_id, char *user_key, char *recovery_data);
+func (ls *libSigner) Recover(appId string, recoveryKey []byte, recoveryData []byte) ([]byte, error) {
+	cPtrCharAppID := C.CString(appId)
+	defer C.free(unsafe.Pointer(cPtrCharAppID))
+
+	cUcharPtrResult := C.TrustSigner_setWBRecoveryData(cPtrCharAppID, (*C.char)(unsafe.Pointer(&recoveryKey[0])), (*C.char)(unsafe.Pointer(&recoveryData[0])))
+	defer C.free(unsafe.Pointer(cUcharPtrResult))
+
+	return ptrToWhiteboxData(cUcharPtrResult)
+}
@@ -0,0 +1,121 @@
+package trustSigner
+
+import "github.com/btcsuite/btcd/chaincfg"
+
+/*
+Network parameters of bitcoin family, only fields used for address encoding are set
+these are not registered to chaincfg (address decoding is not needed)
+*/
+
+// networks of bitcoin family, key = BlockChainType, network
+var utxoNetParams = map[BlockChainType]map[BlockChainNetworkType]*chaincfg.Params{
+	BTC: {
+		MAINNET: &chaincfg.MainNetParams,
+		TESTNET: &chaincfg.TestNet3Params,
+		REGTEST: &chaincfg.RegressionNetParams,
+		SIGNET:  &sigNetParams,
+	},
+	LTC: {
+		MAINNET: &ltcMainNetParams,
+		TESTNET: &ltcTestNetParams,
+		REGTEST: &ltcRegTestParams,
+	},
+	BCH: {
+		MAINNET: &bchMainNetParams,
+		TESTNET: &bchTestNetParams,
+		REGTEST: &bchRegTestParams,
+	},
+	DOGE: {
+		MAINNET: &dogeMainNetParams,
+		TESTNET: &dogeTestNetParams,
+		REGTEST: &dogeRegTestParams,
+	},
+}
+
+// bitcoin signet (BIP325), shares address prefixes and HD version bytes with testnet3
+var sigNetParams = chaincfg.Params{
+	Name:             "signet",
+	PubKeyHashAddrID: 0x6f, // m or n
+	ScriptHashAddrID: 0xc4, // 2
+	PrivateKeyID:     0xef,
+	Bech32HRPSegwit:  "tb",
+	HDPrivateKeyID:   chaincfg.TestNet3Params.HDPrivateKeyID,
+	HDPublicKeyID:    chaincfg.TestNet3Params.HDPublicKeyID,
+	HDCoinType:       1,
+}
+
+var ltcMainNetParams = chaincfg.Params{
+	Name:             "litecoin",
+	PubKeyHashAddrID: 0x30, // L
+	ScriptHashAddrID: 0x32, // M
+	PrivateKeyID:     0xb0,
+	Bech32HRPSegwit:  "ltc",
+	HDCoinType:       2,
+}
+
+var ltcTestNetParams = chaincfg.Params{
+	Name:             "litecoin-testnet",
+	PubKeyHashAddrID: 0x6f, // m or n
+	ScriptHashAddrID: 0x3a, // Q
+	PrivateKeyID:     0xef,
+	Bech32HRPSegwit:  "tltc",
+	HDCoinType:       1,
+}
+
+var ltcRegTestParams = chaincfg.Params{
+	Name:             "litecoin-regtest",
+	PubKeyHashAddrID: 0x6f,
+	ScriptHashAddrID: 0x3a,
+	PrivateKeyID:     0xef,
+	Bech32HRPSegwit:  "rltc",
+	HDCoinType:       1,
+}
+
+// Name is used as CashAddr prefix
+var bchMainNetParams = chaincfg.Params{
+	Name:             "bitcoincash",
+	PubKeyHashAddrID: 0x00,
+	ScriptHashAddrID: 0x05,
+	PrivateKeyID:     0x80,
+	HDCoinType:       145,
+}
+
+var bchTestNetParams = chaincfg.Params{
+	Name:             "bchtest",
+	PubKeyHashAddrID: 0x6f,
+	ScriptHashAddrID: 0xc4,
+	PrivateKeyID:     0xef,
+	HDCoinType:       1,
+}
+
+var bchRegTestParams = chaincfg.Params{
+	Name:             "bchreg",
+	PubKeyHashAddrID: 0x6f,
+	ScriptHashAddrID: 0xc4,
+	PrivateKeyID:     0xef,
+	HDCoinType:       1,
+}
+
+var dogeMainNetParams = chaincfg.Params{
+	Name:             "dogecoin",
+	PubKeyHashAddrID: 0x1e, // D
+	ScriptHashAddrID: 0x16, // 9 or A
+	PrivateKeyID:     0x9e,
+	HDCoinType:       3,
+}
+
+var dogeTestNetParams = chaincfg.Params{
+	Name:             "dogecoin-testnet",
+	PubKeyHashAddrID: 0x71, // n
+	ScriptHashAddrID: 0xc4, // 2
+	PrivateKeyID:     0xf1,
+	HDCoinType:       1,
+}
+
+var dogeRegTestParams = chaincfg.Params{
+	Name:             "dogecoin-regtest",
+	PubKeyHashAddrID: 0x6f,
+	ScriptHashAddrID: 0xc4,
+	PrivateKeyID:     0xef,
+	HDCoinType:       1,
+}
@@ -0,0 +1,95 @@
+package trustSigner
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+var ErrPoolBusy = errors.New("trustSigner pool is busy")
+
+// pool
+// caps in-flight signer calls, each whitebox is locked separately
+type pool struct {
+	// 64-bit atomic counters first for alignment
+	queued    int64
+	inFlight  int64
+	completed uint64
+	rejected  uint64
+
+	slots    chan struct{}
+	maxQueue int64
+}
+
+type PoolStats struct {
+	MaxInFlight int    `json:"maxInFlight"`
+	MaxQueue    int64  `json:"maxQueue"`
+	InFlight    int64  `json:"inFlight"`
+	Queued      int64  `json:"queued"`
+	Completed   uint64 `json:"completed"`
+	Rejected    uint64 `json:"rejected"`
+}
+
+// newPool
+// maxQueue <= 0 means unbounded queue
+func newPool(maxInFlight int, maxQueue int) *pool {
+	if maxInFlight <= 0 {
+		maxInFlight = 1
+	}
+	if maxQueue < 0 {
+		maxQueue = 0
+	}
+	return &pool{
+		slots:    make(chan struct{}, maxInFlight),
+		maxQueue: int64(maxQueue),
+	}
+}
+
+// do
+// run fn holding whitebox lock (if wb is not nil) and one in-flight slot
+func (p *pool) do(wb *WhiteBox, fn func() error) error {
+	if queued := atomic.AddInt64(&p.queued, 1); p.maxQueue > 0 && queued > p.maxQueue {
+		atomic.AddInt64(&p.queued, -1)
+		atomic.AddUint64(&p.rejected, 1)
+		return ErrPoolBusy
+	}
+
+	// whitebox lock first, waiting for same whitebox should not hold a slot
+	if wb != nil {
+		wb.lock.Lock()
+		defer wb.lock.Unlock()
+
+		if wb.closed {
+			atomic.AddInt64(&p.queued, -1)
+			return ErrWhiteBoxClosed
+		}
+	}
+
+	p.slots <- struct{}{}
+	atomic.AddInt64(&p.queued, -1)
+	atomic.AddInt64(&p.inFlight, 1)
+
+	defer func() {
+		atomic.AddInt64(&p.inFlight, -1)
+		atomic.AddUint64(&p.completed, 1)
+		<-p.slots
+	}()
+
+	return fn()
+}
+
+// busy
+// true if queue is full, next call would be rejected
+func (p *pool) busy() bool {
+	return p.maxQueue > 0 && atomic.LoadInt64(&p.queued) >= p.maxQueue
+}
+
+func (p *pool) stats() PoolStats {
+	return PoolStats{
+		MaxInFlight: cap(p.slots),
+		MaxQueue:    p.maxQueue,
+		InFlight:    atomic.LoadInt64(&p.inFlight),
+		Queued:      atomic.LoadInt64(&p.queued),
+		Completed:   atomic.LoadUint64(&p.completed),
+		Rejected:    atomic.LoadUint64(&p.rejected),
+	}
+}
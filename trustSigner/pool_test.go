@@ -0,0 +1,172 @@
+//go:build !libtrustsigner
+// +build !libtrustsigner
+
+package trustSigner_test
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/colligence-io/signServer/config"
+	"github.com/colligence-io/signServer/trustSigner"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowSigner
+// stand-in signer which records max concurrent calls
+type slowSigner struct {
+	trustSigner.Signer
+	current int64
+	max     int64
+}
+
+func (s *slowSigner) PublicKey(wb *trustSigner.WhiteBox, bcType trustSigner.BlockChainType, derivation trustSigner.Derivation) (string, error) {
+	c := atomic.AddInt64(&s.current, 1)
+	defer atomic.AddInt64(&s.current, -1)
+
+	for {
+		m := atomic.LoadInt64(&s.max)
+		if c <= m || atomic.CompareAndSwapInt64(&s.max, m, c) {
+			break
+		}
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	return "", nil
+}
+
+func withSigner(s trustSigner.Signer, maxInFlight int, maxQueue int) {
+	trustSigner.SetSigner(s)
+	trustSigner.ConfigurePool(maxInFlight, maxQueue)
+}
+
+func restoreSigner(t testing.TB) {
+	if e := trustSigner.Configure(config.SignerConfig{Backend: trustSigner.SoftwareBackend, SealKey: testSealKey}); e != nil {
+		t.Fatal(e)
+	}
+}
+
+func TestPoolMaxInFlight(t *testing.T) {
+	defer restoreSigner(t)
+
+	s := &slowSigner{}
+	withSigner(s, 3, 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 12; i++ {
+		wb := newWhiteBox(t, fmt.Sprint(i), []byte{0})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = trustSigner.GetWBPublicKey(wb, trustSigner.BTC, trustSigner.Derivation{})
+		}()
+	}
+	wg.Wait()
+
+	if s.max != 3 {
+		t.Error("ER : max in-flight", s.max, "expected 3")
+	}
+
+	if stats := trustSigner.Stats(); stats.Completed != 12 || stats.InFlight != 0 || stats.Queued != 0 {
+		t.Error("ER : stats", stats)
+	}
+}
+
+func TestPoolWhiteBoxLock(t *testing.T) {
+	defer restoreSigner(t)
+
+	s := &slowSigner{}
+	withSigner(s, 8, 0)
+
+	wb := newWhiteBox(t, "test", []byte{0})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = trustSigner.GetWBPublicKey(wb, trustSigner.BTC, trustSigner.Derivation{})
+		}()
+	}
+	wg.Wait()
+
+	if s.max != 1 {
+		t.Error("ER : same whitebox called concurrently", s.max)
+	}
+}
+
+func TestPoolMaxQueue(t *testing.T) {
+	defer restoreSigner(t)
+
+	withSigner(&slowSigner{}, 1, 2)
+
+	var busy int64
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wb := newWhiteBox(t, fmt.Sprint(i), []byte{0})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, e := trustSigner.GetWBPublicKey(wb, trustSigner.BTC, trustSigner.Derivation{})
+			if e == trustSigner.ErrPoolBusy {
+				atomic.AddInt64(&busy, 1)
+			}
+		}()
+	}
+
+	// full queue is reported before call is rejected
+	busySeen := false
+	for deadline := time.Now().Add(time.Second); !busySeen && time.Now().Before(deadline); {
+		busySeen = trustSigner.Busy()
+	}
+	wg.Wait()
+
+	if !busySeen || trustSigner.Busy() {
+		t.Error("ER : Busy", busySeen, trustSigner.Busy())
+	}
+
+	if busy == 0 || trustSigner.Stats().Rejected != uint64(busy) {
+		t.Error("ER : bounded queue did not reject", busy, trustSigner.Stats())
+	}
+}
+
+// BenchmarkPool
+// signing throughput of software signer at different in-flight caps, each goroutine signs with its own whitebox
+func BenchmarkPool(b *testing.B) {
+	defer restoreSigner(b)
+
+	for _, concurrency := range []int{1, 2, 4, 8, 16} {
+		b.Run(fmt.Sprintf("inFlight=%d", concurrency), func(b *testing.B) {
+			s, e := trustSigner.NewSoftSigner(testSealKey)
+			if e != nil {
+				b.Fatal(e)
+			}
+			withSigner(s, concurrency, 0)
+
+			message := make([]byte, 32)
+			_, _ = io.ReadFull(rand.Reader, message)
+
+			var seq int64
+
+			b.SetParallelism(concurrency)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				appID := fmt.Sprint("bench", atomic.AddInt64(&seq, 1))
+				data, e := s.InitializeData(appID)
+				if e != nil {
+					b.Fatal(e)
+				}
+				wb := newWhiteBox(b, appID, data)
+
+				for pb.Next() {
+					if _, e := trustSigner.GetWBSignatureData(wb, trustSigner.ETH, trustSigner.Derivation{}, message); e != nil {
+						b.Fatal(e)
+					}
+				}
+			})
+		})
+	}
+}
@@ -1,2 +1,2 @@
 #!/bin/sh
-go test -ldflags=-r=.
+go test -tags libtrustsigner -ldflags=-r=.
@@ -0,0 +1,191 @@
+package sigformat
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+/*
+Signature output formats of secp256k1 [R || S || V] signature (V is 0 or 1)
+
+raw     : [R || S || V] as whitebox returns
+der     : ASN.1 DER SEQUENCE { INTEGER r, INTEGER s } for bitcoin scripts, sighash type byte optionally appended
+compact : [27 + 4 + V || R || S], recoverable compact signature of compressed public key (bitcoin signmessage form)
+rsv     : {"r": "0x..", "s": "0x..", "v": V}
+
+ed25519 signatures support raw only
+*/
+
+type Format string
+
+const (
+	Raw     Format = "raw"
+	DER     Format = "der"
+	Compact Format = "compact"
+	RSV     Format = "rsv"
+)
+
+var Formats = map[string]Format{
+	string(Raw):     Raw,
+	string(DER):     DER,
+	string(Compact): Compact,
+	string(RSV):     RSV,
+}
+
+const (
+	// length of [R || S || V]
+	RecoverableLength = 65
+
+	compactHeaderCompressed byte = 27 + 4
+)
+
+type RSVSignature struct {
+	R string `json:"r"`
+	S string `json:"s"`
+	V byte   `json:"v"`
+}
+
+// ParseFormat
+// empty format is raw
+func ParseFormat(format string) (Format, error) {
+	if format == "" {
+		return Raw, nil
+	}
+	if f, found := Formats[format]; found {
+		return f, nil
+	}
+	return "", fmt.Errorf("signature format %s is not supported", format)
+}
+
+func checkRecoverable(signature []byte) error {
+	if len(signature) != RecoverableLength || signature[64] > 1 {
+		return errors.New("signature must be [R || S || V] with V 0 or 1")
+	}
+	return nil
+}
+
+// ToDER
+// DER encoding of R and S
+func ToDER(signature []byte) ([]byte, error) {
+	if e := checkRecoverable(signature); e != nil {
+		return nil, e
+	}
+
+	r := derInteger(signature[:32])
+	s := derInteger(signature[32:64])
+
+	der := make([]byte, 0, 6+len(r)+len(s))
+	der = append(der, 0x30, byte(4+len(r)+len(s)))
+	der = append(der, 0x02, byte(len(r)))
+	der = append(der, r...)
+	der = append(der, 0x02, byte(len(s)))
+	der = append(der, s...)
+
+	return der, nil
+}
+
+// ToDERWithHashType
+// DER encoding with sighash type byte, as in bitcoin scriptSig / witness
+func ToDERWithHashType(signature []byte, hashType byte) ([]byte, error) {
+	der, e := ToDER(signature)
+	if e != nil {
+		return nil, e
+	}
+	return append(der, hashType), nil
+}
+
+// derInteger
+// minimal big-endian positive integer, leading zeros removed and 0x00 prepended if high bit is set
+func derInteger(b []byte) []byte {
+	for len(b) > 1 && b[0] == 0 {
+		b = b[1:]
+	}
+	if b[0]&0x80 != 0 {
+		return append([]byte{0x00}, b...)
+	}
+	return append([]byte{}, b...)
+}
+
+// ToCompact
+// [27 + 4 + V || R || S]
+func ToCompact(signature []byte) ([]byte, error) {
+	if e := checkRecoverable(signature); e != nil {
+		return nil, e
+	}
+
+	compact := make([]byte, RecoverableLength)
+	compact[0] = compactHeaderCompressed + signature[64]
+	copy(compact[1:], signature[:64])
+
+	return compact, nil
+}
+
+// ToRSV
+// R, S as 0x prefixed hex and V
+func ToRSV(signature []byte) (RSVSignature, error) {
+	if e := checkRecoverable(signature); e != nil {
+		return RSVSignature{}, e
+	}
+
+	return RSVSignature{
+		R: "0x" + hex.EncodeToString(signature[:32]),
+		S: "0x" + hex.EncodeToString(signature[32:64]),
+		V: signature[64],
+	}, nil
+}
+
+// Convert
+// each signatureLength bytes signature of signature data in format
+// hex string for raw, der and compact, RSVSignature for rsv, hashType is appended to der if not nil
+func Convert(format Format, signatureLength int, signatureData []byte, hashType *byte) ([]interface{}, error) {
+	if signatureLength <= 0 || len(signatureData) == 0 || len(signatureData)%signatureLength != 0 {
+		return nil, fmt.Errorf("signature data length must be %d*N", signatureLength)
+	}
+
+	if format != Raw && signatureLength != RecoverableLength {
+		return nil, fmt.Errorf("signature format %s is only for secp256k1 signature", format)
+	}
+
+	if hashType != nil && format != DER {
+		return nil, errors.New("sighash type is only for der format")
+	}
+
+	converted := make([]interface{}, 0, len(signatureData)/signatureLength)
+
+	for i := 0; i < len(signatureData); i += signatureLength {
+		signature := signatureData[i : i+signatureLength]
+
+		var formatted []byte
+		var e error
+
+		switch format {
+		case Raw:
+			formatted = signature
+		case DER:
+			if hashType != nil {
+				formatted, e = ToDERWithHashType(signature, *hashType)
+			} else {
+				formatted, e = ToDER(signature)
+			}
+		case Compact:
+			formatted, e = ToCompact(signature)
+		case RSV:
+			rsv, e := ToRSV(signature)
+			if e != nil {
+				return nil, e
+			}
+			converted = append(converted, rsv)
+			continue
+		default:
+			return nil, fmt.Errorf("signature format %s is not supported", format)
+		}
+
+		if e != nil {
+			return nil, e
+		}
+		converted = append(converted, hex.EncodeToString(formatted))
+	}
+
+	return converted, nil
+}
@@ -0,0 +1,139 @@
+package sigformat_test
+
+import (
+	"encoding/hex"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/colligence-io/signServer/trustSigner/sigformat"
+	"github.com/ethereum/go-ethereum/crypto"
+	"testing"
+)
+
+var vectors = []struct {
+	name    string
+	raw     string
+	der     string
+	compact string
+}{
+	{
+		// EIP-155 example signature
+		name:    "short",
+		raw:     "28ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa63627667cbe9d8997f761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d8300",
+		der:     "3044022028ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa636276022067cbe9d8997f761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d83",
+		compact: "1f28ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa63627667cbe9d8997f761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d83",
+	},
+	{
+		// leading zeros of R removed, 0x00 prepended to high bit
+		name:    "leading zeros",
+		raw:     "0000000000000000000000000000000000000000000000000000000000008a1b7fffffffffffffffffffffffffffffff5d576e7357a4501ddfe92f46681b20a001",
+		der:     "30270203008a1b02207fffffffffffffffffffffffffffffff5d576e7357a4501ddfe92f46681b20a0",
+		compact: "200000000000000000000000000000000000000000000000000000000000008a1b7fffffffffffffffffffffffffffffff5d576e7357a4501ddfe92f46681b20a0",
+	},
+	{
+		// high bit of R
+		name:    "high bit",
+		raw:     "d2143f2c6533390e6b55d75bf8c48dfd71958a825f7c4d0989d84624bcdc9f5c3e8c442390bdb7810c4b8bfeebf21d9aae68a7c7ac1372031c561f94845a5c2a01",
+		der:     "3045022100d2143f2c6533390e6b55d75bf8c48dfd71958a825f7c4d0989d84624bcdc9f5c02203e8c442390bdb7810c4b8bfeebf21d9aae68a7c7ac1372031c561f94845a5c2a",
+		compact: "20d2143f2c6533390e6b55d75bf8c48dfd71958a825f7c4d0989d84624bcdc9f5c3e8c442390bdb7810c4b8bfeebf21d9aae68a7c7ac1372031c561f94845a5c2a",
+	},
+}
+
+func TestVectors(t *testing.T) {
+	for _, v := range vectors {
+		raw, _ := hex.DecodeString(v.raw)
+
+		der, err := sigformat.ToDER(raw)
+		if err != nil || hex.EncodeToString(der) != v.der {
+			t.Error("ER : ToDER", v.name, ":", hex.EncodeToString(der), err)
+		}
+
+		withHashType, err := sigformat.ToDERWithHashType(raw, 0x01)
+		if err != nil || hex.EncodeToString(withHashType) != v.der+"01" {
+			t.Error("ER : ToDERWithHashType", v.name, ":", hex.EncodeToString(withHashType), err)
+		}
+
+		compact, err := sigformat.ToCompact(raw)
+		if err != nil || hex.EncodeToString(compact) != v.compact {
+			t.Error("ER : ToCompact", v.name, ":", hex.EncodeToString(compact), err)
+		}
+
+		rsv, err := sigformat.ToRSV(raw)
+		if err != nil || rsv.R != "0x"+v.raw[:64] || rsv.S != "0x"+v.raw[64:128] || rsv.V != raw[64] {
+			t.Error("ER : ToRSV", v.name, ":", rsv, err)
+		}
+	}
+}
+
+// formats are read back by btcec
+func TestFormatsRecover(t *testing.T) {
+	privateKey, err := btcec.NewPrivateKey(btcec.S256())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := crypto.Keccak256([]byte("signature format"))
+
+	raw, err := crypto.Sign(hash, privateKey.ToECDSA())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, _ := sigformat.ToDER(raw)
+	parsed, err := btcec.ParseDERSignature(der, btcec.S256())
+	if err != nil {
+		t.Fatal("ER : DER is not parsed :", err)
+	}
+	if !parsed.Verify(hash, privateKey.PubKey()) {
+		t.Error("ER : DER signature is not verified")
+	}
+
+	compact, _ := sigformat.ToCompact(raw)
+	recovered, compressed, err := btcec.RecoverCompact(btcec.S256(), compact, hash)
+	if err != nil || !compressed || !recovered.IsEqual(privateKey.PubKey()) {
+		t.Error("ER : compact signature is not recovered", err)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	raw0, _ := hex.DecodeString(vectors[0].raw)
+	raw2, _ := hex.DecodeString(vectors[2].raw)
+	signatureData := append(append([]byte{}, raw0...), raw2...)
+
+	hashType := byte(0x81)
+	converted, err := sigformat.Convert(sigformat.DER, 65, signatureData, &hashType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(converted) != 2 || converted[0] != vectors[0].der+"81" || converted[1] != vectors[2].der+"81" {
+		t.Error("ER : Convert der", converted)
+	}
+
+	converted, err = sigformat.Convert(sigformat.RSV, 65, signatureData, nil)
+	if err != nil || len(converted) != 2 {
+		t.Fatal("ER : Convert rsv", err)
+	}
+	if rsv, ok := converted[1].(sigformat.RSVSignature); !ok || rsv.V != 1 {
+		t.Error("ER : Convert rsv", converted[1])
+	}
+
+	// ed25519 is raw only
+	ed25519Signature := make([]byte, 64)
+	if _, err := sigformat.Convert(sigformat.Raw, 64, ed25519Signature, nil); err != nil {
+		t.Error("ER : Convert raw ed25519", err)
+	}
+	if _, err := sigformat.Convert(sigformat.DER, 64, ed25519Signature, nil); err == nil {
+		t.Error("ER : ed25519 converted to der")
+	}
+
+	if _, err := sigformat.Convert(sigformat.Compact, 65, signatureData, &hashType); err == nil {
+		t.Error("ER : sighash type accepted for compact")
+	}
+	if _, err := sigformat.Convert(sigformat.DER, 65, signatureData[:64], nil); err == nil {
+		t.Error("ER : truncated signature data converted")
+	}
+
+	if _, err := sigformat.ParseFormat("base58"); err == nil {
+		t.Error("ER : unknown format accepted")
+	}
+	if format, err := sigformat.ParseFormat(""); err != nil || format != sigformat.Raw {
+		t.Error("ER : empty format is not raw")
+	}
+}
@@ -0,0 +1,300 @@
+package trustSigner
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"github.com/colligence-io/signServer/util"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stellar/go/exp/crypto/derivation"
+	stellarkp "github.com/stellar/go/keypair"
+	"io"
+)
+
+const softSeedLength = 32
+
+// magic header of software whitebox data
+var softWhiteBoxMagic = []byte("SWB1")
+
+// softSigner
+// Signer which holds HD seed in software, sealed by AES-GCM with seal key
+// whitebox data = magic || nonce || AES-GCM(sealKey, seed), appID is used as additional data
+type softSigner struct {
+	sealKey []byte
+}
+
+// NewSoftSigner
+// sealKey is hashed into AES-256 key
+func NewSoftSigner(sealKey string) (Signer, error) {
+	if sealKey == "" {
+		return nil, errors.New("software signer requires seal key")
+	}
+	return &softSigner{sealKey: util.Crypto.Sha256Hash(sealKey)}, nil
+}
+
+func (ss *softSigner) InitializeData(appID string) ([]byte, error) {
+	seed := make([]byte, softSeedLength)
+	defer zero(seed)
+
+	if _, e := io.ReadFull(rand.Reader, seed); e != nil {
+		return nil, e
+	}
+
+	return ss.seal(appID, seed)
+}
+
+func (ss *softSigner) PublicKey(wb *WhiteBox, bcType BlockChainType, derivation Derivation) (string, error) {
+	seed, e := ss.unseal(wb.AppID, wb.data)
+	if e != nil {
+		return "", e
+	}
+	defer zero(seed)
+
+	if bcType == XLM {
+		kp, e := deriveEd25519(seed, bcType, derivation)
+		if e != nil {
+			return "", e
+		}
+		return kp.Address(), nil
+	}
+
+	key, e := deriveSecp256k1(seed, bcType, derivation)
+	if e != nil {
+		return "", e
+	}
+	defer key.Zero()
+
+	pub, e := key.Neuter()
+	if e != nil {
+		return "", e
+	}
+
+	return pub.String(), nil
+}
+
+func (ss *softSigner) AccountPublicKey(wb *WhiteBox, bcType BlockChainType) (string, error) {
+	if bcType == XLM {
+		return ss.PublicKey(wb, bcType, Derivation{})
+	}
+
+	seed, e := ss.unseal(wb.AppID, wb.data)
+	if e != nil {
+		return "", e
+	}
+	defer zero(seed)
+
+	key, e := deriveSecp256k1Depth(seed, bcType, Derivation{}, accountHDDepth)
+	if e != nil {
+		return "", e
+	}
+	defer key.Zero()
+
+	pub, e := key.Neuter()
+	if e != nil {
+		return "", e
+	}
+
+	return pub.String(), nil
+}
+
+func (ss *softSigner) SignatureData(wb *WhiteBox, bcType BlockChainType, derivation Derivation, message []byte) ([]byte, error) {
+	if len(message) == 0 || len(message)%32 != 0 {
+		return nil, errors.New("message length must be 32*N")
+	}
+
+	seed, e := ss.unseal(wb.AppID, wb.data)
+	if e != nil {
+		return nil, e
+	}
+	defer zero(seed)
+
+	var signFunc func(hash []byte) ([]byte, error)
+
+	if bcType == XLM {
+		kp, e := deriveEd25519(seed, bcType, derivation)
+		if e != nil {
+			return nil, e
+		}
+		signFunc = kp.Sign
+	} else {
+		key, e := deriveSecp256k1(seed, bcType, derivation)
+		if e != nil {
+			return nil, e
+		}
+		defer key.Zero()
+
+		privateKey, e := key.ECPrivKey()
+		if e != nil {
+			return nil, e
+		}
+
+		signFunc = func(hash []byte) ([]byte, error) {
+			// [R || S || V], V is 0 or 1
+			return crypto.Sign(hash, privateKey.ToECDSA())
+		}
+	}
+
+	signature := make([]byte, 0, bcConfig[bcType].SignatureLength*len(message)/32)
+	for i := 0; i < len(message); i += 32 {
+		sig, e := signFunc(message[i : i+32])
+		if e != nil {
+			return nil, e
+		}
+		signature = append(signature, sig...)
+	}
+
+	return signature, nil
+}
+
+func (ss *softSigner) RecoveryData(wb *WhiteBox, recoveryKey []byte) ([]byte, error) {
+	seed, e := ss.unseal(wb.AppID, wb.data)
+	if e != nil {
+		return nil, e
+	}
+	defer zero(seed)
+
+	sealed, e := sealWith(util.Crypto.Sha256Hash(string(recoveryKey)), wb.AppID, seed)
+	if e != nil {
+		return nil, e
+	}
+
+	recoveryData := make([]byte, base64.StdEncoding.EncodedLen(len(sealed)))
+	base64.StdEncoding.Encode(recoveryData, sealed)
+
+	if len(recoveryData) > recoveryDataLength {
+		return nil, errors.New("recovery data too long")
+	}
+
+	return recoveryData, nil
+}
+
+func (ss *softSigner) Recover(appID string, recoveryKey []byte, recoveryData []byte) ([]byte, error) {
+	sealed, e := base64.StdEncoding.DecodeString(string(recoveryData))
+	if e != nil {
+		return nil, e
+	}
+
+	seed, e := unsealWith(util.Crypto.Sha256Hash(string(recoveryKey)), appID, sealed)
+	if e != nil {
+		return nil, errors.New("recovery data cannot be opened with recovery key")
+	}
+	defer zero(seed)
+
+	return ss.seal(appID, seed)
+}
+
+func (ss *softSigner) seal(appID string, seed []byte) ([]byte, error) {
+	return sealWith(ss.sealKey, appID, seed)
+}
+
+func (ss *softSigner) unseal(appID string, wbData []byte) ([]byte, error) {
+	seed, e := unsealWith(ss.sealKey, appID, wbData)
+	if e != nil {
+		return nil, fmt.Errorf("cannot unseal whitebox %s : %s", appID, e.Error())
+	}
+	return seed, nil
+}
+
+func sealWith(key []byte, appID string, plain []byte) ([]byte, error) {
+	aead, e := newGCM(key)
+	if e != nil {
+		return nil, e
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, e := io.ReadFull(rand.Reader, nonce); e != nil {
+		return nil, e
+	}
+
+	sealed := append([]byte{}, softWhiteBoxMagic...)
+	sealed = append(sealed, nonce...)
+	return aead.Seal(sealed, nonce, plain, []byte(appID)), nil
+}
+
+func unsealWith(key []byte, appID string, sealed []byte) ([]byte, error) {
+	aead, e := newGCM(key)
+	if e != nil {
+		return nil, e
+	}
+
+	headerLength := len(softWhiteBoxMagic) + aead.NonceSize()
+	if len(sealed) < headerLength || !bytes.Equal(sealed[:len(softWhiteBoxMagic)], softWhiteBoxMagic) {
+		return nil, errors.New("not a software whitebox")
+	}
+
+	return aead.Open(nil, sealed[len(softWhiteBoxMagic):headerLength], sealed[headerLength:], []byte(appID))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, e := aes.NewCipher(key)
+	if e != nil {
+		return nil, e
+	}
+	return cipher.NewGCM(block)
+}
+
+// deriveSecp256k1
+// BIP44 m/44'/coin'/0'/change/index
+func deriveSecp256k1(seed []byte, bcType BlockChainType, derivation Derivation) (*hdkeychain.ExtendedKey, error) {
+	return deriveSecp256k1Depth(seed, bcType, derivation, bcConfig[bcType].HDDepth)
+}
+
+// deriveSecp256k1Depth
+// BIP44 path truncated to depth
+func deriveSecp256k1Depth(seed []byte, bcType BlockChainType, derivation Derivation, depth int) (*hdkeychain.ExtendedKey, error) {
+	if derivation.Change >= hdkeychain.HardenedKeyStart || derivation.Index >= hdkeychain.HardenedKeyStart {
+		return nil, errors.New("hardened change/index is not supported")
+	}
+
+	key, e := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if e != nil {
+		return nil, e
+	}
+
+	path := []uint32{
+		hdkeychain.HardenedKeyStart + 44,
+		hdkeychain.HardenedKeyStart + bcConfig[bcType].HDCoinType,
+		hdkeychain.HardenedKeyStart + 0,
+		derivation.Change,
+		derivation.Index,
+	}
+
+	for _, i := range path[:depth] {
+		child, e := key.Child(i)
+		key.Zero()
+		if e != nil {
+			return nil, e
+		}
+		key = child
+	}
+
+	return key, nil
+}
+
+// deriveEd25519
+// SLIP-0010 m/44'/coin'/index'
+func deriveEd25519(seed []byte, bcType BlockChainType, hdPath Derivation) (*stellarkp.Full, error) {
+	if hdPath.Change != 0 {
+		return nil, errors.New("ed25519 derivation does not support change")
+	}
+
+	key, e := derivation.DeriveForPath(fmt.Sprintf("m/44'/%d'/%d'", bcConfig[bcType].HDCoinType, hdPath.Index), seed)
+	if e != nil {
+		return nil, e
+	}
+	defer zero(key.Key)
+
+	return stellarkp.FromRawSeed(key.RawSeed())
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,224 @@
+//go:build !libtrustsigner
+// +build !libtrustsigner
+
+package trustSigner_test
+
+import (
+	"bytes"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"github.com/colligence-io/signServer/config"
+	"github.com/colligence-io/signServer/hd"
+	"github.com/colligence-io/signServer/trustSigner"
+	"github.com/ethereum/go-ethereum/crypto"
+	"os"
+	"testing"
+)
+
+const testSealKey = "test seal key"
+
+func TestMain(m *testing.M) {
+	if e := trustSigner.Configure(config.SignerConfig{Backend: trustSigner.SoftwareBackend, SealKey: testSealKey}); e != nil {
+		panic(e)
+	}
+	os.Exit(m.Run())
+}
+
+func TestSoftSignerSealKey(t *testing.T) {
+	data, err := trustSigner.GetWBInitializeData("test")
+	if err != nil {
+		t.Fatal("ER : WB Initialize :", err)
+	}
+
+	publicKey, err := trustSigner.GetWBPublicKey(newWhiteBox(t, "test", data), trustSigner.ETH, trustSigner.Derivation{})
+	if err != nil {
+		t.Fatal("ER : Public key :", err)
+	}
+
+	// whitebox is bound to appID
+	if _, err := trustSigner.GetWBPublicKey(newWhiteBox(t, "other", data), trustSigner.ETH, trustSigner.Derivation{}); err == nil {
+		t.Error("ER : whitebox opened with different appID")
+	}
+
+	// whitebox is bound to seal key
+	other, err := trustSigner.NewSoftSigner("other seal key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.PublicKey(newWhiteBox(t, "test", data), trustSigner.ETH, trustSigner.Derivation{}); err == nil {
+		t.Error("ER : whitebox opened with different seal key")
+	}
+
+	// same whitebox yields same key
+	again, err := trustSigner.GetWBPublicKey(newWhiteBox(t, "test", data), trustSigner.ETH, trustSigner.Derivation{})
+	if err != nil || again != publicKey {
+		t.Error("ER : public key not deterministic", publicKey, again)
+	}
+}
+
+func TestSoftSignerMessageLength(t *testing.T) {
+	data, err := trustSigner.GetWBInitializeData("test")
+	if err != nil {
+		t.Fatal("ER : WB Initialize :", err)
+	}
+
+	wb := newWhiteBox(t, "test", data)
+
+	if _, err := trustSigner.GetWBSignatureData(wb, trustSigner.BTC, trustSigner.Derivation{}, make([]byte, 31)); err == nil {
+		t.Error("ER : signed message with invalid length")
+	}
+
+	signature, err := trustSigner.GetWBSignatureData(wb, trustSigner.XLM, trustSigner.Derivation{}, make([]byte, 64))
+	if err != nil {
+		t.Fatal("ER : Sign Failed :", err)
+	}
+	if len(signature) != 128 {
+		t.Error("ER : signature length", len(signature))
+	}
+}
+
+func TestSoftSignerRequiresSealKey(t *testing.T) {
+	if err := trustSigner.Configure(config.SignerConfig{Backend: trustSigner.SoftwareBackend}); err == nil {
+		t.Error("ER : software signer configured without seal key")
+	}
+	if err := trustSigner.Configure(config.SignerConfig{Backend: "unknown", SealKey: testSealKey}); err == nil {
+		t.Error("ER : unknown backend configured")
+	}
+}
+
+func TestBackendRequired(t *testing.T) {
+	if err := trustSigner.Configure(config.SignerConfig{SealKey: testSealKey}); err == nil {
+		t.Error("ER : signer configured without backend")
+	}
+}
+
+func TestSoftSignerDerivation(t *testing.T) {
+	data, err := trustSigner.GetWBInitializeData("test")
+	if err != nil {
+		t.Fatal("ER : WB Initialize :", err)
+	}
+
+	wb := newWhiteBox(t, "test", data)
+
+	addresses := make(map[string]trustSigner.Derivation)
+	for _, d := range []trustSigner.Derivation{{0, 0}, {0, 1}, {1, 0}, {0, 1000}} {
+		publicKey, err := trustSigner.GetWBPublicKey(wb, trustSigner.ETH, d)
+		if err != nil {
+			t.Fatal("ER : Public key :", d, err)
+		}
+
+		address, err := trustSigner.DeriveAddress(trustSigner.ETH, "", publicKey, "testnet")
+		if err != nil {
+			t.Fatal("ER : DeriveAddress :", err)
+		}
+
+		if prev, found := addresses[address]; found {
+			t.Error("ER : derivation", d, "collides with", prev)
+		}
+		addresses[address] = d
+
+		// signature recovers to derived key
+		message := crypto.Keccak256([]byte(d.String()))
+		signature, err := trustSigner.GetWBSignatureData(wb, trustSigner.ETH, d, message)
+		if err != nil {
+			t.Fatal("ER : Sign Failed :", err)
+		}
+
+		recovered, err := crypto.SigToPub(message, signature)
+		if err != nil {
+			t.Fatal("ER : Recover :", err)
+		}
+
+		wallet, err := hd.FromBIP32ExtendedKey(publicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(crypto.CompressPubkey(recovered), wallet.Key) {
+			t.Error("ER : signature for", d, "is not made by derived key")
+		}
+	}
+
+	if _, err := trustSigner.GetWBPublicKey(wb, trustSigner.XLM, trustSigner.Derivation{Change: 1}); err == nil {
+		t.Error("ER : ed25519 derived with change")
+	}
+
+	xlm0, _ := trustSigner.GetWBPublicKey(wb, trustSigner.XLM, trustSigner.Derivation{Index: 0})
+	xlm1, _ := trustSigner.GetWBPublicKey(wb, trustSigner.XLM, trustSigner.Derivation{Index: 1})
+	if xlm0 == xlm1 {
+		t.Error("ER : ed25519 index not applied")
+	}
+}
+
+func TestSoftSignerAccountPublicKey(t *testing.T) {
+	data, err := trustSigner.GetWBInitializeData("test")
+	if err != nil {
+		t.Fatal("ER : WB Initialize :", err)
+	}
+
+	wb := newWhiteBox(t, "test", data)
+	defer wb.Close()
+
+	accountKey, err := trustSigner.GetWBAccountPublicKey(wb, trustSigner.BTC)
+	if err != nil {
+		t.Fatal("ER : Account public key :", err)
+	}
+
+	account, err := hdkeychain.NewKeyFromString(accountKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.IsPrivate() || account.Depth() != 3 {
+		t.Fatal("ER : account key is not public key of depth 3")
+	}
+
+	// watch-only derivation from account key matches signer derivation
+	for _, d := range []trustSigner.Derivation{{0, 0}, {0, 7}, {1, 3}} {
+		change, err := account.Child(d.Change)
+		if err != nil {
+			t.Fatal(err)
+		}
+		child, err := change.Child(d.Index)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		publicKey, err := trustSigner.GetWBPublicKey(wb, trustSigner.BTC, d)
+		if err != nil {
+			t.Fatal("ER : Public key :", d, err)
+		}
+
+		if child.String() != publicKey {
+			t.Error("ER : watch-only derivation", d, "differs from signer")
+		}
+
+		derived, err := trustSigner.DeriveAccountPublicKey(trustSigner.BTC, accountKey, d)
+		if err != nil || derived != publicKey {
+			t.Error("ER : DeriveAccountPublicKey", d, err)
+		}
+	}
+
+	// version bytes of network
+	for network, prefix := range map[trustSigner.BlockChainNetworkType]string{
+		trustSigner.MAINNET: "xpub",
+		trustSigner.TESTNET: "tpub",
+		trustSigner.REGTEST: "tpub",
+		trustSigner.SIGNET:  "tpub",
+	} {
+		encoded, err := trustSigner.EncodeAccountPublicKey(trustSigner.BTC, network, accountKey)
+		if err != nil || encoded[:4] != prefix {
+			t.Error("ER : account key of", network, encoded, err)
+		}
+	}
+	if encoded, err := trustSigner.EncodeAccountPublicKey(trustSigner.ETH, trustSigner.TESTNET, accountKey); err != nil || encoded[:4] != "tpub" {
+		t.Error("ER : ETH account key of testnet", encoded, err)
+	}
+	if _, err := trustSigner.EncodeAccountPublicKey(trustSigner.LTC, trustSigner.SIGNET, accountKey); err == nil {
+		t.Error("ER : LTC signet account key encoded")
+	}
+
+	xlmAccount, _ := trustSigner.GetWBAccountPublicKey(wb, trustSigner.XLM)
+	xlm0, _ := trustSigner.GetWBPublicKey(wb, trustSigner.XLM, trustSigner.Derivation{})
+	if xlmAccount != xlm0 {
+		t.Error("ER : ed25519 account key is not primary key")
+	}
+}
@@ -1,168 +1,234 @@
 package trustSigner
 
-/*
-#cgo LDFLAGS: -L${SRCDIR} -Wl,-rpath=\$ORIGIN/trustSigner -ltrustsigner
-
-#include <stdlib.h>
-
-unsigned char *TrustSigner_getWBInitializeData(char *app_id);
-char *TrustSigner_getWBPublicKey(char *app_id, unsigned char *wb_data, char *coin_symbol, int hd_depth, int hd_change, int hd_index);
-unsigned char *TrustSigner_getWBSignatureData(char *app_id, unsigned char *wb_data, char *coin_symbol, int hd_depth, int hd_change, int hd_index, unsigned char *hash_message, int hash_len);
-char *TrustSigner_getWBRecoveryData(char *app_id, unsigned char *wb_data, char *user_key, char *server_key);
-unsigned char *TrustSigner_setWBRecoveryData(char *app_id, char *user_key, char *recovery_data);
-*/
-import "C"
 import (
-	"bytes"
 	"errors"
-	"sync"
-	"unsafe"
+	"fmt"
+	"github.com/colligence-io/signServer/config"
+	"runtime"
 )
 
 const recoveryKeyLength int = 128
 const recoveryDataLength int = 1024
 
-var syncLock = &sync.Mutex{}
+// depth of BIP44 account key (m/44'/coin'/0')
+const accountHDDepth int = 3
 
-type WhiteBox struct {
-	AppID   *C.char
-	Pointer *C.uchar
+const (
+	LibraryBackend  = "trustsigner"
+	SoftwareBackend = "software"
+)
+
+// Signer
+// whitebox backend which initializes, derives, signs and recovers whitebox data
+type Signer interface {
+	InitializeData(appID string) ([]byte, error)
+	PublicKey(wb *WhiteBox, bcType BlockChainType, derivation Derivation) (string, error)
+	AccountPublicKey(wb *WhiteBox, bcType BlockChainType) (string, error)
+	SignatureData(wb *WhiteBox, bcType BlockChainType, derivation Derivation, message []byte) ([]byte, error)
+	RecoveryData(wb *WhiteBox, recoveryKey []byte) ([]byte, error)
+	Recover(appID string, recoveryKey []byte, recoveryData []byte) ([]byte, error)
 }
 
-func DeriveAddress(bcType BlockChainType, publicKey string, bcNetwork string) (string, error) {
-	return bcConfig[bcType].Address(publicKey, chooseNetwork(bcNetwork))
+// Derivation
+// change and address index of BIP44 path (m/44'/coin'/0'/change/index)
+// ed25519 chains use index only (m/44'/coin'/index')
+type Derivation struct {
+	Change uint32 `json:"change"`
+	Index  uint32 `json:"index"`
 }
 
-//unsigned char *TrustSigner_getWBInitializeData(char *app_id);
-func GetWBInitializeData(appId string) ([]byte, error) {
-	syncLock.Lock()
-	defer syncLock.Unlock()
+func (d Derivation) String() string {
+	return fmt.Sprintf("%d/%d", d.Change, d.Index)
+}
 
-	cPtrCharAppID := C.CString(appId)
-	defer C.free(unsafe.Pointer(cPtrCharAppID))
+type backend struct {
+	newSigner func(cfg config.SignerConfig) (Signer, error)
 
-	cUcharPtrResult := C.TrustSigner_getWBInitializeData(cPtrCharAppID)
-	defer C.free(unsafe.Pointer(cUcharPtrResult))
+	// default in-flight cap when config does not specify maxInFlight
+	maxInFlight int
+}
 
-	return ptrToWhiteboxData(cUcharPtrResult)
+// backends, key = backend name
+var backends = map[string]backend{
+	SoftwareBackend: {
+		newSigner: func(cfg config.SignerConfig) (Signer, error) {
+			return NewSoftSigner(cfg.SealKey)
+		},
+		maxInFlight: runtime.NumCPU(),
+	},
 }
 
-func ptrToWhiteboxData(ptr *C.uchar) ([]byte, error) {
-	if ptr == nil {
-		return nil, errors.New("whitebox initialization failed")
+// defaultBackend is used when config does not specify signer backend
+// empty unless built with libtrustsigner, software backend is never chosen without explicit config
+var defaultBackend = ""
+
+// signer is the active backend, nil until configured (unless built with libtrustsigner)
+var signer Signer
+
+// signerPool caps in-flight calls to signer
+var signerPool = newPool(1, 0)
+
+var ErrNoSigner = errors.New("trustSigner backend is not configured")
+
+// Configure
+// select signer backend from configuration
+func Configure(cfg config.SignerConfig) error {
+	backend := cfg.Backend
+	if backend == "" {
+		backend = defaultBackend
+	}
+	if backend == "" {
+		return fmt.Errorf("signer.backend is not set, build with -tags libtrustsigner or set signer.backend to %s explicitly", SoftwareBackend)
 	}
 
-	wbLength := *(*int32)(unsafe.Pointer(ptr))
-	cIntWBLength := C.int(wbLength)
+	b, found := backends[backend]
+	if !found {
+		return fmt.Errorf("signer backend %s is not available in this build", backend)
+	}
 
-	wbData := C.GoBytes(unsafe.Pointer(ptr), cIntWBLength)
+	s, e := b.newSigner(cfg)
+	if e != nil {
+		return e
+	}
 
-	if wbData != nil {
-		return wbData, nil
-	} else {
-		return nil, errors.New("whitebox initialization failed")
+	maxInFlight := cfg.MaxInFlight
+	if maxInFlight <= 0 {
+		maxInFlight = b.maxInFlight
 	}
+
+	SetSigner(s)
+	ConfigurePool(maxInFlight, cfg.MaxQueue)
+	return nil
 }
 
-func ConvertToWhiteBox(appID string, wbBytes []byte) *WhiteBox {
-	var buf bytes.Buffer
-	buf.Write(wbBytes)
-	return &WhiteBox{C.CString(appID), (*C.uchar)(unsafe.Pointer(&buf.Bytes()[0]))}
+// SetSigner
+// replace active signer backend
+func SetSigner(s Signer) {
+	signer = s
 }
 
-//char *TrustSigner_getWBPublicKey(char *app_id, unsigned char *wb_data, char *coin_symbol, int hd_depth, int hd_change, int hd_index);
-func GetWBPublicKey(wb *WhiteBox, bcType BlockChainType) (string, error) {
-	syncLock.Lock()
-	defer syncLock.Unlock()
+// ConfigurePool
+// replace signer pool, calls already queued in previous pool are not affected
+// maxQueue <= 0 means unbounded queue
+func ConfigurePool(maxInFlight int, maxQueue int) {
+	signerPool = newPool(maxInFlight, maxQueue)
+}
 
-	cPtrCharSymbol := C.CString(string(bcType))
-	defer C.free(unsafe.Pointer(cPtrCharSymbol))
+// Stats
+// queue depth and in-flight calls of signer pool
+func Stats() PoolStats {
+	return signerPool.stats()
+}
 
-	cCharPtrResult := C.TrustSigner_getWBPublicKey(wb.AppID, wb.Pointer, cPtrCharSymbol, C.int(bcConfig[bcType].HDDepth), C.int(0), C.int(0))
-	defer C.free(unsafe.Pointer(cCharPtrResult))
+// Busy
+// true if signer pool queue is full and call would fail with ErrPoolBusy
+func Busy() bool {
+	return signerPool.busy()
+}
 
-	if cCharPtrResult != nil {
-		publicKey := C.GoBytes(unsafe.Pointer(cCharPtrResult), C.int(bcConfig[bcType].PublicKeyLength))
+// DeriveAddress
+// empty addrType derives default address type of bcType
+func DeriveAddress(bcType BlockChainType, addrType AddressType, publicKey string, bcNetwork string) (string, error) {
+	addrType, e := ResolveAddressType(bcType, addrType)
+	if e != nil {
+		return "", e
+	}
 
-		return string(publicKey), nil
-	} else {
-		return "", errors.New("public key generation failed")
+	network, e := ParseNetwork(bcNetwork)
+	if e != nil {
+		return "", e
 	}
+
+	return bcConfig[bcType].Address(publicKey, network, addrType)
 }
 
-//unsigned char *TrustSigner_getWBSignatureData(char *app_id, unsigned char *wb_data, char *coin_symbol, int hd_depth, int hd_change, int hd_index, unsigned char *hash_message, int hash_len);
-func GetWBSignatureData(wb *WhiteBox, bcType BlockChainType, message []byte) ([]byte, error) {
-	syncLock.Lock()
-	defer syncLock.Unlock()
+func GetWBInitializeData(appId string) ([]byte, error) {
+	if signer == nil {
+		return nil, ErrNoSigner
+	}
 
-	cPtrCharSymbol := C.CString(string(bcType))
-	defer C.free(unsafe.Pointer(cPtrCharSymbol))
+	var wbData []byte
+	e := signerPool.do(nil, func() (e error) {
+		wbData, e = signer.InitializeData(appId)
+		return
+	})
+	return wbData, e
+}
 
-	var buf bytes.Buffer
-	buf.Write(message)
+func GetWBPublicKey(wb *WhiteBox, bcType BlockChainType, derivation Derivation) (string, error) {
+	if signer == nil {
+		return "", ErrNoSigner
+	}
 
-	numMessage := len(message) / 32
+	var publicKey string
+	e := signerPool.do(wb, func() (e error) {
+		publicKey, e = signer.PublicKey(wb, bcType, derivation)
+		return
+	})
+	return publicKey, e
+}
 
-	cCharPtrResult := C.TrustSigner_getWBSignatureData(wb.AppID, wb.Pointer, cPtrCharSymbol, C.int(bcConfig[bcType].HDDepth), C.int(0), C.int(0), (*C.uchar)(unsafe.Pointer(&buf.Bytes()[0])), C.int(C.size_t(len(message))))
-	defer C.free(unsafe.Pointer(cCharPtrResult))
+// GetWBAccountPublicKey
+// extended public key of BIP44 account (m/44'/coin'/0') for secp256k1 chains, watch-only wallets derive change/index from it
+// ed25519 has no public derivation, primary public key (index 0) is returned
+func GetWBAccountPublicKey(wb *WhiteBox, bcType BlockChainType) (string, error) {
+	if signer == nil {
+		return "", ErrNoSigner
+	}
+
+	var publicKey string
+	e := signerPool.do(wb, func() (e error) {
+		publicKey, e = signer.AccountPublicKey(wb, bcType)
+		return
+	})
+	return publicKey, e
+}
 
-	if cCharPtrResult != nil {
-		return C.GoBytes(unsafe.Pointer(cCharPtrResult), C.int(bcConfig[bcType].SignatureLength*numMessage)), nil
-	} else {
-		return nil, errors.New("signing error")
+func GetWBSignatureData(wb *WhiteBox, bcType BlockChainType, derivation Derivation, message []byte) ([]byte, error) {
+	if signer == nil {
+		return nil, ErrNoSigner
 	}
+
+	var signature []byte
+	e := signerPool.do(wb, func() (e error) {
+		signature, e = signer.SignatureData(wb, bcType, derivation, message)
+		return
+	})
+	return signature, e
 }
 
 // BACKUP MODE IS NOT USING THIS FUNCTION
-//char *TrustSigner_getWBRecoveryData(char *app_id, unsigned char *wb_data, char *user_key, char *server_key);
 func GetWBRecoveryData(wb *WhiteBox, recoveryKey []byte) ([]byte, error) {
-	syncLock.Lock()
-	defer syncLock.Unlock()
+	if signer == nil {
+		return nil, ErrNoSigner
+	}
 
 	if len(recoveryKey) != recoveryKeyLength {
 		return nil, errors.New("recovery key length must be 128")
 	}
 
-	cCharPtrResult := C.TrustSigner_getWBRecoveryData(wb.AppID, wb.Pointer, (*C.char)(unsafe.Pointer(&recoveryKey[0])), (*C.char)(unsafe.Pointer(&recoveryKey[0])))
-	defer C.free(unsafe.Pointer(cCharPtrResult))
-
-	if cCharPtrResult != nil {
-		rBytes := C.GoBytes(unsafe.Pointer(cCharPtrResult), C.int(recoveryDataLength))
-		nt := clen(rBytes)
-		if nt == 0 {
-			return nil, errors.New("recovery data generation returned null")
-		} else {
-			return rBytes[:nt], nil
-		}
-	} else {
-		return nil, errors.New("recovery data generation failed")
-	}
-}
-
-func clen(n []byte) int {
-	for i := 0; i < len(n); i++ {
-		if n[i] == 0 {
-			return i
-		}
-	}
-	return len(n)
+	var recoveryData []byte
+	e := signerPool.do(wb, func() (e error) {
+		recoveryData, e = signer.RecoveryData(wb, recoveryKey)
+		return
+	})
+	return recoveryData, e
 }
 
 // RESTORING MODE IS NOT USING THIS FUNCTION
-//unsigned char *TrustSigner_setWBRecoveryData(char *app_id, char *user_key, char *recovery_data);
 func SetWBRecoveryData(appId string, recoveryKey []byte, recoveryData []byte) ([]byte, error) {
-	syncLock.Lock()
-	defer syncLock.Unlock()
+	if signer == nil {
+		return nil, ErrNoSigner
+	}
 
 	if len(recoveryKey) != recoveryKeyLength {
 		return nil, errors.New("recovery key length must be 128")
 	}
 
-	cPtrCharAppID := C.CString(appId)
-	defer C.free(unsafe.Pointer(cPtrCharAppID))
-
-	cUcharPtrResult := C.TrustSigner_setWBRecoveryData(cPtrCharAppID, (*C.char)(unsafe.Pointer(&recoveryKey[0])), (*C.char)(unsafe.Pointer(&recoveryData[0])))
-	defer C.free(unsafe.Pointer(cUcharPtrResult))
-
-	return ptrToWhiteboxData(cUcharPtrResult)
+	var wbData []byte
+	e := signerPool.do(nil, func() (e error) {
+		wbData, e = signer.Recover(appId, recoveryKey, recoveryData)
+		return
+	})
+	return wbData, e
 }
@@ -1,6 +1,7 @@
 /*
-should run with -ldflags
-go test -ldflags=-r=.
+runs against software signer by default
+to test libtrustsigner, should run with -tags and -ldflags
+go test -tags libtrustsigner -ldflags=-r=.
 */
 package trustSigner_test
 
@@ -12,6 +13,16 @@ import (
 	"testing"
 )
 
+// newWhiteBox
+// whitebox of data, test fails if not converted
+func newWhiteBox(t testing.TB, appID string, data []byte) *trustSigner.WhiteBox {
+	wb, err := trustSigner.ConvertToWhiteBox(appID, data)
+	if err != nil {
+		t.Fatal("ER : ConvertToWhiteBox :", err)
+	}
+	return wb
+}
+
 func TestTrustSigner(t *testing.T) {
 
 	data, err := trustSigner.GetWBInitializeData("test")
@@ -21,12 +32,12 @@ func TestTrustSigner(t *testing.T) {
 		t.Log("OK : WB Initialized : Length =", len(data))
 	}
 
-	wbData := trustSigner.ConvertToWhiteBox("test", data)
+	wbData := newWhiteBox(t, "test", data)
 
 	publicKeys := make(map[trustSigner.BlockChainType]string)
 
 	for k, v := range trustSigner.BCTypes {
-		publicKey, err := trustSigner.GetWBPublicKey(wbData, v)
+		publicKey, err := trustSigner.GetWBPublicKey(wbData, v, trustSigner.Derivation{})
 		if err != nil {
 			t.Fatal("ER : Public key :", err)
 		}
@@ -35,7 +46,7 @@ func TestTrustSigner(t *testing.T) {
 
 		publicKeys[v] = publicKey
 
-		address, err := trustSigner.DeriveAddress(v, publicKey, "testnet")
+		address, err := trustSigner.DeriveAddress(v, "", publicKey, "testnet")
 		if err != nil {
 			t.Fatal("ER : DeriveAddress :", err)
 		}
@@ -45,7 +56,7 @@ func TestTrustSigner(t *testing.T) {
 
 		_, _ = io.ReadFull(rand.Reader, message)
 
-		signatureData, err := trustSigner.GetWBSignatureData(wbData, v, message)
+		signatureData, err := trustSigner.GetWBSignatureData(wbData, v, trustSigner.Derivation{}, message)
 		if err != nil {
 			t.Error("ER : Sign Failed :", err)
 		} else {
@@ -67,10 +78,10 @@ func TestTrustSigner(t *testing.T) {
 	} else {
 		t.Log("OK : Whitebox Recovered")
 
-		wbData := trustSigner.ConvertToWhiteBox("test", recoveredData)
+		wbData := newWhiteBox(t, "test", recoveredData)
 
 		for k, v := range trustSigner.BCTypes {
-			publicKey, err := trustSigner.GetWBPublicKey(wbData, v)
+			publicKey, err := trustSigner.GetWBPublicKey(wbData, v, trustSigner.Derivation{})
 			if err != nil {
 				t.Fatal("ER : Public key :", err)
 			}
@@ -84,3 +95,33 @@ func TestTrustSigner(t *testing.T) {
 
 	}
 }
+
+func TestWhiteBoxClose(t *testing.T) {
+	data, err := trustSigner.GetWBInitializeData("test")
+	if err != nil {
+		t.Fatal("ER : WB Initialize :", err)
+	}
+
+	wb := newWhiteBox(t, "test", data)
+	trustSigner.ZeroBytes(data)
+
+	if _, err := trustSigner.GetWBPublicKey(wb, trustSigner.BTC, trustSigner.Derivation{}); err != nil {
+		t.Fatal("ER : Public key after source zeroized :", err)
+	}
+
+	wb.Close()
+	wb.Close()
+
+	if _, err := trustSigner.GetWBPublicKey(wb, trustSigner.BTC, trustSigner.Derivation{}); err != trustSigner.ErrWhiteBoxClosed {
+		t.Error("ER : closed whitebox used :", err)
+	}
+	if _, err := trustSigner.GetWBSignatureData(wb, trustSigner.BTC, trustSigner.Derivation{}, make([]byte, 32)); err != trustSigner.ErrWhiteBoxClosed {
+		t.Error("ER : closed whitebox signed :", err)
+	}
+}
+
+func TestWhiteBoxEmpty(t *testing.T) {
+	if wb, err := trustSigner.ConvertToWhiteBox("test", nil); err == nil || wb != nil {
+		t.Error("ER : whitebox of empty data", wb, err)
+	}
+}
@@ -0,0 +1,134 @@
+package trustSigner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/colligence-io/signServer/hd"
+	"github.com/ethereum/go-ethereum/crypto"
+	stellarkp "github.com/stellar/go/keypair"
+	"math/big"
+)
+
+/*
+SIGNATURE SELF-VERIFICATION
+
+signature data returned by whitebox is checked against public key of keypair before it leaves signServer
+secp256k1 : [R || S || V] per 32 bytes message, S is normalized to low-S (BIP62 / EIP-2) with V flipped, then signer is recovered from V
+ed25519 : [R || S] per 32 bytes message
+*/
+
+var ErrSignatureMismatch = errors.New("signature is not signed by public key of keypair")
+
+var (
+	secp256k1N     = crypto.S256().Params().N
+	secp256k1HalfN = new(big.Int).Rsh(secp256k1N, 1)
+)
+
+// VerifySignatureData
+// verify signature data of message by publicKey (GetWBPublicKey form), low-S normalized copy of signature is returned
+func VerifySignatureData(bcType BlockChainType, publicKey string, message []byte, signature []byte) ([]byte, error) {
+	cfg, found := bcConfig[bcType]
+	if !found {
+		return nil, fmt.Errorf("BlockChainType %s is invalid", bcType)
+	}
+
+	if len(message) == 0 || len(message)%32 != 0 {
+		return nil, errors.New("message length must be 32*N")
+	}
+
+	if len(signature) != cfg.SignatureLength*len(message)/32 {
+		return nil, fmt.Errorf("signature length %d is not for %d messages", len(signature), len(message)/32)
+	}
+
+	if bcType == XLM {
+		return verifyEd25519(publicKey, message, signature)
+	}
+	return verifySecp256k1(publicKey, message, signature)
+}
+
+func verifyEd25519(publicKey string, message []byte, signature []byte) ([]byte, error) {
+	kp, e := stellarkp.Parse(publicKey)
+	if e != nil {
+		return nil, fmt.Errorf("invalid public key : %s", e.Error())
+	}
+
+	for i := 0; i < len(message)/32; i++ {
+		if kp.Verify(message[i*32:(i+1)*32], signature[i*64:(i+1)*64]) != nil {
+			return nil, ErrSignatureMismatch
+		}
+	}
+
+	return append([]byte{}, signature...), nil
+}
+
+func verifySecp256k1(publicKey string, message []byte, signature []byte) ([]byte, error) {
+	wallet, e := hd.FromBIP32ExtendedKey(publicKey)
+	if e != nil {
+		return nil, fmt.Errorf("invalid public key : %s", e.Error())
+	}
+
+	normalized := append([]byte{}, signature...)
+
+	for i := 0; i < len(message)/32; i++ {
+		hash := message[i*32 : (i+1)*32]
+		sig := normalized[i*65 : (i+1)*65]
+
+		if !NormalizeLowS(sig) {
+			return nil, ErrSignatureMismatch
+		}
+
+		// V may be 0/1 or 27/28
+		recoverable := append([]byte{}, sig...)
+		if recoverable[64] >= 27 {
+			recoverable[64] -= 27
+		}
+
+		signer, e := crypto.SigToPub(hash, recoverable)
+		if e != nil || !bytes.Equal(crypto.CompressPubkey(signer), wallet.Key) {
+			return nil, ErrSignatureMismatch
+		}
+
+		if !crypto.VerifySignature(wallet.Key, hash, sig[:64]) {
+			return nil, ErrSignatureMismatch
+		}
+	}
+
+	return normalized, nil
+}
+
+// NormalizeLowS
+// replace S of [R || S || V] signature with N - S if S > N/2 and flip V (0/1 or 27/28), false if R, S or V is invalid
+func NormalizeLowS(signature []byte) bool {
+	if len(signature) != 65 {
+		return false
+	}
+
+	base, v := byte(0), signature[64]
+	if v >= 27 {
+		base, v = 27, v-27
+	}
+	if v > 1 {
+		return false
+	}
+
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:64])
+	if r.Sign() == 0 || r.Cmp(secp256k1N) >= 0 || s.Sign() == 0 || s.Cmp(secp256k1N) >= 0 {
+		return false
+	}
+
+	if s.Cmp(secp256k1HalfN) <= 0 {
+		return true
+	}
+
+	s.Sub(secp256k1N, s)
+	sBytes := s.Bytes()
+	for i := 32; i < 64; i++ {
+		signature[i] = 0
+	}
+	copy(signature[64-len(sBytes):64], sBytes)
+	signature[64] = base + (v ^ 1)
+
+	return true
+}
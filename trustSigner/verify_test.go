@@ -0,0 +1,105 @@
+//go:build !libtrustsigner
+// +build !libtrustsigner
+
+package trustSigner_test
+
+import (
+	"bytes"
+	"github.com/colligence-io/signServer/trustSigner"
+	"github.com/ethereum/go-ethereum/crypto"
+	"math/big"
+	"testing"
+)
+
+func signForVerify(t *testing.T, bcType trustSigner.BlockChainType, derivation trustSigner.Derivation, message []byte) (string, []byte) {
+	data, err := trustSigner.GetWBInitializeData("verify")
+	if err != nil {
+		t.Fatal("ER : WB Initialize :", err)
+	}
+	wb := newWhiteBox(t, "verify", data)
+
+	publicKey, err := trustSigner.GetWBPublicKey(wb, bcType, derivation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature, err := trustSigner.GetWBSignatureData(wb, bcType, derivation, message)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return publicKey, signature
+}
+
+func TestVerifySignatureData(t *testing.T) {
+	message := append(crypto.Keccak256([]byte("first")), crypto.Keccak256([]byte("second"))...)
+
+	for _, bcType := range []trustSigner.BlockChainType{trustSigner.BTC, trustSigner.ETH, trustSigner.XLM} {
+		publicKey, signature := signForVerify(t, bcType, trustSigner.Derivation{Index: 1}, message)
+
+		verified, err := trustSigner.VerifySignatureData(bcType, publicKey, message, signature)
+		if err != nil {
+			t.Error("ER : Verify", bcType, ":", err)
+		}
+		if !bytes.Equal(verified, signature) {
+			t.Error("ER : verified signature of", bcType, "differs")
+		}
+
+		corrupted := append([]byte{}, signature...)
+		corrupted[len(corrupted)-10] ^= 0xff
+		if _, err := trustSigner.VerifySignatureData(bcType, publicKey, message, corrupted); err != trustSigner.ErrSignatureMismatch {
+			t.Error("ER : corrupted signature of", bcType, "verified", err)
+		}
+
+		// signature of other derivation
+		otherKey, _ := signForVerify(t, bcType, trustSigner.Derivation{Index: 2}, message)
+		if _, err := trustSigner.VerifySignatureData(bcType, otherKey, message, signature); err != trustSigner.ErrSignatureMismatch {
+			t.Error("ER : signature of", bcType, "verified with other key", err)
+		}
+
+		if _, err := trustSigner.VerifySignatureData(bcType, publicKey, message, signature[:len(signature)-1]); err == nil {
+			t.Error("ER : truncated signature of", bcType, "verified")
+		}
+	}
+}
+
+func TestVerifyLowS(t *testing.T) {
+	message := crypto.Keccak256([]byte("low s"))
+	publicKey, signature := signForVerify(t, trustSigner.ETH, trustSigner.Derivation{}, message)
+
+	// same signature with high S, V flipped
+	n := crypto.S256().Params().N
+	highS := new(big.Int).Sub(n, new(big.Int).SetBytes(signature[32:64])).Bytes()
+	high := append([]byte{}, signature...)
+	for i := 32; i < 64; i++ {
+		high[i] = 0
+	}
+	copy(high[64-len(highS):64], highS)
+	high[64] ^= 1
+
+	normalized, err := trustSigner.VerifySignatureData(trustSigner.ETH, publicKey, message, high)
+	if err != nil {
+		t.Fatal("ER : high S signature :", err)
+	}
+	if !bytes.Equal(normalized, signature) {
+		t.Error("ER : high S signature is not normalized")
+	}
+
+	// V in 27/28 form is kept
+	wallet := append([]byte{}, high...)
+	wallet[64] += 27
+	normalized, err = trustSigner.VerifySignatureData(trustSigner.ETH, publicKey, message, wallet)
+	if err != nil {
+		t.Fatal("ER : 27/28 signature :", err)
+	}
+	if normalized[64] != signature[64]+27 || !bytes.Equal(normalized[:64], signature[:64]) {
+		t.Error("ER : 27/28 signature is not normalized")
+	}
+
+	// wrong V recovers other key
+	flipped := append([]byte{}, signature...)
+	flipped[64] ^= 1
+	if _, err := trustSigner.VerifySignatureData(trustSigner.ETH, publicKey, message, flipped); err != trustSigner.ErrSignatureMismatch {
+		t.Error("ER : signature with wrong V verified", err)
+	}
+}
@@ -0,0 +1,68 @@
+package trustSigner
+
+import (
+	"errors"
+	"sync"
+	"unsafe"
+)
+
+var ErrWhiteBoxClosed = errors.New("whitebox is closed")
+
+// WhiteBox
+// owns whitebox data (and C allocated app ID in libtrustsigner build) until Close
+type WhiteBox struct {
+	AppID string
+	data  []byte
+
+	// C allocated app ID, nil if not allocated by C
+	cAppID unsafe.Pointer
+
+	// zeroize and release memory
+	free func(wb *WhiteBox)
+
+	closed bool
+
+	// calls on same whitebox are serialized
+	lock sync.Mutex
+}
+
+// allocWhiteBox is replaced by libtrustsigner build to allocate whitebox in C memory
+var allocWhiteBox = func(appID string, wbBytes []byte) (*WhiteBox, error) {
+	data := make([]byte, len(wbBytes))
+	copy(data, wbBytes)
+	return &WhiteBox{AppID: appID, data: data, free: func(wb *WhiteBox) {
+		zero(wb.data)
+	}}, nil
+}
+
+// ConvertToWhiteBox
+// copy wbBytes into memory owned by WhiteBox, caller may zeroize wbBytes after this
+func ConvertToWhiteBox(appID string, wbBytes []byte) (*WhiteBox, error) {
+	if len(wbBytes) == 0 {
+		return nil, errors.New("whitebox data of " + appID + " is empty")
+	}
+	return allocWhiteBox(appID, wbBytes)
+}
+
+// Close
+// zeroize and free whitebox memory, waits for in-flight call on this whitebox
+func (wb *WhiteBox) Close() {
+	wb.lock.Lock()
+	defer wb.lock.Unlock()
+
+	if wb.closed {
+		return
+	}
+
+	wb.free(wb)
+
+	wb.data = nil
+	wb.cAppID = nil
+	wb.closed = true
+}
+
+// ZeroBytes
+// zeroize byte slice holding key material
+func ZeroBytes(b []byte) {
+	zero(b)
+}
@@ -0,0 +1,116 @@
+package vault
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+/*
+LOCK RECORD
+
+vault KV (v1) has no check-and-set, so processes sharing a path take lock record
+  {path} : token and expires (unix) of holder
+holder writes its token, waits lockSettle and reads it back, lock is taken if token is still its own
+this is exclusive while read-to-write gap of every contender is shorter than lockSettle (Fischer's algorithm)
+expired record is taken over, so that crashed holder never blocks others forever
+*/
+
+// time between writing lock record and reading it back
+var lockSettle = 100 * time.Millisecond
+
+// interval of retry while lock is held by other process
+var lockPoll = 50 * time.Millisecond
+
+type Lock struct {
+	vc    *Client
+	path  string
+	token string
+}
+
+// Lock
+// take lock record of path for ttl, waits up to wait while it is held by other process
+func (vc *Client) Lock(path string, ttl time.Duration, wait time.Duration) (*Lock, error) {
+	tBytes := make([]byte, 16)
+	if _, e := rand.Read(tBytes); e != nil {
+		return nil, e
+	}
+	lock := &Lock{vc: vc, path: path, token: hex.EncodeToString(tBytes)}
+
+	deadline := time.Now().Add(wait)
+
+	for {
+		holder, e := lock.holder()
+		if e != nil {
+			return nil, e
+		}
+
+		if holder == "" {
+			_, e := vc.Logical().Write(path, map[string]interface{}{
+				"token":   lock.token,
+				"expires": strconv.FormatInt(time.Now().Add(ttl).Unix(), 10),
+			})
+			if e != nil {
+				return nil, e
+			}
+
+			time.Sleep(lockSettle)
+
+			if holder, e = lock.holder(); e != nil {
+				return nil, e
+			}
+			if holder == lock.token {
+				return lock, nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s is locked by other process", path)
+		}
+		time.Sleep(lockPoll)
+	}
+}
+
+// holder
+// token of unexpired lock record, empty if not locked
+func (lock *Lock) holder() (string, error) {
+	secret, e := lock.vc.Logical().Read(lock.path)
+	if e != nil {
+		return "", e
+	}
+	if secret == nil || secret.Data == nil {
+		return "", nil
+	}
+
+	token, _ := secret.Data["token"].(string)
+	expiresString, _ := secret.Data["expires"].(string)
+	expires, e := strconv.ParseInt(expiresString, 10, 64)
+	if token == "" || e != nil {
+		return "", errors.New("broken lock record " + lock.path)
+	}
+
+	if time.Now().Unix() >= expires {
+		return "", nil
+	}
+	return token, nil
+}
+
+// Unlock
+// remove lock record if it is still held
+func (lock *Lock) Unlock() {
+	holder, e := lock.holder()
+	if e != nil {
+		logger.Error("cannot read lock ", lock.path, " : ", e)
+		return
+	}
+	if holder != lock.token {
+		logger.Warn("lock ", lock.path, " was taken over before unlock")
+		return
+	}
+	if _, e := lock.vc.Logical().Delete(lock.path); e != nil {
+		logger.Error("cannot unlock ", lock.path, " : ", e)
+	}
+}
@@ -0,0 +1,82 @@
+package vault_test
+
+import (
+	"github.com/colligence-io/signServer/config"
+	"github.com/colligence-io/signServer/vault"
+	"github.com/colligence-io/signServer/vault/vaulttest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newClient(fv *vaulttest.Server) *vault.Client {
+	vc := vault.NewClient(&config.Configuration{
+		Vault: config.VaultConfig{Username: "user", Password: "pass", AppRole: "role", Address: fv.URL},
+	})
+	vc.Connect()
+	return vc
+}
+
+func TestLockExclusive(t *testing.T) {
+	fv := vaulttest.NewServer()
+	defer fv.Close()
+
+	// each client is other process
+	var mutex sync.Mutex
+	holders, maxHolders := 0, 0
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		vc := newClient(fv)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lock, err := vc.Lock("tss/lock", time.Minute, 10*time.Second)
+			if err != nil {
+				t.Error("ER : Lock", err)
+				return
+			}
+			mutex.Lock()
+			holders++
+			if holders > maxHolders {
+				maxHolders = holders
+			}
+			mutex.Unlock()
+
+			time.Sleep(20 * time.Millisecond)
+
+			mutex.Lock()
+			holders--
+			mutex.Unlock()
+			lock.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if maxHolders != 1 {
+		t.Error("ER : lock held by", maxHolders)
+	}
+	if fv.Get("tss/lock") != nil {
+		t.Error("ER : lock record is not removed")
+	}
+}
+
+func TestLockExpired(t *testing.T) {
+	fv := vaulttest.NewServer()
+	defer fv.Close()
+	vc := newClient(fv)
+
+	// held by other process
+	fv.Put("tss/lock", map[string]interface{}{"token": "other", "expires": strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10)})
+	if _, err := vc.Lock("tss/lock", time.Minute, 200*time.Millisecond); err == nil {
+		t.Error("ER : lock held by other process is taken")
+	}
+
+	// crashed holder
+	fv.Put("tss/lock", map[string]interface{}{"token": "other", "expires": strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10)})
+	lock, err := vc.Lock("tss/lock", time.Minute, 200*time.Millisecond)
+	if err != nil {
+		t.Fatal("ER : expired lock is not taken over", err)
+	}
+	lock.Unlock()
+}
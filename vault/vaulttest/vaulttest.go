@@ -0,0 +1,134 @@
+package vaulttest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+in memory vault for tests
+serves login endpoints used by vault.Client.Connect and KV (v1) read, list, write and delete
+*/
+
+type Server struct {
+	*httptest.Server
+
+	mutex sync.Mutex
+	data  map[string]map[string]interface{}
+}
+
+func NewServer() *Server {
+	s := &Server{data: make(map[string]map[string]interface{})}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Get
+// data of path, nil if not written
+func (s *Server) Get(path string) map[string]interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.data[path]
+}
+
+// Find
+// data of first path under prefix
+func (s *Server) Find(prefix string) map[string]interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for path, data := range s.data {
+		if strings.HasPrefix(path, prefix+"/") {
+			return data
+		}
+	}
+	return nil
+}
+
+// Put
+// write data of path as if it is written by operator
+func (s *Server) Put(path string, data map[string]interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.data[path] = data
+}
+
+// Delete
+// remove path as if it is deleted by operator
+func (s *Server) Delete(path string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.data, path)
+}
+
+func (s *Server) serve(rw http.ResponseWriter, req *http.Request) {
+	path := strings.TrimPrefix(req.URL.Path, "/v1/")
+	auth := map[string]interface{}{"client_token": "token", "lease_duration": 3600}
+
+	switch {
+	case strings.HasPrefix(path, "auth/userpass/login/"), path == "auth/approle/login":
+		writeJSON(rw, map[string]interface{}{"auth": auth})
+	case strings.HasSuffix(path, "/role-id"):
+		writeJSON(rw, map[string]interface{}{"data": map[string]interface{}{"role_id": "role"}})
+	case strings.HasSuffix(path, "/secret-id"):
+		writeJSON(rw, map[string]interface{}{"data": map[string]interface{}{"secret_id": "secret"}})
+	case req.Method == "LIST" || req.URL.Query().Get("list") == "true":
+		s.list(rw, path)
+	case req.Method == http.MethodGet:
+		if data := s.Get(path); data != nil {
+			writeJSON(rw, map[string]interface{}{"data": data})
+		} else {
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	case req.Method == http.MethodPut || req.Method == http.MethodPost:
+		var data map[string]interface{}
+		if err := json.NewDecoder(req.Body).Decode(&data); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.Put(path, data)
+		rw.WriteHeader(http.StatusNoContent)
+	case req.Method == http.MethodDelete:
+		s.Delete(path)
+		rw.WriteHeader(http.StatusNoContent)
+	default:
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// list
+// direct children of path, sub paths end with "/"
+func (s *Server) list(rw http.ResponseWriter, path string) {
+	s.mutex.Lock()
+	found := make(map[string]bool)
+	for key := range s.data {
+		if rest := strings.TrimPrefix(key, path+"/"); rest != key {
+			if i := strings.Index(rest, "/"); i >= 0 {
+				rest = rest[:i+1]
+			}
+			found[rest] = true
+		}
+	}
+	s.mutex.Unlock()
+
+	if len(found) == 0 {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	keys := make([]string, 0, len(found))
+	for key := range found {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	writeJSON(rw, map[string]interface{}{"data": map[string]interface{}{"keys": keys}})
+}
+
+func writeJSON(rw http.ResponseWriter, body interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(rw).Encode(body)
+}
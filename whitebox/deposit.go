@@ -0,0 +1,282 @@
+package whitebox
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/colligence-io/signServer/trustSigner"
+	"github.com/colligence-io/signServer/util"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+DEPOSIT ADDRESS
+
+stored next to whitebox record
+  {whiteboxPath}/{keyID}/deposit/counter          : next index to allocate
+  {whiteboxPath}/{keyID}/deposit/index/{index}    : index - address, label
+  {whiteboxPath}/{keyID}/deposit/label/{labelID}  : label - index, labelID = sha256(label)
+  {whiteboxPath}/{keyID}/deposit/lock             : lock record of allocating process
+index 0 is primary address of keypair, deposit address starts from 1
+allocation is serialized by lock record, so that server (POST /deposit) and CLI (deposit mode) allocate from same counter
+*/
+
+// lock record of allocation expires after depositLockTTL, allocation waits up to depositLockWait for other process
+const (
+	depositLockTTL  = 30 * time.Second
+	depositLockWait = 10 * time.Second
+)
+
+type DepositAddress struct {
+	KeyID   string `json:"keyID"`
+	Symbol  string `json:"symbol"`
+	Index   uint32 `json:"index"`
+	Address string `json:"address"`
+	Label   string `json:"label"`
+}
+
+func (ks *KeyStore) depositPath(keyID string) string {
+	return ks.config.Vault.WhiteBoxPath + "/" + keyID + "/deposit"
+}
+
+func (ks *KeyStore) depositIndexPath(keyID string, index uint32) string {
+	return ks.depositPath(keyID) + "/index/" + strconv.FormatUint(uint64(index), 10)
+}
+
+func (ks *KeyStore) depositLabelPath(keyID string, label string) string {
+	return ks.depositPath(keyID) + "/label/" + hex.EncodeToString(util.Crypto.Sha256Hash(label))
+}
+
+// loadDepositAddresses
+// verify and track deposit addresses of keypair, lock must be held by caller
+func (ks *KeyStore) loadDepositAddresses(keyID string, kp keyPair) {
+	indexList, e := ks.vc.Logical().List(ks.depositPath(keyID) + "/index")
+	util.CheckAndDie(e)
+
+	if indexList == nil {
+		return
+	}
+
+	for _, ik := range indexList.Data["keys"].([]interface{}) {
+		index, e := strconv.ParseUint(ik.(string), 10, 32)
+		util.CheckAndDie(e)
+
+		deposit, e := ks.readDepositAddress(keyID, uint32(index))
+		util.CheckAndDie(e)
+
+		derivation := trustSigner.Derivation{Index: deposit.Index}
+
+		derivedAddress, publicKey, e := ks.deriveAddress(kp, derivation)
+		util.CheckAndDie(e)
+
+		if derivedAddress != deposit.Address {
+			util.CheckAndDie(fmt.Errorf("cannot load deposit address %s/%d : address verification failed %s != %s", keyID, index, deposit.Address, derivedAddress))
+		}
+
+		ks.trackAddress(keyID, kp, derivedAddress, publicKey, derivation)
+	}
+}
+
+func (ks *KeyStore) readDepositAddress(keyID string, index uint32) (*DepositAddress, error) {
+	secret, e := ks.vc.Logical().Read(ks.depositIndexPath(keyID, index))
+	if e != nil {
+		return nil, e
+	}
+
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+
+	address, ok := secret.Data["address"].(string)
+	if !ok {
+		return nil, fmt.Errorf("broken deposit data %s/%d, address is not string", keyID, index)
+	}
+	label, ok := secret.Data["label"].(string)
+	if !ok {
+		return nil, fmt.Errorf("broken deposit data %s/%d, label is not string", keyID, index)
+	}
+	symbol, ok := secret.Data["symbol"].(string)
+	if !ok {
+		return nil, fmt.Errorf("broken deposit data %s/%d, symbol is not string", keyID, index)
+	}
+
+	return &DepositAddress{
+		KeyID:   keyID,
+		Symbol:  symbol,
+		Index:   index,
+		Address: address,
+		Label:   label,
+	}, nil
+}
+
+func (ks *KeyStore) readDepositNumber(path string, field string) (uint32, bool, error) {
+	secret, e := ks.vc.Logical().Read(path)
+	if e != nil {
+		return 0, false, e
+	}
+
+	if secret == nil || secret.Data == nil {
+		return 0, false, nil
+	}
+
+	value, ok := secret.Data[field].(string)
+	if !ok {
+		return 0, false, fmt.Errorf("broken deposit data %s, %s is not string", path, field)
+	}
+
+	number, e := strconv.ParseUint(value, 10, 32)
+	if e != nil {
+		return 0, false, e
+	}
+
+	return uint32(number), true, nil
+}
+
+// AllocateDepositAddress
+// allocate next unused HD index of keypair for label
+// same label always gets same address, index is never reused
+func (ks *KeyStore) AllocateDepositAddress(keyID string, label string) (*DepositAddress, error) {
+	if strings.TrimSpace(label) == "" {
+		return nil, errors.New("deposit label is empty")
+	}
+
+	ks.depositLock.Lock()
+	defer ks.depositLock.Unlock()
+
+	ks.lock.RLock()
+	kp, found := ks.storage[keyID]
+	ks.lock.RUnlock()
+
+	if !found {
+		return nil, fmt.Errorf("keypair %s not found", keyID)
+	}
+
+	// other process (server or CLI) might allocate from same counter
+	lock, e := ks.vc.Lock(ks.depositPath(keyID)+"/lock", depositLockTTL, depositLockWait)
+	if e != nil {
+		return nil, e
+	}
+	defer lock.Unlock()
+
+	// idempotent per label
+	labelIndex, found, e := ks.readDepositNumber(ks.depositLabelPath(keyID, label), "index")
+	if e != nil {
+		return nil, e
+	}
+
+	if found {
+		deposit, e := ks.readDepositAddress(keyID, labelIndex)
+		if e != nil {
+			return nil, e
+		}
+		if deposit == nil || deposit.Label != label {
+			return nil, fmt.Errorf("broken deposit data %s/%d for label %s", keyID, labelIndex, label)
+		}
+
+		// address allocated after load is not tracked yet, verify and track it for signing
+		address, e := ks.derive(keyID, trustSigner.Derivation{Index: deposit.Index}, false)
+		if e != nil {
+			return nil, e
+		}
+		if address != deposit.Address {
+			return nil, fmt.Errorf("broken deposit data %s/%d : address verification failed %s != %s", keyID, labelIndex, deposit.Address, address)
+		}
+
+		return deposit, nil
+	}
+
+	next, found, e := ks.readDepositNumber(ks.depositPath(keyID)+"/counter", "next")
+	if e != nil {
+		return nil, e
+	}
+
+	if !found {
+		next = 1
+	}
+
+	// skip index already taken (counter might not be updated)
+	for {
+		if next >= math.MaxInt32 {
+			return nil, fmt.Errorf("keypair %s has no more deposit index", keyID)
+		}
+
+		taken, e := ks.readDepositAddress(keyID, next)
+		if e != nil {
+			return nil, e
+		}
+		if taken == nil {
+			break
+		}
+		next++
+	}
+
+	address, e := ks.derive(keyID, trustSigner.Derivation{Index: next}, false)
+	if e != nil {
+		return nil, e
+	}
+
+	// lock record might be taken over if derivation outlived it
+	if taken, e := ks.readDepositAddress(keyID, next); e != nil {
+		return nil, e
+	} else if taken != nil {
+		return nil, fmt.Errorf("deposit index %s/%d is taken while allocating", keyID, next)
+	}
+
+	deposit := &DepositAddress{
+		KeyID:   keyID,
+		Symbol:  string(kp.bcType),
+		Index:   next,
+		Address: address,
+		Label:   label,
+	}
+
+	indexString := strconv.FormatUint(uint64(next), 10)
+
+	// claim index first, so that index is never reused even if following writes fail
+	_, e = ks.vc.Logical().Write(ks.depositIndexPath(keyID, next), map[string]interface{}{
+		"symbol":  deposit.Symbol,
+		"address": deposit.Address,
+		"label":   deposit.Label,
+	})
+	if e != nil {
+		return nil, e
+	}
+
+	_, e = ks.vc.Logical().Write(ks.depositLabelPath(keyID, label), map[string]interface{}{
+		"index": indexString,
+	})
+	if e != nil {
+		return nil, e
+	}
+
+	_, e = ks.vc.Logical().Write(ks.depositPath(keyID)+"/counter", map[string]interface{}{
+		"next": strconv.FormatUint(uint64(next+1), 10),
+	})
+	if e != nil {
+		return nil, e
+	}
+
+	logger.Info("deposit address ", deposit.Address, " allocated for ", label, " : ", keyID, " ", next)
+
+	return deposit, nil
+}
+
+// IssueDepositAddress
+// allocate deposit address of keypair for label and print it (CLI)
+func (ks *KeyStore) IssueDepositAddress(appID string, label string) {
+	keyID := ks.appIDtoKeyID(appID)
+
+	deposit, e := ks.AllocateDepositAddress(keyID, label)
+	util.CheckAndDie(e)
+
+	fmt.Println("Deposit Address Issued")
+	fmt.Println("AppID :", appID)
+	fmt.Println("KeyID :", keyID)
+	fmt.Println("BlockChainType :", deposit.Symbol)
+	fmt.Println("Index :", deposit.Index)
+	fmt.Println("Address :", deposit.Address)
+	fmt.Println("Label :", deposit.Label)
+}
@@ -0,0 +1,217 @@
+package whitebox_test
+
+import (
+	"github.com/colligence-io/signServer/config"
+	"github.com/colligence-io/signServer/trustSigner"
+	"github.com/colligence-io/signServer/vault"
+	"github.com/colligence-io/signServer/vault/vaulttest"
+	"github.com/colligence-io/signServer/whitebox"
+	"sync"
+	"testing"
+)
+
+// newKeyStore
+// keystore with one BTC keypair in fake vault
+func newKeyStore(t *testing.T) (*whitebox.KeyStore, *config.Configuration, *vaulttest.Server, string) {
+	fv := vaulttest.NewServer()
+
+	cfg := &config.Configuration{
+		Server: config.ServerConfig{BlockChainNetwork: "testnet"},
+		Vault: config.VaultConfig{
+			Username:     "user",
+			Password:     "pass",
+			AppRole:      "role",
+			Address:      fv.URL,
+			WhiteBoxPath: "tss/whitebox",
+		},
+		Signer: config.SignerConfig{Backend: trustSigner.SoftwareBackend, SealKey: "seal key"},
+	}
+
+	if err := trustSigner.Configure(cfg.Signer); err != nil {
+		t.Fatal(err)
+	}
+
+	ks := whitebox.NewKeyStore(cfg, vault.NewClient(cfg))
+	ks.GenerateKeypair("btc1", "BTC", "", "testnet")
+	ks.Load()
+
+	keyMap, _ := ks.GetKeyMap()
+	for keyID := range keyMap {
+		return ks, cfg, fv, keyID
+	}
+
+	t.Fatal("ER : keypair is not loaded")
+	return nil, nil, nil, ""
+}
+
+func TestAllocateDepositAddress(t *testing.T) {
+	ks, cfg, fv, keyID := newKeyStore(t)
+	defer fv.Close()
+	defer ks.Close()
+
+	alice, err := ks.AllocateDepositAddress(keyID, "alice")
+	if err != nil || alice.Index != 1 {
+		t.Fatal("ER : first deposit address", alice, err)
+	}
+
+	// tracked for signing
+	if foundKeyID, derivation, found := ks.LookupAddress(trustSigner.BTC, trustSigner.TESTNET, alice.Address); !found || foundKeyID != keyID || derivation.Index != 1 {
+		t.Error("ER : deposit address is not tracked", foundKeyID, derivation, found)
+	}
+
+	// idempotent per label
+	again, err := ks.AllocateDepositAddress(keyID, "alice")
+	if err != nil || *again != *alice {
+		t.Error("ER : same label", again, err)
+	}
+
+	bob, err := ks.AllocateDepositAddress(keyID, "bob")
+	if err != nil || bob.Index != 2 || bob.Address == alice.Address {
+		t.Error("ER : second deposit address", bob, err)
+	}
+
+	// index taken is skipped even if counter is lost
+	fv.Delete(cfg.Vault.WhiteBoxPath + "/" + keyID + "/deposit/counter")
+	carol, err := ks.AllocateDepositAddress(keyID, "carol")
+	if err != nil || carol.Index != 3 {
+		t.Error("ER : deposit address without counter", carol, err)
+	}
+
+	if _, err := ks.AllocateDepositAddress(keyID, " "); err == nil {
+		t.Error("ER : empty label allocated")
+	}
+	if _, err := ks.AllocateDepositAddress("unknown", "dave"); err == nil {
+		t.Error("ER : unknown keypair allocated")
+	}
+}
+
+func TestDepositAddressConcurrent(t *testing.T) {
+	ks, _, fv, keyID := newKeyStore(t)
+	defer fv.Close()
+	defer ks.Close()
+
+	labels := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	indexes := make(chan uint32, len(labels))
+
+	var wg sync.WaitGroup
+	for _, label := range labels {
+		wg.Add(1)
+		go func(label string) {
+			defer wg.Done()
+			deposit, err := ks.AllocateDepositAddress(keyID, label)
+			if err != nil {
+				t.Error("ER : concurrent allocation", label, err)
+				return
+			}
+			indexes <- deposit.Index
+		}(label)
+	}
+	wg.Wait()
+	close(indexes)
+
+	seen := make(map[uint32]bool)
+	for index := range indexes {
+		if seen[index] {
+			t.Error("ER : index reused", index)
+		}
+		seen[index] = true
+	}
+}
+
+func TestDepositAddressProcesses(t *testing.T) {
+	ks, cfg, fv, keyID := newKeyStore(t)
+	defer fv.Close()
+	defer ks.Close()
+
+	// keystore of other process (CLI) on same vault
+	other := whitebox.NewKeyStore(cfg, vault.NewClient(cfg))
+	other.Load()
+	defer other.Close()
+
+	deposits := make(chan *whitebox.DepositAddress, 6)
+
+	var wg sync.WaitGroup
+	for i, label := range []string{"a", "b", "c", "d", "e", "f"} {
+		store := ks
+		if i%2 == 1 {
+			store = other
+		}
+		wg.Add(1)
+		go func(store *whitebox.KeyStore, label string) {
+			defer wg.Done()
+			deposit, err := store.AllocateDepositAddress(keyID, label)
+			if err != nil {
+				t.Error("ER : allocation", label, err)
+				return
+			}
+			deposits <- deposit
+		}(store, label)
+	}
+	wg.Wait()
+	close(deposits)
+
+	seen := make(map[uint32]bool)
+	for deposit := range deposits {
+		if seen[deposit.Index] {
+			t.Error("ER : index reused across processes", deposit.Index)
+		}
+		seen[deposit.Index] = true
+	}
+	if fv.Get(cfg.Vault.WhiteBoxPath+"/"+keyID+"/deposit/lock") != nil {
+		t.Error("ER : lock record is not removed")
+	}
+}
+
+func TestDepositAddressLoaded(t *testing.T) {
+	ks, cfg, fv, keyID := newKeyStore(t)
+	defer fv.Close()
+	defer ks.Close()
+
+	// keystore loaded before allocation does not know address
+	other := whitebox.NewKeyStore(cfg, vault.NewClient(cfg))
+	other.Load()
+	defer other.Close()
+
+	deposit, err := ks.AllocateDepositAddress(keyID, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, found := other.LookupAddress(trustSigner.BTC, trustSigner.TESTNET, deposit.Address); found {
+		t.Fatal("ER : address tracked before load")
+	}
+
+	// resolving label tracks it
+	resolved, err := other.AllocateDepositAddress(keyID, "alice")
+	if err != nil || *resolved != *deposit {
+		t.Fatal("ER : resolve label", resolved, err)
+	}
+	if _, derivation, found := other.LookupAddress(trustSigner.BTC, trustSigner.TESTNET, deposit.Address); !found || derivation.Index != deposit.Index {
+		t.Error("ER : resolved address is not tracked", derivation, found)
+	}
+
+	for _, label := range []string{"bob", "carol", "dave"} {
+		if _, err := ks.AllocateDepositAddress(keyID, label); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// reload tracks every deposit address, derived from account key without signer
+	reloaded := whitebox.NewKeyStore(cfg, vault.NewClient(cfg))
+	completed := trustSigner.Stats().Completed
+	reloaded.Load()
+	defer reloaded.Close()
+	if calls := trustSigner.Stats().Completed - completed; calls != 2 {
+		t.Error("ER : signer calls of load", calls)
+	}
+	if _, _, found := reloaded.LookupAddress(trustSigner.BTC, trustSigner.TESTNET, deposit.Address); !found {
+		t.Error("ER : deposit address is not loaded")
+	}
+
+	// tampered address is not accepted
+	path := cfg.Vault.WhiteBoxPath + "/" + keyID + "/deposit/index/1"
+	fv.Put(path, map[string]interface{}{"symbol": deposit.Symbol, "address": "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn", "label": deposit.Label})
+	if _, err := other.AllocateDepositAddress(keyID, "alice"); err == nil {
+		t.Error("ER : tampered deposit address accepted")
+	}
+}
@@ -0,0 +1,147 @@
+package whitebox
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/colligence-io/signServer/trustSigner"
+	"github.com/colligence-io/signServer/util"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+)
+
+/*
+WATCH-ONLY EXPORT
+
+public keys and first N receive addresses (0/0 ~ 0/N-1) of keypairs
+publicKey is BIP32 account key (m/44'/coin'/0') for secp256k1 chains, ed25519 public key for XLM
+secp256k1 addresses are derived from account key loaded with keypair in software, without signer
+XLM has no public derivation, its addresses are derived by signer and limited to MaxXLMExportCount
+*/
+
+const (
+	ExportJSON = "json"
+	ExportCSV  = "csv"
+
+	DefaultExportCount = 20
+	MaxExportCount     = 1000
+	MaxXLMExportCount  = 20
+)
+
+type KeyExport struct {
+	KeyID       string            `json:"keyID"`
+	Symbol      string            `json:"symbol"`
+	Network     string            `json:"network"`
+	AddressType string            `json:"addressType,omitempty"`
+	PublicKey   string            `json:"publicKey"`
+	Addresses   []ExportedAddress `json:"addresses"`
+}
+
+type ExportedAddress struct {
+	Index   uint32 `json:"index"`
+	Address string `json:"address"`
+}
+
+// ExportKeys
+// watch-only data of all loaded keypairs, sorted by keyID
+// exported addresses are not tracked for signing
+func (ks *KeyStore) ExportKeys(count int) ([]KeyExport, error) {
+	if count < 0 || count > MaxExportCount {
+		return nil, fmt.Errorf("export address count must be 0 ~ %d", MaxExportCount)
+	}
+
+	ks.lock.RLock()
+	keyIDs := make([]string, 0, len(ks.storage))
+	keyPairs := make(map[string]keyPair, len(ks.storage))
+	for keyID, kp := range ks.storage {
+		keyIDs = append(keyIDs, keyID)
+		keyPairs[keyID] = kp
+	}
+	ks.lock.RUnlock()
+
+	sort.Strings(keyIDs)
+
+	exports := make([]KeyExport, 0, len(keyIDs))
+
+	for _, keyID := range keyIDs {
+		kp := keyPairs[keyID]
+
+		publicKey, e := trustSigner.EncodeAccountPublicKey(kp.bcType, kp.network, kp.accountKey)
+		if e != nil {
+			return nil, fmt.Errorf("cannot export keypair %s : %s", keyID, e.Error())
+		}
+
+		n := count
+		if kp.bcType == trustSigner.XLM && n > MaxXLMExportCount {
+			n = MaxXLMExportCount
+		}
+
+		addresses := make([]ExportedAddress, 0, n)
+		for i := 0; i < n; i++ {
+			address, _, e := ks.deriveAddress(kp, trustSigner.Derivation{Index: uint32(i)})
+			if e != nil {
+				return nil, fmt.Errorf("cannot export keypair %s : %s", keyID, e.Error())
+			}
+			addresses = append(addresses, ExportedAddress{Index: uint32(i), Address: address})
+		}
+
+		exports = append(exports, KeyExport{
+			KeyID:       keyID,
+			Symbol:      string(kp.bcType),
+			Network:     string(kp.network),
+			AddressType: string(kp.addrType),
+			PublicKey:   publicKey,
+			Addresses:   addresses,
+		})
+	}
+
+	return exports, nil
+}
+
+// WriteKeyExportCSV
+// one row per address, keypair without address is written with empty index and address
+func WriteKeyExportCSV(w io.Writer, exports []KeyExport) error {
+	cw := csv.NewWriter(w)
+
+	if e := cw.Write([]string{"keyID", "symbol", "network", "addressType", "publicKey", "index", "address"}); e != nil {
+		return e
+	}
+
+	for _, export := range exports {
+		row := []string{export.KeyID, export.Symbol, export.Network, export.AddressType, export.PublicKey}
+
+		if len(export.Addresses) == 0 {
+			if e := cw.Write(append(row, "", "")); e != nil {
+				return e
+			}
+			continue
+		}
+
+		for _, address := range export.Addresses {
+			if e := cw.Write(append(row, strconv.FormatUint(uint64(address.Index), 10), address.Address)); e != nil {
+				return e
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func (ks *KeyStore) ExportKeyPairs(count int, format string) {
+	exports, e := ks.ExportKeys(count)
+	util.CheckAndDie(e)
+
+	switch format {
+	case ExportJSON:
+		jsonData, e := json.MarshalIndent(exports, "", "  ")
+		util.CheckAndDie(e)
+		fmt.Println(string(jsonData))
+	case ExportCSV:
+		util.CheckAndDie(WriteKeyExportCSV(os.Stdout, exports))
+	default:
+		util.Die("unknown export format " + format)
+	}
+}
@@ -0,0 +1,51 @@
+package whitebox_test
+
+import (
+	"github.com/colligence-io/signServer/trustSigner"
+	"strings"
+	"testing"
+)
+
+func TestExportKeys(t *testing.T) {
+	ks, _, fv, keyID := newKeyStore(t)
+	defer fv.Close()
+	defer ks.Close()
+
+	keyMap, _ := ks.GetKeyMap()
+
+	completed := trustSigner.Stats().Completed
+	exports, err := ks.ExportKeys(100)
+	if err != nil || len(exports) != 1 {
+		t.Fatal("ER : ExportKeys", exports, err)
+	}
+
+	// account key is loaded with keypair, addresses are derived in software
+	if calls := trustSigner.Stats().Completed - completed; calls != 0 {
+		t.Error("ER : signer calls of export", calls)
+	}
+
+	export := exports[0]
+	if export.KeyID != keyID || export.Network != "testnet" || len(export.Addresses) != 100 {
+		t.Error("ER : export", export.KeyID, export.Network, len(export.Addresses))
+	}
+
+	// testnet account key has testnet version bytes
+	if !strings.HasPrefix(export.PublicKey, "tpub") {
+		t.Error("ER : account key of testnet keypair", export.PublicKey)
+	}
+
+	if "BTC:"+export.Addresses[0].Address != keyMap[keyID] {
+		t.Error("ER : exported primary address", export.Addresses[0].Address, keyMap[keyID])
+	}
+
+	for _, index := range []uint32{1, 42, 99} {
+		address, err := ks.DeriveAddress(keyID, trustSigner.Derivation{Index: index})
+		if err != nil || export.Addresses[index].Address != address {
+			t.Error("ER : exported address", index, export.Addresses[index].Address, address, err)
+		}
+	}
+
+	if _, err := ks.ExportKeys(1001); err == nil {
+		t.Error("ER : export count over max")
+	}
+}
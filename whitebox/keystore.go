@@ -1,11 +1,11 @@
 package whitebox
 
-import "C"
 import (
 	"bufio"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/colligence-io/signServer/config"
 	"github.com/colligence-io/signServer/trustSigner"
@@ -16,10 +16,17 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"strings"
+	"sync"
 )
 
 var logger = logrus.WithField("module", "WhiteBoxKeyStore")
 
+// derivation index of sign request must be below server.maxDerivationIndex (default), unless it is deposit address
+const DefaultMaxDerivationIndex = 1000
+
+var ErrDerivationNotAllowed = errors.New("derivation is out of allowed range")
+
 type KeyStore struct {
 	config *config.Configuration
 
@@ -28,19 +35,44 @@ type KeyStore struct {
 
 	// KeyID - keyPair map
 	storage map[string]keyPair
+
+	// symbol:address - addressEntry map
+	addressBook map[string]addressEntry
+
+	lock sync.RWMutex
+
+	// serializes deposit address allocation
+	depositLock sync.Mutex
 }
 
 type keyPair struct {
 	bcType   trustSigner.BlockChainType
+	addrType trustSigner.AddressType
+	network  trustSigner.BlockChainNetworkType
 	address  string
 	whiteBox *trustSigner.WhiteBox
+
+	// account public key of GetWBAccountPublicKey, secp256k1 addresses are derived from it in software
+	accountKey string
+
+	// address - derivation map, includes primary address (0/0)
+	derived map[string]trustSigner.Derivation
+}
+
+type addressEntry struct {
+	keyID      string
+	derivation trustSigner.Derivation
+	// public key the address is derived from, signatures are verified with it
+	publicKey string
 }
 
 type backupData struct {
-	AppID    string `json:"appID"`
-	Symbol   string `json:"symbol"`
-	Address  string `json:"address"`
-	WhiteBox string `json:"whitebox"`
+	AppID       string `json:"appID"`
+	Symbol      string `json:"symbol"`
+	AddressType string `json:"addressType,omitempty"`
+	Network     string `json:"network,omitempty"`
+	Address     string `json:"address"`
+	WhiteBox    string `json:"whitebox"`
 }
 
 func NewKeyStore(cfg *config.Configuration, vaultClient *vault.Client) *KeyStore {
@@ -55,7 +87,14 @@ func (ks *KeyStore) Load() {
 		ks.vc.Connect()
 	}
 
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+
+	// release whiteboxes of previous load
+	ks.closeWhiteBoxes()
+
 	ks.storage = make(map[string]keyPair)
+	ks.addressBook = make(map[string]addressEntry)
 
 	ksList, e := ks.vc.Logical().List(ks.config.Vault.WhiteBoxPath)
 	util.CheckAndDie(e)
@@ -68,6 +107,11 @@ func (ks *KeyStore) Load() {
 	for _, ik := range ksList.Data["keys"].([]interface{}) {
 		keyID := ik.(string)
 
+		// skip sub paths (deposit addresses)
+		if strings.HasSuffix(keyID, "/") {
+			continue
+		}
+
 		secret, e := ks.vc.Logical().Read(ks.config.Vault.WhiteBoxPath + "/" + keyID)
 		util.CheckAndDie(e)
 
@@ -82,27 +126,95 @@ func (ks *KeyStore) Load() {
 			util.CheckAndDie(fmt.Errorf("cannot load keypair %s : BlockChainType %s is invalid", appID, symbol))
 		}
 
-		wb := trustSigner.ConvertToWhiteBox(appID, wbBytes)
+		// keypair stored before address type was introduced uses default address type
+		addrType, e := trustSigner.ResolveAddressType(bcType, trustSigner.AddressType(optionalString(secret.Data, "addressType")))
+		if e != nil {
+			util.CheckAndDie(fmt.Errorf("cannot load keypair %s : %s", appID, e.Error()))
+		}
+
+		// keypair stored before network was introduced uses bc_network of config
+		network, e := ks.resolveNetwork(optionalString(secret.Data, "network"))
+		if e != nil {
+			util.CheckAndDie(fmt.Errorf("cannot load keypair %s : %s", appID, e.Error()))
+		}
+
+		wb, e := trustSigner.ConvertToWhiteBox(appID, wbBytes)
+		trustSigner.ZeroBytes(wbBytes)
+		util.CheckAndDie(e)
+
+		publicKey, e := trustSigner.GetWBPublicKey(wb, bcType, trustSigner.Derivation{})
+		util.CheckAndDie(e)
+
+		accountKey, e := trustSigner.GetWBAccountPublicKey(wb, bcType)
+		util.CheckAndDie(e)
+
+		kp := keyPair{
+			bcType:     bcType,
+			addrType:   addrType,
+			network:    network,
+			whiteBox:   wb,
+			accountKey: accountKey,
+			derived:    make(map[string]trustSigner.Derivation),
+		}
 
-		publicKey, e := trustSigner.GetWBPublicKey(wb, bcType)
+		// primary address derived from account key must be the one of signer
+		derivedAddress, derivedPublicKey, e := ks.deriveAddress(kp, trustSigner.Derivation{})
 		util.CheckAndDie(e)
 
-		derivedAddress, err := trustSigner.DeriveAddress(bcType, publicKey, ks.config.Server.BlockChainNetwork)
-		util.CheckAndDie(err)
+		if derivedPublicKey != publicKey {
+			util.CheckAndDie(fmt.Errorf("cannot load keypair %s : account key verification failed", appID))
+		}
 
 		if derivedAddress != address {
 			util.CheckAndDie(fmt.Errorf("cannot load keypair %s : address verification failed %s != %s", appID, address, derivedAddress))
 		}
 
-		ks.storage[keyID] = keyPair{
-			bcType:   bcType,
-			address:  derivedAddress,
-			whiteBox: wb,
-		}
+		kp.address = derivedAddress
+
+		ks.storage[keyID] = kp
+		ks.trackAddress(keyID, kp, derivedAddress, publicKey, trustSigner.Derivation{})
+
+		ks.loadDepositAddresses(keyID, kp)
 	}
 }
 
+// Close
+// zeroize and free all whiteboxes, keystore is empty until next Load
+func (ks *KeyStore) Close() {
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+
+	ks.closeWhiteBoxes()
+
+	ks.storage = make(map[string]keyPair)
+	ks.addressBook = make(map[string]addressEntry)
+}
+
+// closeWhiteBoxes
+// lock must be held by caller
+func (ks *KeyStore) closeWhiteBoxes() {
+	for _, kp := range ks.storage {
+		kp.whiteBox.Close()
+	}
+}
+
+func addressBookKey(bcType trustSigner.BlockChainType, network trustSigner.BlockChainNetworkType, address string) string {
+	return string(bcType) + ":" + string(network) + ":" + address
+}
+
+// resolveNetwork
+// empty network means bc_network of config
+func (ks *KeyStore) resolveNetwork(network string) (trustSigner.BlockChainNetworkType, error) {
+	if network == "" {
+		network = ks.config.Server.BlockChainNetwork
+	}
+	return trustSigner.ParseNetwork(network)
+}
+
 func (ks *KeyStore) GetWhiteBoxData(keyID string, bcType trustSigner.BlockChainType) *trustSigner.WhiteBox {
+	ks.lock.RLock()
+	defer ks.lock.RUnlock()
+
 	if wbData, found := ks.storage[keyID]; found && wbData.bcType == bcType {
 		return wbData.whiteBox
 	} else {
@@ -110,11 +222,143 @@ func (ks *KeyStore) GetWhiteBoxData(keyID string, bcType trustSigner.BlockChainT
 	}
 }
 
+// DeriveAddress
+// derive address of keypair at derivation and track it for signing
+// derivation must be in range of maxDerivationIndex or allocated deposit address
+func (ks *KeyStore) DeriveAddress(keyID string, derivation trustSigner.Derivation) (string, error) {
+	return ks.derive(keyID, derivation, true)
+}
+
+// derive
+// bounded derivation is checked by allowDerivation, deposit allocator derives its own index unbounded
+func (ks *KeyStore) derive(keyID string, derivation trustSigner.Derivation, bounded bool) (string, error) {
+	ks.lock.RLock()
+	kp, found := ks.storage[keyID]
+	ks.lock.RUnlock()
+
+	if !found {
+		return "", fmt.Errorf("keypair %s not found", keyID)
+	}
+
+	if bounded {
+		if e := ks.allowDerivation(keyID, derivation); e != nil {
+			return "", e
+		}
+	}
+
+	address, publicKey, e := ks.deriveAddress(kp, derivation)
+	if e != nil {
+		return "", e
+	}
+
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+
+	// keypair might be reloaded while deriving
+	if current, found := ks.storage[keyID]; !found || current.whiteBox != kp.whiteBox {
+		return "", fmt.Errorf("keypair %s reloaded while deriving", keyID)
+	}
+
+	ks.trackAddress(keyID, kp, address, publicKey, derivation)
+
+	return address, nil
+}
+
+// allowDerivation
+// change 0 or 1 and index below maxDerivationIndex, or index allocated as deposit address
+// every derived address is tracked until reload, so that derivation is never unbounded
+func (ks *KeyStore) allowDerivation(keyID string, derivation trustSigner.Derivation) error {
+	if derivation.Change <= 1 && derivation.Index < ks.maxDerivationIndex() {
+		return nil
+	}
+
+	if derivation.Change == 0 {
+		deposit, e := ks.readDepositAddress(keyID, derivation.Index)
+		if e != nil {
+			return e
+		}
+		if deposit != nil {
+			return nil
+		}
+	}
+
+	return ErrDerivationNotAllowed
+}
+
+func (ks *KeyStore) maxDerivationIndex() uint32 {
+	if max := ks.config.Server.MaxDerivationIndex; max > 0 {
+		return uint32(max)
+	}
+	return DefaultMaxDerivationIndex
+}
+
+// deriveAddress
+// address and public key of keypair at derivation
+// secp256k1 public key is derived from account key in software, XLM (hardened only) is derived by signer
+func (ks *KeyStore) deriveAddress(kp keyPair, derivation trustSigner.Derivation) (string, string, error) {
+	var publicKey string
+	var e error
+
+	if kp.bcType == trustSigner.XLM {
+		publicKey, e = trustSigner.GetWBPublicKey(kp.whiteBox, kp.bcType, derivation)
+	} else {
+		publicKey, e = trustSigner.DeriveAccountPublicKey(kp.bcType, kp.accountKey, derivation)
+	}
+	if e != nil {
+		return "", "", e
+	}
+
+	address, e := trustSigner.DeriveAddress(kp.bcType, kp.addrType, publicKey, string(kp.network))
+	if e != nil {
+		return "", "", e
+	}
+
+	return address, publicKey, nil
+}
+
+// trackAddress
+// lock must be held by caller
+func (ks *KeyStore) trackAddress(keyID string, kp keyPair, address string, publicKey string, derivation trustSigner.Derivation) {
+	kp.derived[address] = derivation
+	ks.addressBook[addressBookKey(kp.bcType, kp.network, address)] = addressEntry{keyID: keyID, derivation: derivation, publicKey: publicKey}
+}
+
+// LookupAddress
+// find keyID and derivation of tracked address on network
+func (ks *KeyStore) LookupAddress(bcType trustSigner.BlockChainType, network trustSigner.BlockChainNetworkType, address string) (string, trustSigner.Derivation, bool) {
+	ks.lock.RLock()
+	defer ks.lock.RUnlock()
+
+	if da, found := ks.addressBook[addressBookKey(bcType, network, address)]; found {
+		return da.keyID, da.derivation, true
+	}
+	return "", trustSigner.Derivation{}, false
+}
+
+// LookupPublicKey
+// public key of tracked address on network, verified against address when tracked
+func (ks *KeyStore) LookupPublicKey(bcType trustSigner.BlockChainType, network trustSigner.BlockChainNetworkType, address string) (string, bool) {
+	ks.lock.RLock()
+	defer ks.lock.RUnlock()
+
+	if da, found := ks.addressBook[addressBookKey(bcType, network, address)]; found {
+		return da.publicKey, true
+	}
+	return "", false
+}
+
 func (ks *KeyStore) GetKeyStoreListDescription() []string {
+	ks.lock.RLock()
+	defer ks.lock.RUnlock()
+
 	kplist := make([]string, 0, len(ks.storage))
 
 	for keyID, kp := range ks.storage {
-		kplist = append(kplist, fmt.Sprint("KeyPair ", C.GoString((*C.char)(kp.whiteBox.AppID)), " : ", keyID, " ", kp.bcType, " ", kp.address))
+		bcDescription := string(kp.bcType)
+		if kp.addrType != "" {
+			bcDescription += "(" + string(kp.addrType) + ")"
+		}
+		kplist = append(kplist, fmt.Sprint("KeyPair ", kp.whiteBox.AppID, " : ", keyID, " ", bcDescription, " ", kp.network, " ", kp.address, " (", len(kp.derived), " derived)"))
 	}
 
 	return kplist
@@ -123,7 +367,7 @@ func (ks *KeyStore) GetKeyStoreListDescription() []string {
 /*
 KEYPAIR GENERATION
 */
-func (ks *KeyStore) GenerateKeypair(appID string, symbol string) {
+func (ks *KeyStore) GenerateKeypair(appID string, symbol string, addressType string, bcNetwork string) {
 	if !ks.vc.IsConnected() {
 		ks.vc.Connect()
 	}
@@ -134,15 +378,30 @@ func (ks *KeyStore) GenerateKeypair(appID string, symbol string) {
 		return
 	}
 
+	addrType, e := trustSigner.ResolveAddressType(bcType, trustSigner.AddressType(addressType))
+	if e != nil {
+		fmt.Println(e)
+		return
+	}
+
+	network, e := ks.resolveNetwork(bcNetwork)
+	if e != nil {
+		fmt.Println(e)
+		return
+	}
+
 	wbBytes, e := trustSigner.GetWBInitializeData(appID)
 	util.CheckAndDie(e)
+	defer trustSigner.ZeroBytes(wbBytes)
 
-	wb := trustSigner.ConvertToWhiteBox(appID, wbBytes)
+	wb, e := trustSigner.ConvertToWhiteBox(appID, wbBytes)
+	util.CheckAndDie(e)
+	defer wb.Close()
 
-	key, e := trustSigner.GetWBPublicKey(wb, bcType)
+	key, e := trustSigner.GetWBPublicKey(wb, bcType, trustSigner.Derivation{})
 	util.CheckAndDie(e)
 
-	address, e := trustSigner.DeriveAddress(bcType, key, ks.config.Server.BlockChainNetwork)
+	address, e := trustSigner.DeriveAddress(bcType, addrType, key, string(network))
 	util.CheckAndDie(e)
 
 	keyID := ks.appIDtoKeyID(appID)
@@ -155,25 +414,40 @@ func (ks *KeyStore) GenerateKeypair(appID string, symbol string) {
 	}
 
 	// store to vault
-	_, e = ks.vc.Logical().Write(ks.config.Vault.WhiteBoxPath+"/"+keyID, toVaultData(appID, symbol, address, base64.StdEncoding.EncodeToString(wbBytes)))
+	_, e = ks.vc.Logical().Write(ks.config.Vault.WhiteBoxPath+"/"+keyID, toVaultData(appID, symbol, string(addrType), string(network), address, base64.StdEncoding.EncodeToString(wbBytes)))
 	util.CheckAndDie(e)
 
 	fmt.Println("Whitebox Keypair Generated")
 	fmt.Println("AppID :", appID)
 	fmt.Println("KeyID :", keyID)
 	fmt.Println("BlockChainType :", string(bcType))
+	if addrType != "" {
+		fmt.Println("AddressType :", string(addrType))
+	}
+	fmt.Println("Network :", string(network))
 	fmt.Println("Address :", address)
 }
 
-func toVaultData(appID string, symbol string, address string, wbBase64 string) map[string]interface{} {
+func toVaultData(appID string, symbol string, addressType string, network string, address string, wbBase64 string) map[string]interface{} {
 	return map[string]interface{}{
-		"appID":   appID,
-		"symbol":  symbol,
-		"address": address,
-		"wb":      wbBase64,
+		"appID":       appID,
+		"symbol":      symbol,
+		"addressType": addressType,
+		"network":     network,
+		"address":     address,
+		"wb":          wbBase64,
 	}
 }
 
+// optionalString
+// string field of vault data, empty if not present
+func optionalString(data map[string]interface{}, field string) string {
+	if value, ok := data[field].(string); ok {
+		return value
+	}
+	return ""
+}
+
 func (ks *KeyStore) ShowKeypairInfo(appID string) {
 	if !ks.vc.IsConnected() {
 		ks.vc.Connect()
@@ -189,12 +463,21 @@ func (ks *KeyStore) ShowKeypairInfo(appID string) {
 	}
 
 	symbol := secret.Data["symbol"].(string)
+	addressType := optionalString(secret.Data, "addressType")
+	network := optionalString(secret.Data, "network")
+	if network == "" {
+		network = ks.config.Server.BlockChainNetwork + " (default)"
+	}
 	address := secret.Data["address"].(string)
 
 	fmt.Println("Whitebox Keypair Information")
 	fmt.Println("AppID :", appID)
 	fmt.Println("KeyID :", keyID)
 	fmt.Println("BlockChainType :", symbol)
+	if addressType != "" {
+		fmt.Println("AddressType :", addressType)
+	}
+	fmt.Println("Network :", network)
 	fmt.Println("Address :", address)
 }
 
@@ -230,6 +513,9 @@ func (ks *KeyStore) appIDtoKeyID(appID string) string {
 }
 
 func (ks *KeyStore) GetKeyMap() (map[string]string, error) {
+	ks.lock.RLock()
+	defer ks.lock.RUnlock()
+
 	keymap := make(map[string]string)
 
 	for keyID, wb := range ks.storage {
@@ -271,10 +557,12 @@ func (ks *KeyStore) BackupKeyPair(appID string) {
 	}
 
 	jsonData, e := json.Marshal(backupData{
-		AppID:    secretAppID,
-		Symbol:   secretSymbol,
-		Address:  secretAddress,
-		WhiteBox: secretWbBase64,
+		AppID:       secretAppID,
+		Symbol:      secretSymbol,
+		AddressType: optionalString(secret.Data, "addressType"),
+		Network:     optionalString(secret.Data, "network"),
+		Address:     secretAddress,
+		WhiteBox:    secretWbBase64,
 	})
 	util.CheckAndDie(e)
 
@@ -321,15 +609,25 @@ func (ks *KeyStore) RecoverKeyPair(filePath string) {
 		return
 	}
 
+	addrType, e := trustSigner.ResolveAddressType(bcType, trustSigner.AddressType(backup.AddressType))
+	util.CheckAndDie(e)
+
+	// backup made before network was introduced uses bc_network of config
+	network, e := ks.resolveNetwork(backup.Network)
+	util.CheckAndDie(e)
+
 	wbBytes, e := base64.StdEncoding.DecodeString(backup.WhiteBox)
 	util.CheckAndDie(e)
 
-	whitebox := trustSigner.ConvertToWhiteBox(backup.AppID, wbBytes)
+	whitebox, e := trustSigner.ConvertToWhiteBox(backup.AppID, wbBytes)
+	trustSigner.ZeroBytes(wbBytes)
+	util.CheckAndDie(e)
+	defer whitebox.Close()
 
-	publicKey, e := trustSigner.GetWBPublicKey(whitebox, bcType)
+	publicKey, e := trustSigner.GetWBPublicKey(whitebox, bcType, trustSigner.Derivation{})
 	util.CheckAndDie(e)
 
-	derivedAddress, e := trustSigner.DeriveAddress(bcType, publicKey, ks.config.Server.BlockChainNetwork)
+	derivedAddress, e := trustSigner.DeriveAddress(bcType, addrType, publicKey, string(network))
 	util.CheckAndDie(e)
 
 	if backup.Address != derivedAddress {
@@ -337,12 +635,16 @@ func (ks *KeyStore) RecoverKeyPair(filePath string) {
 	}
 
 	// store to vault
-	_, e = ks.vc.Logical().Write(ks.config.Vault.WhiteBoxPath+"/"+keyID, toVaultData(backup.AppID, backup.Symbol, backup.Address, backup.WhiteBox))
+	_, e = ks.vc.Logical().Write(ks.config.Vault.WhiteBoxPath+"/"+keyID, toVaultData(backup.AppID, backup.Symbol, string(addrType), string(network), backup.Address, backup.WhiteBox))
 	util.CheckAndDie(e)
 
 	fmt.Println("Whitebox Keypair Recovered")
 	fmt.Println("AppID :", backup.AppID)
 	fmt.Println("KeyID :", keyID)
 	fmt.Println("BlockChainType :", string(bcType))
+	if addrType != "" {
+		fmt.Println("AddressType :", string(addrType))
+	}
+	fmt.Println("Network :", string(network))
 	fmt.Println("Address :", backup.Address)
 }
@@ -0,0 +1,166 @@
+package whitebox_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/btcsuite/btcutil"
+	"github.com/colligence-io/signServer/trustSigner"
+	"github.com/colligence-io/signServer/whitebox"
+	"strings"
+	"testing"
+)
+
+func TestDeriveAddress(t *testing.T) {
+	ks, _, fv, keyID := newKeyStore(t)
+	defer fv.Close()
+	defer ks.Close()
+
+	primary, err := ks.DeriveAddress(keyID, trustSigner.Derivation{})
+	if err != nil {
+		t.Fatal("ER : primary address", err)
+	}
+
+	derivation := trustSigner.Derivation{Change: 1, Index: 5}
+	address, err := ks.DeriveAddress(keyID, derivation)
+	if err != nil || address == primary {
+		t.Fatal("ER : derived address", address, err)
+	}
+
+	// same derivation is same address
+	if again, err := ks.DeriveAddress(keyID, derivation); err != nil || again != address {
+		t.Error("ER : derived again", again, err)
+	}
+
+	// tracked for signing
+	if foundKeyID, found, ok := ks.LookupAddress(trustSigner.BTC, trustSigner.TESTNET, address); !ok || foundKeyID != keyID || found != derivation {
+		t.Error("ER : derived address is not tracked", foundKeyID, found, ok)
+	}
+	if _, ok := ks.LookupPublicKey(trustSigner.BTC, trustSigner.TESTNET, address); !ok {
+		t.Error("ER : public key of derived address is not tracked")
+	}
+	if _, _, ok := ks.LookupAddress(trustSigner.BTC, trustSigner.MAINNET, address); ok {
+		t.Error("ER : derived address tracked on other network")
+	}
+
+	if _, err := ks.DeriveAddress("unknown", derivation); err == nil {
+		t.Error("ER : address of unknown keypair")
+	}
+}
+
+func TestDeriveAddressBound(t *testing.T) {
+	ks, cfg, fv, keyID := newKeyStore(t)
+	defer fv.Close()
+	defer ks.Close()
+
+	cfg.Server.MaxDerivationIndex = 3
+
+	for _, derivation := range []trustSigner.Derivation{{Change: 0, Index: 2}, {Change: 1, Index: 2}} {
+		if _, err := ks.DeriveAddress(keyID, derivation); err != nil {
+			t.Error("ER : derivation in range", derivation, err)
+		}
+	}
+	for _, derivation := range []trustSigner.Derivation{{Change: 0, Index: 3}, {Change: 2, Index: 0}, {Change: 0, Index: 1 << 31}} {
+		if _, err := ks.DeriveAddress(keyID, derivation); err != whitebox.ErrDerivationNotAllowed {
+			t.Error("ER : derivation out of range", derivation, err)
+		}
+	}
+
+	// deposit address over max is allocated index
+	for _, label := range []string{"alice", "bob", "carol"} {
+		if _, err := ks.AllocateDepositAddress(keyID, label); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := ks.DeriveAddress(keyID, trustSigner.Derivation{Index: 3}); err != nil {
+		t.Error("ER : derivation of deposit address", err)
+	}
+	if _, err := ks.DeriveAddress(keyID, trustSigner.Derivation{Index: 4}); err != whitebox.ErrDerivationNotAllowed {
+		t.Error("ER : derivation over allocated deposit address", err)
+	}
+}
+
+func TestKeypairNetwork(t *testing.T) {
+	ks, _, fv, testnetKeyID := newKeyStore(t)
+	defer fv.Close()
+	defer ks.Close()
+
+	// same symbol on other networks
+	ks.GenerateKeypair("btc-main", "BTC", "", "mainnet")
+	ks.GenerateKeypair("btc-reg", "BTC", "p2wpkh", "regtest")
+	ks.GenerateKeypair("btc-sig", "BTC", "p2wpkh", "signet")
+	ks.GenerateKeypair("btc-bad", "BTC", "", "foonet")
+	ks.Load()
+
+	keyMap, _ := ks.GetKeyMap()
+	if len(keyMap) != 4 {
+		t.Fatal("ER : keypairs on networks", keyMap)
+	}
+	if _, found := keyMap[keyIDOf("btc-bad")]; found {
+		t.Error("ER : keypair on unknown network generated")
+	}
+
+	for _, tc := range []struct {
+		keyID   string
+		network trustSigner.BlockChainNetworkType
+		prefix  string
+	}{
+		{testnetKeyID, trustSigner.TESTNET, ""},
+		{keyIDOf("btc-main"), trustSigner.MAINNET, "1"},
+		{keyIDOf("btc-reg"), trustSigner.REGTEST, "bcrt1q"},
+		{keyIDOf("btc-sig"), trustSigner.SIGNET, "tb1q"},
+	} {
+		address := strings.TrimPrefix(keyMap[tc.keyID], "BTC:")
+		if address == "" || !strings.HasPrefix(address, tc.prefix) {
+			t.Error("ER : address encoding on", tc.network, address)
+			continue
+		}
+		netParam, _ := trustSigner.NetParams(trustSigner.BTC, tc.network)
+		if decoded, err := btcutil.DecodeAddress(address, netParam); err != nil || !decoded.IsForNet(netParam) {
+			t.Error("ER : address is not for", tc.network, address, err)
+		}
+
+		// tracked on its own network only
+		if keyID, _, found := ks.LookupAddress(trustSigner.BTC, tc.network, address); !found || keyID != tc.keyID {
+			t.Error("ER : address is not tracked on", tc.network, address)
+		}
+		for _, other := range []trustSigner.BlockChainNetworkType{trustSigner.MAINNET, trustSigner.TESTNET, trustSigner.REGTEST, trustSigner.SIGNET} {
+			if other == tc.network {
+				continue
+			}
+			if _, _, found := ks.LookupAddress(trustSigner.BTC, other, address); found {
+				t.Error("ER : address of", tc.network, "is tracked on", other)
+			}
+		}
+	}
+
+	// regtest and signet keys differ from each other though both are test networks
+	if keyMap[keyIDOf("btc-reg")] == keyMap[keyIDOf("btc-sig")] {
+		t.Error("ER : regtest and signet keypairs share address")
+	}
+}
+
+func TestKeypairDefaultNetwork(t *testing.T) {
+	ks, cfg, fv, keyID := newKeyStore(t)
+	defer fv.Close()
+	defer ks.Close()
+
+	// keypair stored before network was introduced uses bc_network of config
+	path := cfg.Vault.WhiteBoxPath + "/" + keyID
+	data := fv.Get(path)
+	delete(data, "network")
+	fv.Put(path, data)
+	ks.Load()
+
+	address := fv.Get(path)["address"].(string)
+	if _, _, found := ks.LookupAddress(trustSigner.BTC, trustSigner.TESTNET, address); !found {
+		t.Error("ER : keypair without network is not on bc_network", address)
+	}
+	if _, _, found := ks.LookupAddress(trustSigner.BTC, trustSigner.MAINNET, address); found {
+		t.Error("ER : keypair without network is on mainnet", address)
+	}
+}
+
+func keyIDOf(appID string) string {
+	keyID := sha256.Sum256([]byte(appID))
+	return hex.EncodeToString(keyID[:])
+}
@@ -0,0 +1,122 @@
+package whitebox
+
+import (
+	"fmt"
+	"github.com/btcsuite/btcutil"
+	"github.com/colligence-io/signServer/btcmsg"
+	"github.com/colligence-io/signServer/trustSigner"
+	"github.com/colligence-io/signServer/util"
+	"github.com/sirupsen/logrus"
+)
+
+/*
+BITCOIN SIGNED MESSAGE
+
+BIP137 signature of message by BTC keypair address, for proof of address control
+whitebox signature of MessageHash is verified with public key of tracked address as any other signature,
+then encoded to compact signature and verified again as message signature, so that proof always matches address of kplist
+*/
+
+// BitcoinMessageSignature
+// base64 compact signature of message by address from verified [R || S || V] signature of MessageHash
+func BitcoinMessageSignature(network trustSigner.BlockChainNetworkType, address string, message string, signature []byte) (string, error) {
+	netParams, e := trustSigner.NetParams(trustSigner.BTC, network)
+	if e != nil {
+		return "", e
+	}
+
+	decodedAddress, e := btcutil.DecodeAddress(address, netParams)
+	if e != nil {
+		return "", e
+	}
+
+	compact, e := btcmsg.Signature(signature, decodedAddress)
+	if e != nil {
+		return "", e
+	}
+
+	if e := btcmsg.Verify(address, message, compact, netParams); e != nil {
+		return "", fmt.Errorf("message signature of %s is not verified : %s", address, e.Error())
+	}
+
+	return compact, nil
+}
+
+// SignMessage
+// sign message with primary address (0/0) of BTC keypair
+func (ks *KeyStore) SignMessage(keyID string, message string) (string, string, error) {
+	ks.lock.RLock()
+	kp, found := ks.storage[keyID]
+	ks.lock.RUnlock()
+
+	if !found {
+		return "", "", fmt.Errorf("keypair %s not found", keyID)
+	}
+
+	if kp.bcType != trustSigner.BTC {
+		return "", "", fmt.Errorf("keypair %s is not BTC keypair", keyID)
+	}
+
+	publicKey, found := ks.LookupPublicKey(kp.bcType, kp.network, kp.address)
+	if !found {
+		return "", "", fmt.Errorf("public key of %s not found", kp.address)
+	}
+
+	messageHash := btcmsg.MessageHash(message)
+
+	signature, e := trustSigner.GetWBSignatureData(kp.whiteBox, kp.bcType, trustSigner.Derivation{}, messageHash)
+	if e != nil {
+		return "", "", e
+	}
+
+	verified, e := trustSigner.VerifySignatureData(kp.bcType, publicKey, messageHash, signature)
+	if e != nil {
+		logger.WithFields(logrus.Fields{
+			"alert":   "SIGNATURE_VERIFICATION",
+			"keyID":   keyID,
+			"type":    kp.bcType,
+			"network": kp.network,
+			"address": kp.address,
+		}).Error("ALERT : whitebox message signature is not verified : ", e)
+		return "", "", fmt.Errorf("signature of %s is not verified : %s", kp.address, e.Error())
+	}
+
+	compact, e := BitcoinMessageSignature(kp.network, kp.address, message, verified)
+	if e != nil {
+		return "", "", e
+	}
+
+	return kp.address, compact, nil
+}
+
+func (ks *KeyStore) SignMessageProof(appID string, message string) {
+	keyID := ks.appIDtoKeyID(appID)
+
+	address, signature, e := ks.SignMessage(keyID, message)
+	util.CheckAndDie(e)
+
+	fmt.Println("Bitcoin Signed Message")
+	fmt.Println("AppID :", appID)
+	fmt.Println("KeyID :", keyID)
+	fmt.Println("Address :", address)
+	fmt.Println("Message :", message)
+	fmt.Println("Signature :", signature)
+}
+
+func (ks *KeyStore) VerifyMessageProof(address string, message string, signature string, network string) {
+	bcNetwork, e := ks.resolveNetwork(network)
+	util.CheckAndDie(e)
+
+	netParams, e := trustSigner.NetParams(trustSigner.BTC, bcNetwork)
+	util.CheckAndDie(e)
+
+	fmt.Println("Bitcoin Signed Message Verification")
+	fmt.Println("Address :", address)
+	fmt.Println("Network :", bcNetwork)
+	fmt.Println("Message :", message)
+
+	if e := btcmsg.Verify(address, message, signature, netParams); e != nil {
+		util.Die("Result : INVALID, " + e.Error())
+	}
+	fmt.Println("Result : VALID")
+}
@@ -0,0 +1,38 @@
+package whitebox_test
+
+import (
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/colligence-io/signServer/btcmsg"
+	"github.com/colligence-io/signServer/trustSigner"
+	"github.com/colligence-io/signServer/whitebox"
+	"testing"
+)
+
+func TestSignMessage(t *testing.T) {
+	ks, _, fv, keyID := newKeyStore(t)
+	defer fv.Close()
+	defer ks.Close()
+
+	address, signature, err := ks.SignMessage(keyID, "hello")
+	if err != nil {
+		t.Fatal("ER : SignMessage", err)
+	}
+	if err := btcmsg.Verify(address, "hello", signature, &chaincfg.TestNet3Params); err != nil {
+		t.Error("ER : message signature", err)
+	}
+
+	// signature of other message is not encoded as signature of message
+	other, err := ks.DeriveAddress(keyID, trustSigner.Derivation{Index: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := make([]byte, 65)
+	raw[0], raw[32] = 1, 1
+	if _, err := whitebox.BitcoinMessageSignature(trustSigner.TESTNET, other, "hello", raw); err == nil {
+		t.Error("ER : signature not by address encoded")
+	}
+
+	if _, _, err := ks.SignMessage("unknown", "hello"); err == nil {
+		t.Error("ER : message signed by unknown keypair")
+	}
+}
@@ -0,0 +1,108 @@
+package xlmtx
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/xdr"
+	"math/big"
+)
+
+/*
+Stellar transaction envelope
+
+transaction hash = sha256(networkID || ENVELOPE_TYPE_TX || tx), networkID = sha256(network passphrase)
+signature is appended as DecoratedSignature, hint = last 4 bytes of ed25519 public key
+*/
+
+// max signatures of envelope (xdrmaxsize of TransactionEnvelope.Signatures)
+const maxSignatures = 20
+
+type Envelope struct {
+	xdr.TransactionEnvelope
+}
+
+func DecodeBase64(envelopeXDR string) (*Envelope, error) {
+	var envelope Envelope
+	if e := xdr.SafeUnmarshalBase64(envelopeXDR, &envelope.TransactionEnvelope); e != nil {
+		return nil, e
+	}
+	return &envelope, nil
+}
+
+func (env *Envelope) EncodeBase64() (string, error) {
+	return xdr.MarshalBase64(env.TransactionEnvelope)
+}
+
+// Hash
+// network specific transaction hash to sign
+func (env *Envelope) Hash(networkPassphrase string) ([32]byte, error) {
+	return network.HashTransaction(&env.Tx, networkPassphrase)
+}
+
+// AddSignature
+// append ed25519 signature of transaction hash by address, same signature is not appended twice
+func (env *Envelope) AddSignature(address string, signature []byte) error {
+	kp, e := keypair.Parse(address)
+	if e != nil {
+		return e
+	}
+
+	if len(signature) != 64 {
+		return errors.New("ed25519 signature must be 64 bytes")
+	}
+
+	decorated := xdr.DecoratedSignature{
+		Hint:      xdr.SignatureHint(kp.Hint()),
+		Signature: xdr.Signature(signature),
+	}
+
+	for _, s := range env.Signatures {
+		if s.Hint == decorated.Hint && bytes.Equal(s.Signature, decorated.Signature) {
+			return nil
+		}
+	}
+
+	if len(env.Signatures) >= maxSignatures {
+		return errors.New("envelope has too many signatures")
+	}
+
+	env.Signatures = append(env.Signatures, decorated)
+	return nil
+}
+
+// Destinations
+// destination accounts of payment operations and total native amount (stroops) they move
+// both are nil if envelope has any operation other than create account / payment (set options, path payment, ...)
+// amount is nil if any payment moves other asset
+func (env *Envelope) Destinations() ([]string, *big.Int) {
+	destinations := make([]string, 0, len(env.Tx.Operations))
+	amount := new(big.Int)
+	known := true
+
+	for _, op := range env.Tx.Operations {
+		switch op.Body.Type {
+		case xdr.OperationTypeCreateAccount:
+			createAccount := op.Body.MustCreateAccountOp()
+			destinations = append(destinations, createAccount.Destination.Address())
+			amount.Add(amount, big.NewInt(int64(createAccount.StartingBalance)))
+		case xdr.OperationTypePayment:
+			payment := op.Body.MustPaymentOp()
+			destinations = append(destinations, payment.Destination.Address())
+			if payment.Asset.Type == xdr.AssetTypeAssetTypeNative {
+				amount.Add(amount, big.NewInt(int64(payment.Amount)))
+			} else {
+				known = false
+			}
+		default:
+			// effect of other operations is not a transfer to destination (signer, trustline, merge, ...)
+			return nil, nil
+		}
+	}
+
+	if !known {
+		return destinations, nil
+	}
+	return destinations, amount
+}
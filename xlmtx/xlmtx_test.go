@@ -0,0 +1,213 @@
+package xlmtx_test
+
+import (
+	"crypto/sha256"
+	"github.com/colligence-io/signServer/server/policy"
+	"github.com/colligence-io/signServer/xlmtx"
+	"github.com/stellar/go/keypair"
+	"github.com/stellar/go/network"
+	"github.com/stellar/go/xdr"
+	"testing"
+	"time"
+)
+
+func randomKeyPair(t *testing.T) *keypair.Full {
+	kp, err := keypair.Random()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kp
+}
+
+func testEnvelope(t *testing.T, source *keypair.Full) string {
+	var sourceAccount, destination xdr.AccountId
+	if err := sourceAccount.SetAddress(source.Address()); err != nil {
+		t.Fatal(err)
+	}
+	if err := destination.SetAddress(randomKeyPair(t).Address()); err != nil {
+		t.Fatal(err)
+	}
+
+	payment, err := xdr.NewOperationBody(xdr.OperationTypePayment, xdr.PaymentOp{
+		Destination: destination,
+		Asset:       xdr.Asset{Type: xdr.AssetTypeAssetTypeNative},
+		Amount:      10000000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelope := xdr.TransactionEnvelope{
+		Tx: xdr.Transaction{
+			SourceAccount: sourceAccount,
+			Fee:           100,
+			SeqNum:        1,
+			Operations:    []xdr.Operation{{Body: payment}},
+		},
+	}
+
+	envelopeXDR, err := xdr.MarshalBase64(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return envelopeXDR
+}
+
+func TestSignEnvelope(t *testing.T) {
+	source := randomKeyPair(t)
+
+	envelope, err := xlmtx.DecodeBase64(testEnvelope(t, source))
+	if err != nil {
+		t.Fatal("ER : Decode :", err)
+	}
+
+	hash, err := envelope.Hash(network.TestNetworkPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// sha256(networkID || ENVELOPE_TYPE_TX || tx)
+	txBytes, _ := envelope.Tx.MarshalBinary()
+	networkID := sha256.Sum256([]byte(network.TestNetworkPassphrase))
+	expected := sha256.Sum256(append(append(networkID[:], 0, 0, 0, 2), txBytes...))
+	if hash != expected {
+		t.Error("ER : transaction hash mismatch")
+	}
+
+	signature, err := source.Sign(hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := envelope.AddSignature(source.Address(), signature); err != nil {
+		t.Fatal(err)
+	}
+	// same signature is not appended twice
+	if err := envelope.AddSignature(source.Address(), signature); err != nil {
+		t.Fatal(err)
+	}
+
+	signedXDR, err := envelope.EncodeBase64()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := xlmtx.DecodeBase64(signedXDR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(signed.Signatures) != 1 {
+		t.Fatal("ER : signature count", len(signed.Signatures))
+	}
+
+	decorated := signed.Signatures[0]
+	if [4]byte(decorated.Hint) != source.Hint() {
+		t.Error("ER : signature hint mismatch")
+	}
+	if err := source.Verify(hash[:], decorated.Signature); err != nil {
+		t.Error("ER : signature verification failed", err)
+	}
+
+	// hash differs by network
+	publicHash, _ := signed.Hash(network.PublicNetworkPassphrase)
+	if publicHash == hash {
+		t.Error("ER : network passphrase not applied")
+	}
+}
+
+func TestDestinations(t *testing.T) {
+	envelope, err := xlmtx.DecodeBase64(testEnvelope(t, randomKeyPair(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payment := envelope.Tx.Operations[0].Body.MustPaymentOp()
+
+	destinations, amount := envelope.Destinations()
+	if len(destinations) != 1 || destinations[0] != payment.Destination.Address() {
+		t.Error("ER : destinations", destinations)
+	}
+	if amount == nil || amount.Int64() != 10000000 {
+		t.Error("ER : native amount", amount)
+	}
+
+	// amount of other asset is not known
+	var issuer xdr.AccountId
+	issuer.SetAddress(randomKeyPair(t).Address())
+	payment.Asset.SetCredit("USD", issuer)
+	envelope.Tx.Operations[0].Body.PaymentOp = &payment
+
+	if _, amount := envelope.Destinations(); amount != nil {
+		t.Error("ER : amount of credit asset", amount)
+	}
+}
+
+func TestDestinationsOfSetOptions(t *testing.T) {
+	envelope, err := xlmtx.DecodeBase64(testEnvelope(t, randomKeyPair(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payment := envelope.Tx.Operations[0].Body.MustPaymentOp()
+
+	// new signer takes over source account
+	var signerKey xdr.SignerKey
+	if err := signerKey.SetAddress(randomKeyPair(t).Address()); err != nil {
+		t.Fatal(err)
+	}
+	setOptions, err := xdr.NewOperationBody(xdr.OperationTypeSetOptions, xdr.SetOptionsOp{
+		Signer: &xdr.Signer{Key: signerKey, Weight: 255},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope.Tx.Operations = []xdr.Operation{{Body: setOptions}}
+
+	destinations, amount := envelope.Destinations()
+	if destinations != nil || amount != nil {
+		t.Error("ER : destinations of set options", destinations, amount)
+	}
+
+	// destination allowlist does not allow it
+	rule, err := policy.ParseRule("payout", map[string]interface{}{
+		"operations":   "xlm.envelope",
+		"destinations": payment.Destination.Address(),
+		"decision":     "allow",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := policy.NewEngine([]*policy.Rule{rule}, "")
+
+	request := policy.Request{
+		App:          "exchange",
+		Symbol:       "XLM",
+		Operation:    policy.OpXLMEnvelope,
+		Destinations: destinations,
+		Amount:       amount,
+		Time:         time.Now(),
+	}
+	if result := engine.Evaluate(request); result.Decision == policy.Allow {
+		t.Error("ER : set options allowed by destination rule", result)
+	}
+
+	// set options with payment is not known either
+	envelope.Tx.Operations = append(envelope.Tx.Operations, xdr.Operation{Body: xdr.OperationBody{Type: xdr.OperationTypePayment, PaymentOp: &payment}})
+	if destinations, _ := envelope.Destinations(); destinations != nil {
+		t.Error("ER : destinations of set options and payment", destinations)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	if _, err := xlmtx.DecodeBase64("AAAA"); err == nil {
+		t.Error("ER : invalid envelope accepted")
+	}
+
+	envelope, _ := xlmtx.DecodeBase64(testEnvelope(t, randomKeyPair(t)))
+	if _, err := envelope.Hash(" "); err == nil {
+		t.Error("ER : empty passphrase accepted")
+	}
+	if err := envelope.AddSignature(randomKeyPair(t).Address(), make([]byte, 65)); err == nil {
+		t.Error("ER : 65 byte signature accepted")
+	}
+}